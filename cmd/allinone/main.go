@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/docs"
+	"github.com/ThalysSilva/ingestor-consumo/internal/auth"
+	"github.com/ThalysSilva/ingestor-consumo/internal/bootstrap"
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/config"
+	"github.com/ThalysSilva/ingestor-consumo/internal/health"
+	"github.com/ThalysSilva/ingestor-consumo/internal/history"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulsesender"
+	"github.com/ThalysSilva/ingestor-consumo/internal/quota"
+	"github.com/ThalysSilva/ingestor-consumo/internal/reconcile"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usage"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+func init() {
+	_, filename, _, ok := runtime.Caller(0)
+	if !ok {
+		fmt.Println("falha ao obter o caminho do arquivo atual")
+		os.Exit(1)
+	}
+	projectRoot := filepath.Dir(filepath.Dir(filepath.Dir(filename)))
+	clients.InitLog("log_allinone.log", projectRoot)
+}
+
+// main executa o ingestor e o sender no mesmo processo, compartilhando o store dos agregados (Redis, PostgreSQL ou memória)
+// e um único servidor HTTP na porta do ingestor, com as rotas dos dois componentes
+func main() {
+	cfg, err := config.Load(config.AllInOne, os.Args[1:])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Erro ao carregar a configuração do all-in-one")
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout, config.AllInOne); err != nil {
+			log.Fatal().Err(err).Msg("Erro ao imprimir a configuração")
+		}
+		return
+	}
+	if err := cfg.Validate(config.AllInOne); err != nil {
+		log.Fatal().Err(err).Msg("Configuração inválida do all-in-one")
+	}
+
+	units, err := cfg.UnitRegistry()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Registro de unidades inválido")
+	}
+	pulse.SetUnitRegistry(units)
+	if err := pulse.SetAmountScale(cfg.Amount.Scale); err != nil {
+		log.Fatal().Err(err).Msg("Escala dos valores inválida")
+	}
+	docs.SwaggerInfo.Description = "Unidades aceitas em use_unit: " + strings.Join(bootstrap.UnitNames(units), ", ")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// o Redis só é conectado quando os agregados ou alguma das seções ativas o utilizam
+	var redisClient clients.RedisClient
+	if cfg.UsesRedis(config.AllInOne) {
+		redisClient = clients.InitRedisClient(cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.SentinelAddrs, clients.WithClusterAddrs(cfg.Redis.ClusterAddrs))
+		defer redisClient.Close()
+	}
+	var postgresClient clients.PostgresClient
+	if cfg.Store.Backend == "postgres" {
+		postgresClient = bootstrap.PostgresClient(ctx, cfg.Postgres)
+		defer postgresClient.Close()
+	}
+	storeOpts := []usagestore.RedisOptions{usagestore.WithScanCount(cfg.Sender.ScanCount)}
+	if cfg.Sender.FullScan {
+		log.Warn().Msg("SENDER_FULL_SCAN ativo: as chaves serão percorridas com SCAN em todos os ciclos")
+		storeOpts = append(storeOpts, usagestore.WithFullScan())
+	}
+	if cfg.Ingestor.KeyTTL > 0 {
+		storeOpts = append(storeOpts, usagestore.WithKeyTTL(cfg.Ingestor.KeyTTL))
+	}
+	usageStore := bootstrap.UsageStore(ctx, cfg.Store, redisClient, postgresClient, storeOpts...)
+
+	// Ingestor
+	opts := []pulse.ServiceOptions{pulse.WithChannelSize(cfg.Ingestor.ChannelSize), pulse.WithUsageStore(usageStore)}
+	if cfg.Ingestor.KeepOriginalUnit {
+		log.Warn().Msg("INGESTOR_KEEP_ORIGINAL_UNIT ativo: os pulsos serão agregados na unidade recebida")
+		opts = append(opts, pulse.WithKeepOriginalUnit())
+	}
+	var quotas quota.Tracker
+	var quotaSink quota.Sink
+	if cfg.Quota.Enabled() {
+		quotas, quotaSink = bootstrap.UsageQuotas(ctx, cfg.Quota, redisClient)
+		opts = append(opts, pulse.WithUsageTracker(quotas))
+	}
+	// o ledger é compartilhado pelo ingestor, que registra os totais, e pelo sender, que os concilia
+	var ledger usagestore.Ledger
+	if cfg.Reconcile.Enabled {
+		ledger = bootstrap.Ledger(cfg.Store, redisClient, postgresClient, cfg.Sender.ScanCount)
+		opts = append(opts, pulse.WithLedger(ledger))
+	}
+	pulseService := pulse.NewPulseService(ctx, redisClient, opts...)
+	handlerOpts := bootstrap.CatalogOptions(ctx, cfg.Catalog, redisClient)
+	var usageOpts []usage.HandlerOptions
+	var ingestAuth []gin.HandlerFunc
+	if cfg.Auth.Enabled {
+		ingestAuth = append(ingestAuth, auth.Middleware(bootstrap.Authenticator(ctx, cfg.Auth, redisClient)))
+		handlerOpts = append(handlerOpts, pulse.WithTenantCheck(auth.AllowsTenant), pulse.WithAuthenticatedTenant(auth.NamesTenant))
+		usageOpts = append(usageOpts, usage.WithTenantCheck(auth.AllowsTenant))
+		log.Info().Strs("methods", cfg.Auth.Methods).Msg("Autenticação ativa em /ingest")
+	} else {
+		log.Warn().Msg("AUTH_ENABLED desativado: /ingest aceita pulsos de qualquer origem")
+	}
+	if quotas != nil && cfg.Quota.EnforceHard {
+		handlerOpts = append(handlerOpts, pulse.WithQuotaGuard(quotas))
+	}
+	if cfg.RateLimit.Enabled() {
+		handlerOpts = append(handlerOpts, pulse.WithRateLimiter(bootstrap.RateLimiter(cfg.RateLimit, redisClient)))
+	}
+	pulseHandler := pulse.NewPulseHandler(pulseService, handlerOpts...)
+	go pulseService.Start(cfg.Ingestor.Workers, cfg.Ingestor.GenerationRefresh)
+
+	// Sender: o último ciclo envia os pulsos drenados do ingestor na parada
+	senderOpts := []pulsesender.ServiceOptions{
+		pulsesender.WithMaxWorkers(cfg.Sender.MaxWorkers),
+		pulsesender.WithUsageStore(usageStore),
+		pulsesender.WithFinalCycle(),
+	}
+	if cfg.Sender.DryRun {
+		log.Warn().Msg("SENDER_DRY_RUN ativo: os lotes serão apenas registrados no log")
+		senderOpts = append(senderOpts, pulsesender.WithCustomHTTPClient(clients.NewDryRunHTTPClient()))
+	}
+	var archiver pulsesender.Archiver
+	if cfg.Janitor.Enabled() {
+		var janitor pulsesender.Janitor
+		janitor, archiver = bootstrap.Janitor(cfg.Janitor, usageStore)
+		senderOpts = append(senderOpts, pulsesender.WithJanitor(janitor))
+	}
+	var historyStore history.Store
+	if cfg.History.Enabled() {
+		historyStore, err = history.Open(cfg.History.File, history.WithRetention(cfg.History.Retention()))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Erro ao abrir o histórico de consumo")
+		}
+		senderOpts = append(senderOpts, pulsesender.WithDeliveryRecorder(historyStore))
+		go history.RunPruning(ctx, historyStore, cfg.History.PruneInterval)
+	}
+	var reconciler reconcile.Reconciler
+	if ledger != nil {
+		reconciler = reconcile.NewReconciler(ledger, reconcile.WithHistorySize(cfg.Reconcile.History))
+		senderOpts = append(senderOpts, pulsesender.WithReconciler(reconciler))
+	}
+	// o contexto do sender só é cancelado após a drenagem, para que o último ciclo inclua os pulsos drenados
+	senderCtx, cancelSender := context.WithCancel(context.Background())
+	defer cancelSender()
+	pulseSender := pulsesender.NewPulseSenderService(senderCtx, redisClient, cfg.Sender.APIURL, cfg.Sender.BatchSize, senderOpts...)
+	go pulseSender.StartLoop(cfg.Sender.Interval, cfg.Sender.StabilizationDelay)
+
+	checker := health.NewChecker(string(config.AllInOne))
+	if redisClient != nil {
+		checker.AddCheck("redis", health.RedisCheck(redisClient))
+	}
+	if postgresClient != nil {
+		checker.AddCheck("postgres", health.PostgresCheck(postgresClient))
+	}
+	checker.AddCheck("generation", pulse.GenerationCheck(pulseService))
+	checker.AddCheck("queue", pulse.QueueCheck(pulseService, cfg.Ingestor.QueueHighWater))
+	checker.AddCheck("cycle", pulsesender.CycleCheck(pulseSender, 3*cfg.Sender.Interval))
+
+	r := gin.Default()
+
+	r.POST("/ingest", append(ingestAuth, pulseHandler.Ingestor())...)
+	r.GET("/units", pulseHandler.Units())
+	if cfg.Usage.Enabled {
+		usageHandler := usage.NewUsageHandler(usage.NewReader(usageStore), usageOpts...)
+		r.GET("/usage/:tenant", append(ingestAuth, usageHandler.Tenant())...)
+		r.GET("/usage/:tenant/:sku", append(ingestAuth, usageHandler.Sku())...)
+	}
+	if historyStore != nil {
+		r.GET("/history/:tenant", history.NewHistoryHandler(historyStore).Tenant())
+	}
+	if reconciler != nil {
+		r.GET("/reconciliation", reconcile.NewReconcileHandler(reconciler).Reports())
+	}
+
+	// Verificações de vida e prontidão
+	r.GET("/healthz", checker.Live())
+	r.GET("/readyz", checker.Ready())
+
+	// Métricas do Prometheus
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Swagger
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Ingestor.Port,
+		Handler: r,
+	}
+
+	go func() {
+		log.Info().
+			Str("store", cfg.Store.Backend).
+			Int("batch_size", cfg.Sender.BatchSize).
+			Dur("interval", cfg.Sender.Interval).
+			Bool("dry_run", cfg.Sender.DryRun).
+			Msgf("All-in-one rodando em :%s e métricas em :%s/metrics", cfg.Ingestor.Port, cfg.Ingestor.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Msgf("Erro ao iniciar o servidor: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-stop
+	log.Info().Msg("Recebido sinal de parada, finalizando...")
+
+	// 0. Sinaliza que não está pronto para que o balanceador retire a instância antes de fechar as conexões
+	checker.SetShuttingDown()
+	time.Sleep(cfg.Ingestor.ReadinessDelay)
+
+	// 1. Para de aceitar conexões e aguarda os handlers em andamento
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Ingestor.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Erro ao finalizar o servidor HTTP")
+	}
+
+	// 2. Cancela o contexto da aplicação; os workers continuam drenando o canal para o store
+	cancel()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Ingestor.DrainTimeout)
+	defer cancelDrain()
+	if err := pulseService.Shutdown(drainCtx); err != nil {
+		log.Error().Err(err).Msg("Erro ao drenar os pulsos pendentes")
+	}
+	if quotaSink != nil {
+		quotaSink.Close()
+	}
+
+	// 3. Aguarda o ciclo em andamento e executa o último ciclo de envio com os pulsos drenados
+	stopped := make(chan struct{})
+	go func() {
+		pulseSender.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(cfg.Sender.ShutdownTimeout):
+		log.Error().Dur("timeout", cfg.Sender.ShutdownTimeout).Msg("Tempo esgotado aguardando o ciclo de envio; os agregados não enviados permanecem no store")
+	}
+	cancelSender()
+	if historyStore != nil {
+		if err := historyStore.Close(); err != nil {
+			log.Error().Err(err).Msg("Erro ao fechar o histórico de consumo")
+		}
+	}
+	if archiver != nil {
+		if err := archiver.Close(); err != nil {
+			log.Error().Err(err).Msg("Erro ao fechar o arquivo do janitor")
+		}
+	}
+	log.Info().Msg("All-in-one finalizado")
+}
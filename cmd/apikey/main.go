@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/auth"
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/config"
+)
+
+const usage = `Gerencia as chaves de API aceitas pelo ingestor.
+
+Uso:
+  apikey [flags de configuração] <comando> [opções]
+
+Comandos:
+  issue  -tenants t1,t2 [-name nome]   emite uma chave vinculada aos tenants (use * para todos)
+  rotate -id ID [-grace 24h]           emite uma nova chave com os mesmos tenants e expira a anterior após grace
+  revoke -id ID                        revoga a chave imediatamente
+  list                                 lista as chaves, sem os segredos
+
+As flags de configuração (-config, -redis.*, -auth.*) são as mesmas do ingestor; use -h para listá-las.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "erro:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cfg, err := config.Load(config.APIKey, args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, usage)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cfg.PrintConfig {
+		return cfg.Print(os.Stdout, config.APIKey)
+	}
+	if err := cfg.Validate(config.APIKey); err != nil {
+		return err
+	}
+	if len(cfg.Args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("informe o comando")
+	}
+
+	store := auth.NewFileStore(cfg.Auth.File)
+	if cfg.Auth.Store == "redis" {
+		redisClient := clients.InitRedisClient(cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.SentinelAddrs, clients.WithClusterAddrs(cfg.Redis.ClusterAddrs))
+		defer redisClient.Close()
+		store = auth.NewRedisStore(redisClient, cfg.Auth.RedisPrefix)
+	}
+	manager := auth.NewManager(store)
+	ctx := context.Background()
+
+	command, rest := cfg.Args[0], cfg.Args[1:]
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	switch command {
+	case "issue":
+		tenants := fs.String("tenants", "", "Tenants vinculados à chave, separados por vírgula (* para todos)")
+		name := fs.String("name", "", "Descrição da chave (ex.: nome do cliente ou integração)")
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		raw, key, err := manager.Issue(ctx, *name, splitList(*tenants))
+		if err != nil {
+			return err
+		}
+		printIssued(raw, key)
+	case "rotate":
+		id := fs.String("id", "", "Identificador da chave a ser substituída")
+		grace := fs.Duration("grace", 24*time.Hour, "Tempo em que a chave anterior continua válida (0 revoga imediatamente)")
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		raw, key, err := manager.Rotate(ctx, *id, *grace)
+		if err != nil {
+			return err
+		}
+		printIssued(raw, key)
+		fmt.Printf("a chave %s expira em %s\n", *id, *grace)
+	case "revoke":
+		id := fs.String("id", "", "Identificador da chave a ser revogada")
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if err := manager.Revoke(ctx, *id); err != nil {
+			return err
+		}
+		fmt.Printf("chave %s revogada; os ingestores deixam de aceitá-la em até %s\n", *id, cfg.Auth.CacheTTL)
+	case "list":
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		keys, err := manager.List(ctx)
+		if err != nil {
+			return err
+		}
+		printKeys(keys)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("comando desconhecido: %q", command)
+	}
+	return nil
+}
+
+func printIssued(raw string, key auth.Key) {
+	fmt.Printf("id:      %s\n", key.ID)
+	fmt.Printf("tenants: %s\n", strings.Join(key.Tenants, ","))
+	fmt.Printf("chave:   %s\n", raw)
+	fmt.Println("guarde a chave agora: apenas o seu hash é armazenado")
+}
+
+func printKeys(keys []auth.Key) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNOME\tTENANTS\tCRIADA EM\tEXPIRA EM")
+	for _, key := range keys {
+		expires := "-"
+		if key.ExpiresAt != nil {
+			expires = key.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, strings.Join(key.Tenants, ","), key.CreatedAt.Format(time.RFC3339), expires)
+	}
+	w.Flush()
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
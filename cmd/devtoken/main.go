@@ -0,0 +1,118 @@
+// Comando devtoken emite tokens JWT assinados por uma chave Ed25519 local, para testar a autenticação
+// por JWT do ingestor sem um provedor de identidade. Não deve ser utilizado em produção.
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "erro:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("devtoken", flag.ContinueOnError)
+	keyFile := fs.String("key", "dev-jwt-key.pem", "Chave privada Ed25519 (PEM); é gerada se não existir")
+	jwksFile := fs.String("jwks", "dev-jwks.json", "Arquivo JWKS com a chave pública, para uso em AUTH_JWKS")
+	kid := fs.String("kid", "dev", "Identificador da chave (kid)")
+	tenants := fs.String("tenants", "", "Tenants permitidos ao token, separados por vírgula (* para todos)")
+	claim := fs.String("claim", auth.DefaultTenantClaim, "Claim com os tenants")
+	subject := fs.String("sub", "dev", "Claim sub")
+	issuer := fs.String("iss", "", "Claim iss")
+	audience := fs.String("aud", "", "Claim aud")
+	ttl := fs.Duration("ttl", time.Hour, "Validade do token")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *tenants == "" {
+		return errors.New("informe os tenants com -tenants")
+	}
+
+	key, err := loadOrCreateKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	jwks, err := auth.EncodeJWKS(map[string]crypto.PublicKey{*kid: key.Public()})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*jwksFile, jwks, 0o644); err != nil {
+		return fmt.Errorf("erro ao gravar o JWKS: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":  *subject,
+		"iat":  now.Unix(),
+		"exp":  now.Add(*ttl).Unix(),
+		*claim: strings.Split(*tenants, ","),
+	}
+	if *issuer != "" {
+		claims["iss"] = *issuer
+	}
+	if *audience != "" {
+		claims["aud"] = *audience
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = *kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return fmt.Errorf("erro ao assinar o token: %w", err)
+	}
+	fmt.Println(signed)
+	return nil
+}
+
+// loadOrCreateKey lê a chave privada do arquivo ou gera uma nova, gravada com permissão 0600
+func loadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			return nil, fmt.Errorf("erro ao gravar a chave: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "chave gerada em %s\n", path)
+		return key, nil
+	} else if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s não está no formato PEM", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao interpretar %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s não contém uma chave Ed25519", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/config"
+	"github.com/ThalysSilva/ingestor-consumo/internal/history"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+const usage = `Consulta o histórico do consumo entregue pelo sender.
+
+Uso:
+  history [flags de configuração] <comando> [opções]
+
+Comandos:
+  query -tenant T [-sku S] [-granularity day] [-from 2025-01-01] [-to 2025-02-01] [-url URL] [-json]
+        lista o consumo do tenant por período; com -url consulta o sender em execução (ex.: http://localhost:8081)
+  prune aplica a retenção configurada ao arquivo
+
+Sem -url, o arquivo em -history.file é aberto diretamente e não pode estar em uso pelo sender.
+As flags de configuração (-config, -history.*) são as mesmas do sender; use -h para listá-las.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "erro:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cfg, err := config.Load(config.History, args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, usage)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cfg.PrintConfig {
+		return cfg.Print(os.Stdout, config.History)
+	}
+	if err := cfg.Validate(config.History); err != nil {
+		return err
+	}
+	if len(cfg.Args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("informe o comando")
+	}
+	units, err := cfg.UnitRegistry()
+	if err != nil {
+		return err
+	}
+	pulse.SetUnitRegistry(units)
+
+	command, rest := cfg.Args[0], cfg.Args[1:]
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	switch command {
+	case "query":
+		tenant := fs.String("tenant", "", "Tenant consultado")
+		sku := fs.String("sku", "", "Filtra um SKU")
+		granularity := fs.String("granularity", string(history.DefaultGranularity), "Granularidade: hour, day ou month")
+		from := fs.String("from", "", "Início da consulta (RFC 3339, 2006-01-02T15, 2006-01-02 ou 2006-01); padrão depende da granularidade")
+		to := fs.String("to", "", "Fim (exclusivo) da consulta; padrão é agora")
+		senderURL := fs.String("url", "", "URL do sender em execução; vazio lê o arquivo do histórico")
+		asJSON := fs.Bool("json", false, "Imprime o resultado em JSON")
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		q, err := history.ParseQuery(*tenant, *sku, *granularity, *from, *to, time.Now())
+		if err != nil {
+			return err
+		}
+		var report history.Report
+		if *senderURL != "" {
+			report, err = fetch(*senderURL, q)
+		} else {
+			report, err = read(cfg.History, q)
+		}
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		}
+		printReport(report)
+	case "prune":
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if !cfg.History.Enabled() {
+			return errors.New("arquivo do histórico não informado (HISTORY_FILE)")
+		}
+		store, err := history.Open(cfg.History.File, history.WithRetention(cfg.History.Retention()))
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		removed, err := store.Prune(time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d períodos expirados removidos\n", removed)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("comando desconhecido: %q", command)
+	}
+	return nil
+}
+
+// read consulta o arquivo do histórico em modo somente leitura
+func read(cfg config.HistoryConfig, q history.Query) (history.Report, error) {
+	if !cfg.Enabled() {
+		return history.Report{}, errors.New("arquivo do histórico não informado (HISTORY_FILE); use -url para consultar o sender")
+	}
+	store, err := history.Open(cfg.File, history.WithReadOnly())
+	if err != nil {
+		return history.Report{}, fmt.Errorf("%w; se o sender estiver em execução, use -url", err)
+	}
+	defer store.Close()
+	entries, err := store.Query(context.Background(), q)
+	if err != nil {
+		return history.Report{}, err
+	}
+	return history.Report{TenantId: q.TenantId, Granularity: q.Granularity, From: q.From, To: q.To, Entries: entries}, nil
+}
+
+// fetch consulta GET /history/{tenant} no sender em execução
+func fetch(senderURL string, q history.Query) (history.Report, error) {
+	params := url.Values{}
+	params.Set("granularity", string(q.Granularity))
+	params.Set("from", q.From.Format(time.RFC3339))
+	params.Set("to", q.To.Format(time.RFC3339))
+	if q.ProductSku != "" {
+		params.Set("sku", q.ProductSku)
+	}
+	endpoint := strings.TrimRight(senderURL, "/") + "/history/" + url.PathEscape(q.TenantId) + "?" + params.Encode()
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return history.Report{}, fmt.Errorf("erro ao consultar o sender: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var problem pulse.Problem
+		if err := json.NewDecoder(resp.Body).Decode(&problem); err == nil && problem.Detail != "" {
+			return history.Report{}, fmt.Errorf("sender respondeu %d: %s", resp.StatusCode, problem.Detail)
+		}
+		return history.Report{}, fmt.Errorf("sender respondeu %d", resp.StatusCode)
+	}
+	var report history.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return history.Report{}, fmt.Errorf("resposta inválida do sender: %w", err)
+	}
+	return report, nil
+}
+
+func printReport(report history.Report) {
+	fmt.Printf("tenant %s, por %s, de %s a %s\n", report.TenantId, report.Granularity, report.From.Format(time.RFC3339), report.To.Format(time.RFC3339))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERÍODO\tSKU\tUNIDADE\tTOTAL\tEXIBIÇÃO")
+	for _, e := range report.Entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.2f %s\n", e.PeriodStart.Format(time.RFC3339), e.ProductSku, e.UseUnit, e.UsedAmount, e.DisplayAmount, e.DisplayUnit)
+	}
+	w.Flush()
+}
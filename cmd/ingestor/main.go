@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -11,9 +13,16 @@ import (
 	"syscall"
 	"time"
 
-	_ "github.com/ThalysSilva/ingestor-consumo/docs"
+	"github.com/ThalysSilva/ingestor-consumo/docs"
+	"github.com/ThalysSilva/ingestor-consumo/internal/auth"
+	"github.com/ThalysSilva/ingestor-consumo/internal/bootstrap"
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/config"
+	"github.com/ThalysSilva/ingestor-consumo/internal/health"
 	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/quota"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usage"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
@@ -21,13 +30,6 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-var (
-	API_URL_SENDER = os.Getenv("API_URL_SENDER")
-	INGESTOR_PORT  = os.Getenv("INGESTOR_PORT")
-	REDIS_PORT     = os.Getenv("REDIS_PORT")
-	REDIS_HOST     = os.Getenv("REDIS_HOST")
-)
-
 func init() {
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
@@ -38,25 +40,116 @@ func init() {
 	clients.InitLog("log_ingestor.log", projectRoot)
 }
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description Chave de API emitida pelo comando apikey. Também é aceita no cabeçalho "Authorization: Bearer <chave>", que transporta ainda os tokens JWT quando AUTH_METHODS inclui jwt.
 func main() {
-	ctx := context.Background()
-	sentinelEnv := os.Getenv("REDIS_SENTINEL_ADDRS")
-	sentinelAddrs := strings.Split(sentinelEnv, ",")
+	cfg, err := config.Load(config.Ingestor, os.Args[1:])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Erro ao carregar a configuração do ingestor")
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout, config.Ingestor); err != nil {
+			log.Fatal().Err(err).Msg("Erro ao imprimir a configuração")
+		}
+		return
+	}
+	if err := cfg.Validate(config.Ingestor); err != nil {
+		log.Fatal().Err(err).Msg("Configuração inválida do ingestor")
+	}
+
+	units, err := cfg.UnitRegistry()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Registro de unidades inválido")
+	}
+	pulse.SetUnitRegistry(units)
+	if err := pulse.SetAmountScale(cfg.Amount.Scale); err != nil {
+		log.Fatal().Err(err).Msg("Escala dos valores inválida")
+	}
+	docs.SwaggerInfo.Description = "Unidades aceitas em use_unit: " + strings.Join(bootstrap.UnitNames(units), ", ")
 
-	redisClient := clients.InitRedisClient(REDIS_HOST, REDIS_PORT, sentinelAddrs)
-	defer redisClient.Close()
-	ctx, cancel := context.WithCancel(ctx)
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	// o Redis só é conectado quando os agregados ou alguma das seções ativas o utilizam
+	var redisClient clients.RedisClient
+	if cfg.UsesRedis(config.Ingestor) {
+		redisClient = clients.InitRedisClient(cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.SentinelAddrs, clients.WithClusterAddrs(cfg.Redis.ClusterAddrs))
+		defer redisClient.Close()
+	}
+	var postgresClient clients.PostgresClient
+	if cfg.Store.Backend == "postgres" {
+		postgresClient = bootstrap.PostgresClient(ctx, cfg.Postgres)
+		defer postgresClient.Close()
+	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	pulseService := pulse.NewPulseService(ctx, redisClient)
-	pulseHandler := pulse.NewPulseHandler(pulseService)
-	go pulseService.Start(10, 5*time.Second)
+	// os agregados gravados pelo ingestor são lidos pela consulta de consumo no mesmo store
+	var storeOpts []usagestore.RedisOptions
+	if cfg.Ingestor.KeyTTL > 0 {
+		storeOpts = append(storeOpts, usagestore.WithKeyTTL(cfg.Ingestor.KeyTTL))
+	}
+	usageStore := bootstrap.UsageStore(ctx, cfg.Store, redisClient, postgresClient, storeOpts...)
+	opts := []pulse.ServiceOptions{pulse.WithChannelSize(cfg.Ingestor.ChannelSize), pulse.WithUsageStore(usageStore)}
+	if cfg.Ingestor.KeepOriginalUnit {
+		log.Warn().Msg("INGESTOR_KEEP_ORIGINAL_UNIT ativo: os pulsos serão agregados na unidade recebida")
+		opts = append(opts, pulse.WithKeepOriginalUnit())
+	}
+	var quotas quota.Tracker
+	var quotaSink quota.Sink
+	if cfg.Quota.Enabled() {
+		quotas, quotaSink = bootstrap.UsageQuotas(ctx, cfg.Quota, redisClient)
+		opts = append(opts, pulse.WithUsageTracker(quotas))
+	}
+	if cfg.Reconcile.Enabled {
+		log.Info().Msg("Conciliação ativa: os totais gravados serão registrados para o sender")
+		opts = append(opts, pulse.WithLedger(bootstrap.Ledger(cfg.Store, redisClient, postgresClient, usagestore.DefaultScanCount)))
+	}
+	pulseService := pulse.NewPulseService(ctx, redisClient, opts...)
+	handlerOpts := bootstrap.CatalogOptions(ctx, cfg.Catalog, redisClient)
+	var usageOpts []usage.HandlerOptions
+	var ingestAuth []gin.HandlerFunc
+	if cfg.Auth.Enabled {
+		ingestAuth = append(ingestAuth, auth.Middleware(bootstrap.Authenticator(ctx, cfg.Auth, redisClient)))
+		handlerOpts = append(handlerOpts, pulse.WithTenantCheck(auth.AllowsTenant), pulse.WithAuthenticatedTenant(auth.NamesTenant))
+		usageOpts = append(usageOpts, usage.WithTenantCheck(auth.AllowsTenant))
+		log.Info().Strs("methods", cfg.Auth.Methods).Msg("Autenticação ativa em /ingest")
+	} else {
+		log.Warn().Msg("AUTH_ENABLED desativado: /ingest aceita pulsos de qualquer origem")
+	}
+	if quotas != nil && cfg.Quota.EnforceHard {
+		handlerOpts = append(handlerOpts, pulse.WithQuotaGuard(quotas))
+	}
+	if cfg.RateLimit.Enabled() {
+		handlerOpts = append(handlerOpts, pulse.WithRateLimiter(bootstrap.RateLimiter(cfg.RateLimit, redisClient)))
+	}
+	pulseHandler := pulse.NewPulseHandler(pulseService, handlerOpts...)
+	go pulseService.Start(cfg.Ingestor.Workers, cfg.Ingestor.GenerationRefresh)
+
+	checker := health.NewChecker(string(config.Ingestor))
+	if redisClient != nil {
+		checker.AddCheck("redis", health.RedisCheck(redisClient))
+	}
+	if postgresClient != nil {
+		checker.AddCheck("postgres", health.PostgresCheck(postgresClient))
+	}
+	checker.AddCheck("generation", pulse.GenerationCheck(pulseService))
+	checker.AddCheck("queue", pulse.QueueCheck(pulseService, cfg.Ingestor.QueueHighWater))
 
 	r := gin.Default()
 
-	r.POST("/ingest", pulseHandler.Ingestor())
+	r.POST("/ingest", append(ingestAuth, pulseHandler.Ingestor())...)
+	r.GET("/units", pulseHandler.Units())
+	if cfg.Usage.Enabled {
+		usageHandler := usage.NewUsageHandler(usage.NewReader(usageStore), usageOpts...)
+		r.GET("/usage/:tenant", append(ingestAuth, usageHandler.Tenant())...)
+		r.GET("/usage/:tenant/:sku", append(ingestAuth, usageHandler.Sku())...)
+	}
+
+	// Verificações de vida e prontidão
+	r.GET("/healthz", checker.Live())
+	r.GET("/readyz", checker.Ready())
 
 	// Métricas do Prometheus
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
@@ -64,21 +157,44 @@ func main() {
 	// Swagger
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	go func() {
-		// fmt.Printf("Servidor rodando em :%s e métricas em :%s/metrics\n", INGESTOR_PORT, INGESTOR_PORT)
-		log.Info().Msgf("Servidor rodando em :%s e métricas em :%s/metrics\n", INGESTOR_PORT, INGESTOR_PORT)
-		if err := r.Run(":" + INGESTOR_PORT); err != nil {
+	server := &http.Server{
+		Addr:    ":" + cfg.Ingestor.Port,
+		Handler: r,
+	}
 
+	go func() {
+		log.Info().Msgf("Servidor rodando em :%s e métricas em :%s/metrics\n", cfg.Ingestor.Port, cfg.Ingestor.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Error().Msgf("Erro ao iniciar o servidor: %v\n", err)
 			os.Exit(1)
-			return
 		}
 	}()
 
 	<-stop
-	fmt.Println("Recebido sinal de parada, finalizando...")
-	pulseService.Stop()
-	fmt.Println("Todos os workers pararam.")
+	log.Info().Msg("Recebido sinal de parada, finalizando...")
+
+	// 0. Sinaliza que não está pronto para que o balanceador retire a instância antes de fechar as conexões
+	checker.SetShuttingDown()
+	time.Sleep(cfg.Ingestor.ReadinessDelay)
+
+	// 1. Para de aceitar conexões e aguarda os handlers em andamento
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Ingestor.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Erro ao finalizar o servidor HTTP")
+	}
+
+	// 2. Cancela o contexto da aplicação; os workers continuam drenando o canal para o Redis
 	cancel()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Ingestor.DrainTimeout)
+	defer cancelDrain()
+	if err := pulseService.Shutdown(drainCtx); err != nil {
+		log.Error().Err(err).Msg("Erro ao drenar os pulsos pendentes")
+	}
 
+	// 3. Entrega os eventos de cota gerados pelos pulsos drenados
+	if quotaSink != nil {
+		quotaSink.Close()
+	}
+	log.Info().Msg("Ingestor finalizado")
 }
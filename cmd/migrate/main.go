@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/config"
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+const usage = `Migra os agregados do formato anterior, uma chave por tenant, SKU e unidade,
+para os hashes por geração e tenant utilizados pelo ingestor e pelo sender.
+
+Uso:
+  migrate [flags de configuração] [-dry-run] [-scan-count 100]
+
+Execute no Redis anterior ao cluster, com os senders parados e após atualizar os ingestores.
+A migração pode ser repetida; chaves já migradas não existem mais.
+As flags de configuração (-config, -redis.*) são as mesmas do ingestor; use -h para listá-las.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "erro:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cfg, err := config.Load(config.Migrate, args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, usage)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cfg.PrintConfig {
+		return cfg.Print(os.Stdout, config.Migrate)
+	}
+	if err := cfg.Validate(config.Migrate); err != nil {
+		return err
+	}
+	units, err := cfg.UnitRegistry()
+	if err != nil {
+		return err
+	}
+	pulse.SetUnitRegistry(units)
+
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Apenas contabiliza as chaves que seriam migradas")
+	scanCount := fs.Int64("scan-count", 100, "COUNT utilizado em cada iteração do SCAN")
+	if err := fs.Parse(cfg.Args); err != nil {
+		return err
+	}
+	if *scanCount <= 0 {
+		return fmt.Errorf("scan-count deve ser maior que 0, recebido: %d", *scanCount)
+	}
+
+	redisClient := clients.InitRedisClient(cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.SentinelAddrs)
+	defer redisClient.Close()
+
+	opts := []generation.MigrateOptions{
+		generation.WithMigrateScanCount(*scanCount),
+		generation.WithMaxAggregation(func(unit string) bool {
+			return pulse.PulseUnit(unit).Aggregation() == pulse.AggregationMax
+		}),
+	}
+	if *dryRun {
+		opts = append(opts, generation.WithDryRun())
+	}
+	result, err := generation.MigrateLegacyKeys(context.Background(), redisClient, opts...)
+	if err != nil {
+		return fmt.Errorf("%w (%d chaves migradas antes da falha; a migração pode ser repetida)", err, result.Keys)
+	}
+
+	if *dryRun {
+		fmt.Printf("%d chaves a migrar para %d hashes de tenants, %d índices do formato anterior a apagar, %d chaves ignoradas\n", result.Keys, result.Hashes, result.Indexes, result.Skipped)
+		return nil
+	}
+	fmt.Printf("%d chaves migradas para %d hashes de tenants, %d índices do formato anterior apagados, %d chaves ignoradas\n", result.Keys, result.Hashes, result.Indexes, result.Skipped)
+	return nil
+}
@@ -8,22 +8,12 @@ import (
 	"time"
 
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/config"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
 	"github.com/ThalysSilva/ingestor-consumo/internal/pulseproducer"
 	"github.com/rs/zerolog/log"
 )
 
-var (
-	NGINX_PORT = os.Getenv("NGINX_PORT")
-)
-
-const (
-	minDelay     = 100
-	maxDelay     = 400
-	timeDuration = 100 * time.Second
-	qtyTenants   = 100
-	qtySKUs      = 10
-)
-
 func init() {
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
@@ -35,16 +25,51 @@ func init() {
 }
 
 func main() {
-	NGINXHost := os.Getenv("NGINX_HOST")
-if NGINXHost == "" {
-	NGINXHost = "localhost"
-}
-ingestorURL := fmt.Sprintf("http://%s:%s/ingest", NGINXHost, NGINX_PORT)
-	sender := pulseproducer.NewPulseProducerService(ingestorURL, minDelay, maxDelay, qtyTenants, qtySKUs)
+	cfg, err := config.Load(config.Producer, os.Args[1:])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Erro ao carregar a configuração do producer")
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout, config.Producer); err != nil {
+			log.Fatal().Err(err).Msg("Erro ao imprimir a configuração")
+		}
+		return
+	}
+	if err := cfg.Validate(config.Producer); err != nil {
+		log.Fatal().Err(err).Msg("Configuração inválida do producer")
+	}
+
+	units, err := cfg.UnitRegistry()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Registro de unidades inválido")
+	}
+	pulse.SetUnitRegistry(units)
+	if err := pulse.SetAmountScale(cfg.Amount.Scale); err != nil {
+		log.Fatal().Err(err).Msg("Escala dos valores inválida")
+	}
+
+	producerCfg := cfg.Producer
+	ingestorURL := producerCfg.URL()
+	sender := pulseproducer.NewPulseProducerService(
+		ingestorURL,
+		int(producerCfg.MinDelay/time.Millisecond),
+		int(producerCfg.MaxDelay/time.Millisecond),
+		producerCfg.Tenants,
+		producerCfg.SKUs,
+		producerOptions(producerCfg)...,
+	)
 	log.Info().Msgf("Iniciando o Envio de pulsos para %s", ingestorURL)
 
 	sender.Start()
-	time.Sleep(timeDuration)
+	time.Sleep(producerCfg.Duration)
 	sender.Stop()
 
 }
+
+// producerOptions envia a chave de API configurada, se houver
+func producerOptions(cfg config.ProducerConfig) []pulseproducer.ProducerOptions {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	return []pulseproducer.ProducerOptions{pulseproducer.WithAPIKey(cfg.APIKey)}
+}
@@ -3,29 +3,31 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
-	"strings"
+	"syscall"
 	"time"
 
+	"github.com/ThalysSilva/ingestor-consumo/internal/bootstrap"
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/config"
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/health"
+	"github.com/ThalysSilva/ingestor-consumo/internal/history"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
 	"github.com/ThalysSilva/ingestor-consumo/internal/pulsesender"
+	"github.com/ThalysSilva/ingestor-consumo/internal/reconcile"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 )
 
-var (
-	API_URL_SENDER    = os.Getenv("API_URL_SENDER")
-	REDIS_PORT        = os.Getenv("REDIS_PORT")
-	REDIS_HOST        = os.Getenv("REDIS_HOST")
-	PULSE_SENDER_PORT = os.Getenv("PULSE_SENDER_PORT")
-)
-
 func init() {
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
@@ -33,71 +35,165 @@ func init() {
 		os.Exit(1)
 	}
 	projectRoot := filepath.Dir(filepath.Dir(filepath.Dir(filename)))
-	clients.InitLog("log_pulse_sender.log", projectRoot)
-}
-
-type httpClientMock struct {
-	statusCode int
-	body       io.Reader
-	err        error
+	clients.InitLog("log_sender.log", projectRoot)
 }
 
-// NewHttpClientMock cria um novo mock de cliente HTTP
-// com o statusCode, body e err especificados.
-func NewHttpClientMock(statusCode int, body io.Reader, err error) clients.HTTPClient {
-	return &httpClientMock{
-		statusCode: statusCode,
-		body:       body,
-		err:        err,
+func main() {
+	cfg, err := config.Load(config.Sender, os.Args[1:])
+	if err != nil {
+		log.Fatal().Err(err).Msg("Erro ao carregar a configuração do sender")
 	}
-}
-
-func (h *httpClientMock) Post(url, contentType string, body io.Reader) (*http.Response, error) {
-	if h.err != nil {
-		return nil, h.err
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout, config.Sender); err != nil {
+			log.Fatal().Err(err).Msg("Erro ao imprimir a configuração")
+		}
+		return
+	}
+	if err := cfg.Validate(config.Sender); err != nil {
+		log.Fatal().Err(err).Msg("Configuração inválida do sender")
 	}
-	log.Debug().Msgf("Mocking HTTP POST request to URL: %s", url)
-	log.Debug().Msgf("Content-Type: %s", contentType)
 
-	bodyBytes, err := io.ReadAll(body)
+	units, err := cfg.UnitRegistry()
 	if err != nil {
-		return nil, fmt.Errorf("erro ao ler o body: %w", err)
+		log.Fatal().Err(err).Msg("Registro de unidades inválido")
+	}
+	pulse.SetUnitRegistry(units)
+	if err := pulse.SetAmountScale(cfg.Amount.Scale); err != nil {
+		log.Fatal().Err(err).Msg("Escala dos valores inválida")
 	}
-	bodyString := string(bodyBytes)
-
-	log.Debug().Msgf("Body: %s", bodyString)
 
-	return &http.Response{
-		StatusCode: h.statusCode,
-		Body:       io.NopCloser(h.body),
-	}, nil
-}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-func init() {
-	_, filename, _, ok := runtime.Caller(0)
-	if !ok {
-		fmt.Println("falha ao obter o caminho do arquivo atual")
-		os.Exit(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var redisClient clients.RedisClient
+	if cfg.UsesRedis(config.Sender) {
+		redisClient = clients.InitRedisClient(cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.SentinelAddrs, clients.WithClusterAddrs(cfg.Redis.ClusterAddrs))
+		defer redisClient.Close()
 	}
-	projectRoot := filepath.Dir(filepath.Dir(filepath.Dir(filename)))
-	clients.InitLog("log_sender.log", projectRoot)
-}
+	var postgresClient clients.PostgresClient
+	if cfg.Store.Backend == "postgres" {
+		postgresClient = bootstrap.PostgresClient(ctx, cfg.Postgres)
+		defer postgresClient.Close()
+	}
+	storeOpts := []usagestore.RedisOptions{usagestore.WithScanCount(cfg.Sender.ScanCount)}
+	if cfg.Sender.FullScan {
+		log.Warn().Msg("SENDER_FULL_SCAN ativo: as chaves serão percorridas com SCAN em todos os ciclos")
+		storeOpts = append(storeOpts, usagestore.WithFullScan())
+	}
+	usageStore := bootstrap.UsageStore(ctx, cfg.Store, redisClient, postgresClient, storeOpts...)
 
-func main() {
-	ctx := context.Background()
-	mockHTTPClient := NewHttpClientMock(200, nil, nil)
-	sentinelEnv := os.Getenv("REDIS_SENTINEL_ADDRS")
-	sentinelAddrs := strings.Split(sentinelEnv, ",")
+	opts := []pulsesender.ServiceOptions{
+		pulsesender.WithMaxWorkers(cfg.Sender.MaxWorkers),
+		pulsesender.WithUsageStore(usageStore),
+	}
+	if cfg.Sender.DryRun {
+		log.Warn().Msg("SENDER_DRY_RUN ativo: os lotes serão apenas registrados no log")
+		opts = append(opts, pulsesender.WithCustomHTTPClient(clients.NewDryRunHTTPClient()))
+	}
+	var archiver pulsesender.Archiver
+	if cfg.Janitor.Enabled() {
+		var janitor pulsesender.Janitor
+		janitor, archiver = bootstrap.Janitor(cfg.Janitor, usageStore)
+		opts = append(opts, pulsesender.WithJanitor(janitor))
+	}
+	var historyStore history.Store
+	if cfg.History.Enabled() {
+		historyStore, err = history.Open(cfg.History.File, history.WithRetention(cfg.History.Retention()))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Erro ao abrir o histórico de consumo")
+		}
+		opts = append(opts, pulsesender.WithDeliveryRecorder(historyStore))
+		go history.RunPruning(ctx, historyStore, cfg.History.PruneInterval)
+	}
+	var reconciler reconcile.Reconciler
+	if cfg.Reconcile.Enabled {
+		ledger := bootstrap.Ledger(cfg.Store, redisClient, postgresClient, cfg.Sender.ScanCount)
+		reconciler = reconcile.NewReconciler(ledger, reconcile.WithHistorySize(cfg.Reconcile.History))
+		opts = append(opts, pulsesender.WithReconciler(reconciler))
+		log.Info().Int("history", cfg.Reconcile.History).Msg("Conciliação dos totais gravados e entregues ativa")
+	}
 
-	redisClient := clients.InitRedisClient(REDIS_HOST, REDIS_PORT, sentinelAddrs)
-	defer redisClient.Close()
+	pulseSender := pulsesender.NewPulseSenderService(ctx, redisClient, cfg.Sender.APIURL, cfg.Sender.BatchSize, opts...)
+	go pulseSender.StartLoop(cfg.Sender.Interval, cfg.Sender.StabilizationDelay)
 
-	pulseSender := pulsesender.NewPulseSenderService(ctx, redisClient, API_URL_SENDER, 500, pulsesender.WithCustomHTTPClient(mockHTTPClient))
-	go pulseSender.StartLoop(1*time.Minute, 5*time.Second)
+	// O loop é considerado travado se nenhum ciclo for concluído em três intervalos
+	checker := health.NewChecker(string(config.Sender))
+	if redisClient != nil {
+		checker.AddCheck("redis", health.RedisCheck(redisClient))
+	}
+	if postgresClient != nil {
+		checker.AddCheck("postgres", health.PostgresCheck(postgresClient))
+	}
+	checker.AddCheck("generation", generation.Check(usageStore))
+	checker.AddCheck("cycle", pulsesender.CycleCheck(pulseSender, 3*cfg.Sender.Interval))
 
 	r := gin.Default()
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/healthz", checker.Live())
+	r.GET("/readyz", checker.Ready())
+	if historyStore != nil {
+		r.GET("/history/:tenant", history.NewHistoryHandler(historyStore).Tenant())
+	}
+	if reconciler != nil {
+		r.GET("/reconciliation", reconcile.NewReconcileHandler(reconciler).Reports())
+	}
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Sender.Port,
+		Handler: r,
+	}
 
-	log.Info().Msgf("PulseSender rodando em :%s/metrics", PULSE_SENDER_PORT)
-	r.Run(":" + PULSE_SENDER_PORT)
+	go func() {
+		log.Info().
+			Int("batch_size", cfg.Sender.BatchSize).
+			Dur("interval", cfg.Sender.Interval).
+			Int("max_workers", cfg.Sender.MaxWorkers).
+			Int64("scan_count", cfg.Sender.ScanCount).
+			Bool("dry_run", cfg.Sender.DryRun).
+			Msgf("PulseSender rodando em :%s/metrics", cfg.Sender.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Msgf("Erro ao iniciar o servidor: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-stop
+	log.Info().Msg("Recebido sinal de parada, aguardando o ciclo de envio em andamento...")
+
+	// 1. Impede novos ciclos e aguarda o ciclo em andamento apagar as chaves enviadas;
+	// /readyz responde 503 durante a espera
+	checker.SetShuttingDown()
+	stopped := make(chan struct{})
+	go func() {
+		pulseSender.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(cfg.Sender.ShutdownTimeout):
+		// As chaves não apagadas permanecem na geração enviada. Como o sender alterna entre as gerações A e B,
+		// elas só são reenviadas no próximo ciclo dessa geração, dois intervalos depois
+		log.Error().Dur("timeout", cfg.Sender.ShutdownTimeout).Msg("Tempo esgotado aguardando o ciclo de envio; chaves pendentes serão reenviadas no próximo ciclo da mesma geração, dois intervalos depois")
+	}
+
+	// 2. Encerra o servidor de métricas
+	cancel()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Erro ao finalizar o servidor HTTP")
+	}
+	if historyStore != nil {
+		if err := historyStore.Close(); err != nil {
+			log.Error().Err(err).Msg("Erro ao fechar o histórico de consumo")
+		}
+	}
+	if archiver != nil {
+		if err := archiver.Close(); err != nil {
+			log.Error().Err(err).Msg("Erro ao fechar o arquivo do janitor")
+		}
+	}
+	log.Info().Msg("PulseSender finalizado")
 }
@@ -15,8 +15,33 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/healthz": {
+            "get": {
+                "description": "Responde 200 enquanto o processo estiver em execução",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Saúde"
+                ],
+                "summary": "Verificação de vida",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_health.Report"
+                        }
+                    }
+                }
+            }
+        },
         "/pulse/ingestor": {
             "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
                 "description": "Ingestor de pulsos",
                 "consumes": [
                     "application/json"
@@ -40,14 +65,451 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
+                    "202": {
+                        "description": "Pulso enviado para a quarentena",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "204": {
-                        "description": "No Content"
+                        "description": "No Content",
+                        "headers": {
+                            "X-RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Capacidade do balde do tenant"
+                            },
+                            "X-RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Pulsos que ainda podem ser enviados de imediato"
+                            },
+                            "X-RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Segundos até o balde ficar cheio"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "JSON malformado ou campos inválidos, listados em errors",
+                        "schema": {
+                            "$ref": "#/definitions/internal_pulse.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Chave de API ausente, inválida ou expirada",
+                        "schema": {
+                            "$ref": "#/definitions/internal_pulse.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "A chave de API não permite o tenant_id informado",
+                        "schema": {
+                            "$ref": "#/definitions/internal_pulse.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Pulso viola o catálogo de produtos (code: SKU_UNKNOWN, SKU_INACTIVE, UNIT_NOT_ALLOWED, AMOUNT_OUT_OF_RANGE)",
+                        "schema": {
+                            "$ref": "#/definitions/internal_pulse.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Tenant acima do limite de pulsos por segundo (code: RATE_LIMITED) ou da cota do SKU no período (code: QUOTA_EXCEEDED); reenvie após Retry-After",
+                        "schema": {
+                            "$ref": "#/definitions/internal_pulse.Problem"
+                        },
+                        "headers": {
+                            "X-RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Capacidade do balde do tenant"
+                            },
+                            "X-RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Pulsos que ainda podem ser enviados de imediato"
+                            },
+                            "X-RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Segundos até o balde ficar cheio"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Ingestor finalizando, tente novamente",
+                        "schema": {
+                            "$ref": "#/definitions/internal_pulse.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Executa as verificações do componente (Redis, geração, fila) e falha durante a finalização",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Saúde"
+                ],
+                "summary": "Verificação de prontidão",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_health.Report"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/internal_health.Report"
+                        }
+                    }
+                }
+            }
+        },
+        "/units": {
+            "get": {
+                "description": "Lista as unidades aceitas em use_unit, com dimensão, fator em relação à unidade base e forma de agregação",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Pulso"
+                ],
+                "summary": "Unidades aceitas",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/internal_pulse.UnitDefinition"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/usage/{tenant}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Consumo agregado nas gerações atual e pendente, ainda não entregue pelo sender. Os valores enviados e apagados pelo sender não aparecem.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Consumo"
+                ],
+                "summary": "Consumo do tenant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "tenant_id",
+                        "name": "tenant",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "default": true,
+                        "description": "Converte e soma os valores na unidade base de cada dimensão",
+                        "name": "normalize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_usage.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "tenant_id ou normalize inválido",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Credencial ausente, inválida ou expirada",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "A credencial não permite consultar o tenant",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Redis indisponível",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/usage/{tenant}/{sku}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Consumo agregado do SKU nas gerações atual e pendente, ainda não entregue pelo sender.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Consumo"
+                ],
+                "summary": "Consumo do tenant em um SKU",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "tenant_id",
+                        "name": "tenant",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "product_sku",
+                        "name": "sku",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "default": true,
+                        "description": "Converte e soma os valores na unidade base de cada dimensão",
+                        "name": "normalize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/internal_usage.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "tenant_id, product_sku ou normalize inválido",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Credencial ausente, inválida ou expirada",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "A credencial não permite consultar o tenant",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Redis indisponível",
+                        "schema": {
+                            "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem"
+                        }
                     }
                 }
             }
         }
     },
     "definitions": {
+        "github_com_ThalysSilva_ingestor-consumo_internal_pulse.FieldError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code identifica a regra violada",
+                    "type": "string",
+                    "example": "negative"
+                },
+                "field": {
+                    "description": "Field é o nome do campo no JSON",
+                    "type": "string",
+                    "example": "used_amount"
+                },
+                "message": {
+                    "description": "Message descreve o problema",
+                    "type": "string",
+                    "example": "used_amount não pode ser negativo"
+                }
+            }
+        },
+        "github_com_ThalysSilva_ingestor-consumo_internal_pulse.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code é o código da violação do catálogo de produtos (ex.: SKU_UNKNOWN)",
+                    "type": "string",
+                    "example": "SKU_UNKNOWN"
+                },
+                "detail": {
+                    "description": "Detail descreve esta ocorrência do problema",
+                    "type": "string",
+                    "example": "2 campos inválidos"
+                },
+                "errors": {
+                    "description": "Errors lista os campos inválidos",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/github_com_ThalysSilva_ingestor-consumo_internal_pulse.FieldError"
+                    }
+                },
+                "instance": {
+                    "description": "Instance é o caminho da requisição que originou o problema",
+                    "type": "string",
+                    "example": "/ingest"
+                },
+                "status": {
+                    "description": "Status repete o código HTTP da resposta",
+                    "type": "integer",
+                    "example": 400
+                },
+                "title": {
+                    "description": "Title resume o tipo do problema e não varia entre ocorrências",
+                    "type": "string",
+                    "example": "Pulso inválido"
+                },
+                "type": {
+                    "description": "Type identifica o tipo do problema",
+                    "type": "string",
+                    "example": "/problems/invalid-pulse"
+                }
+            }
+        },
+        "internal_health.CheckResult": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string",
+                    "example": "PONG"
+                },
+                "duration_ms": {
+                    "type": "number",
+                    "example": 0.42
+                },
+                "error": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
+        "internal_health.Report": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/internal_health.CheckResult"
+                    }
+                },
+                "component": {
+                    "type": "string",
+                    "example": "ingestor"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                },
+                "uptime": {
+                    "type": "string",
+                    "example": "1m30s"
+                }
+            }
+        },
+        "internal_pulse.AggregationKind": {
+            "type": "string",
+            "enum": [
+                "sum",
+                "max"
+            ],
+            "x-enum-varnames": [
+                "AggregationSum",
+                "AggregationMax"
+            ]
+        },
+        "internal_pulse.FieldError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code identifica a regra violada",
+                    "type": "string",
+                    "example": "negative"
+                },
+                "field": {
+                    "description": "Field é o nome do campo no JSON",
+                    "type": "string",
+                    "example": "used_amount"
+                },
+                "message": {
+                    "description": "Message descreve o problema",
+                    "type": "string",
+                    "example": "used_amount não pode ser negativo"
+                }
+            }
+        },
+        "internal_pulse.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code é o código da violação do catálogo de produtos (ex.: SKU_UNKNOWN)",
+                    "type": "string",
+                    "example": "SKU_UNKNOWN"
+                },
+                "detail": {
+                    "description": "Detail descreve esta ocorrência do problema",
+                    "type": "string",
+                    "example": "2 campos inválidos"
+                },
+                "errors": {
+                    "description": "Errors lista os campos inválidos",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal_pulse.FieldError"
+                    }
+                },
+                "instance": {
+                    "description": "Instance é o caminho da requisição que originou o problema",
+                    "type": "string",
+                    "example": "/ingest"
+                },
+                "status": {
+                    "description": "Status repete o código HTTP da resposta",
+                    "type": "integer",
+                    "example": 400
+                },
+                "title": {
+                    "description": "Title resume o tipo do problema e não varia entre ocorrências",
+                    "type": "string",
+                    "example": "Pulso inválido"
+                },
+                "type": {
+                    "description": "Type identifica o tipo do problema",
+                    "type": "string",
+                    "example": "/problems/invalid-pulse"
+                }
+            }
+        },
         "internal_pulse.Pulse": {
             "type": "object",
             "required": [
@@ -58,44 +520,124 @@ const docTemplate = `{
             ],
             "properties": {
                 "product_sku": {
-                    "description": "ProductSku é o SKU do produto, geralmente segue o padrão \"SKU-\u003cnumero\u003e\"",
-                    "type": "string"
+                    "description": "ProductSku é o SKU do produto, geralmente segue o padrão \"SKU-\u003cnumero\u003e\". Aceita os mesmos caracteres de TenantId.",
+                    "type": "string",
+                    "maxLength": 64,
+                    "minLength": 1,
+                    "example": "SKU-77"
                 },
                 "tenant_id": {
-                    "type": "string"
+                    "description": "TenantId é o ID do cliente que está utilizando o produto. Aceita letras, números, \"_\", \".\" e \"-\", começando com letra ou número.",
+                    "type": "string",
+                    "maxLength": 128,
+                    "minLength": 1,
+                    "example": "tenant_xpto"
                 },
                 "use_unit": {
-                    "description": "UseUnit é a unidade utilizada para o valor utilizado do produto",
+                    "description": "UseUnit é a unidade utilizada para o valor utilizado do produto, uma das unidades listadas em GET /units",
+                    "type": "string",
+                    "example": "KB"
+                },
+                "used_amount": {
+                    "description": "UsedAmount é o valor utilizado do produto; deve ser maior ou igual a 0, no máximo 1e15 e ter no máximo\n6 casas decimais, ou a escala configurada em amount.scale. Com a escala 6, o maior valor representável,\ntambém depois de convertido para a unidade canônica, é 9223372036854.775807.",
+                    "type": "number",
+                    "maximum": 9223372036854.775,
+                    "minimum": 0,
+                    "example": 3.5
+                }
+            }
+        },
+        "internal_pulse.UnitDefinition": {
+            "type": "object",
+            "properties": {
+                "aggregation": {
+                    "description": "Aggregation é a forma de agregação da dimensão; quando vazio, utiliza sum",
                     "allOf": [
                         {
-                            "$ref": "#/definitions/internal_pulse.PulseUnit"
+                            "$ref": "#/definitions/internal_pulse.AggregationKind"
                         }
-                    ]
+                    ],
+                    "example": "sum"
                 },
-                "used_amount": {
-                    "description": "UsedAmount é o valor utilizado do produto",
-                    "type": "number"
+                "dimension": {
+                    "description": "Dimension agrupa as unidades conversíveis entre si",
+                    "type": "string",
+                    "example": "volume"
+                },
+                "factor": {
+                    "description": "Factor é a quantidade de unidades base em uma unidade. A unidade base da dimensão tem fator 1.",
+                    "type": "number",
+                    "example": 1024
+                },
+                "name": {
+                    "description": "Name é o valor informado em use_unit. Não pode conter \":\", \"*\" nem espaços, pois compõe a chave no Redis.",
+                    "type": "string",
+                    "example": "KB"
                 }
             }
         },
-        "internal_pulse.PulseUnit": {
-            "type": "string",
-            "enum": [
-                "KB",
-                "MB",
-                "GB",
-                "KB/sec",
-                "MB/sec",
-                "GB/sec"
-            ],
-            "x-enum-varnames": [
-                "KB",
-                "MB",
-                "GB",
-                "KBxSec",
-                "MBxSec",
-                "GBxSec"
-            ]
+        "internal_usage.Item": {
+            "type": "object",
+            "properties": {
+                "current": {
+                    "description": "Current é o valor agregado na geração que está recebendo os pulsos",
+                    "type": "number",
+                    "example": 1024
+                },
+                "pending": {
+                    "description": "Pending é o valor agregado na geração que o sender está enviando ou enviará no próximo ciclo",
+                    "type": "number",
+                    "example": 512
+                },
+                "product_sku": {
+                    "type": "string",
+                    "example": "SKU-77"
+                },
+                "total": {
+                    "description": "Total é Current mais Pending, ou o maior dos dois nas unidades com agregação max",
+                    "type": "number",
+                    "example": 1536
+                },
+                "use_unit": {
+                    "type": "string",
+                    "example": "B"
+                }
+            }
+        },
+        "internal_usage.Report": {
+            "type": "object",
+            "properties": {
+                "current_generation": {
+                    "type": "string",
+                    "example": "A"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal_usage.Item"
+                    }
+                },
+                "normalized": {
+                    "description": "Normalized indica que os valores foram convertidos e somados na unidade base de cada dimensão",
+                    "type": "boolean"
+                },
+                "pending_generation": {
+                    "type": "string",
+                    "example": "B"
+                },
+                "tenant_id": {
+                    "type": "string",
+                    "example": "tenant_xpto"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "description": "Chave de API emitida pelo comando apikey. Também é aceita no cabeçalho \"Authorization: Bearer \u003cchave\u003e\", que transporta ainda os tokens JWT quando AUTH_METHODS inclui jwt.",
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
         }
     }
 }`
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// failingStore simula um KeyStore indisponível
+type failingStore struct{ KeyStore }
+
+func (failingStore) Get(ctx context.Context, id string) (Key, error) {
+	return Key{}, errors.New("conexão recusada")
+}
+
+// countingStore conta as consultas feitas ao store
+type countingStore struct {
+	KeyStore
+	gets int
+}
+
+func (s *countingStore) Get(ctx context.Context, id string) (Key, error) {
+	s.gets++
+	return s.KeyStore.Get(ctx, id)
+}
+
+func TestParseKey(t *testing.T) {
+	id, secret, err := parseKey("ik_0123456789abcdef_segredo")
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", id)
+	assert.Equal(t, "segredo", secret)
+
+	_, _, err = parseKey("")
+	assert.ErrorIs(t, err, ErrMissingKey)
+	for _, raw := range []string{"segredo", "ik_0123456789abcdef", "ik_0123_segredo", "ik_0123456789abcdeg_segredo", "ik_0123456789abcdef_"} {
+		_, _, err = parseKey(raw)
+		assert.ErrorIs(t, err, ErrMalformedKey, raw)
+	}
+}
+
+func TestKeyAllowsAndExpired(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := Key{Tenants: []string{"tenant1", "tenant2"}}
+	assert.True(t, key.Allows("tenant2"))
+	assert.False(t, key.Allows("tenant3"))
+	assert.True(t, Key{Tenants: []string{AllTenants}}.Allows("tenant3"))
+
+	assert.False(t, key.Expired(now))
+	expiresAt := now.Add(time.Hour)
+	key.ExpiresAt = &expiresAt
+	assert.False(t, key.Expired(now))
+	assert.True(t, key.Expired(expiresAt))
+}
+
+func testStores(t *testing.T) map[string]KeyStore {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return map[string]KeyStore{
+		"redis": NewRedisStore(client, DefaultRedisPrefix),
+		"file":  NewFileStore(filepath.Join(t.TempDir(), "keys.yaml")),
+	}
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			m := NewManager(store)
+
+			_, _, err := m.Issue(ctx, "sem tenants", nil)
+			assert.Error(t, err)
+			_, _, err = m.Issue(ctx, "tenant inválido", []string{"tenant 1"})
+			assert.ErrorContains(t, err, "tenant inválido")
+
+			raw, key, err := m.Issue(ctx, "cliente", []string{"tenant1"})
+			require.NoError(t, err)
+			assert.Regexp(t, `^ik_[0-9a-f]{16}_[A-Za-z0-9_-]+$`, raw)
+			assert.NotContains(t, key.Hash, raw)
+
+			stored, err := store.Get(ctx, key.ID)
+			require.NoError(t, err)
+			assert.Equal(t, key.Hash, stored.Hash)
+			assert.Equal(t, []string{"tenant1"}, stored.Tenants)
+
+			// rotação com período de transição mantém a chave anterior até expirar
+			_, rotated, err := m.Rotate(ctx, key.ID, time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, "cliente", rotated.Name)
+			assert.Equal(t, []string{"tenant1"}, rotated.Tenants)
+			old, err := store.Get(ctx, key.ID)
+			require.NoError(t, err)
+			require.NotNil(t, old.ExpiresAt)
+
+			keys, err := m.List(ctx)
+			require.NoError(t, err)
+			assert.Len(t, keys, 2)
+
+			// rotação sem período de transição revoga a chave imediatamente
+			_, _, err = m.Rotate(ctx, rotated.ID, 0)
+			require.NoError(t, err)
+			_, err = store.Get(ctx, rotated.ID)
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+
+			require.NoError(t, m.Revoke(ctx, key.ID))
+			assert.ErrorIs(t, m.Revoke(ctx, key.ID), ErrKeyNotFound)
+			_, _, err = m.Rotate(ctx, key.ID, time.Hour)
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+		})
+	}
+}
+
+func TestFileStoreMissingFile(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "keys.yaml"))
+	keys, err := store.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	_, err = store.Get(context.Background(), "0123456789abcdef")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{KeyStore: NewFileStore(filepath.Join(t.TempDir(), "keys.yaml"))}
+	m := NewManager(store)
+	raw, key, err := m.Issue(ctx, "cliente", []string{"tenant1"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	a := NewAuthenticator(store).(*authenticator)
+	a.now = func() time.Time { return now }
+
+	got, err := a.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, got.ID)
+
+	_, err = a.Authenticate(ctx, raw[:len(raw)-1])
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = a.Authenticate(ctx, "ik_0123456789abcdef_segredo")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = a.Authenticate(ctx, "")
+	assert.ErrorIs(t, err, ErrMissingKey)
+
+	// dentro do TTL o registro vem do cache, mesmo após a revogação
+	gets := store.gets
+	require.NoError(t, m.Revoke(ctx, key.ID))
+	_, err = a.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, gets, store.gets)
+
+	now = now.Add(DefaultCacheTTL)
+	_, err = a.Authenticate(ctx, raw)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestAuthenticatorExpiredKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "keys.yaml"))
+	raw, key, err := NewManager(store).Issue(ctx, "cliente", []string{"tenant1"})
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(-time.Minute)
+	key.ExpiresAt = &expiresAt
+	require.NoError(t, store.Put(ctx, key))
+
+	_, err = NewAuthenticator(store, WithCacheTTL(0)).Authenticate(ctx, raw)
+	assert.ErrorIs(t, err, ErrExpiredKey)
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "keys.yaml"))
+	raw, _, err := NewManager(store).Issue(ctx, "cliente", []string{"tenant1"})
+	require.NoError(t, err)
+
+	newRouter := func(store KeyStore) *gin.Engine {
+		r := gin.New()
+		r.POST("/ingest", Middleware(NewAuthenticator(store)), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"tenant1": AllowsTenant(c, "tenant1"),
+				"tenant2": AllowsTenant(c, "tenant2"),
+			})
+		})
+		return r
+	}
+	router := newRouter(store)
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"cabeçalho X-API-Key", HeaderAPIKey, raw, http.StatusOK},
+		{"cabeçalho Authorization", "Authorization", "Bearer " + raw, http.StatusOK},
+		{"sem chave", HeaderAPIKey, "", http.StatusUnauthorized},
+		{"chave malformada", HeaderAPIKey, "abc", http.StatusUnauthorized},
+		{"segredo incorreto", HeaderAPIKey, raw + "x", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/ingest", nil)
+			req.Header.Set(tt.header, tt.value)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.JSONEq(t, `{"tenant1":true,"tenant2":false}`, w.Body.String())
+				return
+			}
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			var problem map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, ProblemTypeUnauthorized, problem["type"])
+		})
+	}
+
+	t.Run("tenant identificado pela chave", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		assert.False(t, NamesTenant(c, "tenant1"))
+		c.Set(contextKey, Key{Tenants: []string{"tenant1"}})
+		assert.True(t, NamesTenant(c, "tenant1"))
+		// a chave de todos os tenants permite o tenant, mas não o identifica
+		c.Set(contextKey, Key{Tenants: []string{AllTenants}})
+		assert.True(t, AllowsTenant(c, "tenant1"))
+		assert.False(t, NamesTenant(c, "tenant1"))
+	})
+
+	t.Run("store indisponível", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/ingest", nil)
+		req.Header.Set(HeaderAPIKey, raw)
+		w := httptest.NewRecorder()
+		newRouter(failingStore{}).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+}
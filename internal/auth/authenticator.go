@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type Authenticator interface {
+	// Authenticate valida a chave informada pelo cliente e retorna o seu registro.
+	// Retorna ErrMissingKey, ErrMalformedKey, ErrUnknownKey ou ErrExpiredKey para chaves recusadas;
+	// qualquer outro erro indica falha ao consultar o KeyStore.
+	Authenticate(ctx context.Context, raw string) (Key, error)
+}
+
+// DefaultCacheTTL é o tempo padrão em que um registro consultado no KeyStore é reutilizado
+const DefaultCacheTTL = 30 * time.Second
+
+type cachedKey struct {
+	key       Key
+	fetchedAt time.Time
+}
+
+type authenticator struct {
+	store    KeyStore
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedKey
+}
+
+type AuthenticatorOptions func(*authenticator)
+
+// WithCacheTTL define por quanto tempo os registros consultados são reutilizados.
+// Uma chave revogada continua aceita por até ttl em cada instância; 0 desativa o cache.
+func WithCacheTTL(ttl time.Duration) AuthenticatorOptions {
+	return func(a *authenticator) {
+		a.cacheTTL = ttl
+	}
+}
+
+// NewAuthenticator cria um autenticador que consulta as chaves no store
+func NewAuthenticator(store KeyStore, opts ...AuthenticatorOptions) Authenticator {
+	a := &authenticator{
+		store:    store,
+		cacheTTL: DefaultCacheTTL,
+		now:      time.Now,
+		cache:    make(map[string]cachedKey),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *authenticator) Authenticate(ctx context.Context, raw string) (Key, error) {
+	id, secret, err := parseKey(raw)
+	if err != nil {
+		return Key{}, err
+	}
+	key, err := a.lookup(ctx, id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return Key{}, ErrUnknownKey
+	} else if err != nil {
+		return Key{}, err
+	}
+	if !key.matches(secret) {
+		return Key{}, ErrUnknownKey
+	}
+	if key.Expired(a.now()) {
+		return Key{}, ErrExpiredKey
+	}
+	return key, nil
+}
+
+// lookup consulta o registro no cache e, se ausente ou vencido, no store.
+// Apenas chaves existentes são guardadas, para que identificadores aleatórios não cresçam o cache.
+func (a *authenticator) lookup(ctx context.Context, id string) (Key, error) {
+	now := a.now()
+	a.mu.Lock()
+	cached, ok := a.cache[id]
+	a.mu.Unlock()
+	if ok && now.Sub(cached.fetchedAt) < a.cacheTTL {
+		return cached.key, nil
+	}
+
+	key, err := a.store.Get(ctx, id)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		delete(a.cache, id)
+		return Key{}, err
+	}
+	if a.cacheTTL > 0 {
+		a.cache[id] = cachedKey{key: key, fetchedAt: now}
+	}
+	return key, nil
+}
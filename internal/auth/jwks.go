@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrUnknownSigningKey indica um token assinado por uma chave ausente do JWKS, mesmo após recarregá-lo
+var ErrUnknownSigningKey = errors.New("chave de assinatura desconhecida")
+
+// DefaultJWKSRefresh é o intervalo padrão de recarga do JWKS
+const DefaultJWKSRefresh = 15 * time.Minute
+
+// DefaultJWKSMinRefresh é o intervalo mínimo entre recargas provocadas por tokens com kid desconhecido
+const DefaultJWKSMinRefresh = 30 * time.Second
+
+// KeySet fornece as chaves públicas que verificam a assinatura dos tokens
+type KeySet interface {
+	// PublicKey retorna a chave do kid informado. Com kid vazio, retorna a única chave do conjunto.
+	PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+type jwks struct {
+	source     string
+	httpClient *http.Client
+	refresh    time.Duration
+	minRefresh time.Duration
+	now        func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+type JWKSOptions func(*jwks)
+
+// WithJWKSRefresh define de quanto em quanto tempo o JWKS é recarregado
+func WithJWKSRefresh(refresh time.Duration) JWKSOptions {
+	return func(j *jwks) {
+		j.refresh = refresh
+	}
+}
+
+// WithJWKSMinRefresh define o intervalo mínimo entre recargas, que limita o efeito de tokens com kid inventado
+func WithJWKSMinRefresh(minRefresh time.Duration) JWKSOptions {
+	return func(j *jwks) {
+		j.minRefresh = minRefresh
+	}
+}
+
+// WithJWKSHTTPClient define o cliente utilizado quando o JWKS é uma URL
+func WithJWKSHTTPClient(client *http.Client) JWKSOptions {
+	return func(j *jwks) {
+		j.httpClient = client
+	}
+}
+
+// NewJWKS carrega o conjunto de chaves de um arquivo ou de uma URL http(s).
+// As chaves são recarregadas a cada refresh e também quando chega um token com kid desconhecido,
+// o que permite rotacionar as chaves do emissor sem reiniciar o ingestor.
+// A carga inicial precisa ser válida; nas recargas, uma falha mantém as chaves anteriores.
+func NewJWKS(ctx context.Context, source string, opts ...JWKSOptions) (KeySet, error) {
+	j := &jwks{
+		source:     source,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		refresh:    DefaultJWKSRefresh,
+		minRefresh: DefaultJWKSMinRefresh,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.load(ctx); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *jwks) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// loadErr guarda a falha da recarga feita nesta consulta, que só é retornada se o kid não for encontrado
+	var loadErr error
+	now := j.now()
+	if now.Sub(j.fetchedAt) >= j.refresh && now.Sub(j.attemptedAt) >= j.minRefresh {
+		if loadErr = j.load(ctx); loadErr != nil {
+			log.Warn().Err(loadErr).Str("jwks", j.source).Msg("Erro ao recarregar o JWKS, mantendo as chaves anteriores")
+		}
+	}
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	if loadErr == nil && now.Sub(j.attemptedAt) >= j.minRefresh {
+		loadErr = j.load(ctx)
+		if key, ok := j.lookup(kid); ok {
+			return key, nil
+		}
+	}
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+func (j *jwks) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// load substitui as chaves pelas do JWKS. Deve ser chamado com mu travado.
+func (j *jwks) load(ctx context.Context) error {
+	j.attemptedAt = j.now()
+	data, err := j.read(ctx)
+	if err != nil {
+		return fmt.Errorf("erro ao ler o JWKS %s: %w", j.source, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("JWKS %s inválido: %w", j.source, err)
+	}
+	j.keys = keys
+	j.fetchedAt = j.attemptedAt
+	return nil
+}
+
+func (j *jwks) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(j.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// jsonWebKey contém os campos de uma JWK (RFC 7517) utilizados na verificação de assinaturas
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// parseJWKS interpreta as chaves RSA, EC e Ed25519 de assinatura. Chaves de outros tipos ou de cifragem são ignoradas.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("chave %d (kid %q): %w", i, jwk.Kid, err)
+		}
+		if _, ok := keys[jwk.Kid]; ok {
+			return nil, fmt.Errorf("kid duplicado: %q", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("nenhuma chave de assinatura suportada")
+	}
+	return keys, nil
+}
+
+var errUnsupportedKey = errors.New("tipo de chave não suportado")
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("expoente inválido")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errUnsupportedKey
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ponto fora da curva")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errUnsupportedKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("tamanho de chave Ed25519 inválido")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errUnsupportedKey
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("valor ausente")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// EncodeJWKS gera o JWKS das chaves públicas, indexadas pelo kid. É utilizado para publicar chaves geradas localmente.
+func EncodeJWKS(keys map[string]crypto.PublicKey) ([]byte, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{Keys: []jsonWebKey{}}
+	for kid, key := range keys {
+		jwk := jsonWebKey{Kid: kid, Use: "sig"}
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (key.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = key.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(key)
+		default:
+			return nil, fmt.Errorf("%w: %T", errUnsupportedKey, key)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, k int) bool { return set.Keys[i].Kid < set.Keys[k].Kid })
+	return json.MarshalIndent(set, "", "  ")
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrMalformedToken indica uma credencial que não está no formato JWT
+	ErrMalformedToken = errors.New("token malformado")
+	// ErrInvalidToken indica um token com assinatura, emissor, audiência ou claims inválidos
+	ErrInvalidToken = errors.New("token inválido")
+	// ErrExpiredToken indica um token fora do seu período de validade
+	ErrExpiredToken = errors.New("token expirado")
+)
+
+// DefaultTenantClaim é a claim padrão com os tenants permitidos ao token
+const DefaultTenantClaim = "tenants"
+
+// DefaultJWTLeeway é a tolerância padrão a diferenças de relógio na verificação de exp, nbf e iat
+const DefaultJWTLeeway = 30 * time.Second
+
+// signingMethods são os algoritmos aceitos. Algoritmos simétricos (HS*) e "none" são recusados,
+// pois a verificação usa apenas chaves públicas.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+type jwtAuthenticator struct {
+	keys        KeySet
+	issuer      string
+	audience    string
+	tenantClaim string
+	leeway      time.Duration
+	now         func() time.Time
+}
+
+type JWTOptions func(*jwtAuthenticator)
+
+// WithIssuer exige que a claim iss do token seja igual a issuer
+func WithIssuer(issuer string) JWTOptions {
+	return func(a *jwtAuthenticator) {
+		a.issuer = issuer
+	}
+}
+
+// WithAudience exige que a claim aud do token contenha audience
+func WithAudience(audience string) JWTOptions {
+	return func(a *jwtAuthenticator) {
+		a.audience = audience
+	}
+}
+
+// WithTenantClaim define a claim com os tenants permitidos, que pode ser uma string ou uma lista de strings
+func WithTenantClaim(claim string) JWTOptions {
+	return func(a *jwtAuthenticator) {
+		a.tenantClaim = claim
+	}
+}
+
+// WithLeeway define a tolerância a diferenças de relógio
+func WithLeeway(leeway time.Duration) JWTOptions {
+	return func(a *jwtAuthenticator) {
+		a.leeway = leeway
+	}
+}
+
+// NewJWTAuthenticator cria um autenticador de tokens JWT assinados por uma das chaves de keys.
+// O token precisa ter exp, e os tenants permitidos são lidos da claim configurada (padrão "tenants").
+// A Key retornada tem como ID a claim jti (ou sub, na ausência de jti) e como nome a claim sub.
+func NewJWTAuthenticator(keys KeySet, opts ...JWTOptions) Authenticator {
+	a := &jwtAuthenticator{
+		keys:        keys,
+		tenantClaim: DefaultTenantClaim,
+		leeway:      DefaultJWTLeeway,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *jwtAuthenticator) Authenticate(ctx context.Context, raw string) (Key, error) {
+	if raw == "" {
+		return Key{}, ErrMissingKey
+	}
+	if strings.Count(raw, ".") != 2 {
+		return Key{}, ErrMalformedToken
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(a.leeway),
+		jwt.WithTimeFunc(a.now),
+	}
+	if a.issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(a.issuer))
+	}
+	if a.audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(a.audience))
+	}
+
+	// keyErr separa as falhas ao consultar o JWKS, que não dependem do token, das recusas do token
+	var keyErr error
+	claims := jwt.MapClaims{}
+	_, err := jwt.NewParser(parserOpts...).ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		var key any
+		key, keyErr = a.keys.PublicKey(ctx, kid)
+		return key, keyErr
+	})
+	switch {
+	case keyErr != nil && !errors.Is(keyErr, ErrUnknownSigningKey):
+		return Key{}, keyErr
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return Key{}, ErrMalformedToken
+	case errors.Is(err, jwt.ErrTokenExpired), errors.Is(err, jwt.ErrTokenNotValidYet):
+		return Key{}, ErrExpiredToken
+	case err != nil:
+		return Key{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	tenants, err := tenantsFromClaim(claims[a.tenantClaim])
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: claim %s: %v", ErrInvalidToken, a.tenantClaim, err)
+	}
+	subject, _ := claims.GetSubject()
+	key := Key{ID: subject, Name: subject, Tenants: tenants}
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		key.ID = jti
+	}
+	if iat, _ := claims.GetIssuedAt(); iat != nil {
+		key.CreatedAt = iat.UTC()
+	}
+	if exp, _ := claims.GetExpirationTime(); exp != nil {
+		expiresAt := exp.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+	return key, nil
+}
+
+// tenantsFromClaim lê os tenants de uma claim em string ou lista de strings
+func tenantsFromClaim(value any) ([]string, error) {
+	var tenants []string
+	switch value := value.(type) {
+	case nil:
+		return nil, errors.New("ausente")
+	case string:
+		tenants = []string{value}
+	case []any:
+		for _, item := range value {
+			tenant, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("valor não textual: %v", item)
+			}
+			tenants = append(tenants, tenant)
+		}
+	default:
+		return nil, fmt.Errorf("tipo não suportado: %T", value)
+	}
+	if len(tenants) == 0 {
+		return nil, errors.New("vazia")
+	}
+	for _, tenant := range tenants {
+		if tenant != AllTenants && !pulse.ValidTenantId(tenant) {
+			return nil, fmt.Errorf("tenant inválido: %q", tenant)
+		}
+	}
+	return tenants, nil
+}
+
+type multiAuthenticator struct {
+	authenticators []Authenticator
+}
+
+// NewMultiAuthenticator aceita credenciais de qualquer um dos autenticadores, consultados na ordem informada.
+// Um autenticador que não reconhece o formato da credencial (ErrMalformedKey ou ErrMalformedToken) passa a vez ao próximo.
+func NewMultiAuthenticator(authenticators ...Authenticator) Authenticator {
+	return &multiAuthenticator{authenticators: authenticators}
+}
+
+func (m *multiAuthenticator) Authenticate(ctx context.Context, raw string) (Key, error) {
+	err := ErrMissingKey
+	for _, authenticator := range m.authenticators {
+		var key Key
+		key, err = authenticator.Authenticate(ctx, raw)
+		if !errors.Is(err, ErrMalformedKey) && !errors.Is(err, ErrMalformedToken) {
+			return key, err
+		}
+	}
+	return Key{}, err
+}
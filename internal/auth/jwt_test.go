@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signer assina tokens com uma chave gerada no teste
+type signer struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+func newSigner(t *testing.T, kid string, method jwt.SigningMethod) signer {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	switch method {
+	case jwt.SigningMethodRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	require.NoError(t, err)
+	return signer{kid: kid, method: method, key: key}
+}
+
+func (s signer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(s.method, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func encodeJWKS(t *testing.T, signers ...signer) []byte {
+	t.Helper()
+	keys := make(map[string]crypto.PublicKey)
+	for _, s := range signers {
+		keys[s.kid] = s.key.Public()
+	}
+	data, err := EncodeJWKS(keys)
+	require.NoError(t, err)
+	return data
+}
+
+func jwksFile(t *testing.T, signers ...signer) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, encodeJWKS(t, signers...), 0o644))
+	return path
+}
+
+func validClaims(tenants any) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub":     "servico-a",
+		"iss":     "https://idp.example.com",
+		"aud":     "ingestor",
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Hour).Unix(),
+		"tenants": tenants,
+	}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	rsaSigner := newSigner(t, "rsa", jwt.SigningMethodRS256)
+	ecSigner := newSigner(t, "ec", jwt.SigningMethodES256)
+	edSigner := newSigner(t, "ed", jwt.SigningMethodEdDSA)
+	keys, err := NewJWKS(ctx, jwksFile(t, rsaSigner, ecSigner, edSigner))
+	require.NoError(t, err)
+	a := NewJWTAuthenticator(keys, WithIssuer("https://idp.example.com"), WithAudience("ingestor"))
+
+	for _, s := range []signer{rsaSigner, ecSigner, edSigner} {
+		t.Run(s.method.Alg(), func(t *testing.T) {
+			key, err := a.Authenticate(ctx, s.sign(t, validClaims([]string{"tenant1", "tenant2"})))
+			require.NoError(t, err)
+			assert.Equal(t, "servico-a", key.ID)
+			assert.Equal(t, []string{"tenant1", "tenant2"}, key.Tenants)
+			assert.True(t, key.Allows("tenant2"))
+			assert.False(t, key.Allows("tenant3"))
+			require.NotNil(t, key.ExpiresAt)
+		})
+	}
+
+	t.Run("TenantClaimAsString", func(t *testing.T) {
+		claims := validClaims("tenant1")
+		claims["jti"] = "token-1"
+		key, err := a.Authenticate(ctx, edSigner.sign(t, claims))
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", key.ID)
+		assert.Equal(t, []string{"tenant1"}, key.Tenants)
+	})
+
+	t.Run("CustomTenantClaim", func(t *testing.T) {
+		claims := validClaims(nil)
+		claims["org_ids"] = []string{"tenant9"}
+		key, err := NewJWTAuthenticator(keys, WithTenantClaim("org_ids")).Authenticate(ctx, edSigner.sign(t, claims))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tenant9"}, key.Tenants)
+	})
+
+	other := newSigner(t, "ed", jwt.SigningMethodEdDSA)
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims("tenant1")).SignedString([]byte("segredo"))
+	require.NoError(t, err)
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims("tenant1")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	refusals := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"Empty", "", ErrMissingKey},
+		{"NotAJWT", "ik_0123456789abcdef_segredo", ErrMalformedToken},
+		{"BadSegments", "a.b.c", ErrMalformedToken},
+		{"Expired", edSigner.sign(t, jwt.MapClaims{"sub": "s", "aud": "ingestor", "iss": "https://idp.example.com", "exp": time.Now().Add(-time.Hour).Unix(), "tenants": "tenant1"}), ErrExpiredToken},
+		{"NotYetValid", edSigner.sign(t, func() jwt.MapClaims {
+			c := validClaims("tenant1")
+			c["nbf"] = time.Now().Add(time.Hour).Unix()
+			return c
+		}()), ErrExpiredToken},
+		{"WithoutExp", edSigner.sign(t, jwt.MapClaims{"sub": "s", "aud": "ingestor", "iss": "https://idp.example.com", "tenants": "tenant1"}), ErrInvalidToken},
+		{"WrongIssuer", edSigner.sign(t, func() jwt.MapClaims { c := validClaims("tenant1"); c["iss"] = "outro"; return c }()), ErrInvalidToken},
+		{"WrongAudience", edSigner.sign(t, func() jwt.MapClaims { c := validClaims("tenant1"); c["aud"] = "outro"; return c }()), ErrInvalidToken},
+		{"WrongKey", other.sign(t, validClaims("tenant1")), ErrInvalidToken},
+		{"HMAC", hmacToken, ErrInvalidToken},
+		{"None", noneToken, ErrInvalidToken},
+		{"WithoutTenants", edSigner.sign(t, validClaims(nil)), ErrInvalidToken},
+		{"InvalidTenant", edSigner.sign(t, validClaims([]string{"tenant 1"})), ErrInvalidToken},
+		{"NonStringTenant", edSigner.sign(t, validClaims([]any{1})), ErrInvalidToken},
+	}
+	for _, tt := range refusals {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Authenticate(ctx, tt.token)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	ctx := context.Background()
+	first := newSigner(t, "k1", jwt.SigningMethodEdDSA)
+	second := newSigner(t, "k2", jwt.SigningMethodEdDSA)
+
+	var published atomic.Value
+	published.Store(encodeJWKS(t, first))
+	var requests, failing atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(published.Load().([]byte))
+	}))
+	defer server.Close()
+
+	keys, err := NewJWKS(ctx, server.URL)
+	require.NoError(t, err)
+	now := time.Now()
+	keys.(*jwks).now = func() time.Time { return now }
+	a := NewJWTAuthenticator(keys)
+
+	_, err = a.Authenticate(ctx, first.sign(t, validClaims("tenant1")))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// o emissor publica a nova chave; o primeiro token com o novo kid provoca a recarga
+	published.Store(encodeJWKS(t, first, second))
+	now = now.Add(DefaultJWKSMinRefresh)
+	_, err = a.Authenticate(ctx, second.sign(t, validClaims("tenant1")))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// kids desconhecidos não provocam novas recargas antes do intervalo mínimo
+	unknown := newSigner(t, "k3", jwt.SigningMethodEdDSA)
+	_, err = a.Authenticate(ctx, unknown.sign(t, validClaims("tenant1")))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// JWKS indisponível: as chaves conhecidas continuam aceitas e um kid desconhecido é uma falha de consulta
+	failing.Store(1)
+	now = now.Add(DefaultJWKSRefresh)
+	_, err = a.Authenticate(ctx, first.sign(t, validClaims("tenant1")))
+	require.NoError(t, err)
+	now = now.Add(DefaultJWKSMinRefresh)
+	_, err = a.Authenticate(ctx, unknown.sign(t, validClaims("tenant1")))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, "error", failureReason(err))
+}
+
+func TestParseJWKS(t *testing.T) {
+	_, err := parseJWKS([]byte(`{"keys":[]}`))
+	assert.ErrorContains(t, err, "nenhuma chave")
+
+	_, err = parseJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	assert.ErrorContains(t, err, "fora da curva")
+
+	// chaves de cifragem e tipos não suportados são ignorados
+	keys, err := parseJWKS([]byte(`{"keys":[
+		{"kty":"oct","kid":"hmac","k":"c2VncmVkbw"},
+		{"kty":"OKP","kid":"enc","use":"enc","crv":"Ed25519","x":"3T18z0NvD2kAInEllROJvr6y9Qm2gC4ASdnjoE0eJuY"},
+		{"kty":"OKP","kid":"sig","crv":"Ed25519","x":"3T18z0NvD2kAInEllROJvr6y9Qm2gC4ASdnjoE0eJuY"}
+	]}`))
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Contains(t, keys, "sig")
+}
+
+func TestMultiAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "keys.yaml"))
+	raw, _, err := NewManager(store).Issue(ctx, "cliente", []string{"tenant1"})
+	require.NoError(t, err)
+	s := newSigner(t, "ed", jwt.SigningMethodEdDSA)
+	keys, err := NewJWKS(ctx, jwksFile(t, s))
+	require.NoError(t, err)
+	a := NewMultiAuthenticator(NewAuthenticator(store), NewJWTAuthenticator(keys))
+
+	key, err := a.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, "cliente", key.Name)
+
+	key, err = a.Authenticate(ctx, s.sign(t, validClaims("tenant2")))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tenant2"}, key.Tenants)
+
+	_, err = a.Authenticate(ctx, "")
+	assert.ErrorIs(t, err, ErrMissingKey)
+	_, err = a.Authenticate(ctx, "qualquer-coisa")
+	assert.ErrorIs(t, err, ErrMalformedToken)
+	_, err = a.Authenticate(ctx, "ik_0123456789abcdef_segredo")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// AllTenants vincula a chave a qualquer tenant. Deve ser reservado a integrações internas, como o pulseProducer.
+const AllTenants = "*"
+
+// keyPrefix identifica as chaves de API emitidas pelo projeto
+const keyPrefix = "ik_"
+
+var (
+	// ErrMissingKey indica que a requisição não informou uma chave
+	ErrMissingKey = errors.New("chave de API não informada")
+	// ErrMalformedKey indica uma chave fora do formato ik_<id>_<segredo>
+	ErrMalformedKey = errors.New("chave de API malformada")
+	// ErrUnknownKey indica uma chave inexistente, revogada ou com segredo incorreto
+	ErrUnknownKey = errors.New("chave de API inválida")
+	// ErrExpiredKey indica uma chave substituída por rotação cujo período de transição terminou
+	ErrExpiredKey = errors.New("chave de API expirada")
+)
+
+// Key é o registro de uma chave de API. O segredo nunca é armazenado, apenas o seu hash SHA-256.
+type Key struct {
+	ID        string     `json:"id" yaml:"id"`
+	Name      string     `json:"name,omitempty" yaml:"name,omitempty"`
+	Hash      string     `json:"hash" yaml:"hash"`
+	Tenants   []string   `json:"tenants" yaml:"tenants"`
+	CreatedAt time.Time  `json:"created_at" yaml:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+}
+
+// Allows indica se a chave pode registrar consumo para o tenant
+func (k Key) Allows(tenantId string) bool {
+	for _, tenant := range k.Tenants {
+		if tenant == AllTenants || tenant == tenantId {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired indica se a chave expirou no instante now
+func (k Key) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// matches compara o segredo com o hash armazenado em tempo constante
+func (k Key) matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.Hash)) == 1
+}
+
+// validateTenants verifica os tenants vinculados a uma nova chave
+func validateTenants(tenants []string) error {
+	if len(tenants) == 0 {
+		return errors.New("informe ao menos um tenant")
+	}
+	for _, tenant := range tenants {
+		if tenant != AllTenants && !pulse.ValidTenantId(tenant) {
+			return fmt.Errorf("tenant inválido: %q", tenant)
+		}
+	}
+	return nil
+}
+
+// newSecretKey gera o identificador e o segredo de uma chave, retornando a chave completa e o registro sem o segredo
+func newSecretKey(name string, tenants []string, now time.Time) (string, Key, error) {
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", Key{}, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", Key{}, err
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+	key := Key{
+		ID:        id,
+		Name:      name,
+		Hash:      hashSecret(secret),
+		Tenants:   append([]string(nil), tenants...),
+		CreatedAt: now.UTC(),
+	}
+	return keyPrefix + id + "_" + secret, key, nil
+}
+
+// parseKey separa o identificador e o segredo de uma chave no formato ik_<id>_<segredo>
+func parseKey(raw string) (id, secret string, err error) {
+	if raw == "" {
+		return "", "", ErrMissingKey
+	}
+	rest, ok := strings.CutPrefix(raw, keyPrefix)
+	if !ok {
+		return "", "", ErrMalformedKey
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || len(id) != 16 || secret == "" {
+		return "", "", ErrMalformedKey
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", "", ErrMalformedKey
+	}
+	return id, secret, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
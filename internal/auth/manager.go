@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Manager interface {
+	// Issue emite uma chave vinculada aos tenants e retorna a chave completa, que só é exibida nesse momento
+	Issue(ctx context.Context, name string, tenants []string) (string, Key, error)
+
+	// Rotate emite uma nova chave com o mesmo nome e tenants da chave id.
+	// A chave anterior continua válida por grace; com grace 0 ela é revogada imediatamente.
+	Rotate(ctx context.Context, id string, grace time.Duration) (string, Key, error)
+
+	// Revoke remove a chave, que deixa de ser aceita assim que expirar o cache dos ingestores
+	Revoke(ctx context.Context, id string) error
+
+	// List retorna os registros das chaves, sem os segredos
+	List(ctx context.Context) ([]Key, error)
+}
+
+type manager struct {
+	store KeyStore
+	now   func() time.Time
+}
+
+// NewManager cria o gerenciador das chaves armazenadas no store
+func NewManager(store KeyStore) Manager {
+	return &manager{store: store, now: time.Now}
+}
+
+func (m *manager) Issue(ctx context.Context, name string, tenants []string) (string, Key, error) {
+	if err := validateTenants(tenants); err != nil {
+		return "", Key{}, err
+	}
+	raw, key, err := newSecretKey(name, tenants, m.now())
+	if err != nil {
+		return "", Key{}, fmt.Errorf("erro ao gerar a chave: %w", err)
+	}
+	if err := m.store.Put(ctx, key); err != nil {
+		return "", Key{}, fmt.Errorf("erro ao gravar a chave: %w", err)
+	}
+	return raw, key, nil
+}
+
+func (m *manager) Rotate(ctx context.Context, id string, grace time.Duration) (string, Key, error) {
+	if grace < 0 {
+		return "", Key{}, fmt.Errorf("período de transição não pode ser negativo: %s", grace)
+	}
+	old, err := m.store.Get(ctx, id)
+	if err != nil {
+		return "", Key{}, err
+	}
+	raw, key, err := m.Issue(ctx, old.Name, old.Tenants)
+	if err != nil {
+		return "", Key{}, err
+	}
+	if grace == 0 {
+		err = m.store.Delete(ctx, id)
+	} else {
+		expiresAt := m.now().Add(grace).UTC()
+		if old.ExpiresAt == nil || expiresAt.Before(*old.ExpiresAt) {
+			old.ExpiresAt = &expiresAt
+		}
+		err = m.store.Put(ctx, old)
+	}
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return raw, key, fmt.Errorf("nova chave %s emitida, mas a chave %s não foi expirada: %w", key.ID, id, err)
+	}
+	return raw, key, nil
+}
+
+func (m *manager) Revoke(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, id)
+}
+
+func (m *manager) List(ctx context.Context) ([]Key, error) {
+	return m.store.List(ctx)
+}
@@ -0,0 +1,23 @@
+package auth
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	metricsRegistered = false
+	authFailures      = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestor_auth_failures_total",
+			Help: "Total de requisições recusadas pela autenticação, por motivo (missing, invalid, expired, error)",
+		},
+		[]string{"reason"},
+	)
+)
+
+func registerMetrics() {
+	if metricsRegistered {
+		return
+	}
+	metricsRegistered = true
+
+	prometheus.MustRegister(authFailures)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// HeaderAPIKey é o cabeçalho que transporta a chave de API. Também é aceito "Authorization: Bearer <chave>",
+// que é o cabeçalho usual dos tokens JWT.
+const HeaderAPIKey = "X-API-Key"
+
+// ProblemTypeUnauthorized é o tipo do problema retornado para credenciais ausentes ou recusadas
+const ProblemTypeUnauthorized = "/problems/unauthorized"
+
+// contextKey guarda a Key autenticada no gin.Context
+const contextKey = "auth.key"
+
+// Middleware exige uma credencial válida (chave de API ou token, conforme o authenticator) e guarda o seu registro
+// no contexto da requisição. Requisições sem credencial ou com credencial recusada recebem 401; falhas ao consultar
+// o KeyStore ou o JWKS recebem 503.
+func Middleware(authenticator Authenticator) gin.HandlerFunc {
+	registerMetrics()
+	return func(c *gin.Context) {
+		key, err := authenticator.Authenticate(c.Request.Context(), keyFromRequest(c.Request))
+		if err == nil {
+			c.Set(contextKey, key)
+			c.Next()
+			return
+		}
+
+		reason := failureReason(err)
+		authFailures.WithLabelValues(reason).Inc()
+		if reason == "error" {
+			log.Error().Err(err).Msg("Erro ao validar a credencial")
+			c.Header("Retry-After", "1")
+			pulse.WriteProblem(c, http.StatusServiceUnavailable, pulse.Problem{
+				Type:   pulse.ProblemTypeUnavailable,
+				Title:  http.StatusText(http.StatusServiceUnavailable),
+				Detail: "não foi possível validar a credencial; tente novamente",
+			})
+			c.Abort()
+			return
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="ingestor"`)
+		pulse.WriteProblem(c, http.StatusUnauthorized, pulse.Problem{
+			Type:   ProblemTypeUnauthorized,
+			Title:  "Não autenticado",
+			Detail: err.Error(),
+		})
+		c.Abort()
+	}
+}
+
+// AllowsTenant indica se a chave autenticada na requisição está vinculada ao tenant.
+// Deve ser utilizado em rotas protegidas por Middleware (veja pulse.WithTenantCheck).
+func AllowsTenant(c *gin.Context, tenantId string) bool {
+	key, ok := KeyFromContext(c)
+	return ok && key.Allows(tenantId)
+}
+
+// NamesTenant indica se a chave autenticada na requisição lista o tenant explicitamente.
+// Ao contrário de AllowsTenant, uma chave de todos os tenants (AllTenants) não identifica o tenant
+// (veja pulse.WithAuthenticatedTenant).
+func NamesTenant(c *gin.Context, tenantId string) bool {
+	key, ok := KeyFromContext(c)
+	return ok && slices.Contains(key.Tenants, tenantId)
+}
+
+// KeyFromContext retorna a chave autenticada na requisição
+func KeyFromContext(c *gin.Context) (Key, bool) {
+	value, ok := c.Get(contextKey)
+	if !ok {
+		return Key{}, false
+	}
+	key, ok := value.(Key)
+	return key, ok
+}
+
+func keyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// failureReason é o label da métrica de falhas de autenticação
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrMissingKey):
+		return "missing"
+	case errors.Is(err, ErrMalformedKey), errors.Is(err, ErrUnknownKey),
+		errors.Is(err, ErrMalformedToken), errors.Is(err, ErrInvalidToken):
+		return "invalid"
+	case errors.Is(err, ErrExpiredKey), errors.Is(err, ErrExpiredToken):
+		return "expired"
+	default:
+		return "error"
+	}
+}
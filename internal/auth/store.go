@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrKeyNotFound é retornado pelo KeyStore quando o identificador não existe
+var ErrKeyNotFound = errors.New("chave de API não encontrada")
+
+// KeyStore armazena os registros das chaves de API
+type KeyStore interface {
+	Get(ctx context.Context, id string) (Key, error)
+	Put(ctx context.Context, key Key) error
+	Delete(ctx context.Context, id string) error
+	// List retorna as chaves ordenadas pela data de criação
+	List(ctx context.Context) ([]Key, error)
+}
+
+// DefaultRedisPrefix é o prefixo padrão das chaves de API no Redis
+const DefaultRedisPrefix = "apikey:"
+
+type redisStore struct {
+	client    clients.RedisClient
+	prefix    string
+	scanCount int64
+}
+
+// NewRedisStore armazena cada chave de API em <prefix><id> como JSON.
+// Chaves com data de expiração recebem o TTL correspondente no Redis.
+func NewRedisStore(client clients.RedisClient, prefix string) KeyStore {
+	return &redisStore{client: client, prefix: prefix, scanCount: 100}
+}
+
+func (r *redisStore) Get(ctx context.Context, id string) (Key, error) {
+	data, err := r.client.Get(ctx, r.prefix+id).Result()
+	if err == redis.Nil {
+		return Key{}, ErrKeyNotFound
+	} else if err != nil {
+		return Key{}, err
+	}
+	var key Key
+	if err := json.Unmarshal([]byte(data), &key); err != nil {
+		return Key{}, fmt.Errorf("registro da chave %s inválido: %w", id, err)
+	}
+	return key, nil
+}
+
+func (r *redisStore) Put(ctx context.Context, key Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if key.ExpiresAt != nil {
+		if ttl = time.Until(*key.ExpiresAt); ttl <= 0 {
+			return r.Delete(ctx, key.ID)
+		}
+	}
+	return r.client.Set(ctx, r.prefix+key.ID, data, ttl).Err()
+}
+
+func (r *redisStore) Delete(ctx context.Context, id string) error {
+	deleted, err := r.client.Del(ctx, r.prefix+id).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (r *redisStore) List(ctx context.Context) ([]Key, error) {
+	var keys []Key
+	var cursor uint64
+	for {
+		redisKeys, next, err := r.client.Scan(ctx, cursor, r.prefix+"*", r.scanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, redisKey := range redisKeys {
+			key, err := r.Get(ctx, strings.TrimPrefix(redisKey, r.prefix))
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+// keyFile é o formato do arquivo de chaves
+type keyFile struct {
+	Keys []Key `json:"keys" yaml:"keys"`
+}
+
+type fileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore armazena as chaves de API em um arquivo YAML ou JSON.
+// O arquivo é lido a cada consulta e reescrito por completo a cada alteração,
+// sendo adequado para poucas chaves e um único processo que as altera (o comando apikey).
+func NewFileStore(path string) KeyStore {
+	return &fileStore{path: path}
+}
+
+func (f *fileStore) Get(ctx context.Context, id string) (Key, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys, err := f.read()
+	if err != nil {
+		return Key{}, err
+	}
+	for _, key := range keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return Key{}, ErrKeyNotFound
+}
+
+func (f *fileStore) Put(ctx context.Context, key Key) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys, err := f.read()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range keys {
+		if keys[i].ID == key.ID {
+			keys[i] = key
+			replaced = true
+		}
+	}
+	if !replaced {
+		keys = append(keys, key)
+	}
+	return f.write(keys)
+}
+
+func (f *fileStore) Delete(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys, err := f.read()
+	if err != nil {
+		return err
+	}
+	for i := range keys {
+		if keys[i].ID == id {
+			return f.write(append(keys[:i], keys[i+1:]...))
+		}
+	}
+	return ErrKeyNotFound
+}
+
+func (f *fileStore) List(ctx context.Context) ([]Key, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+// read carrega as chaves do arquivo; um arquivo inexistente equivale a nenhuma chave
+func (f *fileStore) read() ([]Key, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("erro ao ler o arquivo de chaves: %w", err)
+	}
+	var doc keyFile
+	if f.isJSON() {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao interpretar o arquivo de chaves %s: %w", f.path, err)
+	}
+	return doc.Keys, nil
+}
+
+// write grava o arquivo em um temporário e o renomeia, para que leitores nunca vejam um arquivo parcial
+func (f *fileStore) write(keys []Key) error {
+	var data []byte
+	var err error
+	if f.isJSON() {
+		data, err = json.MarshalIndent(keyFile{Keys: keys}, "", "  ")
+	} else {
+		data, err = yaml.Marshal(keyFile{Keys: keys})
+	}
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("erro ao gravar o arquivo de chaves: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("erro ao gravar o arquivo de chaves: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("erro ao gravar o arquivo de chaves: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return fmt.Errorf("erro ao gravar o arquivo de chaves: %w", err)
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f *fileStore) isJSON() bool {
+	return strings.EqualFold(filepath.Ext(f.path), ".json")
+}
+
+func sortKeys(keys []Key) {
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+}
@@ -0,0 +1,177 @@
+// Package bootstrap monta, a partir da configuração, os componentes compartilhados pelos binários
+// (cmd/ingestor, cmd/sender e cmd/allinone).
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/auth"
+	"github.com/ThalysSilva/ingestor-consumo/internal/catalog"
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/config"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulsesender"
+	"github.com/ThalysSilva/ingestor-consumo/internal/quota"
+	"github.com/ThalysSilva/ingestor-consumo/internal/ratelimit"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/rs/zerolog/log"
+)
+
+// Authenticator combina os autenticadores das credenciais aceitas em AUTH_METHODS, na ordem configurada
+func Authenticator(ctx context.Context, cfg config.AuthConfig, redisClient clients.RedisClient) auth.Authenticator {
+	var authenticators []auth.Authenticator
+	for _, method := range cfg.Methods {
+		switch method {
+		case "apikey":
+			authenticators = append(authenticators, auth.NewAuthenticator(keyStore(cfg, redisClient), auth.WithCacheTTL(cfg.CacheTTL)))
+		case "jwt":
+			keys, err := auth.NewJWKS(ctx, cfg.JWKS, auth.WithJWKSRefresh(cfg.JWKSRefresh))
+			if err != nil {
+				log.Fatal().Err(err).Msg("Erro ao carregar o JWKS")
+			}
+			authenticators = append(authenticators, auth.NewJWTAuthenticator(keys,
+				auth.WithIssuer(cfg.Issuer),
+				auth.WithAudience(cfg.Audience),
+				auth.WithTenantClaim(cfg.TenantClaim),
+				auth.WithLeeway(cfg.Leeway),
+			))
+		}
+	}
+	return auth.NewMultiAuthenticator(authenticators...)
+}
+
+// RateLimiter cria o limitador de taxa por tenant no backend configurado
+func RateLimiter(cfg config.RateLimitConfig, redisClient clients.RedisClient) pulse.RateLimiter {
+	limits, err := cfg.Limits()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Limites de taxa inválidos")
+	}
+	log.Info().Float64("rate", limits.Default.Rate).Int("burst", limits.Default.Burst).Int("overrides", len(limits.Overrides)).
+		Str("backend", cfg.Backend).Msg("Limite de taxa por tenant ativo")
+	if cfg.Backend == "redis" {
+		return ratelimit.NewRedisLimiter(redisClient, cfg.RedisPrefix, limits)
+	}
+	return ratelimit.NewLocalLimiter(limits)
+}
+
+// UsageQuotas carrega as cotas de consumo e cria o tracker e o sink dos eventos, que deve ser fechado na parada.
+// Os bloqueios já registrados no Redis são aplicados antes de a réplica receber pulsos.
+func UsageQuotas(ctx context.Context, cfg config.QuotaConfig, redisClient clients.RedisClient) (quota.Tracker, quota.Sink) {
+	quotas, err := quota.LoadFile(cfg.File)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Erro ao carregar as cotas de consumo")
+	}
+	sink := quota.NewLogSink()
+	if cfg.WebhookURL != "" {
+		sink = quota.NewMultiSink(sink, quota.NewWebhookSink(cfg.WebhookURL, cfg.WebhookTimeout))
+	}
+	tracker := quota.NewTracker(redisClient, quotas,
+		quota.WithRedisPrefix(cfg.RedisPrefix),
+		quota.WithRetention(cfg.Retention),
+		quota.WithSink(sink),
+	)
+	if err := tracker.Sync(ctx); err != nil {
+		log.Warn().Err(err).Msg("Erro ao ler os totais das cotas no Redis; os bloqueios serão aplicados a partir dos próximos pulsos")
+	}
+	log.Info().Int("quotas", tracker.Len()).Str("file", cfg.File).Bool("enforce_hard", cfg.EnforceHard).
+		Bool("webhook", cfg.WebhookURL != "").Msg("Cotas de consumo ativas")
+	return tracker, sink
+}
+
+// keyStore retorna o armazenamento das chaves de API configurado
+func keyStore(cfg config.AuthConfig, redisClient clients.RedisClient) auth.KeyStore {
+	if cfg.Store == "file" {
+		return auth.NewFileStore(cfg.File)
+	}
+	return auth.NewRedisStore(redisClient, cfg.RedisPrefix)
+}
+
+// CatalogOptions carrega o catálogo de produtos, se configurado, e retorna as opções do handler
+// que validam os pulsos contra ele
+func CatalogOptions(ctx context.Context, cfg config.CatalogConfig, redisClient clients.RedisClient) []pulse.HandlerOptions {
+	if !cfg.Enabled() {
+		return nil
+	}
+	source := catalog.NewFileSource(cfg.File)
+	if cfg.Source == "redis" {
+		source = catalog.NewRedisSource(redisClient, cfg.RedisKey)
+	}
+	products, err := catalog.NewCatalog(ctx, source)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Erro ao carregar o catálogo de produtos")
+	}
+	go products.Start(ctx, cfg.Refresh)
+	log.Info().Int("products", products.Len()).Str("source", source.String()).Str("mode", cfg.Mode).Msg("Catálogo de produtos ativo")
+
+	opts := []pulse.HandlerOptions{pulse.WithValidator(products)}
+	if cfg.Mode == "quarantine" {
+		opts = append(opts, pulse.WithQuarantine(catalog.NewRedisQuarantine(redisClient, cfg.QuarantineKey, cfg.QuarantineMaxLen)))
+	}
+	return opts
+}
+
+// UnitNames lista as unidades do registro para a descrição do Swagger
+func UnitNames(units *pulse.UnitRegistry) []string {
+	var names []string
+	for _, def := range units.Definitions() {
+		names = append(names, fmt.Sprintf("%s (%s, fator %g, %s)", def.Name, def.Dimension, def.Factor, def.Aggregation))
+	}
+	return names
+}
+
+// PostgresClient conecta ao PostgreSQL e, com POSTGRES_MIGRATE, aplica as migrações do esquema dos agregados
+func PostgresClient(ctx context.Context, cfg config.PostgresConfig) clients.PostgresClient {
+	client := clients.InitPostgresClient(cfg.URL, clients.WithMaxConns(int32(cfg.MaxConns)))
+	if cfg.Migrate {
+		applied, err := usagestore.MigratePostgres(ctx, client)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Erro ao aplicar as migrações do PostgreSQL")
+		}
+		log.Info().Int("applied", applied).Msg("Esquema dos agregados no PostgreSQL atualizado")
+	}
+	return client
+}
+
+// UsageStore cria o store dos agregados do backend configurado. redisOpts só são aplicadas ao store do Redis.
+func UsageStore(ctx context.Context, cfg config.StoreConfig, redisClient clients.RedisClient, postgresClient clients.PostgresClient, redisOpts ...usagestore.RedisOptions) usagestore.UsageStore {
+	switch cfg.Backend {
+	case "memory":
+		log.Warn().Msg("STORE_BACKEND=memory: os agregados não enviados serão perdidos ao finalizar o processo")
+		return usagestore.NewMemoryStore()
+	case "postgres":
+		return usagestore.NewPostgresStore(ctx, postgresClient)
+	default:
+		return usagestore.NewRedisStore(ctx, redisClient, redisOpts...)
+	}
+}
+
+// Janitor cria o janitor dos agregados reservados com a ação configurada e, com a ação archive,
+// o arquivo dos agregados arquivados, que deve ser fechado na parada (nil nas demais ações)
+func Janitor(cfg config.JanitorConfig, store usagestore.UsageStore) (pulsesender.Janitor, pulsesender.Archiver) {
+	opts := []pulsesender.JanitorOptions{pulsesender.WithJanitorAction(pulsesender.JanitorAction(cfg.Action))}
+	var archiver pulsesender.Archiver
+	if cfg.Action == string(pulsesender.JanitorArchive) {
+		var err error
+		archiver, err = pulsesender.NewFileArchiver(cfg.ArchiveFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Erro ao abrir o arquivo do janitor")
+		}
+		opts = append(opts, pulsesender.WithArchiver(archiver))
+	}
+	log.Info().Str("action", cfg.Action).Dur("threshold", cfg.Threshold).Msg("Janitor dos agregados reservados ativo")
+	return pulsesender.NewJanitor(store, cfg.Threshold, opts...), archiver
+}
+
+// Ledger cria o registro dos totais da conciliação no mesmo backend dos agregados. O ledger em memória
+// só é compartilhado entre o ingestor e o sender do mesmo processo, como o store em memória.
+func Ledger(cfg config.StoreConfig, redisClient clients.RedisClient, postgresClient clients.PostgresClient, scanCount int64) usagestore.Ledger {
+	switch cfg.Backend {
+	case "memory":
+		return usagestore.NewMemoryLedger()
+	case "postgres":
+		return usagestore.NewPostgresLedger(postgresClient)
+	default:
+		return usagestore.NewRedisLedger(redisClient, scanCount)
+	}
+}
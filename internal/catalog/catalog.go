@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/rs/zerolog/log"
+)
+
+type Catalog interface {
+	// Validate verifica o pulso contra o produto do SKU informado.
+	// Retorna *pulse.ValidationError com um dos códigos CodeSkuUnknown, CodeSkuInactive,
+	// CodeUnitNotAllowed ou CodeAmountOutOfRange quando o pulso viola o catálogo.
+	Validate(p pulse.Pulse) error
+
+	// Refresh recarrega os produtos da origem. Se a origem estiver indisponível ou o catálogo for inválido,
+	// os produtos carregados anteriormente continuam em uso e o erro é retornado.
+	Refresh(ctx context.Context) error
+
+	// Start recarrega o catálogo a cada interval até ctx ser cancelado.
+	// O método bloqueia e deve ser executado em uma goroutine.
+	Start(ctx context.Context, interval time.Duration)
+
+	// Len retorna a quantidade de produtos em uso
+	Len() int
+}
+
+type catalog struct {
+	source   Source
+	products atomic.Pointer[map[string]Product]
+}
+
+// NewCatalog cria o catálogo e carrega os produtos da origem.
+// Retorna erro se a carga inicial falhar, pois sem catálogo todos os pulsos seriam rejeitados.
+func NewCatalog(ctx context.Context, source Source) (Catalog, error) {
+	registerMetrics()
+	c := &catalog{source: source}
+	if err := c.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *catalog) Validate(p pulse.Pulse) error {
+	product, ok := (*c.products.Load())[p.ProductSku]
+	if !ok {
+		return &pulse.ValidationError{Code: CodeSkuUnknown, Message: fmt.Sprintf("o produto %s não está no catálogo", p.ProductSku)}
+	}
+	if violation := product.check(p); violation != nil {
+		return violation
+	}
+	return nil
+}
+
+func (c *catalog) Refresh(ctx context.Context) error {
+	products, err := c.source.Load(ctx)
+	if err == nil {
+		err = c.store(products)
+	}
+	if err != nil {
+		catalogRefreshErrors.Inc()
+		return fmt.Errorf("catálogo (%s): %w", c.source, err)
+	}
+	log.Debug().Int("products", c.Len()).Str("source", c.source.String()).Msg("Catálogo de produtos carregado")
+	return nil
+}
+
+// store valida todos os produtos e só então substitui o catálogo em uso
+func (c *catalog) store(products []Product) error {
+	if len(products) == 0 {
+		return errors.New("nenhum produto definido")
+	}
+	bySku := make(map[string]Product, len(products))
+	var errs []error
+	for _, product := range products {
+		if err := product.validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, exists := bySku[product.Sku]; exists {
+			errs = append(errs, fmt.Errorf("produto %q: definido mais de uma vez", product.Sku))
+			continue
+		}
+		bySku[product.Sku] = product
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	c.products.Store(&bySku)
+	catalogProducts.Set(float64(len(bySku)))
+	return nil
+}
+
+func (c *catalog) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil {
+				log.Error().Err(err).Msg("Erro ao recarregar o catálogo de produtos; mantendo a versão anterior")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *catalog) Len() int {
+	products := c.products.Load()
+	if products == nil {
+		return 0
+	}
+	return len(*products)
+}
@@ -0,0 +1,226 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+type staticSource struct {
+	products []Product
+	err      error
+}
+
+func (s *staticSource) Load(ctx context.Context) ([]Product, error) { return s.products, s.err }
+func (s *staticSource) String() string                              { return "static" }
+
+func amount(v float64) *float64 { return &v }
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestCatalogValidate(t *testing.T) {
+	c, err := NewCatalog(context.Background(), &staticSource{products: []Product{
+		{Sku: "SKU-1", AllowedUnits: []pulse.PulseUnit{pulse.KB, pulse.MB}, MinAmount: amount(1), MaxAmount: amount(10 << 20)},
+		{Sku: "SKU-2", AllowedUnits: []pulse.PulseUnit{pulse.GB}, Status: Inactive},
+		{Sku: "SKU-3", AllowedUnits: []pulse.PulseUnit{pulse.BxSec}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.Len())
+
+	tests := []struct {
+		name  string
+		pulse pulse.Pulse
+		code  string
+	}{
+		{name: "Valid", pulse: pulse.Pulse{ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("5"), UseUnit: pulse.MB}},
+		{name: "ValidWithoutBounds", pulse: pulse.Pulse{ProductSku: "SKU-3", UsedAmount: pulse.MustParseAmount("1e12"), UseUnit: pulse.BxSec}},
+		{name: "UnknownSku", pulse: pulse.Pulse{ProductSku: "SKU-9", UsedAmount: pulse.MustParseAmount("5"), UseUnit: pulse.KB}, code: CodeSkuUnknown},
+		{name: "InactiveSku", pulse: pulse.Pulse{ProductSku: "SKU-2", UsedAmount: pulse.MustParseAmount("5"), UseUnit: pulse.GB}, code: CodeSkuInactive},
+		{name: "UnitNotAllowed", pulse: pulse.Pulse{ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("5"), UseUnit: pulse.GB}, code: CodeUnitNotAllowed},
+		// Os limites são comparados na unidade base: 11 MB ultrapassa o máximo de 10 MB
+		{name: "AboveMax", pulse: pulse.Pulse{ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("11"), UseUnit: pulse.MB}, code: CodeAmountOutOfRange},
+		{name: "BelowMin", pulse: pulse.Pulse{ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("0"), UseUnit: pulse.KB}, code: CodeAmountOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Validate(tt.pulse)
+			if tt.code == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var violation *pulse.ValidationError
+			require.True(t, errors.As(err, &violation), err)
+			assert.Equal(t, tt.code, violation.Code)
+		})
+	}
+}
+
+func TestCatalogRefresh(t *testing.T) {
+	source := &staticSource{products: []Product{{Sku: "SKU-1", AllowedUnits: []pulse.PulseUnit{pulse.KB}}}}
+	c, err := NewCatalog(context.Background(), source)
+	require.NoError(t, err)
+
+	t.Run("InvalidCatalogKeepsPrevious", func(t *testing.T) {
+		source.products = []Product{
+			{Sku: "SKU-2", AllowedUnits: []pulse.PulseUnit{"TB"}},
+			{Sku: "SKU-3", AllowedUnits: []pulse.PulseUnit{pulse.KB, pulse.KBxSec}},
+			{Sku: "SKU-4", AllowedUnits: []pulse.PulseUnit{pulse.KB}, MinAmount: amount(10), MaxAmount: amount(1)},
+			{Sku: "SKU-5", AllowedUnits: []pulse.PulseUnit{pulse.KB}, Status: "paused"},
+		}
+		err := c.Refresh(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unidade não registrada")
+		assert.Contains(t, err.Error(), "mesma dimensão")
+		assert.Contains(t, err.Error(), "min_amount")
+		assert.Contains(t, err.Error(), "status inválido")
+		assert.NoError(t, c.Validate(pulse.Pulse{ProductSku: "SKU-1", UseUnit: pulse.KB}))
+	})
+
+	t.Run("SourceErrorKeepsPrevious", func(t *testing.T) {
+		source.err = errors.New("indisponível")
+		assert.ErrorContains(t, c.Refresh(context.Background()), "indisponível")
+		assert.Equal(t, 1, c.Len())
+		source.err = nil
+	})
+
+	t.Run("ReplacesProducts", func(t *testing.T) {
+		source.products = []Product{{Sku: "SKU-2", AllowedUnits: []pulse.PulseUnit{pulse.MB}}}
+		require.NoError(t, c.Refresh(context.Background()))
+		assert.NoError(t, c.Validate(pulse.Pulse{ProductSku: "SKU-2", UseUnit: pulse.MB}))
+		assert.Error(t, c.Validate(pulse.Pulse{ProductSku: "SKU-1", UseUnit: pulse.KB}))
+	})
+
+	t.Run("DuplicatedSku", func(t *testing.T) {
+		source.products = []Product{
+			{Sku: "SKU-1", AllowedUnits: []pulse.PulseUnit{pulse.KB}},
+			{Sku: "SKU-1", AllowedUnits: []pulse.PulseUnit{pulse.MB}},
+		}
+		assert.ErrorContains(t, c.Refresh(context.Background()), "mais de uma vez")
+	})
+
+	t.Run("StartReloadsUntilCanceled", func(t *testing.T) {
+		source.products = []Product{{Sku: "SKU-7", AllowedUnits: []pulse.PulseUnit{pulse.GB}}}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			c.Start(ctx, 10*time.Millisecond)
+			close(done)
+		}()
+		assert.Eventually(t, func() bool {
+			return c.Validate(pulse.Pulse{ProductSku: "SKU-7", UseUnit: pulse.GB}) == nil
+		}, time.Second, 10*time.Millisecond)
+		cancel()
+		<-done
+	})
+}
+
+func TestNewCatalogFailsWithoutProducts(t *testing.T) {
+	_, err := NewCatalog(context.Background(), &staticSource{})
+	assert.ErrorContains(t, err, "nenhum produto")
+}
+
+func TestFileSource(t *testing.T) {
+	files := map[string]string{
+		"catalog.yaml": `
+products:
+  - sku: SKU-1
+    allowed_units: [KB, MB]
+    max_amount: 1048576
+  - sku: SKU-2
+    allowed_units: [GB]
+    status: inactive
+`,
+		"catalog.toml": `
+[[products]]
+sku = "SKU-1"
+allowed_units = ["KB", "MB"]
+max_amount = 1048576.0
+
+[[products]]
+sku = "SKU-2"
+allowed_units = ["GB"]
+status = "inactive"
+`,
+		"catalog.json": `{"products":[{"sku":"SKU-1","allowed_units":["KB","MB"],"max_amount":1048576},{"sku":"SKU-2","allowed_units":["GB"],"status":"inactive"}]}`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			products, err := NewFileSource(writeFile(t, name, content)).Load(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, []Product{
+				{Sku: "SKU-1", AllowedUnits: []pulse.PulseUnit{pulse.KB, pulse.MB}, MaxAmount: amount(1048576)},
+				{Sku: "SKU-2", AllowedUnits: []pulse.PulseUnit{pulse.GB}, Status: Inactive},
+			}, products)
+		})
+	}
+
+	t.Run("UnsupportedFormat", func(t *testing.T) {
+		_, err := NewFileSource(writeFile(t, "catalog.csv", "")).Load(context.Background())
+		assert.ErrorContains(t, err, "não suportado")
+	})
+}
+
+func TestRedisSource(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	source := NewRedisSource(client, "catalog:products")
+
+	_, err := source.Load(context.Background())
+	assert.ErrorContains(t, err, "não encontrado")
+
+	require.NoError(t, mr.Set("catalog:products", `{"products":[{"sku":"SKU-1","allowed_units":["KB"]}]}`))
+	products, err := source.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Product{{Sku: "SKU-1", AllowedUnits: []pulse.PulseUnit{pulse.KB}}}, products)
+
+	require.NoError(t, mr.Set("catalog:products", `[`))
+	_, err = source.Load(context.Background())
+	assert.ErrorContains(t, err, "interpretar")
+}
+
+func TestRedisQuarantine(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	q := NewRedisQuarantine(client, "quarantine:pulses", 2).(*redisQuarantine)
+	q.now = func() time.Time { return time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC) }
+
+	reason := &pulse.ValidationError{Code: CodeSkuUnknown, Message: "o produto SKU-9 não está no catálogo"}
+	for _, tenant := range []string{"tenant1", "tenant2", "tenant3"} {
+		p := pulse.Pulse{TenantId: tenant, ProductSku: "SKU-9", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.KB}
+		require.NoError(t, q.Quarantine(context.Background(), p, reason))
+	}
+
+	// Apenas os registros mais recentes são mantidos
+	entries, err := mr.List("quarantine:pulses")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	var last QuarantinedPulse
+	require.NoError(t, json.Unmarshal([]byte(entries[1]), &last))
+	assert.Equal(t, "tenant3", last.TenantId)
+	assert.Equal(t, CodeSkuUnknown, last.Code)
+	assert.Equal(t, reason.Message, last.Reason)
+	assert.Equal(t, q.now(), last.ReceivedAt)
+}
@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// Códigos das violações do catálogo, informados ao cliente e utilizados como label nas métricas
+const (
+	CodeSkuUnknown       = "SKU_UNKNOWN"
+	CodeSkuInactive      = "SKU_INACTIVE"
+	CodeUnitNotAllowed   = "UNIT_NOT_ALLOWED"
+	CodeAmountOutOfRange = "AMOUNT_OUT_OF_RANGE"
+)
+
+// Status indica se o produto aceita pulsos
+type Status string
+
+const (
+	Active   Status = "active"
+	Inactive Status = "inactive"
+)
+
+// Product descreve as regras de um SKU
+type Product struct {
+	// Sku é o valor informado em product_sku
+	Sku string `yaml:"sku" toml:"sku" json:"sku"`
+	// AllowedUnits são as unidades aceitas para o SKU. Todas devem ser da mesma dimensão.
+	AllowedUnits []pulse.PulseUnit `yaml:"allowed_units" toml:"allowed_units" json:"allowed_units"`
+	// MinAmount e MaxAmount limitam used_amount, expressos na unidade base da dimensão (ex.: B).
+	// Quando ausentes, o limite correspondente não é verificado.
+	MinAmount *float64 `yaml:"min_amount" toml:"min_amount" json:"min_amount,omitempty"`
+	MaxAmount *float64 `yaml:"max_amount" toml:"max_amount" json:"max_amount,omitempty"`
+	// Status do produto; quando vazio, o produto é considerado ativo
+	Status Status `yaml:"status" toml:"status" json:"status,omitempty"`
+}
+
+// document é o formato do catálogo no arquivo e no Redis
+type document struct {
+	Products []Product `yaml:"products" toml:"products" json:"products"`
+}
+
+// validate verifica o produto contra o registro de unidades em uso
+func (p Product) validate() error {
+	if p.Sku == "" {
+		return errors.New("sku não informado")
+	}
+	if p.Status != "" && p.Status != Active && p.Status != Inactive {
+		return fmt.Errorf("produto %q: status inválido %q (use active ou inactive)", p.Sku, p.Status)
+	}
+	if len(p.AllowedUnits) == 0 {
+		return fmt.Errorf("produto %q: nenhuma unidade permitida", p.Sku)
+	}
+	var dimension pulse.Dimension
+	for _, unit := range p.AllowedUnits {
+		if !unit.IsValid() {
+			return fmt.Errorf("produto %q: unidade não registrada %q", p.Sku, unit)
+		}
+		if dimension == "" {
+			dimension = unit.Dimension()
+		} else if unit.Dimension() != dimension {
+			return fmt.Errorf("produto %q: as unidades permitidas devem ser da mesma dimensão (%s e %s)", p.Sku, dimension, unit.Dimension())
+		}
+	}
+	for _, bound := range []*float64{p.MinAmount, p.MaxAmount} {
+		if bound != nil && (math.IsNaN(*bound) || math.IsInf(*bound, 0)) {
+			return fmt.Errorf("produto %q: limite de used_amount inválido: %g", p.Sku, *bound)
+		}
+	}
+	if p.MinAmount != nil && p.MaxAmount != nil && *p.MinAmount > *p.MaxAmount {
+		return fmt.Errorf("produto %q: min_amount (%g) maior que max_amount (%g)", p.Sku, *p.MinAmount, *p.MaxAmount)
+	}
+	return nil
+}
+
+// check verifica o pulso contra as regras do produto
+func (p Product) check(pl pulse.Pulse) *pulse.ValidationError {
+	if p.Status == Inactive {
+		return &pulse.ValidationError{Code: CodeSkuInactive, Message: fmt.Sprintf("o produto %s está inativo", p.Sku)}
+	}
+	allowed := false
+	for _, unit := range p.AllowedUnits {
+		if unit == pl.UseUnit {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return &pulse.ValidationError{
+			Code:    CodeUnitNotAllowed,
+			Message: fmt.Sprintf("a unidade %s não é permitida para o produto %s (permitidas: %v)", pl.UseUnit, p.Sku, p.AllowedUnits),
+		}
+	}
+	if p.MinAmount == nil && p.MaxAmount == nil {
+		return nil
+	}
+	normalized, err := pl.Normalize()
+	if err != nil {
+		return &pulse.ValidationError{Code: CodeUnitNotAllowed, Message: err.Error()}
+	}
+	amount := normalized.UsedAmount.Float64()
+	if (p.MinAmount != nil && amount < *p.MinAmount) || (p.MaxAmount != nil && amount > *p.MaxAmount) {
+		return &pulse.ValidationError{
+			Code:    CodeAmountOutOfRange,
+			Message: fmt.Sprintf("used_amount %s %s fora do intervalo permitido para o produto %s (%s)", normalized.UsedAmount, normalized.UseUnit, p.Sku, p.describeRange(normalized.UseUnit)),
+		}
+	}
+	return nil
+}
+
+func (p Product) describeRange(unit pulse.PulseUnit) string {
+	switch {
+	case p.MinAmount != nil && p.MaxAmount != nil:
+		return fmt.Sprintf("%g a %g %s", *p.MinAmount, *p.MaxAmount, unit)
+	case p.MinAmount != nil:
+		return fmt.Sprintf("mínimo %g %s", *p.MinAmount, unit)
+	default:
+		return fmt.Sprintf("máximo %g %s", *p.MaxAmount, unit)
+	}
+}
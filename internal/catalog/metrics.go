@@ -0,0 +1,31 @@
+package catalog
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	metricsRegistered = false
+	catalogProducts   = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "catalog_products",
+			Help: "Quantidade de produtos no catálogo em uso",
+		},
+	)
+	catalogRefreshErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "catalog_refresh_errors_total",
+			Help: "Total de falhas ao carregar o catálogo de produtos",
+		},
+	)
+)
+
+func registerMetrics() {
+	if metricsRegistered {
+		return
+	}
+	metricsRegistered = true
+
+	prometheus.MustRegister(
+		catalogProducts,
+		catalogRefreshErrors,
+	)
+}
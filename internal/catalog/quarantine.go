@@ -0,0 +1,46 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// QuarantinedPulse é o registro guardado na quarentena
+type QuarantinedPulse struct {
+	pulse.Pulse
+	Code       string    `json:"code"`
+	Reason     string    `json:"reason"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// pushScript adiciona ARGV[1] ao fim da lista KEYS[1] e mantém apenas os ARGV[2] registros mais recentes
+const pushScript = `
+redis.call('RPUSH', KEYS[1], ARGV[1])
+redis.call('LTRIM', KEYS[1], -tonumber(ARGV[2]), -1)
+return redis.call('LLEN', KEYS[1])
+`
+
+type redisQuarantine struct {
+	client clients.RedisClient
+	key    string
+	maxLen int
+	now    func() time.Time
+}
+
+// NewRedisQuarantine guarda os pulsos em quarentena na lista key do Redis,
+// descartando os mais antigos quando a lista ultrapassa maxLen registros
+func NewRedisQuarantine(client clients.RedisClient, key string, maxLen int) pulse.Quarantine {
+	return &redisQuarantine{client: client, key: key, maxLen: maxLen, now: time.Now}
+}
+
+func (q *redisQuarantine) Quarantine(ctx context.Context, p pulse.Pulse, reason *pulse.ValidationError) error {
+	data, err := json.Marshal(QuarantinedPulse{Pulse: p, Code: reason.Code, Reason: reason.Message, ReceivedAt: q.now().UTC()})
+	if err != nil {
+		return err
+	}
+	return q.client.Eval(ctx, pushScript, []string{q.key}, string(data), q.maxLen).Err()
+}
@@ -0,0 +1,85 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/yaml.v3"
+)
+
+// Source carrega a lista de produtos do catálogo
+type Source interface {
+	Load(ctx context.Context) ([]Product, error)
+	// String descreve a origem nos logs
+	String() string
+}
+
+type fileSource struct {
+	path string
+}
+
+// NewFileSource lê o catálogo de um arquivo YAML, TOML ou JSON com a lista products
+func NewFileSource(path string) Source {
+	return &fileSource{path: path}
+}
+
+func (f *fileSource) Load(ctx context.Context) ([]Product, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o catálogo: %w", err)
+	}
+	var doc document
+	switch strings.ToLower(filepath.Ext(f.path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("formato de catálogo não suportado: %s (use .yaml, .yml, .toml ou .json)", f.path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao interpretar o catálogo %s: %w", f.path, err)
+	}
+	return doc.Products, nil
+}
+
+func (f *fileSource) String() string {
+	return "arquivo " + f.path
+}
+
+type redisSource struct {
+	client clients.RedisClient
+	key    string
+}
+
+// NewRedisSource lê o catálogo de uma chave do Redis contendo o JSON {"products": [...]}
+func NewRedisSource(client clients.RedisClient, key string) Source {
+	return &redisSource{client: client, key: key}
+}
+
+func (r *redisSource) Load(ctx context.Context) ([]Product, error) {
+	data, err := r.client.Get(ctx, r.key).Result()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("catálogo não encontrado na chave %s", r.key)
+	} else if err != nil {
+		return nil, fmt.Errorf("erro ao ler o catálogo do Redis: %w", err)
+	}
+	var doc document
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("erro ao interpretar o catálogo da chave %s: %w", r.key, err)
+	}
+	return doc.Products, nil
+}
+
+func (r *redisSource) String() string {
+	return "redis " + r.key
+}
@@ -1,11 +1,65 @@
 package clients
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/rs/zerolog/log"
 )
 
 type HTTPClient interface {
 	// Método para realizar una requisição HTTP Post
 	Post(url, contentType string, body io.Reader) (*http.Response, error)
 }
+
+type headerHTTPClient struct {
+	client *http.Client
+	header http.Header
+}
+
+// NewHeaderHTTPClient cria um cliente HTTP que inclui os cabeçalhos informados em todas as requisições
+// (ex.: a chave de API enviada ao ingestor)
+func NewHeaderHTTPClient(client *http.Client, header http.Header) HTTPClient {
+	return &headerHTTPClient{client: client, header: header}
+}
+
+func (h *headerHTTPClient) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = h.header.Clone()
+	req.Header.Set("Content-Type", contentType)
+	return h.client.Do(req)
+}
+
+type dryRunHTTPClient struct{}
+
+// NewDryRunHTTPClient cria um cliente HTTP que não realiza requisições.
+// O corpo de cada Post é registrado no log e a resposta é sempre 200 OK,
+// permitindo executar o ciclo completo de envio sem uma API de destino.
+func NewDryRunHTTPClient() HTTPClient {
+	return &dryRunHTTPClient{}
+}
+
+func (d *dryRunHTTPClient) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o body: %w", err)
+	}
+
+	log.Info().
+		Str("url", url).
+		Str("content_type", contentType).
+		Int("bytes", len(payload)).
+		Str("payload", string(payload)).
+		Msg("Dry-run: envio simulado")
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients/mocks"
@@ -29,3 +30,42 @@ func TestHTTPClient(t *testing.T) {
 		t.Fatalf("Expected status OK, got %s", resp.Status)
 	}
 }
+
+func TestDryRunHTTPClient(t *testing.T) {
+	httpClient := NewDryRunHTTPClient()
+
+	resp, err := httpClient.Post("http://example.com", "application/json", bytes.NewBufferString(`[{"tenant_id":"t1"}]`))
+	if err != nil {
+		t.Fatalf("Dry-run não deveria retornar erro: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", resp.StatusCode)
+	}
+	if resp.Status != "200 OK" {
+		t.Fatalf("Expected status 200 OK, got %s", resp.Status)
+	}
+}
+
+func TestHeaderHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "ik_test" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	httpClient := NewHeaderHTTPClient(server.Client(), http.Header{"X-Api-Key": []string{"ik_test"}})
+	resp, err := httpClient.Post(server.URL, "application/json", bytes.NewBufferString(`{}`))
+	if err != nil {
+		t.Fatalf("Failed to make HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status No Content, got %d", resp.StatusCode)
+	}
+}
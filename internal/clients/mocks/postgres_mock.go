@@ -0,0 +1,44 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPostgresClient struct {
+	mock.Mock
+}
+
+func (m *MockPostgresClient) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	called := m.Called(ctx, sql, args)
+	return pgconn.NewCommandTag(called.String(0)), called.Error(1)
+}
+
+func (m *MockPostgresClient) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	called := m.Called(ctx, sql, args)
+	rows, _ := called.Get(0).(pgx.Rows)
+	return rows, called.Error(1)
+}
+
+func (m *MockPostgresClient) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	called := m.Called(ctx, sql, args)
+	return called.Get(0).(pgx.Row)
+}
+
+func (m *MockPostgresClient) Begin(ctx context.Context) (pgx.Tx, error) {
+	called := m.Called(ctx)
+	tx, _ := called.Get(0).(pgx.Tx)
+	return tx, called.Error(1)
+}
+
+func (m *MockPostgresClient) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockPostgresClient) Close() {
+	m.Called()
+}
@@ -71,6 +71,140 @@ func (m *MockRedisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd
 	return cmd
 }
 
+func (m *MockRedisClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	called := m.Called(ctx, script, keys, args)
+	cmd := redis.NewCmd(ctx, "EVAL", script)
+	if err := called.Error(1); err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(called.Get(0))
+	}
+	return cmd
+}
+
+func (m *MockRedisClient) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
+	args := m.Called(ctx, key, field, incr)
+	cmd := redis.NewIntCmd(ctx, "HINCRBY", key, field, incr)
+	if err := args.Error(0); err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(incr)
+	}
+	return cmd
+}
+
+func (m *MockRedisClient) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	args := m.Called(ctx, key)
+	cmd := redis.NewStringStringMapCmd(ctx, "HGETALL", key)
+	if fields, ok := args.Get(0).(map[string]string); ok {
+		cmd.SetVal(fields)
+	}
+	if err := args.Error(1); err != nil {
+		cmd.SetErr(err)
+	}
+	return cmd
+}
+
+func (m *MockRedisClient) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	args := m.Called(ctx, key, fields)
+	cmd := redis.NewIntCmd(ctx, "HDEL", key)
+	if err := args.Error(0); err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(int64(len(fields)))
+	}
+	return cmd
+}
+
+func (m *MockRedisClient) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	args := m.Called(ctx, key, members)
+	cmd := redis.NewIntCmd(ctx, "SADD", key)
+	if err := args.Error(0); err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(int64(len(members)))
+	}
+	return cmd
+}
+
+func (m *MockRedisClient) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	args := m.Called(ctx, key, members)
+	cmd := redis.NewIntCmd(ctx, "SREM", key)
+	if err := args.Error(0); err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(int64(len(members)))
+	}
+	return cmd
+}
+
+func (m *MockRedisClient) SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd {
+	args := m.Called(ctx, key, cursor, match, count)
+	scanCmd := redis.NewScanCmd(ctx, nil, "SSCAN", key, cursor, "MATCH", match, "COUNT", count)
+	if members, ok := args.Get(0).([]string); ok {
+		var nextCursor uint64
+		if cursorVal, ok := args.Get(1).(uint64); ok {
+			nextCursor = cursorVal
+		}
+		scanCmd.SetVal(members, nextCursor)
+	}
+	if err := args.Error(2); err != nil {
+		scanCmd.SetErr(err)
+	}
+	return scanCmd
+}
+
+func (m *MockRedisClient) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	args := m.Called(ctx, keys)
+	cmd := redis.NewIntCmd(ctx, "EXISTS")
+	if err := args.Error(1); err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(args.Get(0).(int64))
+	}
+	return cmd
+}
+
+// Pipelined executa fn com um pipeline que encaminha os comandos para os métodos do mock,
+// então as expectativas são registradas nos próprios comandos (ex.: SAdd, HIncrBy)
+func (m *MockRedisClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	pipe := &mockPipeliner{m: m}
+	if err := fn(pipe); err != nil {
+		return nil, err
+	}
+	for _, cmd := range pipe.cmds {
+		if err := cmd.Err(); err != nil {
+			return pipe.cmds, err
+		}
+	}
+	return pipe.cmds, nil
+}
+
+// mockPipeliner implementa apenas os comandos utilizados em pipelines pelos serviços
+type mockPipeliner struct {
+	redis.Pipeliner
+	m    *MockRedisClient
+	cmds []redis.Cmder
+}
+
+func (p *mockPipeliner) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	cmd := p.m.SAdd(ctx, key, members...)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+func (p *mockPipeliner) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
+	cmd := p.m.HIncrBy(ctx, key, field, incr)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+func (p *mockPipeliner) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	cmd := p.m.Eval(ctx, script, keys, args...)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
 func (m *MockRedisClient) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -0,0 +1,54 @@
+package clients
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// PostgresClient são as operações do pool do PostgreSQL utilizadas pelo projeto (implementadas por *pgxpool.Pool)
+type PostgresClient interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Ping(ctx context.Context) error
+	Close()
+}
+
+type PostgresClientOptions func(*pgxpool.Config)
+
+// WithMaxConns define a quantidade máxima de conexões do pool
+func WithMaxConns(maxConns int32) PostgresClientOptions {
+	return func(c *pgxpool.Config) {
+		c.MaxConns = maxConns
+	}
+}
+
+// Cria o pool do PostgreSQL a partir da URL de conexão (postgres://...) e verifica a conexão
+func InitPostgresClient(url string, opts ...PostgresClientOptions) PostgresClient {
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		log.Panic().Msgf("URL do PostgreSQL inválida: %v\n", err)
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		log.Panic().Msgf("Erro ao criar o pool do PostgreSQL: %v\n", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		log.Panic().Msgf("Erro ao conectar ao PostgreSQL: %v\n", err)
+	}
+
+	log.Debug().Int32("max_conns", config.MaxConns).Msg("Conexão com PostgreSQL estabelecida com sucesso!")
+	return pool
+}
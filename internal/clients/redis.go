@@ -2,6 +2,7 @@ package clients
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -14,13 +15,23 @@ type RedisClient interface {
 	Get(ctx context.Context, key string) *redis.StringCmd
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
 	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd
+	SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd
+	Exists(ctx context.Context, keys ...string) *redis.IntCmd
+	Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
 	Ping(ctx context.Context) *redis.StatusCmd
 	PoolStats() *redis.PoolStats
 	Close() error
 }
 
 type redisClient struct {
-	client RedisClient
+	client       RedisClient
+	clusterAddrs []string
 }
 
 func (r *redisClient) IncrByFloat(ctx context.Context, key string, value float64) *redis.FloatCmd {
@@ -43,6 +54,44 @@ func (r *redisClient) Del(ctx context.Context, keys ...string) *redis.IntCmd {
 	return r.client.Del(ctx, keys...)
 }
 
+func (r *redisClient) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	return r.client.Eval(ctx, script, keys, args...)
+}
+
+func (r *redisClient) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
+	return r.client.HIncrBy(ctx, key, field, incr)
+}
+
+func (r *redisClient) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	return r.client.HGetAll(ctx, key)
+}
+
+func (r *redisClient) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	return r.client.HDel(ctx, key, fields...)
+}
+
+func (r *redisClient) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	return r.client.SAdd(ctx, key, members...)
+}
+
+func (r *redisClient) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	return r.client.SRem(ctx, key, members...)
+}
+
+func (r *redisClient) SScan(ctx context.Context, key string, cursor uint64, match string, count int64) *redis.ScanCmd {
+	return r.client.SScan(ctx, key, cursor, match, count)
+}
+
+func (r *redisClient) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	return r.client.Exists(ctx, keys...)
+}
+
+// Pipelined envia os comandos registrados em fn em uma única ida ao Redis, sem atomicidade.
+// No Redis Cluster os comandos são agrupados por nó.
+func (r *redisClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return r.client.Pipelined(ctx, fn)
+}
+
 func (r *redisClient) Ping(ctx context.Context) *redis.StatusCmd {
 	return r.client.Ping(ctx)
 }
@@ -64,11 +113,37 @@ func WithCustomRedisClient(client RedisClient) RedisClientOptions {
 	}
 }
 
+// WithClusterAddrs conecta a um Redis Cluster pelos endereços informados, ignorando host, porta e sentinelas.
+// Sem endereços, a opção não tem efeito.
+func WithClusterAddrs(addrs []string) RedisClientOptions {
+	return func(r *redisClient) {
+		r.clusterAddrs = addrs
+	}
+}
+
 // Cria um cliente Redis com as opções padrão
 // DialTimeout: 5s, ReadTimeout: 3s, WriteTimeout: 3s, PoolSize: 100, MinIdleConns: 10, MaxRetries: 3
 func createRedisClient(host, port string, sentinelAddrs []string, opts ...RedisClientOptions) RedisClient {
-	newRedisClient := &redis.Client{}
-	if len(sentinelAddrs) > 0 {
+	clientCreated := &redisClient{}
+	for _, opt := range opts {
+		opt(clientCreated)
+	}
+	if clientCreated.client != nil {
+		return clientCreated.client
+	}
+
+	var newRedisClient RedisClient
+	if len(clientCreated.clusterAddrs) > 0 {
+		newRedisClient = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        clientCreated.clusterAddrs,
+			DialTimeout:  5 * time.Second,
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 3 * time.Second,
+			PoolSize:     100,
+			MinIdleConns: 10,
+			MaxRetries:   3,
+		})
+	} else if len(sentinelAddrs) > 0 {
 		newRedisClient = redis.NewFailoverClient(&redis.FailoverOptions{
 			MasterName:    "mymaster",
 			SentinelAddrs: sentinelAddrs,
@@ -90,15 +165,45 @@ func createRedisClient(host, port string, sentinelAddrs []string, opts ...RedisC
 			MaxRetries:   3,
 		})
 	}
+	return newRedisClient
+}
 
-	clientCreated := &redisClient{
-		client: newRedisClient,
+// ScanKeys percorre as chaves que correspondem ao padrão e chama fn com cada lote retornado pelo SCAN.
+// Em um Redis Cluster, percorre todos os masters; as chamadas a fn nunca são simultâneas.
+func ScanKeys(ctx context.Context, client RedisClient, match string, count int64, fn func(keys []string) error) error {
+	cluster, ok := client.(*redis.ClusterClient)
+	if !ok {
+		return scanKeys(ctx, client, match, count, fn)
 	}
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		return scanKeys(ctx, master, match, count, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(keys)
+		})
+	})
+}
 
-	for _, opt := range opts {
-		opt(clientCreated)
+type scanner interface {
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
+}
+
+func scanKeys(ctx context.Context, client scanner, match string, count int64, fn func(keys []string) error) error {
+	cursor := uint64(0)
+	for {
+		keys, next, err := client.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return err
+		}
+		if err := fn(keys); err != nil {
+			return err
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
 	}
-	return clientCreated.client
 }
 
 // Cria um cliente Redis com as opções padrão e verifica a conexão
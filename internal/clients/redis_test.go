@@ -1,13 +1,18 @@
 package clients
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients/mocks"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRedisInit(t *testing.T) {
@@ -42,3 +47,46 @@ func TestRedisInit(t *testing.T) {
 		redisClientMock.AssertExpectations(t)
 	})
 }
+
+func TestCreateRedisClient(t *testing.T) {
+	_, ok := createRedisClient("localhost", "6379", nil).(*redis.Client)
+	assert.True(t, ok)
+
+	cluster := createRedisClient("localhost", "6379", []string{"s1:26379"}, WithClusterAddrs([]string{"c1:7000", "c2:7001"}))
+	defer cluster.Close()
+	_, ok = cluster.(*redis.ClusterClient)
+	assert.True(t, ok)
+
+	custom := new(mocks.MockRedisClient)
+	assert.Same(t, custom, createRedisClient("localhost", "6379", nil, WithClusterAddrs([]string{"c1:7000"}), WithCustomRedisClient(custom)))
+}
+
+func TestScanKeys(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	for i := 0; i < 25; i++ {
+		mr.Set(fmt.Sprintf("generation:A:{tenant%d}", i), "1")
+	}
+	mr.Set("current_generation", "A")
+
+	clients := map[string]RedisClient{
+		"Single":  redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		"Cluster": redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}}),
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			defer client.Close()
+			var found []string
+			err := ScanKeys(ctx, client, "generation:A:{*}", 10, func(keys []string) error {
+				found = append(found, keys...)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Len(t, found, 25)
+
+			stop := errors.New("interrompido")
+			err = ScanKeys(ctx, client, "generation:A:{*}", 10, func([]string) error { return stop })
+			assert.ErrorIs(t, err, stop)
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"gopkg.in/yaml.v3"
+)
+
+// componentSections define quais seções de Config cada componente utiliza.
+// Apenas as flags dessas seções são registradas e apenas elas são impressas com --print-config.
+var componentSections = map[Component][]string{
+	Ingestor: {"Redis", "Store", "Postgres", "Ingestor", "Reconcile", "Catalog", "Auth", "RateLimit", "Quota", "Usage", "Amount", "Units"},
+	Sender:   {"Redis", "Store", "Postgres", "Sender", "Janitor", "Reconcile", "History", "Amount", "Units"},
+	Producer: {"Producer", "Amount", "Units"},
+	APIKey:   {"Redis", "Auth"},
+	History:  {"History", "Units"},
+	Migrate:  {"Redis", "Units"},
+	AllInOne: {"Redis", "Store", "Postgres", "Ingestor", "Sender", "Janitor", "Reconcile", "Catalog", "Auth", "RateLimit", "Quota", "Usage", "History", "Amount", "Units"},
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field representa um valor configurável de uma seção
+type field struct {
+	value reflect.Value
+	env   string
+	flag  string
+	def   string
+	help  string
+}
+
+// rawFlag guarda o texto informado na linha de comando para ser aplicado
+// somente depois do arquivo e das variáveis de ambiente
+type rawFlag struct {
+	value  string
+	isBool bool
+}
+
+func (r *rawFlag) String() string     { return r.value }
+func (r *rawFlag) Set(v string) error { r.value = v; return nil }
+func (r *rawFlag) IsBoolFlag() bool   { return r.isBool }
+
+// Load carrega a configuração do componente a partir dos valores padrão, do arquivo informado
+// em --config (ou CONFIG_FILE), das variáveis de ambiente e das flags em args, nessa ordem de precedência.
+// Load não valida os valores; utilize Config.Validate após imprimir ou ajustar a configuração.
+func Load(component Component, args []string) (*Config, error) {
+	sections, ok := componentSections[component]
+	if !ok {
+		return nil, fmt.Errorf("componente desconhecido: %q", component)
+	}
+
+	cfg := &Config{Units: pulse.DefaultUnits()}
+	all := collectFields(reflect.ValueOf(cfg).Elem())
+	for _, f := range all {
+		if f.def == "" {
+			continue
+		}
+		if err := setValue(f.value, f.def); err != nil {
+			return nil, fmt.Errorf("valor padrão inválido para %s: %w", f.flag, err)
+		}
+	}
+
+	fs := flag.NewFlagSet(string(component), flag.ContinueOnError)
+	fs.StringVar(&cfg.File, "config", os.Getenv("CONFIG_FILE"), "Arquivo de configuração YAML ou TOML (CONFIG_FILE)")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "Imprime a configuração efetiva e encerra")
+
+	flags := make(map[string]field)
+	raws := make(map[string]*rawFlag)
+	for _, section := range sections {
+		sv := reflect.ValueOf(cfg).Elem().FieldByName(section)
+		if sv.Kind() != reflect.Struct {
+			// Seções em lista (como units) são definidas apenas pelo arquivo
+			continue
+		}
+		for _, f := range collectFields(sv) {
+			if f.flag == "" {
+				continue
+			}
+			raw := &rawFlag{value: formatValue(f.value), isBool: f.value.Kind() == reflect.Bool}
+			usage := f.help
+			if f.env != "" {
+				usage = fmt.Sprintf("%s (%s)", f.help, f.env)
+			}
+			fs.Var(raw, f.flag, usage)
+			flags[f.flag] = f
+			raws[f.flag] = raw
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg.Args = fs.Args()
+
+	if cfg.File != "" {
+		if err := loadFile(cfg.File, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, f := range all {
+		if f.env == "" {
+			continue
+		}
+		if v, ok := os.LookupEnv(f.env); ok && v != "" {
+			if err := setValue(f.value, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		f, ok := flags[fl.Name]
+		if !ok {
+			return
+		}
+		if err := setValue(f.value, raws[fl.Name].value); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", fl.Name, err))
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return cfg, nil
+}
+
+// loadFile decodifica o arquivo sobre a configuração atual, preservando os valores que não estiverem no arquivo
+func loadFile(path string, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("erro ao ler o arquivo de configuração: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("erro ao interpretar o arquivo de configuração %s: %w", path, err)
+		}
+	case ".toml":
+		if _, err := toml.DecodeFile(path, cfg); err != nil {
+			return fmt.Errorf("erro ao interpretar o arquivo de configuração %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("formato de arquivo de configuração não suportado: %s (use .yaml, .yml ou .toml)", path)
+	}
+	return nil
+}
+
+// collectFields percorre a struct e retorna os campos configuráveis por ambiente, flag ou valor padrão.
+// Structs aninhadas sem essas tags são percorridas recursivamente.
+func collectFields(v reflect.Value) []field {
+	var fields []field
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		f := field{
+			value: fv,
+			env:   sf.Tag.Get("env"),
+			flag:  sf.Tag.Get("flag"),
+			def:   sf.Tag.Get("default"),
+			help:  sf.Tag.Get("help"),
+		}
+		if f.env != "" || f.flag != "" || f.def != "" {
+			fields = append(fields, f)
+			continue
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			fields = append(fields, collectFields(fv)...)
+		}
+	}
+	return fields
+}
+
+// setValue converte o texto para o tipo do campo e atribui o valor
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("duração inválida %q (ex.: 500ms, 30s, 1m)", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("número inteiro inválido %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("número inválido %q", raw)
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("booleano inválido %q (use true ou false)", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("tipo não suportado: %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("tipo não suportado: %s", v.Type())
+	}
+	return nil
+}
+
+// formatValue converte o valor do campo para o texto aceito por setValue
+func formatValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range v.Len() {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// Print escreve em YAML a configuração efetiva das seções utilizadas pelo componente
+func (c *Config) Print(w io.Writer, component Component) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	v := reflect.ValueOf(c).Elem()
+	for _, section := range componentSections[component] {
+		sf, _ := v.Type().FieldByName(section)
+		node, err := toNode(v.FieldByName(section))
+		if err != nil {
+			return err
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: yamlName(sf)}, node)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(root)
+}
+
+// toNode converte o valor para um nó YAML mantendo a ordem dos campos e exibindo durações como texto
+func toNode(v reflect.Value) (*yaml.Node, error) {
+	if v.Type() == durationType {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: time.Duration(v.Int()).String()}, nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := range v.NumField() {
+			sf := v.Type().Field(i)
+			name := yamlName(sf)
+			if !sf.IsExported() || name == "-" {
+				continue
+			}
+			// Valores sensíveis não são exibidos, apenas indicados como preenchidos
+			if sf.Tag.Get("secret") == "true" && !v.Field(i).IsZero() {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, &yaml.Node{Kind: yaml.ScalarNode, Value: "********"})
+				continue
+			}
+			child, err := toNode(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, child)
+		}
+		return node, nil
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		if k := v.Type().Elem().Kind(); k != reflect.Struct && k != reflect.Map {
+			node.Style = yaml.FlowStyle
+		}
+		for i := range v.Len() {
+			child, err := toNode(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			child, err := toNode(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(key)}, child)
+		}
+		return node, nil
+	default:
+		node := &yaml.Node{}
+		if err := node.Encode(v.Interface()); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
+
+func yamlName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(sf.Name)
+	}
+	return name
+}
@@ -0,0 +1,19 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/health"
+)
+
+// Check verifica se a geração atual pode ser lida do Redis
+func Check(manager ManagerGeneration) health.CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		gen, err := manager.GetCurrentGeneration()
+		if err != nil {
+			return "", fmt.Errorf("erro ao obter a geração atual: %w", err)
+		}
+		return "geração " + gen, nil
+	}
+}
@@ -0,0 +1,29 @@
+package generation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	mockRedis := new(mocks.MockRedisClient)
+	mgr := &managerGeneration{redisClient: mockRedis, ctx: ctx}
+
+	t.Run("Known", func(t *testing.T) {
+		mockRedis.On("Get", ctx, "current_generation").Return("A", nil).Once()
+		detail, err := Check(mgr)(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "geração A", detail)
+	})
+
+	t.Run("RedisError", func(t *testing.T) {
+		mockRedis.On("Get", ctx, "current_generation").Return("", errors.New("boom")).Once()
+		_, err := Check(mgr)(ctx)
+		assert.ErrorContains(t, err, "boom")
+	})
+}
@@ -0,0 +1,188 @@
+package generation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/keycodec"
+)
+
+// Other retorna a geração que não está recebendo pulsos, ou seja, a que o sender está enviando ou enviará em seguida
+func Other(gen string) string {
+	if gen == "B" {
+		return "A"
+	}
+	return "B"
+}
+
+// Key retorna o hash com os agregados do tenant na geração: generation:<geração>:{<tenant>}.
+// O tenant fica entre chaves (hash tag do Redis Cluster), então os hashes das duas gerações
+// de um tenant ficam no mesmo slot. O tenant é codificado com keycodec.Escape, então pode conter ":" ou "{".
+func Key(gen, tenantId string) string {
+	return fmt.Sprintf("generation:%s:{%s}", gen, keycodec.Escape(tenantId))
+}
+
+// Pattern retorna o padrão do SCAN que encontra os hashes de todos os tenants na geração
+func Pattern(gen string) string {
+	return fmt.Sprintf("generation:%s:{*}", gen)
+}
+
+// IndexKey retorna o SET com os tenants que receberam pulsos na geração.
+// O sender percorre o índice com SSCAN em vez de percorrer todas as chaves do Redis com SCAN.
+func IndexKey(gen string) string {
+	return fmt.Sprintf("generation:%s:tenants", gen)
+}
+
+// ClaimIndexKey retorna o SET com os tenants reservados pelo sender para o envio da geração.
+// No início do ciclo o índice da geração é movido para ele, então os tenants gravados depois
+// voltam a formar o índice da geração. O nome usa o índice da geração como hash tag, para que
+// os dois SETs fiquem no mesmo slot do Redis Cluster.
+func ClaimIndexKey(gen string) string {
+	return fmt.Sprintf("{%s}:sending", IndexKey(gen))
+}
+
+// LeftoversKey retorna o ZSET com os tenants que ficaram com agregados reservados na geração, com o horário
+// (em segundos Unix) em que foram encontrados pela primeira vez. Fica no mesmo slot do índice reservado (veja ClaimIndexKey).
+func LeftoversKey(gen string) string {
+	return fmt.Sprintf("{%s}:leftovers", IndexKey(gen))
+}
+
+// ClaimKey retorna o hash em que o sender reserva os agregados do tenant durante o envio:
+// generation:<geração>:{<tenant>}:sending. Ele fica no mesmo slot do hash do tenant (veja Key).
+func ClaimKey(gen, tenantId string) string {
+	return Key(gen, tenantId) + ":sending"
+}
+
+// ClaimPattern retorna o padrão do SCAN que encontra os hashes reservados de todos os tenants na geração
+func ClaimPattern(gen string) string {
+	return Pattern(gen) + ":sending"
+}
+
+// ParseClaimKey extrai a geração e o tenant de um hash retornado por ClaimKey
+func ParseClaimKey(key string) (gen, tenantId string, ok bool) {
+	key, found := strings.CutSuffix(key, ":sending")
+	if !found {
+		return "", "", false
+	}
+	return ParseKey(key)
+}
+
+// ParseKey extrai a geração e o tenant de um hash retornado por Key
+func ParseKey(key string) (gen, tenantId string, ok bool) {
+	rest, found := strings.CutPrefix(key, "generation:")
+	if !found {
+		return "", "", false
+	}
+	gen, tag, found := strings.Cut(rest, ":")
+	if !found || gen == "" || len(tag) < 3 || tag[0] != '{' || tag[len(tag)-1] != '}' {
+		return "", "", false
+	}
+	encoded := tag[1 : len(tag)-1]
+	if encoded == "" {
+		return "", "", false
+	}
+	tenantId, err := keycodec.Unescape(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return gen, tenantId, true
+}
+
+// LedgerKey retorna o hash com os totais gravados pelos ingestores para o tenant na geração, utilizado na conciliação:
+// ledger:<geração>:{<tenant>}. O prefixo é diferente do de Key, então o SCAN dos agregados não encontra os totais.
+func LedgerKey(gen, tenantId string) string {
+	return fmt.Sprintf("ledger:%s:{%s}", gen, keycodec.Escape(tenantId))
+}
+
+// LedgerIndexKey retorna o SET com os tenants que têm totais gravados na geração (veja LedgerKey)
+func LedgerIndexKey(gen string) string {
+	return fmt.Sprintf("ledger:%s:tenants", gen)
+}
+
+// LedgerClosingKey retorna o SET com os tenants cujos totais estão sendo fechados pela conciliação.
+// Usa o índice como hash tag, para que os dois SETs fiquem no mesmo slot do Redis Cluster.
+func LedgerClosingKey(gen string) string {
+	return fmt.Sprintf("{%s}:closing", LedgerIndexKey(gen))
+}
+
+// LedgerStateKey retorna a string com o estado da conciliação, compartilhado pelas duas gerações
+func LedgerStateKey() string {
+	return "ledger:state"
+}
+
+// FloatScale é a escala retornada por ParseField para os campos sem escala (veja FloatField)
+const FloatScale = -1
+
+// Field retorna o campo do hash do tenant com o agregado do SKU na unidade: <sku>:<unidade>:<escala>,
+// com o SKU e a unidade codificados por keycodec. O valor do campo é um inteiro em 10^-escala da unidade
+// (veja pulse.Amount), incrementado com HINCRBY.
+func Field(productSku, unit string, scale int) string {
+	return keycodec.Join(productSku, unit, strconv.Itoa(scale))
+}
+
+// FloatField retorna o campo sem escala, <sku>:<unidade>, cujo valor é um número em ponto flutuante.
+// É o formato gravado antes dos valores em ponto fixo e pela migração das chaves do formato anterior.
+func FloatField(productSku, unit string) string {
+	return keycodec.Join(productSku, unit)
+}
+
+// OverflowField retorna a parte n (a partir de 1) do campo com escala: <sku>:<unidade>:<escala>:<n>.
+// Um incremento que transbordaria o inteiro de 64 bits do campo é somado na primeira parte em que cabe,
+// e cada parte é lida como um campo do mesmo SKU e unidade, então o total não fica limitado a 64 bits.
+func OverflowField(field string, n int) string {
+	return field + keycodec.Separator + strconv.Itoa(n)
+}
+
+// SplitOverflowField separa o campo e o número da parte de um campo de OverflowField.
+// Para os demais campos retorna o próprio campo e 0.
+func SplitOverflowField(field string) (string, int) {
+	i := strings.LastIndex(field, keycodec.Separator)
+	if i < 0 || strings.Count(field, keycodec.Separator) != 3 {
+		return field, 0
+	}
+	n, err := strconv.Atoi(field[i+1:])
+	if err != nil || n < 1 || strconv.Itoa(n) != field[i+1:] {
+		return field, 0
+	}
+	return field[:i], n
+}
+
+// ParseField separa o SKU, a unidade e a escala de um campo do hash, inclusive das partes de OverflowField.
+// Para os campos de FloatField a escala é FloatScale.
+func ParseField(field string) (productSku, unit string, scale int, ok bool) {
+	if parts, err := keycodec.Split(field, 2); err == nil {
+		return parts[0], parts[1], FloatScale, true
+	}
+	base, _ := SplitOverflowField(field)
+	parts, err := keycodec.Split(base, 3)
+	if err != nil {
+		return "", "", 0, false
+	}
+	scale, err = strconv.Atoi(parts[2])
+	if err != nil || scale < 0 || strconv.Itoa(scale) != parts[2] {
+		return "", "", 0, false
+	}
+	return parts[0], parts[1], scale, true
+}
+
+// LegacyPattern retorna o padrão do SCAN que encontra as chaves do formato anterior,
+// uma string por tenant, SKU e unidade: generation:<geração>:tenant:<tenant>:sku:<sku>:useUnit:<unidade>
+func LegacyPattern() string {
+	return "generation:*:tenant:*:sku:*:useUnit:*"
+}
+
+// ParseLegacyKey extrai a geração, o tenant, o SKU e a unidade de uma chave do formato anterior
+func ParseLegacyKey(key string) (gen, tenantId, productSku, unit string, ok bool) {
+	parts := strings.Split(key, ":")
+	if len(parts) != 8 || parts[0] != "generation" || parts[2] != "tenant" || parts[4] != "sku" || parts[6] != "useUnit" {
+		return "", "", "", "", false
+	}
+	return parts[1], parts[3], parts[5], parts[7], true
+}
+
+// LegacyIndexPattern retorna o padrão do SCAN que encontra os índices dos tenants do formato anterior,
+// substituídos pelos próprios hashes dos tenants
+func LegacyIndexPattern() string {
+	return "index:generation:*:tenant:*"
+}
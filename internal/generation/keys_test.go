@@ -0,0 +1,154 @@
+package generation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOther(t *testing.T) {
+	assert.Equal(t, "B", Other("A"))
+	assert.Equal(t, "A", Other("B"))
+	assert.Equal(t, "B", Other(""))
+}
+
+func TestKeys(t *testing.T) {
+	key := Key("A", "tenant1")
+	assert.Equal(t, "generation:A:{tenant1}", key)
+	assert.Equal(t, "generation:A:{*}", Pattern("A"))
+	assert.Equal(t, "generation:A:tenants", IndexKey("A"))
+	gen, tenant, ok := ParseKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, "A", gen)
+	assert.Equal(t, "tenant1", tenant)
+
+	key = Key("A", "org:{tenant1}")
+	assert.Equal(t, "generation:A:{org%3A%7Btenant1%7D}", key)
+	_, tenant, ok = ParseKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, "org:{tenant1}", tenant)
+
+	for _, invalid := range []string{"generation:A:tenant1", "generation:A:{a:b}", "generation:A:{a%zz}", "generation:A:{}", "generation::{t}", "current_generation", "generation:A:{a}b}", "generation:A:tenant:t:sku:s:useUnit:B", IndexKey("A")} {
+		_, _, ok := ParseKey(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestClaimKeys(t *testing.T) {
+	key := ClaimKey("A", "org:tenant1")
+	assert.Equal(t, "generation:A:{org%3Atenant1}:sending", key)
+	assert.Equal(t, "generation:A:{*}:sending", ClaimPattern("A"))
+	assert.Equal(t, "{generation:A:tenants}:sending", ClaimIndexKey("A"))
+	gen, tenant, ok := ParseClaimKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, "A", gen)
+	assert.Equal(t, "org:tenant1", tenant)
+
+	_, _, ok = ParseKey(key)
+	assert.False(t, ok)
+	for _, invalid := range []string{Key("A", "tenant1"), "generation:A:{}:sending", ClaimIndexKey("A")} {
+		_, _, ok := ParseClaimKey(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestFields(t *testing.T) {
+	field := Field("SKU-1", "B/sec", 6)
+	assert.Equal(t, "SKU-1:B/sec:6", field)
+	sku, unit, scale, ok := ParseField(field)
+	assert.True(t, ok)
+	assert.Equal(t, "SKU-1", sku)
+	assert.Equal(t, "B/sec", unit)
+	assert.Equal(t, 6, scale)
+
+	field = Field("SKU:1", "a:b", 0)
+	assert.Equal(t, "SKU%3A1:a%3Ab:0", field)
+	sku, unit, scale, ok = ParseField(field)
+	assert.True(t, ok)
+	assert.Equal(t, "SKU:1", sku)
+	assert.Equal(t, "a:b", unit)
+	assert.Equal(t, 0, scale)
+
+	field = FloatField("SKU:1", "KB")
+	assert.Equal(t, "SKU%3A1:KB", field)
+	sku, unit, scale, ok = ParseField(field)
+	assert.True(t, ok)
+	assert.Equal(t, "SKU:1", sku)
+	assert.Equal(t, "KB", unit)
+	assert.Equal(t, FloatScale, scale)
+
+	field = OverflowField(Field("SKU:1", "B", 6), 2)
+	assert.Equal(t, "SKU%3A1:B:6:2", field)
+	sku, unit, scale, ok = ParseField(field)
+	assert.True(t, ok)
+	assert.Equal(t, "SKU:1", sku)
+	assert.Equal(t, "B", unit)
+	assert.Equal(t, 6, scale)
+	base, n := SplitOverflowField(field)
+	assert.Equal(t, "SKU%3A1:B:6", base)
+	assert.Equal(t, 2, n)
+	base, n = SplitOverflowField("SKU%3A1:B:6")
+	assert.Equal(t, "SKU%3A1:B:6", base)
+	assert.Equal(t, 0, n)
+
+	for _, invalid := range []string{"SKU-1", ":B", "SKU-1:", "SKU-1:a:b", "SKU-1:a:-1", "SKU-1:a:06", "SKU-1:a:6:0", "SKU-1:a:6:07", "SKU-1:a:6:7:8", "SKU-1:%zz"} {
+		_, _, _, ok := ParseField(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestLegacyKeys(t *testing.T) {
+	gen, tenant, sku, unit, ok := ParseLegacyKey("generation:B:tenant:t1:sku:SKU-1:useUnit:KB")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"B", "t1", "SKU-1", "KB"}, []string{gen, tenant, sku, unit})
+
+	for _, invalid := range []string{"generation:B:{t1}", "generation:B:tenant:t1:sku:SKU-1:unit:KB", "generation:B:tenant:t1:sku:SKU-1:useUnit:B:x"} {
+		_, _, _, _, ok := ParseLegacyKey(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func FuzzKeyRoundTrip(f *testing.F) {
+	for _, seed := range []string{"tenant1", "org:tenant1", "{t}", "a}b", "100%", "*"} {
+		f.Add("A", seed)
+		f.Add("B", seed)
+	}
+	f.Fuzz(func(t *testing.T, gen, tenantId string) {
+		if gen == "" || strings.Contains(gen, ":") || tenantId == "" {
+			t.Skip()
+		}
+		parsedGen, parsedTenant, ok := ParseKey(Key(gen, tenantId))
+		if !ok || parsedGen != gen || parsedTenant != tenantId {
+			t.Fatalf("ParseKey(Key(%q, %q)) = %q, %q, %v", gen, tenantId, parsedGen, parsedTenant, ok)
+		}
+	})
+}
+
+func FuzzFieldRoundTrip(f *testing.F) {
+	f.Add("SKU-1", "KB")
+	f.Add("SKU:1", "B/sec")
+	f.Add("a%3Ab", "x:y")
+	f.Fuzz(func(t *testing.T, productSku, unit string) {
+		if productSku == "" || unit == "" {
+			t.Skip()
+		}
+		parsedSku, parsedUnit, scale, ok := ParseField(Field(productSku, unit, 6))
+		if !ok || parsedSku != productSku || parsedUnit != unit || scale != 6 {
+			t.Fatalf("ParseField(Field(%q, %q, 6)) = %q, %q, %d, %v", productSku, unit, parsedSku, parsedUnit, scale, ok)
+		}
+		parsedSku, parsedUnit, scale, ok = ParseField(FloatField(productSku, unit))
+		if !ok || parsedSku != productSku || parsedUnit != unit || scale != FloatScale {
+			t.Fatalf("ParseField(FloatField(%q, %q)) = %q, %q, %d, %v", productSku, unit, parsedSku, parsedUnit, scale, ok)
+		}
+	})
+}
+
+func TestLedgerKeys(t *testing.T) {
+	assert.Equal(t, "ledger:A:{org%3Atenant1}", LedgerKey("A", "org:tenant1"))
+	assert.Equal(t, "ledger:A:tenants", LedgerIndexKey("A"))
+	assert.Equal(t, "{ledger:A:tenants}:closing", LedgerClosingKey("A"))
+	// os totais não são encontrados pelo SCAN dos agregados
+	_, _, ok := ParseKey(LedgerKey("A", "tenant1"))
+	assert.False(t, ok)
+}
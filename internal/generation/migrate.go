@@ -0,0 +1,134 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/rs/zerolog/log"
+)
+
+// migrateScript move o valor da chave KEYS[1] do formato anterior para o campo ARGV[1] do hash KEYS[2],
+// registra o tenant ARGV[3] no índice da geração KEYS[3] e apaga a chave.
+// Com ARGV[2] igual a "1" mantém o maior valor em vez de somar. Retorna 0 quando a chave não existe mais.
+const migrateScript = `
+local value = redis.call('GET', KEYS[1])
+if not value then
+	return 0
+end
+if ARGV[2] == '1' then
+	local current = tonumber(redis.call('HGET', KEYS[2], ARGV[1]))
+	if not current or tonumber(value) > current then
+		redis.call('HSET', KEYS[2], ARGV[1], value)
+	end
+else
+	redis.call('HINCRBYFLOAT', KEYS[2], ARGV[1], value)
+end
+redis.call('SADD', KEYS[3], ARGV[3])
+redis.call('DEL', KEYS[1])
+return 1
+`
+
+// Migration resume a migração das chaves do formato anterior
+type Migration struct {
+	// Keys é a quantidade de chaves movidas para os hashes dos tenants
+	Keys int
+	// Hashes é a quantidade de hashes de tenants que receberam as chaves
+	Hashes int
+	// Indexes é a quantidade de índices de tenants apagados
+	Indexes int
+	// Skipped é a quantidade de chaves ignoradas por não seguirem o formato anterior
+	Skipped int
+}
+
+type migrator struct {
+	scanCount int64
+	dryRun    bool
+	isMax     func(unit string) bool
+}
+
+type MigrateOptions func(*migrator)
+
+// WithMigrateScanCount define o COUNT utilizado em cada iteração do SCAN
+func WithMigrateScanCount(count int64) MigrateOptions {
+	return func(m *migrator) {
+		m.scanCount = count
+	}
+}
+
+// WithDryRun apenas contabiliza as chaves que seriam migradas, sem alterar o Redis
+func WithDryRun() MigrateOptions {
+	return func(m *migrator) {
+		m.dryRun = true
+	}
+}
+
+// WithMaxAggregation informa as unidades cujos valores são combinados pelo maior valor em vez da soma
+// quando o hash do tenant já possui o campo
+func WithMaxAggregation(isMax func(unit string) bool) MigrateOptions {
+	return func(m *migrator) {
+		m.isMax = isMax
+	}
+}
+
+// MigrateLegacyKeys move os agregados gravados no formato anterior, uma chave por tenant, SKU e unidade,
+// para os hashes dos tenants (veja Key e FloatField), registrando os tenants no índice de cada geração (veja IndexKey),
+// e apaga os índices dos tenants do formato anterior.
+//
+// A migração utiliza scripts com duas chaves em slots diferentes, então deve ser executada no Redis
+// anterior ao cluster, com os senders parados e após a atualização dos ingestores. Pode ser repetida:
+// chaves já migradas não existem mais.
+func MigrateLegacyKeys(ctx context.Context, client clients.RedisClient, opts ...MigrateOptions) (Migration, error) {
+	m := &migrator{scanCount: 100, isMax: func(string) bool { return false }}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	var result Migration
+	hashes := make(map[string]struct{})
+	err := clients.ScanKeys(ctx, client, LegacyPattern(), m.scanCount, func(keys []string) error {
+		for _, key := range keys {
+			gen, tenantId, productSku, unit, ok := ParseLegacyKey(key)
+			if !ok {
+				log.Warn().Str("key", key).Msg("Chave fora do formato anterior ignorada")
+				result.Skipped++
+				continue
+			}
+			hash := Key(gen, tenantId)
+			if m.dryRun {
+				result.Keys++
+				hashes[hash] = struct{}{}
+				continue
+			}
+			isMax := "0"
+			if m.isMax(unit) {
+				isMax = "1"
+			}
+			moved, err := client.Eval(ctx, migrateScript, []string{key, hash, IndexKey(gen)}, FloatField(productSku, unit), isMax, tenantId).Int()
+			if err != nil {
+				return fmt.Errorf("erro ao migrar a chave %s: %w", key, err)
+			}
+			if moved == 1 {
+				result.Keys++
+				hashes[hash] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Hashes = len(hashes)
+
+	err = clients.ScanKeys(ctx, client, LegacyIndexPattern(), m.scanCount, func(keys []string) error {
+		result.Indexes += len(keys)
+		if m.dryRun || len(keys) == 0 {
+			return nil
+		}
+		if err := client.Del(ctx, keys...).Err(); err != nil {
+			return fmt.Errorf("erro ao apagar os índices do formato anterior: %w", err)
+		}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,76 @@
+package generation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	ctx := context.Background()
+	seed := func(mr *miniredis.Miniredis) {
+		mr.Set("generation:A:tenant:t1:sku:sku1:useUnit:B", "10")
+		mr.Set("generation:A:tenant:t1:sku:sku1:useUnit:KB", "2")
+		mr.Set("generation:B:tenant:t1:sku:sku1:useUnit:B", "5")
+		mr.Set("generation:A:tenant:t2:sku:sku1:useUnit:conn", "30")
+		mr.SAdd("index:generation:A:tenant:t1", "sku1:B", "sku1:KB")
+		mr.Set("current_generation", "A")
+	}
+	newClient := func(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+		mr := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return mr, client
+	}
+
+	t.Run("MovesKeysIntoTenantHashes", func(t *testing.T) {
+		mr, client := newClient(t)
+		seed(mr)
+		// gravações já no formato novo são combinadas com as migradas
+		mr.HSet("generation:A:{t1}", "sku1:B", "1")
+		mr.HSet("generation:A:{t2}", "sku1:conn", "50")
+
+		result, err := MigrateLegacyKeys(ctx, client, WithMaxAggregation(func(unit string) bool { return unit == "conn" }))
+		require.NoError(t, err)
+		assert.Equal(t, Migration{Keys: 4, Hashes: 3, Indexes: 1}, result)
+
+		assert.Equal(t, "11", mr.HGet("generation:A:{t1}", "sku1:B"))
+		assert.Equal(t, "2", mr.HGet("generation:A:{t1}", "sku1:KB"))
+		assert.Equal(t, "5", mr.HGet("generation:B:{t1}", "sku1:B"))
+		assert.Equal(t, "50", mr.HGet("generation:A:{t2}", "sku1:conn"))
+		assert.Equal(t, []string{"current_generation", "generation:A:tenants", "generation:A:{t1}", "generation:A:{t2}", "generation:B:tenants", "generation:B:{t1}"}, mr.Keys())
+		tenants, err := mr.Members("generation:A:tenants")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"t1", "t2"}, tenants)
+
+		// executar novamente não altera os hashes
+		result, err = MigrateLegacyKeys(ctx, client)
+		require.NoError(t, err)
+		assert.Equal(t, Migration{}, result)
+		assert.Equal(t, "11", mr.HGet("generation:A:{t1}", "sku1:B"))
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		mr, client := newClient(t)
+		seed(mr)
+
+		result, err := MigrateLegacyKeys(ctx, client, WithDryRun(), WithMigrateScanCount(2))
+		require.NoError(t, err)
+		assert.Equal(t, Migration{Keys: 4, Hashes: 3, Indexes: 1}, result)
+		assert.True(t, mr.Exists("generation:A:tenant:t1:sku:sku1:useUnit:B"))
+		assert.True(t, mr.Exists("index:generation:A:tenant:t1"))
+		assert.False(t, mr.Exists("generation:A:{t1}"))
+	})
+
+	t.Run("RedisUnavailable", func(t *testing.T) {
+		mr, client := newClient(t)
+		mr.Close()
+
+		_, err := MigrateLegacyKeys(ctx, client)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,197 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// DefaultCheckTimeout é o tempo máximo padrão de cada verificação de prontidão
+const DefaultCheckTimeout = 2 * time.Second
+
+// CheckFunc executa uma verificação de prontidão.
+// O detalhe retornado é exibido na resposta mesmo quando a verificação falha.
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+// CheckResult é o resultado de uma verificação individual
+type CheckResult struct {
+	Status     string  `json:"status" example:"ok"`
+	Detail     string  `json:"detail,omitempty" example:"PONG"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms" example:"0.42"`
+}
+
+// Report é a resposta dos endpoints de saúde
+type Report struct {
+	Status    string                 `json:"status" example:"ok"`
+	Component string                 `json:"component" example:"ingestor"`
+	Uptime    string                 `json:"uptime" example:"1m30s"`
+	Checks    map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type Checker interface {
+	// AddCheck registra uma verificação executada pelo endpoint de prontidão
+	AddCheck(name string, check CheckFunc)
+
+	// SetShuttingDown faz o endpoint de prontidão falhar a partir deste momento,
+	// para que o balanceador deixe de enviar tráfego durante a finalização
+	SetShuttingDown()
+
+	// Live é o handler de /healthz. Responde 200 enquanto o processo estiver em execução.
+	Live() gin.HandlerFunc
+
+	// Ready é o handler de /readyz. Executa as verificações em paralelo e responde 503
+	// se alguma falhar ou se o componente estiver finalizando.
+	Ready() gin.HandlerFunc
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+type checker struct {
+	component    string
+	timeout      time.Duration
+	startedAt    time.Time
+	mu           sync.RWMutex
+	checks       []check
+	shuttingDown atomic.Bool
+}
+
+type CheckerOptions func(*checker)
+
+// WithCheckTimeout define o tempo máximo de cada verificação de prontidão
+func WithCheckTimeout(timeout time.Duration) CheckerOptions {
+	return func(c *checker) {
+		c.timeout = timeout
+	}
+}
+
+// NewChecker cria o verificador de saúde do componente informado
+func NewChecker(component string, opts ...CheckerOptions) Checker {
+	c := &checker{
+		component: component,
+		timeout:   DefaultCheckTimeout,
+		startedAt: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *checker) AddCheck(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+func (c *checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Live é o handler de verificação de vida do processo
+// @OperationId Healthz
+// @Summary Verificação de vida
+// @Description Responde 200 enquanto o processo estiver em execução
+// @Tags Saúde
+// @Produce json
+// @Success 200 {object} health.Report
+// @Router /healthz [get]
+func (c *checker) Live() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, c.report(StatusOK, nil))
+	}
+}
+
+// Ready é o handler de verificação de prontidão
+// @OperationId Readyz
+// @Summary Verificação de prontidão
+// @Description Executa as verificações do componente (Redis, geração, fila) e falha durante a finalização
+// @Tags Saúde
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (c *checker) Ready() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		results := c.run(ctx.Request.Context())
+
+		status := StatusOK
+		for _, result := range results {
+			if result.Status != StatusOK {
+				status = StatusFail
+			}
+		}
+		if c.shuttingDown.Load() {
+			status = StatusFail
+			results["shutdown"] = CheckResult{Status: StatusFail, Detail: "componente finalizando"}
+		}
+
+		code := http.StatusOK
+		if status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+		ctx.JSON(code, c.report(status, results))
+	}
+}
+
+// run executa todas as verificações em paralelo, cada uma limitada ao timeout configurado
+func (c *checker) run(ctx context.Context) map[string]CheckResult {
+	c.mu.RLock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	results := make(map[string]CheckResult, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.runCheck(ctx, chk.fn)
+			mu.Lock()
+			results[chk.name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (c *checker) runCheck(ctx context.Context, fn CheckFunc) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := fn(ctx)
+	result := CheckResult{
+		Status:     StatusOK,
+		Detail:     detail,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (c *checker) report(status string, checks map[string]CheckResult) Report {
+	return Report{
+		Status:    status,
+		Component: c.component,
+		Uptime:    time.Since(c.startedAt).Truncate(time.Second).String(),
+		Checks:    checks,
+	}
+}
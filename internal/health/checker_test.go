@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, handler gin.HandlerFunc) (int, Report) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", handler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func TestLive(t *testing.T) {
+	c := NewChecker("ingestor")
+	c.AddCheck("falha", func(ctx context.Context) (string, error) { return "", errors.New("boom") })
+	c.SetShuttingDown()
+
+	// A verificação de vida não executa as verificações nem depende da finalização
+	code, report := serve(t, c.Live())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, "ingestor", report.Component)
+	assert.Empty(t, report.Checks)
+}
+
+func TestReady(t *testing.T) {
+	t.Run("AllChecksPass", func(t *testing.T) {
+		c := NewChecker("sender")
+		c.AddCheck("a", func(ctx context.Context) (string, error) { return "detalhe a", nil })
+		c.AddCheck("b", func(ctx context.Context) (string, error) { return "", nil })
+
+		code, report := serve(t, c.Ready())
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, StatusOK, report.Status)
+		require.Len(t, report.Checks, 2)
+		assert.Equal(t, CheckResult{Status: StatusOK, Detail: "detalhe a", DurationMs: report.Checks["a"].DurationMs}, report.Checks["a"])
+	})
+
+	t.Run("OneCheckFails", func(t *testing.T) {
+		c := NewChecker("ingestor")
+		c.AddCheck("ok", func(ctx context.Context) (string, error) { return "", nil })
+		c.AddCheck("queue", func(ctx context.Context) (string, error) { return "10/10", errors.New("cheio") })
+
+		code, report := serve(t, c.Ready())
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, StatusFail, report.Status)
+		assert.Equal(t, StatusOK, report.Checks["ok"].Status)
+		assert.Equal(t, StatusFail, report.Checks["queue"].Status)
+		assert.Equal(t, "10/10", report.Checks["queue"].Detail)
+		assert.Equal(t, "cheio", report.Checks["queue"].Error)
+	})
+
+	t.Run("FailsWhileShuttingDown", func(t *testing.T) {
+		c := NewChecker("ingestor")
+		c.AddCheck("ok", func(ctx context.Context) (string, error) { return "", nil })
+		c.SetShuttingDown()
+
+		code, report := serve(t, c.Ready())
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, StatusFail, report.Status)
+		assert.Equal(t, StatusFail, report.Checks["shutdown"].Status)
+	})
+
+	t.Run("CheckTimeout", func(t *testing.T) {
+		c := NewChecker("ingestor", WithCheckTimeout(20*time.Millisecond))
+		c.AddCheck("lento", func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+
+		start := time.Now()
+		code, report := serve(t, c.Ready())
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["lento"].Error)
+	})
+}
+
+func TestRedisCheck(t *testing.T) {
+	t.Run("Pong", func(t *testing.T) {
+		redisClient := new(mocks.MockRedisClient)
+		redisClient.On("Ping", mock.Anything).Return(nil).Once()
+
+		detail, err := RedisCheck(redisClient)(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "PONG", detail)
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		redisClient := new(mocks.MockRedisClient)
+		redisClient.On("Ping", mock.Anything).Return(errors.New("connection refused")).Once()
+
+		_, err := RedisCheck(redisClient)(context.Background())
+		assert.ErrorContains(t, err, "redis indisponível")
+	})
+}
+
+func TestPostgresCheck(t *testing.T) {
+	t.Run("Ok", func(t *testing.T) {
+		postgresClient := new(mocks.MockPostgresClient)
+		postgresClient.On("Ping", mock.Anything).Return(nil).Once()
+
+		detail, err := PostgresCheck(postgresClient)(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", detail)
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		postgresClient := new(mocks.MockPostgresClient)
+		postgresClient.On("Ping", mock.Anything).Return(errors.New("connection refused")).Once()
+
+		_, err := PostgresCheck(postgresClient)(context.Background())
+		assert.ErrorContains(t, err, "postgres indisponível")
+	})
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+)
+
+// RedisCheck verifica se o Redis responde ao PING
+func RedisCheck(client clients.RedisClient) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		pong, err := client.Ping(ctx).Result()
+		if err != nil {
+			return "", fmt.Errorf("redis indisponível: %w", err)
+		}
+		return pong, nil
+	}
+}
+
+// PostgresCheck verifica se o PostgreSQL responde ao ping
+func PostgresCheck(client clients.PostgresClient) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		if err := client.Ping(ctx); err != nil {
+			return "", fmt.Errorf("postgres indisponível: %w", err)
+		}
+		return "ok", nil
+	}
+}
@@ -0,0 +1,129 @@
+package history
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// Granularity é o tamanho dos períodos em que o consumo entregue é acumulado, sempre em UTC
+type Granularity string
+
+const (
+	Hour  Granularity = "hour"
+	Day   Granularity = "day"
+	Month Granularity = "month"
+)
+
+// Granularities são as granularidades gravadas a cada entrega, da menor para a maior
+var Granularities = []Granularity{Hour, Day, Month}
+
+// ParseGranularity converte o valor recebido na consulta
+func ParseGranularity(value string) (Granularity, error) {
+	switch g := Granularity(value); g {
+	case Hour, Day, Month:
+		return g, nil
+	}
+	return "", fmt.Errorf("granularidade inválida %q (use hour, day ou month)", value)
+}
+
+// Start retorna o início do período que contém t
+func (g Granularity) Start(t time.Time) time.Time {
+	t = t.UTC()
+	switch g {
+	case Hour:
+		return t.Truncate(time.Hour)
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// End retorna o fim (exclusivo) do período que começa em start
+func (g Granularity) End(start time.Time) time.Time {
+	switch g {
+	case Hour:
+		return start.Add(time.Hour)
+	case Day:
+		return start.AddDate(0, 0, 1)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// DefaultWindow é o intervalo consultado quando from não é informado
+func (g Granularity) DefaultWindow(to time.Time) time.Time {
+	switch g {
+	case Hour:
+		return to.Add(-24 * time.Hour)
+	case Day:
+		return to.AddDate(0, 0, -30)
+	default:
+		return to.AddDate(-1, 0, 0)
+	}
+}
+
+// Entry é o consumo entregue de um tenant em um SKU e unidade durante um período
+type Entry struct {
+	ProductSku  string          `json:"product_sku" example:"SKU-77"`
+	UseUnit     pulse.PulseUnit `json:"use_unit" swaggertype:"string" example:"B"`
+	PeriodStart time.Time       `json:"period_start" example:"2025-01-31T00:00:00Z"`
+	PeriodEnd   time.Time       `json:"period_end" example:"2025-02-01T00:00:00Z"`
+	UsedAmount  pulse.Amount    `json:"used_amount" swaggertype:"number" example:"1073741824"`
+	// DisplayAmount e DisplayUnit trazem o mesmo total na maior unidade em que o valor é ao menos 1
+	DisplayAmount float64         `json:"display_amount" example:"1"`
+	DisplayUnit   pulse.PulseUnit `json:"display_unit" swaggertype:"string" example:"GB"`
+}
+
+// Query seleciona os períodos de um tenant que começam em [From, To)
+type Query struct {
+	TenantId string
+	// ProductSku filtra um SKU; vazio retorna todos
+	ProductSku  string
+	Granularity Granularity
+	From        time.Time
+	To          time.Time
+}
+
+// Report é o histórico de consumo de um tenant, ordenado por período, SKU e unidade
+type Report struct {
+	TenantId    string      `json:"tenant_id" example:"tenant_xpto"`
+	Granularity Granularity `json:"granularity" swaggertype:"string" example:"day"`
+	From        time.Time   `json:"from" example:"2025-01-01T00:00:00Z"`
+	To          time.Time   `json:"to" example:"2025-02-01T00:00:00Z"`
+	Entries     []Entry     `json:"entries"`
+}
+
+// Retention define por quanto tempo cada granularidade é mantida após o fim do período; 0 mantém para sempre
+type Retention struct {
+	Hour  time.Duration
+	Day   time.Duration
+	Month time.Duration
+}
+
+// For retorna a retenção da granularidade
+func (r Retention) For(g Granularity) time.Duration {
+	switch g {
+	case Hour:
+		return r.Hour
+	case Day:
+		return r.Day
+	default:
+		return r.Month
+	}
+}
+
+// timeLayouts são os formatos aceitos em from e to
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15", "2006-01-02", "2006-01"}
+
+// ParseTime converte from e to, em RFC 3339 ou nos formatos 2006-01-02T15, 2006-01-02 e 2006-01 (UTC)
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("data inválida %q (use RFC 3339, 2006-01-02T15, 2006-01-02 ou 2006-01)", value)
+}
@@ -0,0 +1,87 @@
+package history
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultGranularity é a granularidade consultada quando não informada
+const DefaultGranularity = Day
+
+// ParseQuery monta a consulta a partir dos parâmetros recebidos.
+// Sem granularity utiliza DefaultGranularity; sem to utiliza now; sem from utiliza a janela padrão da granularidade.
+func ParseQuery(tenantId, productSku, granularity, from, to string, now time.Time) (Query, error) {
+	if !pulse.ValidTenantId(tenantId) {
+		return Query{}, fmt.Errorf("tenant_id inválido: %q", tenantId)
+	}
+	if productSku != "" && !pulse.ValidProductSku(productSku) {
+		return Query{}, fmt.Errorf("product_sku inválido: %q", productSku)
+	}
+	q := Query{TenantId: tenantId, ProductSku: productSku, Granularity: DefaultGranularity, To: now.UTC()}
+	var err error
+	if granularity != "" {
+		if q.Granularity, err = ParseGranularity(granularity); err != nil {
+			return Query{}, err
+		}
+	}
+	if to != "" {
+		if q.To, err = ParseTime(to); err != nil {
+			return Query{}, fmt.Errorf("to: %w", err)
+		}
+	}
+	q.From = q.Granularity.DefaultWindow(q.To)
+	if from != "" {
+		if q.From, err = ParseTime(from); err != nil {
+			return Query{}, fmt.Errorf("from: %w", err)
+		}
+	}
+	if !q.From.Before(q.To) {
+		return Query{}, fmt.Errorf("from (%s) deve ser anterior a to (%s)", q.From.Format(time.RFC3339), q.To.Format(time.RFC3339))
+	}
+	return q, nil
+}
+
+type HistoryHandler interface {
+	Tenant() gin.HandlerFunc
+}
+
+type historyHandler struct {
+	store Store
+	now   func() time.Time
+}
+
+func NewHistoryHandler(store Store) HistoryHandler {
+	return &historyHandler{store: store, now: time.Now}
+}
+
+// Tenant retorna o consumo entregue de um tenant por período.
+// Parâmetros de consulta: sku, granularity (hour, day ou month), from e to (veja ParseTime).
+func (h *historyHandler) Tenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := ParseQuery(c.Param("tenant"), c.Query("sku"), c.Query("granularity"), c.Query("from"), c.Query("to"), h.now())
+		if err != nil {
+			pulse.WriteProblem(c, http.StatusBadRequest, pulse.Problem{
+				Type:   pulse.ProblemTypeInvalidQuery,
+				Title:  "Consulta inválida",
+				Detail: err.Error(),
+			})
+			return
+		}
+		entries, err := h.store.Query(c.Request.Context(), q)
+		if err != nil {
+			log.Error().Err(err).Str("tenant_id", q.TenantId).Msg("Erro ao consultar o histórico do tenant")
+			pulse.WriteProblem(c, http.StatusServiceUnavailable, pulse.Problem{
+				Type:   pulse.ProblemTypeUnavailable,
+				Title:  http.StatusText(http.StatusServiceUnavailable),
+				Detail: "não foi possível consultar o histórico; tente novamente",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, Report{TenantId: q.TenantId, Granularity: q.Granularity, From: q.From, To: q.To, Entries: entries})
+	}
+}
@@ -0,0 +1,252 @@
+package history
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestStore(t *testing.T, opts ...StoreOptions) (Store, string) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := Open(path, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store, path
+}
+
+func date(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestGranularity(t *testing.T) {
+	at := date("2025-01-31T13:45:10Z")
+	assert.Equal(t, date("2025-01-31T13:00:00Z"), Hour.Start(at))
+	assert.Equal(t, date("2025-01-31T14:00:00Z"), Hour.End(Hour.Start(at)))
+	assert.Equal(t, date("2025-01-31T00:00:00Z"), Day.Start(at))
+	assert.Equal(t, date("2025-02-01T00:00:00Z"), Day.End(Day.Start(at)))
+	assert.Equal(t, date("2025-01-01T00:00:00Z"), Month.Start(at))
+	assert.Equal(t, date("2025-02-01T00:00:00Z"), Month.End(Month.Start(at)))
+
+	_, err := ParseGranularity("week")
+	assert.Error(t, err)
+}
+
+func TestParseQuery(t *testing.T) {
+	now := date("2025-03-10T12:00:00Z")
+
+	q, err := ParseQuery("t1", "", "", "", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, Day, q.Granularity)
+	assert.Equal(t, now, q.To)
+	assert.Equal(t, date("2025-02-08T12:00:00Z"), q.From)
+
+	q, err = ParseQuery("t1", "sku1", "month", "2025-01", "2025-03-01", now)
+	require.NoError(t, err)
+	assert.Equal(t, Month, q.Granularity)
+	assert.Equal(t, date("2025-01-01T00:00:00Z"), q.From)
+	assert.Equal(t, date("2025-03-01T00:00:00Z"), q.To)
+
+	for _, tc := range []struct{ tenant, sku, granularity, from, to, err string }{
+		{tenant: "$t1", err: "tenant_id inválido"},
+		{tenant: "t1", sku: "a b", err: "product_sku inválido"},
+		{tenant: "t1", granularity: "week", err: "granularidade inválida"},
+		{tenant: "t1", from: "ontem", err: "from: data inválida"},
+		{tenant: "t1", from: "2025-03-01", to: "2025-02-01", err: "deve ser anterior"},
+	} {
+		_, err := ParseQuery(tc.tenant, tc.sku, tc.granularity, tc.from, tc.to, now)
+		assert.ErrorContains(t, err, tc.err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Rollups", func(t *testing.T) {
+		store, _ := openTestStore(t)
+		require.NoError(t, store.Record(ctx, date("2025-01-31T10:05:00Z"), []pulse.Pulse{
+			{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1024"), UseUnit: pulse.B},
+			{TenantId: "t1", ProductSku: "sku2", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.BxSec},
+			{TenantId: "t2", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("7"), UseUnit: pulse.B},
+		}))
+		require.NoError(t, store.Record(ctx, date("2025-01-31T11:10:00Z"), []pulse.Pulse{
+			{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1024"), UseUnit: pulse.B},
+		}))
+		require.NoError(t, store.Record(ctx, date("2025-02-01T00:00:00Z"), []pulse.Pulse{
+			{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("2048"), UseUnit: pulse.B},
+		}))
+
+		hours, err := store.Query(ctx, Query{TenantId: "t1", ProductSku: "sku1", Granularity: Hour, From: date("2025-01-31T00:00:00Z"), To: date("2025-02-02T00:00:00Z")})
+		require.NoError(t, err)
+		require.Len(t, hours, 3)
+		assert.Equal(t, date("2025-01-31T10:00:00Z"), hours[0].PeriodStart)
+		assert.Equal(t, date("2025-01-31T11:00:00Z"), hours[0].PeriodEnd)
+		assert.Equal(t, "1024", hours[0].UsedAmount.String())
+		assert.Equal(t, float64(1), hours[0].DisplayAmount)
+		assert.Equal(t, pulse.KB, hours[0].DisplayUnit)
+
+		days, err := store.Query(ctx, Query{TenantId: "t1", Granularity: Day, From: date("2025-01-01T00:00:00Z"), To: date("2025-03-01T00:00:00Z")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2048", "1", "2048"}, amounts(days))
+		assert.Equal(t, []string{"sku1", "sku2", "sku1"}, skus(days))
+
+		// from no meio do mês inclui o mês inteiro
+		months, err := store.Query(ctx, Query{TenantId: "t1", ProductSku: "sku1", Granularity: Month, From: date("2025-01-15T00:00:00Z"), To: date("2025-02-01T00:00:00Z")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2048"}, amounts(months))
+
+		other, err := store.Query(ctx, Query{TenantId: "t2", Granularity: Month, From: date("2025-01-01T00:00:00Z"), To: date("2026-01-01T00:00:00Z")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"7"}, amounts(other))
+
+		empty, err := store.Query(ctx, Query{TenantId: "t", Granularity: Month, From: date("2025-01-01T00:00:00Z"), To: date("2026-01-01T00:00:00Z")})
+		require.NoError(t, err)
+		assert.NotNil(t, empty)
+		assert.Empty(t, empty)
+	})
+
+	t.Run("ExactTotals", func(t *testing.T) {
+		store, _ := openTestStore(t)
+		// 10^12 B + 10^-6 B não é representável em float64
+		require.NoError(t, store.Record(ctx, date("2025-01-31T10:00:00Z"), []pulse.Pulse{
+			{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1000000000000"), UseUnit: pulse.B},
+		}))
+		require.NoError(t, store.Record(ctx, date("2025-01-31T10:30:00Z"), []pulse.Pulse{
+			{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("0.000001"), UseUnit: pulse.B},
+		}))
+		hours, err := store.Query(ctx, Query{TenantId: "t1", Granularity: Hour, From: date("2025-01-31T00:00:00Z"), To: date("2025-02-01T00:00:00Z")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1000000000000.000001"}, amounts(hours))
+	})
+
+	t.Run("LegacyFloatTotals", func(t *testing.T) {
+		legacy := binary.BigEndian.AppendUint64(nil, math.Float64bits(1.5))
+		amount, err := decodeAmount(legacy)
+		require.NoError(t, err)
+		assert.Equal(t, "1.5", amount.String())
+
+		amount, err = decodeAmount(encodeAmount(pulse.MustParseAmount("2.25")))
+		require.NoError(t, err)
+		assert.Equal(t, "2.25", amount.String())
+
+		_, err = decodeAmount([]byte{1, 2, 3})
+		assert.ErrorContains(t, err, "tamanho inválido")
+	})
+
+	t.Run("MaxAggregation", func(t *testing.T) {
+		registry, err := pulse.NewUnitRegistry(append(pulse.DefaultUnits(), pulse.UnitDefinition{Name: "conn", Dimension: "connections", Factor: 1, Aggregation: pulse.AggregationMax}))
+		require.NoError(t, err)
+		original := pulse.Units()
+		pulse.SetUnitRegistry(registry)
+		defer pulse.SetUnitRegistry(original)
+
+		store, _ := openTestStore(t)
+		for i, amount := range []pulse.Amount{pulse.MustParseAmount("30"), pulse.MustParseAmount("50"), pulse.MustParseAmount("20")} {
+			at := date("2025-01-31T10:00:00Z").Add(time.Duration(i) * time.Hour)
+			require.NoError(t, store.Record(ctx, at, []pulse.Pulse{{TenantId: "t1", ProductSku: "sku1", UsedAmount: amount, UseUnit: "conn"}}))
+		}
+		days, err := store.Query(ctx, Query{TenantId: "t1", Granularity: Day, From: date("2025-01-31T00:00:00Z"), To: date("2025-02-01T00:00:00Z")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"50"}, amounts(days))
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+		store, _ := openTestStore(t, WithRetention(Retention{Hour: 24 * time.Hour, Day: 0, Month: 0}))
+		require.NoError(t, store.Record(ctx, date("2025-01-01T10:00:00Z"), []pulse.Pulse{{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.B}}))
+		require.NoError(t, store.Record(ctx, date("2025-01-02T10:00:00Z"), []pulse.Pulse{{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.B}}))
+
+		removed, err := store.Prune(date("2025-01-02T12:00:00Z"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, removed)
+
+		hours, err := store.Query(ctx, Query{TenantId: "t1", Granularity: Hour, From: date("2025-01-01T00:00:00Z"), To: date("2025-01-03T00:00:00Z")})
+		require.NoError(t, err)
+		require.Len(t, hours, 1)
+		assert.Equal(t, date("2025-01-02T10:00:00Z"), hours[0].PeriodStart)
+		days, err := store.Query(ctx, Query{TenantId: "t1", Granularity: Day, From: date("2025-01-01T00:00:00Z"), To: date("2025-01-03T00:00:00Z")})
+		require.NoError(t, err)
+		assert.Len(t, days, 2)
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.db")
+		store, err := Open(path)
+		require.NoError(t, err)
+		require.NoError(t, store.Record(ctx, date("2025-01-01T10:00:00Z"), []pulse.Pulse{{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.B}}))
+
+		// o arquivo fica bloqueado enquanto o sender o mantém aberto
+		_, err = Open(path, WithReadOnly(), WithOpenTimeout(50*time.Millisecond))
+		assert.Error(t, err)
+		require.NoError(t, store.Close())
+
+		reader, err := Open(path, WithReadOnly())
+		require.NoError(t, err)
+		defer reader.Close()
+		entries, err := reader.Query(ctx, Query{TenantId: "t1", Granularity: Month, From: date("2025-01-01T00:00:00Z"), To: date("2025-02-01T00:00:00Z")})
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Error(t, reader.Record(ctx, time.Now(), []pulse.Pulse{{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.B}}))
+	})
+}
+
+func TestHistoryHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, _ := openTestStore(t)
+	require.NoError(t, store.Record(context.Background(), date("2025-01-31T10:00:00Z"), []pulse.Pulse{{TenantId: "t1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("10"), UseUnit: pulse.B}}))
+
+	h := &historyHandler{store: store, now: func() time.Time { return date("2025-02-10T00:00:00Z") }}
+	r := gin.New()
+	r.GET("/history/:tenant", h.Tenant())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/history/t1?granularity=month&from=2025-01", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "t1", report.TenantId)
+	assert.Equal(t, Month, report.Granularity)
+	assert.Equal(t, []string{"10"}, amounts(report.Entries))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/history/t1?granularity=week", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var problem pulse.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, pulse.ProblemTypeInvalidQuery, problem.Type)
+	assert.Contains(t, problem.Detail, "granularidade inválida")
+
+	require.NoError(t, store.Close())
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/history/t1", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func amounts(entries []Entry) []string {
+	var values []string
+	for _, e := range entries {
+		values = append(values, e.UsedAmount.String())
+	}
+	return values
+}
+
+func skus(entries []Entry) []string {
+	var values []string
+	for _, e := range entries {
+		values = append(values, e.ProductSku)
+	}
+	return values
+}
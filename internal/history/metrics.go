@@ -0,0 +1,38 @@
+package history
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	metricsRegistered = false
+	recordedPulses    = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "history_recorded_pulses_total",
+			Help: "Total de agregados entregues gravados no histórico",
+		},
+	)
+	writeErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "history_write_errors_total",
+			Help: "Total de lotes entregues que não puderam ser gravados no histórico",
+		},
+	)
+	prunedEntries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "history_pruned_entries_total",
+			Help: "Total de períodos apagados do histórico pela retenção",
+		},
+	)
+)
+
+func registerMetrics() {
+	if metricsRegistered {
+		return
+	}
+	metricsRegistered = true
+
+	prometheus.MustRegister(
+		recordedPulses,
+		writeErrors,
+		prunedEntries,
+	)
+}
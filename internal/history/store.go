@@ -0,0 +1,294 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultOpenTimeout é o tempo máximo de espera pelo arquivo, que fica bloqueado enquanto o sender o utiliza
+const DefaultOpenTimeout = time.Second
+
+// Store guarda o consumo entregue pelo sender acumulado por hora, dia e mês
+type Store interface {
+	// Record acumula os agregados entregues em at nos períodos de cada granularidade,
+	// somando ou mantendo o maior valor conforme a agregação da unidade
+	Record(ctx context.Context, at time.Time, pulses []pulse.Pulse) error
+
+	// Query retorna os períodos da granularidade que se sobrepõem a [From, To), ordenados por período, SKU e unidade
+	Query(ctx context.Context, q Query) ([]Entry, error)
+
+	// Prune apaga os períodos cujo fim é mais antigo que a retenção da granularidade e retorna quantos foram apagados
+	Prune(now time.Time) (int, error)
+
+	Close() error
+}
+
+type boltStore struct {
+	db          *bolt.DB
+	retention   Retention
+	readOnly    bool
+	openTimeout time.Duration
+}
+
+type StoreOptions func(*boltStore)
+
+// WithRetention define por quanto tempo cada granularidade é mantida por Prune
+func WithRetention(retention Retention) StoreOptions {
+	return func(s *boltStore) {
+		s.retention = retention
+	}
+}
+
+// WithReadOnly abre o arquivo apenas para consultas, permitindo leitores simultâneos.
+// Record e Prune retornam erro.
+func WithReadOnly() StoreOptions {
+	return func(s *boltStore) {
+		s.readOnly = true
+	}
+}
+
+// WithOpenTimeout define quanto tempo Open aguarda o arquivo ser liberado por outro processo
+func WithOpenTimeout(timeout time.Duration) StoreOptions {
+	return func(s *boltStore) {
+		s.openTimeout = timeout
+	}
+}
+
+// Open abre o histórico no arquivo informado, criando-o se necessário.
+// Cada granularidade é um bucket cujas chaves são <tenant>\x00<início do período><sku>\x00<unidade>,
+// o que mantém os períodos de um tenant contíguos e em ordem cronológica.
+func Open(path string, opts ...StoreOptions) (Store, error) {
+	registerMetrics()
+	s := &boltStore{openTimeout: DefaultOpenTimeout}
+	for _, opt := range opts {
+		opt(s)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: s.openTimeout, ReadOnly: s.readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir o histórico %s: %w", path, err)
+	}
+	s.db = db
+	if s.readOnly {
+		return s, nil
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, g := range Granularities {
+			if _, err := tx.CreateBucketIfNotExists([]byte(g)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("erro ao preparar o histórico %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func encodeKey(tenantId string, start time.Time, productSku string, unit pulse.PulseUnit) []byte {
+	key := append(tenantPrefix(tenantId), encodeTime(start)...)
+	key = append(key, productSku...)
+	key = append(key, 0)
+	return append(key, unit...)
+}
+
+func tenantPrefix(tenantId string) []byte {
+	return append([]byte(tenantId), 0)
+}
+
+func encodeTime(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.Unix()))
+}
+
+func decodeKey(key []byte) (tenantId string, start time.Time, productSku string, unit pulse.PulseUnit, ok bool) {
+	tenant, rest, found := bytes.Cut(key, []byte{0})
+	if !found || len(rest) < 8 {
+		return "", time.Time{}, "", "", false
+	}
+	start = time.Unix(int64(binary.BigEndian.Uint64(rest[:8])), 0).UTC()
+	sku, u, found := bytes.Cut(rest[8:], []byte{0})
+	if !found {
+		return "", time.Time{}, "", "", false
+	}
+	return string(tenant), start, string(sku), pulse.PulseUnit(u), true
+}
+
+// encodeAmount grava o total como a escala (um byte) seguida do inteiro em 10^-escala da unidade (veja pulse.Amount)
+func encodeAmount(amount pulse.Amount) []byte {
+	return binary.BigEndian.AppendUint64([]byte{byte(pulse.AmountScale())}, uint64(amount.Units()))
+}
+
+// decodeAmount lê o total na escala em uso. Os totais de 8 bytes, gravados por versões anteriores,
+// guardam um número em ponto flutuante, que é arredondado para a escala.
+func decodeAmount(value []byte) (pulse.Amount, error) {
+	switch len(value) {
+	case 9:
+		return pulse.AmountFromUnits(int64(binary.BigEndian.Uint64(value[1:]))).Rescale(int(value[0]), pulse.AmountScale())
+	case 8:
+		return pulse.AmountFromFloat(math.Float64frombits(binary.BigEndian.Uint64(value)))
+	}
+	return pulse.Amount{}, fmt.Errorf("total do histórico com tamanho inválido: %d bytes", len(value))
+}
+
+func (s *boltStore) Record(ctx context.Context, at time.Time, pulses []pulse.Pulse) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(pulses) == 0 {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, g := range Granularities {
+			bucket := tx.Bucket([]byte(g))
+			if bucket == nil {
+				return fmt.Errorf("bucket %s não encontrado", g)
+			}
+			start := g.Start(at)
+			for _, p := range pulses {
+				key := encodeKey(p.TenantId, start, p.ProductSku, p.UseUnit)
+				amount := p.UsedAmount
+				if previous := bucket.Get(key); previous != nil {
+					total, err := decodeAmount(previous)
+					if err != nil {
+						return fmt.Errorf("tenant %s, SKU %s: %w", p.TenantId, p.ProductSku, err)
+					}
+					if amount, err = combine(p.UseUnit, total, amount); err != nil {
+						return fmt.Errorf("tenant %s, SKU %s: %w", p.TenantId, p.ProductSku, err)
+					}
+				}
+				if err := bucket.Put(key, encodeAmount(amount)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeErrors.Inc()
+		return fmt.Errorf("erro ao gravar o histórico: %w", err)
+	}
+	recordedPulses.Add(float64(len(pulses)))
+	return nil
+}
+
+// combine soma os valores, ou mantém o maior nas unidades com agregação max
+func combine(unit pulse.PulseUnit, a, b pulse.Amount) (pulse.Amount, error) {
+	if unit.Aggregation() == pulse.AggregationMax {
+		return a.Max(b), nil
+	}
+	return a.Add(b)
+}
+
+func (s *boltStore) Query(ctx context.Context, q Query) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	prefix := tenantPrefix(q.TenantId)
+	seek := append(tenantPrefix(q.TenantId), encodeTime(q.Granularity.Start(q.From))...)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(q.Granularity))
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			_, start, sku, unit, ok := decodeKey(k)
+			if !ok {
+				continue
+			}
+			if !start.Before(q.To) {
+				break
+			}
+			if q.ProductSku != "" && sku != q.ProductSku {
+				continue
+			}
+			amount, err := decodeAmount(v)
+			if err != nil {
+				return fmt.Errorf("SKU %s em %s: %w", sku, start.Format(time.RFC3339), err)
+			}
+			entry := Entry{
+				ProductSku:  sku,
+				UseUnit:     unit,
+				PeriodStart: start,
+				PeriodEnd:   q.Granularity.End(start),
+				UsedAmount:  amount,
+			}
+			entry.DisplayAmount, entry.DisplayUnit = unit.Humanize(amount.Float64())
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar o histórico: %w", err)
+	}
+	return entries, nil
+}
+
+func (s *boltStore) Prune(now time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, g := range Granularities {
+			retention := s.retention.For(g)
+			bucket := tx.Bucket([]byte(g))
+			if retention <= 0 || bucket == nil {
+				continue
+			}
+			cutoff := now.Add(-retention)
+			var expired [][]byte
+			err := bucket.ForEach(func(k, _ []byte) error {
+				_, start, _, _, ok := decodeKey(k)
+				if ok && !g.End(start).After(cutoff) {
+					expired = append(expired, bytes.Clone(k))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expired {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+			removed += len(expired)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("erro ao apagar períodos expirados do histórico: %w", err)
+	}
+	prunedEntries.Add(float64(removed))
+	return removed, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// RunPruning aplica a retenção do histórico a cada interval, até o contexto ser cancelado
+func RunPruning(ctx context.Context, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if removed, err := store.Prune(time.Now()); err != nil {
+			log.Error().Err(err).Msg("Erro ao aplicar a retenção do histórico")
+		} else if removed > 0 {
+			log.Info().Int("removed", removed).Msg("Períodos expirados removidos do histórico")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package keycodec codifica os identificadores (tenant, SKU, unidade) que compõem as chaves e os campos no Redis.
+//
+// Os separadores e os caracteres especiais das chaves são escapados como %XX (hexadecimal maiúsculo),
+// então um identificador com ":" ou "{" não se confunde com os separadores e pode ser recuperado exatamente
+// a partir da chave. Os caracteres de padrão do SCAN também são escapados, para que um identificador
+// nunca seja interpretado como curinga.
+package keycodec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Separator separa os componentes de uma chave ou de um campo
+const Separator = ":"
+
+// reserved são os caracteres escapados por Escape: o próprio escape, o separador,
+// as chaves da hash tag do Redis Cluster e os curingas do SCAN
+const reserved = "%:{}*?[]\\"
+
+const hexDigits = "0123456789ABCDEF"
+
+// Erros retornados pelo codec
+var (
+	ErrEmpty          = errors.New("identificador vazio")
+	ErrInvalidUTF8    = errors.New("identificador não é UTF-8 válido")
+	ErrControl        = errors.New("identificador contém caracteres de controle")
+	ErrInvalidEscape  = errors.New("sequência de escape inválida")
+	ErrUnescaped      = errors.New("caractere reservado sem escape")
+	ErrComponentCount = errors.New("quantidade de componentes inválida")
+)
+
+// Validate indica se o identificador pode ser representado em uma chave.
+// Identificadores vazios, com UTF-8 inválido ou com caracteres de controle são rejeitados,
+// pois não seriam recuperados de forma legível (ou única) a partir da chave.
+func Validate(id string) error {
+	switch {
+	case id == "":
+		return ErrEmpty
+	case !utf8.ValidString(id):
+		return ErrInvalidUTF8
+	case strings.IndexFunc(id, unicode.IsControl) >= 0:
+		return ErrControl
+	}
+	return nil
+}
+
+// Escape codifica o identificador, escapando os caracteres reservados como %XX
+func Escape(id string) string {
+	if !strings.ContainsAny(id, reserved) {
+		return id
+	}
+	var b strings.Builder
+	b.Grow(len(id) + 8)
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if strings.IndexByte(reserved, c) >= 0 {
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0x0F])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// Unescape decodifica um identificador gerado por Escape.
+// Apenas a forma produzida por Escape é aceita: escapes de caracteres não reservados, hexadecimal minúsculo
+// ou caracteres reservados sem escape retornam erro, então cada identificador tem uma única codificação.
+func Unescape(encoded string) (string, error) {
+	if !strings.ContainsAny(encoded, reserved) {
+		return encoded, nil
+	}
+	var b strings.Builder
+	b.Grow(len(encoded))
+	for i := 0; i < len(encoded); i++ {
+		c := encoded[i]
+		if c != '%' {
+			if strings.IndexByte(reserved, c) >= 0 {
+				return "", fmt.Errorf("%w: %q", ErrUnescaped, c)
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(encoded) {
+			return "", ErrInvalidEscape
+		}
+		hi, lo := strings.IndexByte(hexDigits, encoded[i+1]), strings.IndexByte(hexDigits, encoded[i+2])
+		if hi < 0 || lo < 0 {
+			return "", fmt.Errorf("%w: %q", ErrInvalidEscape, encoded[i:i+3])
+		}
+		decoded := byte(hi<<4 | lo)
+		if strings.IndexByte(reserved, decoded) < 0 {
+			return "", fmt.Errorf("%w: %q", ErrInvalidEscape, encoded[i:i+3])
+		}
+		b.WriteByte(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// Join codifica os identificadores e os une com Separator
+func Join(ids ...string) string {
+	encoded := make([]string, len(ids))
+	for i, id := range ids {
+		encoded[i] = Escape(id)
+	}
+	return strings.Join(encoded, Separator)
+}
+
+// Split separa e decodifica exatamente n identificadores unidos por Join.
+// Componentes vazios retornam ErrEmpty.
+func Split(joined string, n int) ([]string, error) {
+	parts := strings.Split(joined, Separator)
+	if len(parts) != n {
+		return nil, fmt.Errorf("%w: esperados %d, recebidos %d", ErrComponentCount, n, len(parts))
+	}
+	for i, part := range parts {
+		if part == "" {
+			return nil, ErrEmpty
+		}
+		id, err := Unescape(part)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = id
+	}
+	return parts, nil
+}
@@ -0,0 +1,92 @@
+package keycodec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, "tenant1", Escape("tenant1"))
+	assert.Equal(t, "org%3Atenant1", Escape("org:tenant1"))
+	assert.Equal(t, "%7Ba%7D%2A%25", Escape("{a}*%"))
+	assert.Equal(t, "%3F%5B%5D%5C", Escape(`?[]\`))
+
+	for _, id := range []string{"tenant1", "org:tenant1", "{a}*%", "100%", "é:ç"} {
+		decoded, err := Unescape(Escape(id))
+		require.NoError(t, err, id)
+		assert.Equal(t, id, decoded)
+	}
+}
+
+func TestUnescape_Invalid(t *testing.T) {
+	for _, encoded := range []string{"a:b", "a{b", "%", "%3", "%3a", "%ZZ", "%41", "a%2"} {
+		_, err := Unescape(encoded)
+		assert.Error(t, err, encoded)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("org:tenant1"))
+	assert.ErrorIs(t, Validate(""), ErrEmpty)
+	assert.ErrorIs(t, Validate("a\xffb"), ErrInvalidUTF8)
+	assert.ErrorIs(t, Validate("a\nb"), ErrControl)
+}
+
+func TestJoinSplit(t *testing.T) {
+	joined := Join("SKU:1", "B/sec")
+	assert.Equal(t, "SKU%3A1:B/sec", joined)
+	parts, err := Split(joined, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SKU:1", "B/sec"}, parts)
+
+	_, err = Split("a:b:c", 2)
+	assert.ErrorIs(t, err, ErrComponentCount)
+	_, err = Split("a:", 2)
+	assert.ErrorIs(t, err, ErrEmpty)
+	_, err = Split("a:%zz", 2)
+	assert.ErrorIs(t, err, ErrInvalidEscape)
+}
+
+func FuzzEscapeRoundTrip(f *testing.F) {
+	for _, seed := range []string{"tenant1", "org:tenant1", "{a}", "100%", "%3A", "*?[]\\", "é:ç", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, id string) {
+		encoded := Escape(id)
+		if strings.ContainsAny(encoded, ":{}*?[]\\") {
+			t.Fatalf("Escape(%q) = %q contém caracteres reservados", id, encoded)
+		}
+		decoded, err := Unescape(encoded)
+		if err != nil {
+			t.Fatalf("Unescape(Escape(%q)): %v", id, err)
+		}
+		if decoded != id {
+			t.Fatalf("Unescape(Escape(%q)) = %q", id, decoded)
+		}
+		// a codificação é única: toda chave aceita por Unescape é a codificação do identificador decodificado
+		if decoded, err := Unescape(id); err == nil && Escape(decoded) != id {
+			t.Fatalf("Escape(Unescape(%q)) = %q", id, Escape(decoded))
+		}
+	})
+}
+
+func FuzzJoinSplit(f *testing.F) {
+	f.Add("SKU-1", "KB")
+	f.Add("SKU:1", "B/sec")
+	f.Add("a%3Ab", "::")
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if a == "" || b == "" {
+			t.Skip()
+		}
+		parts, err := Split(Join(a, b), 2)
+		if err != nil {
+			t.Fatalf("Split(Join(%q, %q)): %v", a, b, err)
+		}
+		if parts[0] != a || parts[1] != b {
+			t.Fatalf("Split(Join(%q, %q)) = %q", a, b, parts)
+		}
+	})
+}
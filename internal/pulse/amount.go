@@ -0,0 +1,299 @@
+package pulse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+)
+
+// Limites da escala dos valores em ponto fixo
+const (
+	// DefaultAmountScale é a escala padrão: os valores são guardados em milionésimos da unidade
+	DefaultAmountScale = 6
+	// MaxAmountScale é a maior escala aceita; escalas maiores reduzem o maior valor representável
+	// para menos de 9,2 milhões de unidades
+	MaxAmountScale = 12
+)
+
+// Erros retornados na conversão dos valores
+var (
+	ErrAmountOverflow  = errors.New("valor excede o limite representável na escala")
+	ErrAmountPrecision = errors.New("valor tem mais casas decimais que a escala")
+	ErrAmountSyntax    = errors.New("valor não é um número")
+)
+
+var amountScale atomic.Int32
+
+// decimalPattern é o formato aceito por ParseAmount: sinal, parte inteira, parte decimal e expoente
+var decimalPattern = regexp.MustCompile(`^([+-]?)([0-9]*)(?:\.([0-9]*))?(?:[eE]([+-]?[0-9]+))?$`)
+
+// maxDecimalExponent limita o expoente aceito por ParseAmount; expoentes maiores sempre transbordam
+// ou excedem a escala, exceto em números com milhares de dígitos
+const maxDecimalExponent = 1000
+
+func init() {
+	amountScale.Store(DefaultAmountScale)
+}
+
+// AmountScale retorna a escala em uso: a quantidade de casas decimais guardadas em cada Amount
+func AmountScale() int {
+	return int(amountScale.Load())
+}
+
+// SetAmountScale substitui a escala em uso. Deve ser chamada na inicialização, antes de qualquer Amount ser criado,
+// pois os valores já criados continuam na escala anterior.
+func SetAmountScale(scale int) error {
+	if scale < 0 || scale > MaxAmountScale {
+		return fmt.Errorf("escala deve estar entre 0 e %d, recebido: %d", MaxAmountScale, scale)
+	}
+	amountScale.Store(int32(scale))
+	return nil
+}
+
+// Amount é um valor decimal em ponto fixo: um inteiro de 64 bits em 10^-AmountScale() da unidade.
+// As somas são exatas e retornam erro em vez de perder precisão ou transbordar.
+type Amount struct {
+	units int64
+}
+
+// AmountFromUnits cria o valor a partir da quantidade de 10^-AmountScale() da unidade
+func AmountFromUnits(units int64) Amount {
+	return Amount{units: units}
+}
+
+// AmountFromInt cria o valor inteiro n
+func AmountFromInt(n int64) (Amount, error) {
+	return AmountFromUnits(n).Rescale(0, AmountScale())
+}
+
+// MustParseAmount é como ParseAmount, mas entra em pânico se o valor for inválido. Utilizado em valores fixos.
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// ParseAmount interpreta um número decimal (ex.: "3.5", "-2", "1e3") sem perda de precisão.
+// Retorna ErrAmountPrecision se o número tiver mais casas decimais que a escala e ErrAmountOverflow
+// se não couber em 64 bits.
+func ParseAmount(s string) (Amount, error) {
+	m := decimalPattern.FindStringSubmatch(s)
+	if m == nil || m[2]+m[3] == "" {
+		return Amount{}, fmt.Errorf("%w: %q", ErrAmountSyntax, s)
+	}
+	negative, integer, fraction, exponent := m[1] == "-", m[2], m[3], m[4]
+	digits := strings.TrimLeft(integer+fraction, "0")
+	if digits == "" {
+		return Amount{}, nil
+	}
+	// o valor é digits * 10^shift unidades da escala; o expoente é limitado antes de qualquer cálculo,
+	// para que um expoente enorme não aloque um inteiro do mesmo tamanho
+	exp := 0
+	if exponent != "" {
+		var err error
+		exp, err = strconv.Atoi(exponent)
+		if err != nil || exp > maxDecimalExponent || exp < -maxDecimalExponent {
+			if strings.HasPrefix(exponent, "-") {
+				return Amount{}, fmt.Errorf("%w (%d): %s", ErrAmountPrecision, AmountScale(), s)
+			}
+			return Amount{}, fmt.Errorf("%w (%d): %s", ErrAmountOverflow, AmountScale(), s)
+		}
+	}
+	shift := exp - len(fraction) + AmountScale()
+	if shift < 0 {
+		trimmed := strings.TrimRight(digits, "0")
+		if len(digits)-len(trimmed) < -shift {
+			return Amount{}, fmt.Errorf("%w (%d): %s", ErrAmountPrecision, AmountScale(), s)
+		}
+		digits, shift = digits[:len(digits)+shift], 0
+	}
+	if len(digits)+shift > 19 {
+		return Amount{}, fmt.Errorf("%w (%d): %s", ErrAmountOverflow, AmountScale(), s)
+	}
+	n, _ := new(big.Int).SetString(digits+strings.Repeat("0", shift), 10)
+	if negative {
+		n.Neg(n)
+	}
+	return fromInt(n, s)
+}
+
+// AmountFromFloat converte um valor em ponto flutuante, arredondando-o para a escala
+func AmountFromFloat(f float64) (Amount, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Amount{}, fmt.Errorf("%w: %g", ErrAmountSyntax, f)
+	}
+	r := new(big.Rat).SetFloat64(f)
+	r.Mul(r, new(big.Rat).SetInt(pow10(AmountScale())))
+	return fromInt(round(r), strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// ParseScaledAmount interpreta um inteiro em 10^-scale da unidade (ex.: o valor de um campo no Redis)
+// e o converte para a escala em uso
+func ParseScaledAmount(s string, scale int) (Amount, error) {
+	units, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return Amount{}, fmt.Errorf("%w: %s", ErrAmountOverflow, s)
+		}
+		return Amount{}, fmt.Errorf("%w: %q", ErrAmountSyntax, s)
+	}
+	return AmountFromUnits(units).Rescale(scale, AmountScale())
+}
+
+// ParseFieldAmount interpreta o valor de um campo do hash do tenant gravado na escala informada
+// (veja generation.ParseField). Os campos sem escala guardam um número em ponto flutuante,
+// arredondado para a escala em uso.
+func ParseFieldAmount(raw string, scale int) (Amount, error) {
+	if scale == generation.FloatScale {
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return Amount{}, fmt.Errorf("%w: %q", ErrAmountSyntax, raw)
+		}
+		return AmountFromFloat(f)
+	}
+	return ParseScaledAmount(raw, scale)
+}
+
+// Rescale converte o valor, interpretado na escala from, para a escala to.
+// Retorna ErrAmountPrecision se a escala to não comportar as casas decimais do valor.
+func (a Amount) Rescale(from, to int) (Amount, error) {
+	if from == to {
+		return a, nil
+	}
+	r := new(big.Rat).SetInt64(a.units)
+	if to > from {
+		r.Mul(r, new(big.Rat).SetInt(pow10(to-from)))
+	} else {
+		r.Quo(r, new(big.Rat).SetInt(pow10(from-to)))
+		if !r.IsInt() {
+			return Amount{}, fmt.Errorf("%w (%d): %d na escala %d", ErrAmountPrecision, to, a.units, from)
+		}
+	}
+	return fromInt(r.Num(), strconv.FormatInt(a.units, 10))
+}
+
+// Units retorna o valor em 10^-AmountScale() da unidade, como é guardado no Redis
+func (a Amount) Units() int64 {
+	return a.units
+}
+
+// Sign retorna -1, 0 ou 1 conforme o sinal do valor
+func (a Amount) Sign() int {
+	switch {
+	case a.units < 0:
+		return -1
+	case a.units > 0:
+		return 1
+	}
+	return 0
+}
+
+// Add retorna a soma dos valores ou ErrAmountOverflow
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a.units + b.units
+	if (b.units > 0 && sum < a.units) || (b.units < 0 && sum > a.units) {
+		return Amount{}, fmt.Errorf("%w: %s + %s", ErrAmountOverflow, a, b)
+	}
+	return Amount{units: sum}, nil
+}
+
+// Max retorna o maior dos valores
+func (a Amount) Max(b Amount) Amount {
+	if b.units > a.units {
+		return b
+	}
+	return a
+}
+
+// Mul multiplica o valor por factor (ex.: o fator de conversão de uma unidade), arredondando o resultado para a escala.
+// Fatores inteiros, como os das unidades padrão, não arredondam.
+func (a Amount) Mul(factor float64) (Amount, error) {
+	if math.IsNaN(factor) || math.IsInf(factor, 0) {
+		return Amount{}, fmt.Errorf("%w: fator %g", ErrAmountSyntax, factor)
+	}
+	r := new(big.Rat).SetInt64(a.units)
+	r.Mul(r, new(big.Rat).SetFloat64(factor))
+	return fromInt(round(r), fmt.Sprintf("%s * %g", a, factor))
+}
+
+// Float64 retorna o valor aproximado em ponto flutuante, para exibição e comparações
+func (a Amount) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(big.NewInt(a.units), pow10(AmountScale())).Float64()
+	return f
+}
+
+// String retorna o valor exato em notação decimal, sem zeros à direita (ex.: "3.5")
+func (a Amount) String() string {
+	scale := AmountScale()
+	digits := strconv.FormatInt(a.units, 10)
+	sign := ""
+	if a.units < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	integer, fraction := digits[:len(digits)-scale], strings.TrimRight(digits[len(digits)-scale:], "0")
+	if fraction == "" {
+		return sign + integer
+	}
+	return sign + integer + "." + fraction
+}
+
+// MarshalJSON escreve o valor como número JSON, sem perda de precisão
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON interpreta um número JSON com ParseAmount. Strings e outros tipos são recusados.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] == '"' || data[0] == '{' || data[0] == '[' || bytes.Equal(data, []byte("true")) || bytes.Equal(data, []byte("false")) {
+		return fmt.Errorf("%w: %s", ErrAmountSyntax, data)
+	}
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	parsed, err := ParseAmount(string(data))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func fromInt(n *big.Int, value string) (Amount, error) {
+	if !n.IsInt64() {
+		return Amount{}, fmt.Errorf("%w (%d): %s", ErrAmountOverflow, AmountScale(), value)
+	}
+	return Amount{units: n.Int64()}, nil
+}
+
+// round arredonda r para o inteiro mais próximo, com as metades para longe do zero
+func round(r *big.Rat) *big.Int {
+	num, den := new(big.Int).Set(r.Num()), r.Denom()
+	twice := new(big.Int).Mul(num, big.NewInt(2))
+	if num.Sign() < 0 {
+		twice.Sub(twice, den)
+	} else {
+		twice.Add(twice, den)
+	}
+	return twice.Quo(twice, new(big.Int).Mul(den, big.NewInt(2)))
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
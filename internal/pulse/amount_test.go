@@ -0,0 +1,232 @@
+package pulse
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input string
+		units int64
+		str   string
+	}{
+		{"0", 0, "0"},
+		{"3.5", 3500000, "3.5"},
+		{"0.000001", 1, "0.000001"},
+		{"-2", -2000000, "-2"},
+		{"1e3", 1000000000, "1000"},
+		{"1.5E-3", 1500, "0.0015"},
+		{"0.1000000", 100000, "0.1"},
+		{"0e999999999999", 0, "0"},
+		{"12000e-9", 12, "0.000012"},
+		{"9223372036854.775807", math.MaxInt64, "9223372036854.775807"},
+		{"-9223372036854.775808", math.MinInt64, "-9223372036854.775808"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			amount, err := ParseAmount(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.units, amount.Units())
+			assert.Equal(t, tt.str, amount.String())
+		})
+	}
+
+	for input, want := range map[string]error{
+		"0.0000001":            ErrAmountPrecision,
+		"1e-7":                 ErrAmountPrecision,
+		"9223372036854.775808": ErrAmountOverflow,
+		"1e400":                ErrAmountOverflow,
+		"-1e400":               ErrAmountOverflow,
+		"abc":                  ErrAmountSyntax,
+		"1/3":                  ErrAmountSyntax,
+		"0x10":                 ErrAmountSyntax,
+		"Inf":                  ErrAmountSyntax,
+		"":                     ErrAmountSyntax,
+		".":                    ErrAmountSyntax,
+		"e5":                   ErrAmountSyntax,
+		"1e999999999999":       ErrAmountOverflow,
+		"1e-999999999999":      ErrAmountPrecision,
+	} {
+		_, err := ParseAmount(input)
+		assert.ErrorIs(t, err, want, input)
+	}
+}
+
+func TestAmountScale(t *testing.T) {
+	defer SetAmountScale(DefaultAmountScale)
+
+	assert.Error(t, SetAmountScale(-1))
+	assert.Error(t, SetAmountScale(MaxAmountScale+1))
+	assert.Equal(t, DefaultAmountScale, AmountScale())
+
+	require.NoError(t, SetAmountScale(2))
+	amount := MustParseAmount("12.34")
+	assert.Equal(t, int64(1234), amount.Units())
+	assert.Equal(t, "12.34", amount.String())
+	_, err := ParseAmount("0.001")
+	assert.ErrorIs(t, err, ErrAmountPrecision)
+
+	require.NoError(t, SetAmountScale(0))
+	assert.Equal(t, "42", MustParseAmount("42").String())
+}
+
+func TestAmountFromFloat(t *testing.T) {
+	amount, err := AmountFromFloat(0.1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100000), amount.Units())
+
+	amount, err = AmountFromFloat(2.0000005)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000001), amount.Units(), "metade arredondada para longe do zero")
+
+	amount, err = AmountFromFloat(-2.0000005)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-2000001), amount.Units())
+
+	_, err = AmountFromFloat(math.NaN())
+	assert.ErrorIs(t, err, ErrAmountSyntax)
+	_, err = AmountFromFloat(1e15)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+}
+
+func TestParseFieldAmount(t *testing.T) {
+	amount, err := ParseFieldAmount("1500", 3)
+	require.NoError(t, err)
+	assert.Equal(t, MustParseAmount("1.5"), amount)
+
+	amount, err = ParseFieldAmount("15", 0)
+	require.NoError(t, err)
+	assert.Equal(t, MustParseAmount("15"), amount)
+
+	amount, err = ParseFieldAmount("1500000000", 9)
+	require.NoError(t, err)
+	assert.Equal(t, MustParseAmount("1.5"), amount)
+
+	_, err = ParseFieldAmount("1500000001", 9)
+	assert.ErrorIs(t, err, ErrAmountPrecision, "casas além da escala em uso não são descartadas")
+
+	amount, err = ParseFieldAmount("0.30000000000000004", generation.FloatScale)
+	require.NoError(t, err)
+	assert.Equal(t, MustParseAmount("0.3"), amount)
+
+	_, err = ParseFieldAmount("99999999999999999999", 6)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+	_, err = ParseFieldAmount("1.5", 6)
+	assert.ErrorIs(t, err, ErrAmountSyntax)
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	sum, err := MustParseAmount("0.1").Add(MustParseAmount("0.2"))
+	require.NoError(t, err)
+	assert.Equal(t, MustParseAmount("0.3"), sum)
+
+	_, err = AmountFromUnits(math.MaxInt64).Add(AmountFromUnits(1))
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+	_, err = AmountFromUnits(math.MinInt64).Add(AmountFromUnits(-1))
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+
+	assert.Equal(t, MustParseAmount("2"), MustParseAmount("2").Max(MustParseAmount("1.999999")))
+
+	product, err := MustParseAmount("1.5").Mul(1024)
+	require.NoError(t, err)
+	assert.Equal(t, MustParseAmount("1536"), product)
+	_, err = MustParseAmount("9000000").Mul(1 << 30)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+
+	amount, err := AmountFromInt(7)
+	require.NoError(t, err)
+	assert.Equal(t, MustParseAmount("7"), amount)
+	assert.Equal(t, 1, amount.Sign())
+	assert.Equal(t, 7.0, amount.Float64())
+}
+
+func TestAmountJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Amount Amount `json:"amount"`
+	}{MustParseAmount("1234567.000001")})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"amount":1234567.000001}`, string(data))
+	assert.Contains(t, string(data), "1234567.000001", "sem notação exponencial nem arredondamento")
+
+	var decoded struct {
+		Amount Amount `json:"amount"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":0.000001}`), &decoded))
+	assert.Equal(t, int64(1), decoded.Amount.Units())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":"1"}`), &decoded))
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":1e-9}`), &decoded))
+}
+
+// TestAmount_ExactSums mostra que a soma de milhões de pulsos não acumula erro, ao contrário de float64
+func TestAmount_ExactSums(t *testing.T) {
+	const pulses = 10_000_000
+	amount := MustParseAmount("0.1")
+
+	var exact Amount
+	var float float64
+	for i := 0; i < pulses; i++ {
+		var err error
+		if exact, err = exact.Add(amount); err != nil {
+			t.Fatal(err)
+		}
+		float += 0.1
+	}
+
+	assert.Equal(t, "1000000", exact.String())
+	assert.Equal(t, MustParseAmount("1000000"), exact)
+	assert.NotEqual(t, 1_000_000.0, float, "float64 acumula erro de arredondamento")
+
+	// valores com todas as casas da escala
+	exact, amount = Amount{}, MustParseAmount("1.000001")
+	for i := 0; i < pulses; i++ {
+		var err error
+		if exact, err = exact.Add(amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, "10000010", exact.String())
+}
+
+func FuzzAmountRoundTrip(f *testing.F) {
+	for _, seed := range []int64{0, 1, -1, 3500000, math.MaxInt64, math.MinInt64} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, units int64) {
+		amount := AmountFromUnits(units)
+		parsed, err := ParseAmount(amount.String())
+		if err != nil || parsed != amount {
+			t.Fatalf("ParseAmount(%q) = %v, %v", amount.String(), parsed, err)
+		}
+		data, err := json.Marshal(amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Amount
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded != amount {
+			t.Fatalf("json %s = %v, %v", data, decoded, err)
+		}
+	})
+}
+
+func FuzzParseAmount(f *testing.F) {
+	for _, seed := range []string{"3.5", "-0.000001", "1e3", "12000e-9", "1e400", "0.1000000", ".5", "1e-999999999999"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		amount, err := ParseAmount(s)
+		if err != nil {
+			return
+		}
+		parsed, err := ParseAmount(amount.String())
+		if err != nil || parsed != amount {
+			t.Fatalf("ParseAmount(%q) = %v, mas ParseAmount(%q) = %v, %v", s, amount, amount.String(), parsed, err)
+		}
+	})
+}
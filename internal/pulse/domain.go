@@ -2,39 +2,36 @@ package pulse
 
 import "fmt"
 
+// PulseUnit é o nome de uma unidade registrada no registro de unidades (veja UnitRegistry).
+// As constantes abaixo são as unidades do registro padrão.
 type PulseUnit string
 
 const (
+	B      PulseUnit = "B"
 	KB     PulseUnit = "KB"
 	MB     PulseUnit = "MB"
 	GB     PulseUnit = "GB"
+	BxSec  PulseUnit = "B/sec"
 	KBxSec PulseUnit = "KB/sec"
 	MBxSec PulseUnit = "MB/sec"
 	GBxSec PulseUnit = "GB/sec"
 )
 
-// Valida se o tipo da unidade informada é válida
-func (p PulseUnit) IsValid() bool {
-	validUnits := map[PulseUnit]bool{
-		KB: true, MB: true, GB: true,
-		KBxSec: true, MBxSec: true, GBxSec: true,
-	}
-	return validUnits[p]
-}
-
 type Pulse struct {
-	// TenantId é o ID do cliente que está utilizando o produto
-	TenantId   string    `json:"tenant_id" binding:"required"`
-	// ProductSku é o SKU do produto, geralmente segue o padrão "SKU-<numero>"
-	ProductSku string    `json:"product_sku" binding:"required"`
-	// UsedAmount é o valor utilizado do produto
-	UsedAmount float64   `json:"used_amount" binding:"required"`
-	// UseUnit é a unidade utilizada para o valor utilizado do produto
-	UseUnit    PulseUnit `json:"use_unit" binding:"required"`
+	// TenantId é o ID do cliente que está utilizando o produto. Aceita letras, números, "_", "." e "-", começando com letra ou número.
+	TenantId   string    `json:"tenant_id" validate:"required" minLength:"1" maxLength:"128" example:"tenant_xpto"`
+	// ProductSku é o SKU do produto, geralmente segue o padrão "SKU-<numero>". Aceita os mesmos caracteres de TenantId.
+	ProductSku string    `json:"product_sku" validate:"required" minLength:"1" maxLength:"64" example:"SKU-77"`
+	// UsedAmount é o valor utilizado do produto; deve ser maior ou igual a 0, no máximo 1e15 e ter no máximo
+	// 6 casas decimais, ou a escala configurada em amount.scale. Com a escala 6, o maior valor representável,
+	// também depois de convertido para a unidade canônica, é 9223372036854.775807.
+	UsedAmount Amount    `json:"used_amount" validate:"required" swaggertype:"number" minimum:"0" maximum:"9223372036854.775807" example:"3.5"`
+	// UseUnit é a unidade utilizada para o valor utilizado do produto, uma das unidades listadas em GET /units
+	UseUnit    PulseUnit `json:"use_unit" validate:"required" swaggertype:"string" example:"KB"`
 }
 
 // Cria um novo objeto Pulse com os parâmetros informados
-func NewPulse(tenantId, productSku string, usedAmount float64, useUnit PulseUnit) (*Pulse, error) {
+func NewPulse(tenantId, productSku string, usedAmount Amount, useUnit PulseUnit) (*Pulse, error) {
 	if !useUnit.IsValid() {
 		return nil, fmt.Errorf("unrecognized pulse unit: %s", useUnit)
 	}
@@ -45,3 +42,16 @@ func NewPulse(tenantId, productSku string, usedAmount float64, useUnit PulseUnit
 		UseUnit:    useUnit,
 	}, nil
 }
+
+// Normalize retorna o pulso com o valor convertido para a unidade canônica da sua dimensão.
+// O valor é arredondado para a escala quando o fator da unidade não é inteiro.
+func (p Pulse) Normalize() (Pulse, error) {
+	base := p.UseUnit.Base()
+	amount, err := p.UseUnit.ConvertAmount(p.UsedAmount, base)
+	if err != nil {
+		return p, err
+	}
+	p.UsedAmount = amount
+	p.UseUnit = base
+	return p, nil
+}
@@ -1,23 +1,26 @@
 package pulse
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/keycodec"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewPulse(t *testing.T) {
 	t.Run("ValidPulse", func(t *testing.T) {
-		pulse, err := NewPulse("tenant1", "sku1", 100.0, KB)
+		pulse, err := NewPulse("tenant1", "sku1", MustParseAmount("100"), KB)
 		assert.NoError(t, err)
 		assert.Equal(t, "tenant1", pulse.TenantId)
 		assert.Equal(t, "sku1", pulse.ProductSku)
-		assert.Equal(t, 100.0, pulse.UsedAmount)
+		assert.Equal(t, MustParseAmount("100"), pulse.UsedAmount)
 		assert.Equal(t, KB, pulse.UseUnit)
 	})
 
 	t.Run("InvalidUseUnit", func(t *testing.T) {
-		pulse, err := NewPulse("tenant1", "sku1", 100.0, "INVALID")
+		pulse, err := NewPulse("tenant1", "sku1", MustParseAmount("100"), "INVALID")
 		assert.Error(t, err)
 		assert.Nil(t, pulse)
 		assert.Contains(t, err.Error(), "unrecognized pulse unit: INVALID")
@@ -35,6 +38,8 @@ func TestPulseUnit_IsValid(t *testing.T) {
 		{KBxSec, true},
 		{MBxSec, true},
 		{GBxSec, true},
+		{B, true},
+		{BxSec, true},
 		{"INVALID", false},
 	}
 	for _, tt := range tests {
@@ -43,4 +48,155 @@ func TestPulseUnit_IsValid(t *testing.T) {
 			assert.Equal(t, tt.want, got)
 		})
 	}
-}
\ No newline at end of file
+}
+func TestPulseUnit_Convert(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    PulseUnit
+		to      PulseUnit
+		amount  float64
+		want    float64
+		wantErr string
+	}{
+		{name: "KBToB", from: KB, to: B, amount: 1, want: 1024},
+		{name: "GBToMB", from: GB, to: MB, amount: 2, want: 2048},
+		{name: "BToKB", from: B, to: KB, amount: 512, want: 0.5},
+		{name: "MBxSecToBxSec", from: MBxSec, to: BxSec, amount: 1, want: 1 << 20},
+		{name: "SameUnit", from: MB, to: MB, amount: 3.5, want: 3.5},
+		{name: "DifferentDimensions", from: MB, to: MBxSec, amount: 1, wantErr: "cannot convert MB (volume) to MB/sec (rate)"},
+		{name: "InvalidFrom", from: "TB", to: B, amount: 1, wantErr: "unrecognized pulse unit: TB"},
+		{name: "InvalidTo", from: B, to: "TB", amount: 1, wantErr: "unrecognized pulse unit: TB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.from.Convert(tt.amount, tt.to)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPulseUnit_ConvertAmount(t *testing.T) {
+	got, err := KB.ConvertAmount(MustParseAmount("1.5"), B)
+	assert.NoError(t, err)
+	assert.Equal(t, MustParseAmount("1536"), got)
+
+	got, err = B.ConvertAmount(MustParseAmount("1"), KB)
+	assert.NoError(t, err)
+	assert.Equal(t, MustParseAmount("0.000977"), got, "1/1024 arredondado para a escala")
+
+	_, err = GB.ConvertAmount(MustParseAmount("9000000"), B)
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+
+	_, err = MB.ConvertAmount(MustParseAmount("1"), MBxSec)
+	assert.EqualError(t, err, "cannot convert MB (volume) to MB/sec (rate)")
+}
+
+func TestPulseUnit_Base(t *testing.T) {
+	assert.Equal(t, B, GB.Base())
+	assert.Equal(t, B, B.Base())
+	assert.Equal(t, BxSec, KBxSec.Base())
+	assert.Equal(t, PulseUnit(""), PulseUnit("INVALID").Base())
+}
+
+func TestPulseUnit_Humanize(t *testing.T) {
+	tests := []struct {
+		name       string
+		unit       PulseUnit
+		amount     float64
+		wantAmount float64
+		wantUnit   PulseUnit
+	}{
+		{name: "BytesToMB", unit: B, amount: 3 << 20, wantAmount: 3, wantUnit: MB},
+		{name: "BelowOneKB", unit: B, amount: 1000, wantAmount: 1000, wantUnit: B},
+		{name: "KBToGB", unit: KB, amount: 1536 << 10, wantAmount: 1.5, wantUnit: GB},
+		{name: "LargerThanGB", unit: GB, amount: 4096, wantAmount: 4096, wantUnit: GB},
+		{name: "Rate", unit: BxSec, amount: 2048, wantAmount: 2, wantUnit: KBxSec},
+		{name: "Zero", unit: MB, amount: 0, wantAmount: 0, wantUnit: B},
+		{name: "Invalid", unit: "INVALID", amount: 7, wantAmount: 7, wantUnit: "INVALID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, unit := tt.unit.Humanize(tt.amount)
+			assert.Equal(t, tt.wantAmount, amount)
+			assert.Equal(t, tt.wantUnit, unit)
+		})
+	}
+}
+
+func TestPulse_Normalize(t *testing.T) {
+	t.Run("ValidUnit", func(t *testing.T) {
+		p, err := Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("2"), UseUnit: MBxSec}.Normalize()
+		assert.NoError(t, err)
+		assert.Equal(t, Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("2097152"), UseUnit: BxSec}, p)
+	})
+
+	t.Run("InvalidUnit", func(t *testing.T) {
+		_, err := Pulse{UsedAmount: MustParseAmount("2"), UseUnit: "TB"}.Normalize()
+		assert.Error(t, err)
+	})
+}
+
+func TestPulse_ValidateFields(t *testing.T) {
+	valid := Pulse{TenantId: "tenant_xpto", ProductSku: "SKU-77", UseUnit: KB}
+	assert.Empty(t, valid.ValidateFields())
+
+	negative := valid
+	negative.UsedAmount = MustParseAmount("-0.000001")
+	if errs := negative.ValidateFields(); assert.Len(t, errs, 1) {
+		assert.Equal(t, FieldNegative, errs[0].Code)
+	}
+
+	// o limite também vale para o valor convertido para a unidade canônica
+	converted := valid
+	converted.UsedAmount = MustParseAmount("10000")
+	converted.UseUnit = GB
+	if errs := converted.ValidateFields(); assert.Len(t, errs, 1) {
+		assert.Equal(t, FieldTooLarge, errs[0].Code)
+		assert.Equal(t, "used_amount convertido para B deve ser no máximo 9223372036854.775807", errs[0].Message)
+	}
+
+	// na escala 0 o limite é MaxUsedAmount, e não o maior valor representável
+	assert.NoError(t, SetAmountScale(0))
+	defer SetAmountScale(DefaultAmountScale)
+	tooLarge := valid
+	tooLarge.UsedAmount = MustParseAmount("1000000000000001")
+	if errs := tooLarge.ValidateFields(); assert.Len(t, errs, 1) {
+		assert.Equal(t, FieldTooLarge, errs[0].Code)
+		assert.Equal(t, "used_amount deve ser no máximo 1e+15", errs[0].Message)
+	}
+
+	invalid := Pulse{TenantId: strings.Repeat("t", MaxTenantIdLength+1), ProductSku: "SKU 1", UsedAmount: MustParseAmount("1e15"), UseUnit: "TB"}
+	var codes []string
+	for _, fe := range invalid.ValidateFields() {
+		codes = append(codes, fe.Field+":"+fe.Code)
+	}
+	assert.Equal(t, []string{"tenant_id:too_long", "product_sku:pattern", "use_unit:unknown_unit"}, codes)
+}
+
+// FuzzValidIdentifier garante que todo tenant_id e product_sku aceito na ingestão é representável nas chaves do Redis
+func FuzzValidIdentifier(f *testing.F) {
+	for _, seed := range []string{"tenant1", "org:tenant1", "SKU-1", "a{b}", "é", "a\nb", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, id string) {
+		if !ValidTenantId(id) && !ValidProductSku(id) {
+			return
+		}
+		if err := keycodec.Validate(id); err != nil {
+			t.Fatalf("identificador %q aceito, mas não representável: %v", id, err)
+		}
+		_, tenantId, ok := generation.ParseKey(generation.Key("A", id))
+		if !ok || tenantId != id {
+			t.Fatalf("ParseKey(Key(%q)) = %q, %v", id, tenantId, ok)
+		}
+		productSku, _, _, ok := generation.ParseField(generation.Field(id, "KB", AmountScale()))
+		if !ok || productSku != id {
+			t.Fatalf("ParseField(Field(%q)) = %q, %v", id, productSku, ok)
+		}
+	})
+}
@@ -1,26 +1,92 @@
 package pulse
 
 import (
-	"github.com/gin-gonic/gin"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 )
 
 type pulseHandler struct {
 	pulseService PulseService
+	validator    Validator
+	quarantine   Quarantine
+	tenantCheck  TenantCheck
+	// authenticated indica os tenants autenticados pela credencial, informados ao rateLimiter
+	authenticated TenantCheck
+	rateLimiter   RateLimiter
+	quotaGuard    QuotaGuard
 }
+
+// TenantCheck indica se a requisição pode registrar consumo para o tenant informado
+type TenantCheck func(c *gin.Context, tenantId string) bool
 type PulseHandler interface {
 	Ingestor() gin.HandlerFunc
+	Units() gin.HandlerFunc
+}
+
+type HandlerOptions func(*pulseHandler)
+
+// WithValidator valida os pulsos antes do enfileiramento. Pulsos que violarem a validação
+// são rejeitados com 422 ou, se houver quarentena configurada, guardados nela.
+func WithValidator(validator Validator) HandlerOptions {
+	return func(ph *pulseHandler) {
+		ph.validator = validator
+	}
+}
+
+// WithQuarantine guarda os pulsos que violarem a validação em vez de rejeitá-los.
+// Só tem efeito em conjunto com WithValidator.
+func WithQuarantine(quarantine Quarantine) HandlerOptions {
+	return func(ph *pulseHandler) {
+		ph.quarantine = quarantine
+	}
+}
+
+// WithTenantCheck rejeita com 403 os pulsos cujo tenant_id não é permitido para a requisição
+// (ex.: tenants vinculados à chave de API utilizada)
+func WithTenantCheck(check TenantCheck) HandlerOptions {
+	return func(ph *pulseHandler) {
+		ph.tenantCheck = check
+	}
+}
+
+// WithAuthenticatedTenant informa ao RateLimiter, no contexto (veja AuthenticatedTenant), os tenants
+// autenticados pela credencial da requisição, e não apenas permitidos por ela (ex.: chave vinculada ao tenant)
+func WithAuthenticatedTenant(check TenantCheck) HandlerOptions {
+	return func(ph *pulseHandler) {
+		ph.authenticated = check
+	}
+}
+
+// WithRateLimiter rejeita com 429 os pulsos de tenants acima do seu limite, antes do enfileiramento.
+// Falhas do limitador são registradas no log e não bloqueiam a ingestão.
+func WithRateLimiter(limiter RateLimiter) HandlerOptions {
+	return func(ph *pulseHandler) {
+		ph.rateLimiter = limiter
+	}
 }
 
-func NewPulseHandler(pulseService PulseService) PulseHandler {
-	return &pulseHandler{
+func NewPulseHandler(pulseService PulseService, opts ...HandlerOptions) PulseHandler {
+	ph := &pulseHandler{
 		pulseService: pulseService,
 	}
+	for _, opt := range opts {
+		opt(ph)
+	}
+	return ph
 }
 
 // Ingestor é o handler que recebe as requisições de ingestão de pulsos
 // e os processa. Ele espera um JSON com os campos TenantId, ProductSku, UsedAmount e UseUnit.
-// O campo UseUnit deve ser um dos seguintes: KB, MB, GB, KBxSec, MBxSec ou GBxSec.
+// O campo UseUnit deve ser uma das unidades do registro em uso (veja GET /units).
+// Por padrão o valor é convertido para a unidade base da dimensão antes da agregação.
+// Com o catálogo de produtos ativo, pulsos que violarem suas regras são rejeitados com 422
+// ou, no modo de quarentena, aceitos com 202 sem serem agregados.
 // @OperationId Ingestor
 // @Summary Ingestor de pulsos
 // @Description Ingestor de pulsos
@@ -29,21 +95,196 @@ func NewPulseHandler(pulseService PulseService) PulseHandler {
 // @Produce json
 // @Param pulse body Pulse true "Pulse"
 // @Success 204 {object} nil "No Content"
+// @Success 202 {object} map[string]string "Pulso enviado para a quarentena"
+// @Failure 400 {object} Problem "JSON malformado ou campos inválidos, listados em errors"
+// @Failure 401 {object} Problem "Chave de API ausente, inválida ou expirada"
+// @Failure 403 {object} Problem "A chave de API não permite o tenant_id informado"
+// @Failure 429 {object} Problem "Tenant acima do limite de pulsos por segundo (code: RATE_LIMITED) ou da cota do SKU no período (code: QUOTA_EXCEEDED); reenvie após Retry-After"
+// @Header 204,429 {integer} X-RateLimit-Limit "Capacidade do balde do tenant"
+// @Header 204,429 {integer} X-RateLimit-Remaining "Pulsos que ainda podem ser enviados de imediato"
+// @Header 204,429 {integer} X-RateLimit-Reset "Segundos até o balde ficar cheio"
+// @Failure 422 {object} Problem "Pulso viola o catálogo de produtos (code: SKU_UNKNOWN, SKU_INACTIVE, UNIT_NOT_ALLOWED, AMOUNT_OUT_OF_RANGE)"
+// @Failure 503 {object} Problem "Ingestor finalizando, tente novamente"
+// @Security ApiKeyAuth
 // @Router /pulse/ingestor [post]
 func (p *pulseHandler) Ingestor() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var pulso Pulse
-		if err := c.ShouldBindJSON(&pulso); err != nil {
-			c.Error(err)
-			c.JSON(400, gin.H{"error": "Invalid request"})
+		pulso, problem := bindPulse(c)
+		if problem != nil {
+			c.Error(errors.New(problem.Detail))
+			WriteProblem(c, http.StatusBadRequest, *problem)
+			return
+		}
+		if p.tenantCheck != nil && !p.tenantCheck(c, pulso.TenantId) {
+			pulsesRejected.WithLabelValues(CodeTenantForbidden).Inc()
+			WriteProblem(c, http.StatusForbidden, Problem{
+				Type:   ProblemTypeTenantForbidden,
+				Title:  "Tenant não permitido",
+				Detail: fmt.Sprintf("a credencial utilizada não permite registrar consumo para o tenant %s", pulso.TenantId),
+				Code:   CodeTenantForbidden,
+			})
+			return
+		}
+		if p.validator != nil {
+			if err := p.validator.Validate(pulso); err != nil {
+				p.handleInvalidPulse(c, pulso, err)
+				return
+			}
+		}
+		if !p.withinQuota(c, pulso) {
+			return
+		}
+		if !p.allow(c, pulso.TenantId) {
 			return
 		}
-		if !pulso.UseUnit.IsValid() {
-			c.JSON(400, gin.H{"error": "Invalid pulse unit"})
+		if err := p.pulseService.EnqueuePulse(pulso); err != nil {
+			c.Header("Retry-After", "1")
+			WriteProblem(c, http.StatusServiceUnavailable, unavailableProblem())
 			return
 		}
-		p.pulseService.EnqueuePulse(pulso)
 		c.JSON(http.StatusNoContent, nil)
 	}
 
 }
+
+// allow consulta o limitador de taxa, escreve os cabeçalhos do limite e responde 429 se o tenant o excedeu
+func (p *pulseHandler) allow(c *gin.Context, tenantId string) bool {
+	if p.rateLimiter == nil {
+		return true
+	}
+	ctx := c.Request.Context()
+	if p.authenticated != nil && p.authenticated(c, tenantId) {
+		ctx = ContextWithAuthenticatedTenant(ctx, tenantId)
+	}
+	limit, err := p.rateLimiter.Allow(ctx, tenantId)
+	if err != nil {
+		log.Error().Err(err).Str("tenant_id", tenantId).Msg("Erro ao consultar o limite de taxa, pulso aceito")
+		return true
+	}
+	writeRateLimitHeaders(c, limit)
+	if limit.Allowed {
+		return true
+	}
+	pulsesRejected.WithLabelValues(CodeRateLimited).Inc()
+	WriteProblem(c, http.StatusTooManyRequests, rateLimitedProblem(tenantId))
+	return false
+}
+
+// pulseRequest é o corpo recebido na ingestão. UsedAmount é mantido como recebido para diferenciar
+// o valor 0, que é válido, de um campo ausente e para ser convertido sem passar por float64.
+type pulseRequest struct {
+	TenantId   string          `json:"tenant_id"`
+	ProductSku string          `json:"product_sku"`
+	UsedAmount json.RawMessage `json:"used_amount"`
+	UseUnit    PulseUnit       `json:"use_unit"`
+}
+
+// bindPulse decodifica e valida o corpo da requisição.
+// Retorna o problema a ser respondido com todos os campos inválidos, ou nil se o pulso for válido.
+func bindPulse(c *gin.Context) (Pulse, *Problem) {
+	var req pulseRequest
+	err := c.ShouldBindJSON(&req)
+	var typeErr *json.UnmarshalTypeError
+	if err != nil && !errors.As(err, &typeErr) {
+		pulsesRejected.WithLabelValues(CodeMalformedRequest).Inc()
+		return Pulse{}, &Problem{
+			Type:   ProblemTypeMalformedRequest,
+			Title:  "Requisição malformada",
+			Detail: "o corpo deve ser um objeto JSON válido: " + err.Error(),
+		}
+	}
+
+	pulso := Pulse{TenantId: req.TenantId, ProductSku: req.ProductSku, UseUnit: req.UseUnit}
+	var fieldErrors []FieldError
+	// O decoder continua após um erro de tipo, então os demais campos também são verificados
+	if typeErr != nil {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   typeErr.Field,
+			Code:    FieldInvalidType,
+			Message: fmt.Sprintf("%s deve ser do tipo %s, recebido: %s", typeErr.Field, typeErr.Type, typeErr.Value),
+		})
+	}
+	// usedAmountErr é o erro do used_amount encontrado antes de ValidateFields, que não o repete
+	var usedAmountErr *FieldError
+	switch raw := string(bytes.TrimSpace(req.UsedAmount)); {
+	case raw == "" || raw == "null":
+		usedAmountErr = &FieldError{Field: "used_amount", Code: FieldRequired, Message: "used_amount é obrigatório"}
+	case jsonKind(raw) != "number":
+		usedAmountErr = &FieldError{Field: "used_amount", Code: FieldInvalidType, Message: "used_amount deve ser do tipo number, recebido: " + jsonKind(raw)}
+	default:
+		pulso.UsedAmount, usedAmountErr = validateUsedAmount(raw)
+	}
+	if usedAmountErr != nil {
+		fieldErrors = append(fieldErrors, *usedAmountErr)
+	}
+	for _, fe := range pulso.ValidateFields() {
+		if (typeErr != nil && fe.Field == typeErr.Field) || (usedAmountErr != nil && fe.Field == "used_amount") {
+			continue
+		}
+		fieldErrors = append(fieldErrors, fe)
+	}
+	if len(fieldErrors) > 0 {
+		pulsesRejected.WithLabelValues(CodeInvalidFields).Inc()
+		return Pulse{}, &Problem{
+			Type:   ProblemTypeInvalidPulse,
+			Title:  "Pulso inválido",
+			Detail: fmt.Sprintf("%d campo(s) inválido(s)", len(fieldErrors)),
+			Errors: fieldErrors,
+		}
+	}
+	return pulso, nil
+}
+
+// jsonKind retorna o tipo do valor JSON, com os nomes utilizados por encoding/json nos erros de tipo
+func jsonKind(raw string) string {
+	switch raw[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "bool"
+	}
+	return "number"
+}
+
+// handleInvalidPulse envia o pulso para a quarentena, se configurada, ou o rejeita com o código da violação.
+// Se a quarentena falhar, o pulso é rejeitado para que o cliente não o considere aceito.
+func (p *pulseHandler) handleInvalidPulse(c *gin.Context, pulso Pulse, err error) {
+	var violation *ValidationError
+	if !errors.As(err, &violation) {
+		violation = &ValidationError{Code: CodeInvalidPulse, Message: err.Error()}
+	}
+	if p.quarantine != nil {
+		qErr := p.quarantine.Quarantine(c.Request.Context(), pulso, violation)
+		if qErr == nil {
+			pulsesQuarantined.WithLabelValues(violation.Code).Inc()
+			c.JSON(http.StatusAccepted, gin.H{"status": "quarantined", "code": violation.Code, "error": violation.Message})
+			return
+		}
+		log.Error().Err(qErr).Str("tenant_id", pulso.TenantId).Str("code", violation.Code).Msg("Erro ao enviar pulso para a quarentena")
+	}
+	pulsesRejected.WithLabelValues(violation.Code).Inc()
+	WriteProblem(c, http.StatusUnprocessableEntity, Problem{
+		Type:   ProblemTypeCatalogViolation,
+		Title:  "Pulso viola o catálogo de produtos",
+		Detail: violation.Message,
+		Code:   violation.Code,
+	})
+}
+
+// Units retorna as unidades aceitas no campo use_unit, conforme o registro em uso
+// @OperationId Units
+// @Summary Unidades aceitas
+// @Description Lista as unidades aceitas em use_unit, com dimensão, fator em relação à unidade base e forma de agregação
+// @Tags Pulso
+// @Produce json
+// @Success 200 {array} UnitDefinition
+// @Router /units [get]
+func (p *pulseHandler) Units() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, Units().Definitions())
+	}
+}
@@ -2,9 +2,12 @@ package pulse
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,8 +20,9 @@ import (
 type MockPulseService struct {
 	mock.Mock
 }
-func (m *MockPulseService) EnqueuePulse(pulse Pulse) {
-	m.Called(pulse)
+func (m *MockPulseService) EnqueuePulse(pulse Pulse) error {
+	args := m.Called(pulse)
+	return args.Error(0)
 }
 
 func (m *MockPulseService) Start(workers int, intervalToSend time.Duration)  {
@@ -27,6 +31,14 @@ func (m *MockPulseService) Start(workers int, intervalToSend time.Duration)  {
 func (m *MockPulseService) Stop() {
 	m.Called()
 }
+func (m *MockPulseService) Shutdown(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+func (m *MockPulseService) Status() Status {
+	args := m.Called()
+	return args.Get(0).(Status)
+}
 
 func TestPulseHandler_Ingestor_Success(t *testing.T) {
 	// Configura o modo de teste do Gin
@@ -40,10 +52,10 @@ func TestPulseHandler_Ingestor_Success(t *testing.T) {
 	validPulse := Pulse{
 		TenantId:   "tenant1",
 		ProductSku: "sku1",
-		UsedAmount: 100.0,
+		UsedAmount: MustParseAmount("100.0"),
 		UseUnit:    KB,
 	}
-	pulseService.On("EnqueuePulse", validPulse).Return()
+	pulseService.On("EnqueuePulse", validPulse).Return(nil)
 
 	// Cria uma requisição HTTP POST com o Pulse válido
 	body, _ := json.Marshal(validPulse)
@@ -82,8 +94,13 @@ func TestPulseHandler_Ingestor_InvalidJSON(t *testing.T) {
 
 	// Verifica a resposta
 	assert.Equal(t, http.StatusBadRequest, w.Code) // 400 Bad Request
-	expectedBody := `{"error":"Invalid request"}`
-	assert.JSONEq(t, expectedBody, w.Body.String())
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, ProblemTypeMalformedRequest, problem.Type)
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, "/ingestor", problem.Instance)
+	assert.Empty(t, problem.Errors)
 	pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything) // Verifica que EnqueuePulse não foi chamado
 }
 
@@ -112,7 +129,18 @@ func TestPulseHandler_Ingestor_MissingFields(t *testing.T) {
 
 	// Verifica a resposta
 	assert.Equal(t, http.StatusBadRequest, w.Code) // 400 Bad Request
-	expectedBody := `{"error":"Invalid request"}`
+	expectedBody := `{
+		"type": "/problems/invalid-pulse",
+		"title": "Pulso inválido",
+		"status": 400,
+		"detail": "3 campo(s) inválido(s)",
+		"instance": "/ingestor",
+		"errors": [
+			{"field": "used_amount", "code": "required", "message": "used_amount é obrigatório"},
+			{"field": "product_sku", "code": "required", "message": "product_sku é obrigatório"},
+			{"field": "use_unit", "code": "required", "message": "use_unit é obrigatório"}
+		]
+	}`
 	assert.JSONEq(t, expectedBody, w.Body.String())
 	pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything) // Verifica que EnqueuePulse não foi chamado
 }
@@ -129,7 +157,7 @@ func TestPulseHandler_Ingestor_InvalidUseUnit(t *testing.T) {
 	invalidPulse := Pulse{
 		TenantId:   "tenant1",
 		ProductSku: "sku1",
-		UsedAmount: 100.0,
+		UsedAmount: MustParseAmount("100.0"),
 		UseUnit:    "INVALID", // Unidade inválida
 	}
 	body, _ := json.Marshal(invalidPulse)
@@ -145,7 +173,451 @@ func TestPulseHandler_Ingestor_InvalidUseUnit(t *testing.T) {
 
 	// Verifica a resposta
 	assert.Equal(t, http.StatusBadRequest, w.Code) 
-	expectedBody := `{"error": "Invalid pulse unit"}`
-	assert.JSONEq(t, expectedBody, w.Body.String())
+	var problem Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, []FieldError{{Field: "use_unit", Code: FieldUnknownUnit, Message: `unidade "INVALID" não registrada; consulte GET /units`}}, problem.Errors)
 	pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything)
 }
+
+func TestPulseHandler_Ingestor_FieldValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		body   string
+		errors []FieldError
+	}{
+		{
+			name: "ZeroAmountIsValid",
+			body: `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":0,"use_unit":"KB"}`,
+		},
+		{
+			name: "ColonsAreValid",
+			body: `{"tenant_id":"org:tenant1","product_sku":"SKU:1","used_amount":1,"use_unit":"KB"}`,
+		},
+		{
+			name:   "NegativeAmount",
+			body:   `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":-1,"use_unit":"KB"}`,
+			errors: []FieldError{{Field: "used_amount", Code: FieldNegative, Message: "used_amount não pode ser negativo"}},
+		},
+		{
+			name:   "AmountTooLarge",
+			body:   `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":1e16,"use_unit":"KB"}`,
+			errors: []FieldError{{Field: "used_amount", Code: FieldTooLarge, Message: "used_amount deve ser no máximo 9223372036854.775807"}},
+		},
+		{
+			name:   "ConvertedAmountTooLarge",
+			body:   `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":10000,"use_unit":"GB"}`,
+			errors: []FieldError{{Field: "used_amount", Code: FieldTooLarge, Message: "used_amount convertido para B deve ser no máximo 9223372036854.775807"}},
+		},
+		{
+			name:   "AmountOverflow",
+			body:   `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":1e400,"use_unit":"KB"}`,
+			errors: []FieldError{{Field: "used_amount", Code: FieldTooLarge, Message: "used_amount deve ser no máximo 9223372036854.775807"}},
+		},
+		{
+			name:   "NegativeOverflow",
+			body:   `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":-1e400,"use_unit":"KB"}`,
+			errors: []FieldError{{Field: "used_amount", Code: FieldNegative, Message: "used_amount não pode ser negativo"}},
+		},
+		{
+			name:   "AmountTooPrecise",
+			body:   `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":0.0000001,"use_unit":"KB"}`,
+			errors: []FieldError{{Field: "used_amount", Code: FieldTooPrecise, Message: "used_amount deve ter no máximo 6 casas decimais"}},
+		},
+		{
+			name: "ExactDecimalAmount",
+			body: `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":0.000001,"use_unit":"KB"}`,
+		},
+		{
+			name:   "AmountIsNotANumber",
+			body:   `{"tenant_id":"tenant1","product_sku":"SKU-1","used_amount":true,"use_unit":"KB"}`,
+			errors: []FieldError{{Field: "used_amount", Code: FieldInvalidType, Message: "used_amount deve ser do tipo number, recebido: bool"}},
+		},
+		{
+			name: "WrongTypeStillValidatesOtherFields",
+			body: `{"tenant_id":"tenant 1","product_sku":"SKU-1","used_amount":"10","use_unit":"KB"}`,
+			errors: []FieldError{
+				{Field: "used_amount", Code: FieldInvalidType, Message: "used_amount deve ser do tipo number, recebido: string"},
+				{Field: "tenant_id", Code: FieldPattern, Message: "tenant_id deve começar com letra ou número e conter apenas letras, números, '_', '.', ':' ou '-'"},
+			},
+		},
+		{
+			name:   "SkuTooLong",
+			body:   `{"tenant_id":"tenant1","product_sku":"` + strings.Repeat("S", MaxProductSkuLength+1) + `","used_amount":1,"use_unit":"KB"}`,
+			errors: []FieldError{{Field: "product_sku", Code: FieldTooLong, Message: "product_sku deve ter no máximo 64 caracteres"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pulseService := new(MockPulseService)
+			pulseService.On("EnqueuePulse", mock.Anything).Return(nil)
+			handler := NewPulseHandler(pulseService)
+
+			req, _ := http.NewRequest("POST", "/ingestor", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			handler.Ingestor()(c)
+
+			if tt.errors == nil {
+				assert.Equal(t, http.StatusNoContent, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var problem Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, ProblemTypeInvalidPulse, problem.Type)
+			assert.Equal(t, tt.errors, problem.Errors)
+			pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything)
+		})
+	}
+}
+
+func TestPulseHandler_Ingestor_ServiceStopped(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	pulseService := new(MockPulseService)
+	handler := NewPulseHandler(pulseService)
+
+	validPulse := Pulse{
+		TenantId:   "tenant1",
+		ProductSku: "sku1",
+		UsedAmount: MustParseAmount("100.0"),
+		UseUnit:    KB,
+	}
+	pulseService.On("EnqueuePulse", validPulse).Return(ErrServiceStopped)
+
+	body, _ := json.Marshal(validPulse)
+	req, _ := http.NewRequest("POST", "/ingestor", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	handler.Ingestor()(c)
+
+	// O pulso não foi aceito, então o cliente deve reenviar
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	pulseService.AssertExpectations(t)
+}
+
+func TestPulseHandler_Ingestor_CustomUnitRegistry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registry, err := NewUnitRegistry([]UnitDefinition{{Name: "req", Dimension: "requests", Factor: 1}})
+	assert.NoError(t, err)
+	original := Units()
+	SetUnitRegistry(registry)
+	defer SetUnitRegistry(original)
+
+	pulseService := new(MockPulseService)
+	handler := NewPulseHandler(pulseService)
+	customPulse := Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("3"), UseUnit: "req"}
+	pulseService.On("EnqueuePulse", customPulse).Return(nil).Once()
+
+	for _, tt := range []struct {
+		pulse Pulse
+		code  int
+	}{
+		{pulse: customPulse, code: http.StatusNoContent},
+		// KB não faz parte do registro em uso
+		{pulse: Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("3"), UseUnit: KB}, code: http.StatusBadRequest},
+	} {
+		body, _ := json.Marshal(tt.pulse)
+		req, _ := http.NewRequest("POST", "/ingestor", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		handler.Ingestor()(c)
+		assert.Equal(t, tt.code, w.Code, tt.pulse.UseUnit)
+	}
+	pulseService.AssertExpectations(t)
+}
+
+func TestPulseHandler_Units(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewPulseHandler(new(MockPulseService))
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/units", nil)
+	handler.Units()(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var units []UnitDefinition
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &units))
+	assert.Equal(t, DefaultUnits(), units)
+}
+
+type validatorFunc func(p Pulse) error
+
+func (f validatorFunc) Validate(p Pulse) error { return f(p) }
+
+type MockQuarantine struct {
+	mock.Mock
+}
+
+func (m *MockQuarantine) Quarantine(ctx context.Context, p Pulse, reason *ValidationError) error {
+	args := m.Called(p, reason)
+	return args.Error(0)
+}
+
+func TestPulseHandler_Ingestor_Validator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	violation := &ValidationError{Code: "SKU_UNKNOWN", Message: "o produto sku1 não está no catálogo"}
+	invalidPulse := Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("100"), UseUnit: KB}
+	rejectAll := validatorFunc(func(p Pulse) error { return violation })
+
+	send := func(handler PulseHandler) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(invalidPulse)
+		req, _ := http.NewRequest("POST", "/ingestor", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		handler.Ingestor()(c)
+		return w
+	}
+
+	t.Run("Reject", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		w := send(NewPulseHandler(pulseService, WithValidator(rejectAll)))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{
+			"type": "/problems/catalog-violation",
+			"title": "Pulso viola o catálogo de produtos",
+			"status": 422,
+			"detail": "o produto sku1 não está no catálogo",
+			"instance": "/ingestor",
+			"code": "SKU_UNKNOWN"
+		}`, w.Body.String())
+		pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything)
+	})
+
+	t.Run("GenericErrorUsesInvalidPulseCode", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		w := send(NewPulseHandler(pulseService, WithValidator(validatorFunc(func(p Pulse) error { return errors.New("falha") }))))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, CodeInvalidPulse, problem.Code)
+		assert.Equal(t, "falha", problem.Detail)
+	})
+
+	t.Run("Quarantine", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		quarantine := new(MockQuarantine)
+		quarantine.On("Quarantine", invalidPulse, violation).Return(nil).Once()
+		w := send(NewPulseHandler(pulseService, WithValidator(rejectAll), WithQuarantine(quarantine)))
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.JSONEq(t, `{"status":"quarantined","code":"SKU_UNKNOWN","error":"o produto sku1 não está no catálogo"}`, w.Body.String())
+		quarantine.AssertExpectations(t)
+		pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything)
+	})
+
+	t.Run("QuarantineFailureRejects", func(t *testing.T) {
+		quarantine := new(MockQuarantine)
+		quarantine.On("Quarantine", invalidPulse, violation).Return(errors.New("redis indisponível")).Once()
+		w := send(NewPulseHandler(new(MockPulseService), WithValidator(rejectAll), WithQuarantine(quarantine)))
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		quarantine.AssertExpectations(t)
+	})
+
+	t.Run("ValidPulseIsEnqueued", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		pulseService.On("EnqueuePulse", invalidPulse).Return(nil).Once()
+		w := send(NewPulseHandler(pulseService, WithValidator(validatorFunc(func(p Pulse) error { return nil }))))
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		pulseService.AssertExpectations(t)
+	})
+}
+
+func TestPulseHandler_Ingestor_TenantCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	pulso := Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("100"), UseUnit: KB}
+	send := func(handler PulseHandler) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(pulso)
+		req, _ := http.NewRequest("POST", "/ingestor", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		handler.Ingestor()(c)
+		return w
+	}
+
+	t.Run("Forbidden", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		w := send(NewPulseHandler(pulseService, WithTenantCheck(func(c *gin.Context, tenantId string) bool {
+			return tenantId == "tenant2"
+		})))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, ProblemTypeTenantForbidden, problem.Type)
+		assert.Equal(t, CodeTenantForbidden, problem.Code)
+		pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything)
+	})
+
+	t.Run("Allowed", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		pulseService.On("EnqueuePulse", pulso).Return(nil).Once()
+		w := send(NewPulseHandler(pulseService, WithTenantCheck(func(c *gin.Context, tenantId string) bool {
+			return tenantId == "tenant1"
+		})))
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		pulseService.AssertExpectations(t)
+	})
+}
+
+type rateLimiterFunc func(ctx context.Context, tenantId string) (RateLimit, error)
+
+func (f rateLimiterFunc) Allow(ctx context.Context, tenantId string) (RateLimit, error) {
+	return f(ctx, tenantId)
+}
+
+func TestPulseHandler_Ingestor_RateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	pulso := Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("100"), UseUnit: KB}
+	send := func(handler PulseHandler) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(pulso)
+		req, _ := http.NewRequest("POST", "/ingestor", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		handler.Ingestor()(c)
+		return w
+	}
+
+	t.Run("Throttled", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		w := send(NewPulseHandler(pulseService, WithRateLimiter(rateLimiterFunc(func(ctx context.Context, tenantId string) (RateLimit, error) {
+			assert.Equal(t, "tenant1", tenantId)
+			return RateLimit{Allowed: false, Limit: 10, Remaining: 0, Reset: 1500 * time.Millisecond, RetryAfter: 100 * time.Millisecond}, nil
+		}))))
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, "10", w.Header().Get(HeaderRateLimitLimit))
+		assert.Equal(t, "0", w.Header().Get(HeaderRateLimitRemaining))
+		assert.Equal(t, "2", w.Header().Get(HeaderRateLimitReset))
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, ProblemTypeRateLimited, problem.Type)
+		assert.Equal(t, CodeRateLimited, problem.Code)
+		pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything)
+	})
+
+	t.Run("Allowed", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		pulseService.On("EnqueuePulse", pulso).Return(nil).Once()
+		w := send(NewPulseHandler(pulseService, WithRateLimiter(rateLimiterFunc(func(ctx context.Context, tenantId string) (RateLimit, error) {
+			return RateLimit{Allowed: true, Limit: 10, Remaining: 9, Reset: 100 * time.Millisecond}, nil
+		}))))
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "9", w.Header().Get(HeaderRateLimitRemaining))
+		assert.Empty(t, w.Header().Get("Retry-After"))
+		pulseService.AssertExpectations(t)
+	})
+
+	t.Run("AuthenticatedTenant", func(t *testing.T) {
+		for _, authenticated := range []bool{true, false} {
+			pulseService := new(MockPulseService)
+			pulseService.On("EnqueuePulse", pulso).Return(nil).Once()
+			w := send(NewPulseHandler(pulseService,
+				WithAuthenticatedTenant(func(c *gin.Context, tenantId string) bool { return authenticated }),
+				WithRateLimiter(rateLimiterFunc(func(ctx context.Context, tenantId string) (RateLimit, error) {
+					assert.Equal(t, authenticated, AuthenticatedTenant(ctx, "tenant1"))
+					return RateLimit{Allowed: true}, nil
+				}))))
+			assert.Equal(t, http.StatusNoContent, w.Code)
+		}
+	})
+
+	t.Run("LimiterErrorAccepts", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		pulseService.On("EnqueuePulse", pulso).Return(nil).Once()
+		w := send(NewPulseHandler(pulseService, WithRateLimiter(rateLimiterFunc(func(ctx context.Context, tenantId string) (RateLimit, error) {
+			return RateLimit{}, errors.New("falha")
+		}))))
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get(HeaderRateLimitLimit))
+		pulseService.AssertExpectations(t)
+	})
+}
+
+type quotaGuardFunc func(tenantId, productSku string) (time.Time, bool)
+
+func (f quotaGuardFunc) Blocked(tenantId, productSku string) (time.Time, bool) {
+	return f(tenantId, productSku)
+}
+
+func TestPulseHandler_Ingestor_QuotaGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	send := func(handler PulseHandler, pulso Pulse) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(pulso)
+		req, _ := http.NewRequest("POST", "/ingestor", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = req
+		handler.Ingestor()(c)
+		return w
+	}
+	until := time.Now().Add(90 * time.Second)
+	guard := quotaGuardFunc(func(tenantId, productSku string) (time.Time, bool) {
+		return until, tenantId == "tenant1" && productSku == "sku1"
+	})
+	limiter := rateLimiterFunc(func(ctx context.Context, tenantId string) (RateLimit, error) {
+		t.Fatal("o limite de taxa não deve ser consultado para um pulso bloqueado pela cota")
+		return RateLimit{}, nil
+	})
+
+	t.Run("Blocked", func(t *testing.T) {
+		pulseService := new(MockPulseService)
+		w := send(NewPulseHandler(pulseService, WithQuotaGuard(guard), WithRateLimiter(limiter)),
+			Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB})
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "90", w.Header().Get("Retry-After"))
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, ProblemTypeQuotaExceeded, problem.Type)
+		assert.Equal(t, CodeQuotaExceeded, problem.Code)
+		assert.Contains(t, problem.Detail, "tenant1")
+		assert.Contains(t, problem.Detail, "sku1")
+		pulseService.AssertNotCalled(t, "EnqueuePulse", mock.Anything)
+	})
+
+	t.Run("OtherSku", func(t *testing.T) {
+		pulso := Pulse{TenantId: "tenant1", ProductSku: "sku2", UsedAmount: MustParseAmount("1"), UseUnit: KB}
+		pulseService := new(MockPulseService)
+		pulseService.On("EnqueuePulse", pulso).Return(nil).Once()
+		w := send(NewPulseHandler(pulseService, WithQuotaGuard(guard)), pulso)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		pulseService.AssertExpectations(t)
+	})
+}
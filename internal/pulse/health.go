@@ -0,0 +1,37 @@
+package pulse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/health"
+)
+
+// GenerationCheck verifica se o serviço conhece a geração atual utilizada na gravação dos pulsos
+func GenerationCheck(svc PulseService) health.CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		gen := svc.Status().Generation
+		if gen == "" {
+			return "", errors.New("geração atual desconhecida")
+		}
+		return "geração " + gen, nil
+	}
+}
+
+// QueueCheck verifica se a ocupação do canal de pulsos está abaixo de highWaterMark (fração da capacidade)
+// e se o serviço ainda aceita pulsos
+func QueueCheck(svc PulseService, highWaterMark float64) health.CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		status := svc.Status()
+		detail := fmt.Sprintf("%d/%d pulsos no canal", status.QueueLength, status.QueueCapacity)
+		if status.ShuttingDown {
+			return detail, errors.New("serviço drenando pulsos para finalização")
+		}
+		limit := int(float64(status.QueueCapacity) * highWaterMark)
+		if status.QueueLength >= limit {
+			return detail, fmt.Errorf("canal acima do limite de %d pulsos (%.0f%% da capacidade)", limit, highWaterMark*100)
+		}
+		return detail, nil
+	}
+}
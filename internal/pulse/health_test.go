@@ -0,0 +1,53 @@
+package pulse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerationCheck(t *testing.T) {
+	t.Run("Known", func(t *testing.T) {
+		svc := new(MockPulseService)
+		svc.On("Status").Return(Status{Generation: "B"}).Once()
+
+		detail, err := GenerationCheck(svc)(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "geração B", detail)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		svc := new(MockPulseService)
+		svc.On("Status").Return(Status{}).Once()
+
+		_, err := GenerationCheck(svc)(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestQueueCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  Status
+		wantErr string
+	}{
+		{name: "BelowHighWater", status: Status{QueueLength: 89, QueueCapacity: 100}},
+		{name: "AtHighWater", status: Status{QueueLength: 90, QueueCapacity: 100}, wantErr: "acima do limite de 90 pulsos"},
+		{name: "ShuttingDown", status: Status{QueueLength: 0, QueueCapacity: 100, ShuttingDown: true}, wantErr: "drenando"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := new(MockPulseService)
+			svc.On("Status").Return(tt.status).Once()
+
+			detail, err := QueueCheck(svc, 0.9)(context.Background())
+			assert.Contains(t, detail, "/100 pulsos no canal")
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package pulse
+
+import (
+	"context"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/rs/zerolog/log"
+)
+
+// WithLedger registra cada incremento gravado no agregado também no ledger, cujos totais são comparados
+// pela conciliação do sender com os totais entregues (veja o pacote reconcile).
+// Falhas do ledger são registradas no log e nas métricas e não afetam a gravação do pulso.
+func WithLedger(ledger usagestore.Ledger) ServiceOptions {
+	return func(ps *pulseService) {
+		ps.ledger = ledger
+	}
+}
+
+// recordLedger registra o incremento gravado no ledger, sem repetição: um incremento registrado duas vezes
+// seria apontado como faltante pela conciliação
+func (s *pulseService) recordLedger(ctx context.Context, inc usagestore.Increment) {
+	if err := s.ledger.Record(ctx, inc); err != nil {
+		ledgerFailures.Inc()
+		log.Warn().Err(err).Str("generation", inc.Generation).Str("tenant_id", inc.TenantId).Str("field", inc.Field).
+			Msg("Erro ao registrar o pulso nos totais da conciliação")
+	}
+}
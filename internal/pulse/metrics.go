@@ -35,6 +35,26 @@ var (
 			Help: "Total de pulsos processados pelo ingestor",
 		},
 	)
+	pulsesRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestor_pulses_rejected_total",
+			Help: "Total de pulsos rejeitados pela validação, por código da violação",
+		},
+		[]string{"code"},
+	)
+	pulsesQuarantined = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestor_pulses_quarantined_total",
+			Help: "Total de pulsos enviados para a quarentena, por código da violação",
+		},
+		[]string{"code"},
+	)
+	ledgerFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestor_ledger_record_failed_total",
+			Help: "Total de pulsos gravados que não puderam ser registrados nos totais da conciliação",
+		},
+	)
 )
 
 func registerMetrics() {
@@ -49,5 +69,8 @@ func registerMetrics() {
 		redisAccessCount,
 		channelBufferSize,
 		pulsesProcessed,
+		pulsesRejected,
+		pulsesQuarantined,
+		ledgerFailures,
 	)
 }
\ No newline at end of file
@@ -0,0 +1,59 @@
+package pulse
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType é o Content-Type das respostas de erro (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Tipos de problema retornados pelo ingestor e pelas consultas de consumo
+const (
+	ProblemTypeMalformedRequest = "/problems/malformed-request"
+	ProblemTypeInvalidPulse     = "/problems/invalid-pulse"
+	ProblemTypeCatalogViolation = "/problems/catalog-violation"
+	ProblemTypeTenantForbidden  = "/problems/tenant-forbidden"
+	ProblemTypeRateLimited      = "/problems/rate-limited"
+	ProblemTypeQuotaExceeded    = "/problems/quota-exceeded"
+	ProblemTypeUnavailable      = "/problems/unavailable"
+	ProblemTypeInvalidQuery     = "/problems/invalid-query"
+)
+
+// Problem é o corpo das respostas de erro no formato problem details (RFC 7807)
+type Problem struct {
+	// Type identifica o tipo do problema
+	Type string `json:"type" example:"/problems/invalid-pulse"`
+	// Title resume o tipo do problema e não varia entre ocorrências
+	Title string `json:"title" example:"Pulso inválido"`
+	// Status repete o código HTTP da resposta
+	Status int `json:"status" example:"400"`
+	// Detail descreve esta ocorrência do problema
+	Detail string `json:"detail,omitempty" example:"2 campos inválidos"`
+	// Instance é o caminho da requisição que originou o problema
+	Instance string `json:"instance,omitempty" example:"/ingest"`
+	// Code é o código da violação do catálogo de produtos (ex.: SKU_UNKNOWN)
+	Code string `json:"code,omitempty" example:"SKU_UNKNOWN"`
+	// Errors lista os campos inválidos
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// WriteProblem responde com o problema, preenchendo status e instance
+func WriteProblem(c *gin.Context, status int, problem Problem) {
+	problem.Status = status
+	if c.Request != nil && c.Request.URL != nil {
+		problem.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(status, problem)
+}
+
+// unavailableProblem é retornado quando o ingestor não aceita pulsos no momento
+func unavailableProblem() Problem {
+	return Problem{
+		Type:   ProblemTypeUnavailable,
+		Title:  http.StatusText(http.StatusServiceUnavailable),
+		Detail: "o ingestor está finalizando; reenvie o pulso",
+	}
+}
@@ -0,0 +1,59 @@
+package pulse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageTracker acompanha o consumo acumulado dos pulsos já gravados no Redis (ex.: cotas por período).
+// Track recebe o pulso como foi aceito, antes da conversão para a unidade base.
+type UsageTracker interface {
+	Track(ctx context.Context, p Pulse) error
+}
+
+// QuotaGuard indica se o tenant excedeu o limite rígido de cota do SKU.
+// Quando bloqueado, until é o fim do período em que os pulsos devem ser recusados.
+type QuotaGuard interface {
+	Blocked(tenantId, productSku string) (until time.Time, blocked bool)
+}
+
+// WithUsageTracker informa ao tracker cada pulso gravado com sucesso.
+// Falhas do tracker são registradas no log e não afetam a gravação do pulso.
+func WithUsageTracker(tracker UsageTracker) ServiceOptions {
+	return func(ps *pulseService) {
+		ps.usageTracker = tracker
+	}
+}
+
+// WithQuotaGuard rejeita com 429 os pulsos de tenants que excederam o limite rígido da cota do SKU,
+// até o fim do período da cota.
+func WithQuotaGuard(guard QuotaGuard) HandlerOptions {
+	return func(ph *pulseHandler) {
+		ph.quotaGuard = guard
+	}
+}
+
+// withinQuota responde 429 se o tenant estiver bloqueado pela cota do SKU
+func (p *pulseHandler) withinQuota(c *gin.Context, pulso Pulse) bool {
+	if p.quotaGuard == nil {
+		return true
+	}
+	until, blocked := p.quotaGuard.Blocked(pulso.TenantId, pulso.ProductSku)
+	if !blocked {
+		return true
+	}
+	pulsesRejected.WithLabelValues(CodeQuotaExceeded).Inc()
+	c.Header("Retry-After", strconv.Itoa(max(1, ceilSeconds(time.Until(until)))))
+	WriteProblem(c, http.StatusTooManyRequests, Problem{
+		Type:   ProblemTypeQuotaExceeded,
+		Title:  "Cota excedida",
+		Detail: fmt.Sprintf("o tenant %s excedeu a cota do produto %s até %s", pulso.TenantId, pulso.ProductSku, until.UTC().Format(time.RFC3339)),
+		Code:   CodeQuotaExceeded,
+	})
+	return false
+}
@@ -0,0 +1,78 @@
+package pulse
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit é a decisão do limitador de taxa para um pulso
+type RateLimit struct {
+	// Allowed indica se o pulso pode ser enfileirado
+	Allowed bool
+	// Limit é a capacidade do balde do tenant (rajada máxima); 0 indica tenant sem limite
+	Limit int
+	// Remaining é a quantidade de pulsos que o tenant ainda pode enviar de imediato
+	Remaining int
+	// Reset é o tempo até o balde voltar a ficar cheio
+	Reset time.Duration
+	// RetryAfter é o tempo até o próximo pulso ser aceito, quando Allowed é false
+	RetryAfter time.Duration
+}
+
+// RateLimiter limita a taxa de pulsos aceitos de cada tenant
+type RateLimiter interface {
+	Allow(ctx context.Context, tenantId string) (RateLimit, error)
+}
+
+type authenticatedTenantKey struct{}
+
+// ContextWithAuthenticatedTenant marca o tenant como autenticado pela credencial da requisição (veja WithAuthenticatedTenant)
+func ContextWithAuthenticatedTenant(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, authenticatedTenantKey{}, tenantId)
+}
+
+// AuthenticatedTenant indica se o tenant foi autenticado pela credencial da requisição.
+// Como o tenant_id é informado pelo cliente, apenas os tenants autenticados (ou configurados)
+// devem ser utilizados como label de métricas.
+func AuthenticatedTenant(ctx context.Context, tenantId string) bool {
+	authenticated, ok := ctx.Value(authenticatedTenantKey{}).(string)
+	return ok && authenticated == tenantId
+}
+
+// Cabeçalhos que informam ao cliente o estado do seu limite
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset"
+)
+
+// writeRateLimitHeaders informa o limite do tenant; Reset e Retry-After são arredondados para cima, em segundos
+func writeRateLimitHeaders(c *gin.Context, limit RateLimit) {
+	if limit.Limit == 0 {
+		return
+	}
+	c.Header(HeaderRateLimitLimit, strconv.Itoa(limit.Limit))
+	c.Header(HeaderRateLimitRemaining, strconv.Itoa(limit.Remaining))
+	c.Header(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(limit.Reset)))
+	if !limit.Allowed {
+		c.Header("Retry-After", strconv.Itoa(max(1, ceilSeconds(limit.RetryAfter))))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func rateLimitedProblem(tenantId string) Problem {
+	return Problem{
+		Type:   ProblemTypeRateLimited,
+		Title:  http.StatusText(http.StatusTooManyRequests),
+		Detail: "limite de pulsos por segundo excedido para o tenant " + tenantId,
+		Code:   CodeRateLimited,
+	}
+}
@@ -2,6 +2,7 @@ package pulse
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -9,15 +10,20 @@ import (
 
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
 	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
 	"github.com/ThalysSilva/ingestor-consumo/pkg/utils"
 	"github.com/rs/zerolog/log"
 )
 
+// ErrServiceStopped indica que o serviço está finalizando e não aceita novos pulsos
+var ErrServiceStopped = errors.New("serviço de pulsos finalizado")
+
 type PulseService interface {
 	// EnqueuePulse adiciona um pulso ao canal pulseChan para processamento.
-	// O método verifica se o contexto foi cancelado antes de adicionar o pulso ao canal.
-	// Se o canal estiver cheio, o método não adiciona o pulso e não bloqueia.
-	EnqueuePulse(pulse Pulse)
+	// Retorna ErrServiceStopped se o serviço estiver finalizando ou se o contexto tiver sido cancelado,
+	// garantindo que todo pulso aceito (retorno nil) será gravado durante a drenagem.
+	// Se o canal estiver cheio, o método aguarda espaço disponível.
+	EnqueuePulse(pulse Pulse) error
 
 	// Start inicia o serviço de pulsos, criando os workers para processar os pulsos recebidos.
 	// O parâmetro workers define o número de workers a serem criados.
@@ -29,6 +35,23 @@ type PulseService interface {
 	// O método aguarda a finalização de todos os workers antes de retornar.
 	// O método não deve ser chamado antes de iniciar o serviço.
 	Stop()
+
+	// Shutdown deixa de aceitar novos pulsos e drena o canal para o Redis.
+	// Os workers continuam gravando mesmo que o contexto do serviço já tenha sido cancelado;
+	// se ctx expirar antes do fim da drenagem, as gravações pendentes são abortadas e o erro de ctx é retornado.
+	Shutdown(ctx context.Context) error
+
+	// Status retorna um resumo do estado do serviço para as verificações de prontidão.
+	// O método não acessa o Redis e pode ser chamado a qualquer momento, inclusive durante a drenagem.
+	Status() Status
+}
+
+// Status resume o estado do serviço de pulsos
+type Status struct {
+	QueueLength   int
+	QueueCapacity int
+	Generation    string
+	ShuttingDown  bool
 }
 
 type pulseService struct {
@@ -37,39 +60,97 @@ type pulseService struct {
 	ctx              context.Context
 	wg               sync.WaitGroup
 	generationAtomic atomic.Value
-	generation       generation.ManagerGeneration
+	// store guarda os agregados e a geração atual (veja WithUsageStore)
+	store usagestore.UsageStore
+
+	// closeMu protege o fechamento do canal contra envios concorrentes
+	closeMu      sync.RWMutex
+	closed       bool
+	quit         chan struct{}
+	workCtx      context.Context
+	cancelWork   context.CancelFunc
+	shutdownOnce sync.Once
+	shutdownErr  error
+	// shuttingDown é marcado antes de adquirir closeMu para que Status não aguarde envios bloqueados
+	shuttingDown atomic.Bool
+
+	accepted atomic.Int64
+	stored   atomic.Int64
+	failed   atomic.Int64
+
+	// keepOriginalUnit desativa a conversão para a unidade canônica antes da gravação
+	keepOriginalUnit bool
+	// usageTracker acompanha o consumo dos pulsos gravados, se configurado
+	usageTracker UsageTracker
+	// ledger registra os totais gravados para a conciliação (veja WithLedger)
+	ledger usagestore.Ledger
 }
 
 type ServiceOptions func(*pulseService)
 
+// DefaultChannelSize é a capacidade padrão do canal de pulsos
+const DefaultChannelSize = 50000
+
+// WithChannelSize define a capacidade do canal de pulsos aguardando processamento
+func WithChannelSize(size int) ServiceOptions {
+	return func(ps *pulseService) {
+		ps.pulseChan = make(chan Pulse, size)
+	}
+}
+
+// WithKeepOriginalUnit grava os pulsos na unidade em que foram recebidos, sem convertê-los para a unidade base da dimensão.
+// Nesse modo, valores da mesma dimensão em unidades diferentes geram agregados separados no Redis.
+func WithKeepOriginalUnit() ServiceOptions {
+	return func(ps *pulseService) {
+		ps.keepOriginalUnit = true
+	}
+}
+
+// WithUsageStore grava os agregados no store informado em vez do Redis de redisClient,
+// como o usagestore.NewMemoryStore para executar o ingestor sem serviços externos
+func WithUsageStore(store usagestore.UsageStore) ServiceOptions {
+	return func(ps *pulseService) {
+		ps.store = store
+	}
+}
+
 // NewPulseService cria uma nova instância do serviço de pulsos
 // com um cliente Redis e uma URL de API para envio de pulsos
 // O parâmetro batchQtyToSend define a quantidade de pulsos a serem enviados em cada lote
 // O parâmetro opts permite passar opções adicionais para o serviço
 // O parâmetro ctx é o contexto de execução
-// O parâmetro redisClient é o cliente Redis a ser utilizado
+// O parâmetro redisClient é o cliente Redis a ser utilizado, e pode ser nil com WithUsageStore
 // O parâmetro apiURLSender é a URL da API para envio de pulsos após agregação
 func NewPulseService(ctx context.Context, redisClient clients.RedisClient, opts ...ServiceOptions) PulseService {
 	registerMetrics()
-	generation := generation.NewManagerGeneration(redisClient, ctx)
 
+	// As gravações no Redis não herdam o cancelamento de ctx para que a drenagem
+	// no Shutdown consiga persistir os pulsos já aceitos
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
 	psv := &pulseService{
-		pulseChan:   make(chan Pulse, 50000),
+		pulseChan:   make(chan Pulse, DefaultChannelSize),
 		redisClient: redisClient,
 		ctx:         ctx,
-		generation:  generation,
+		quit:        make(chan struct{}),
+		workCtx:     workCtx,
+		cancelWork:  cancelWork,
+	}
+
+	for _, opt := range opts {
+		opt(psv)
 	}
-	currentGeneration, err := generation.GetCurrentGeneration()
+	if psv.store == nil {
+		psv.store = usagestore.NewRedisStore(ctx, psv.redisClient)
+	}
+
+	currentGeneration, err := psv.store.GetCurrentGeneration()
 	if err != nil {
 		log.Error().Err(err).Msg("Erro ao obter a geração atual")
+		cancelWork()
 		return nil
 	}
 	psv.generationAtomic.Store(currentGeneration)
 
-	for _, opt := range opts {
-		opt(psv)
-	}
-
 	return psv
 }
 
@@ -80,12 +161,14 @@ func (s *pulseService) refreshCurrentGeneration(timeout time.Duration) {
 	for {
 		select {
 		case <-ticker.C:
-			currentGen, err := s.generation.GetCurrentGeneration()
+			currentGen, err := s.store.GetCurrentGeneration()
 			if err != nil {
 				log.Error().Err(err).Msg("Erro ao obter geração atual")
 				continue
 			}
 			s.generationAtomic.Store(currentGen)
+		case <-s.quit:
+			return
 		case <-s.ctx.Done():
 			return
 		}
@@ -101,17 +184,74 @@ func (s *pulseService) Start(workers int, refreshTimeGeneration time.Duration) {
 }
 
 func (s *pulseService) Stop() {
-	close(s.pulseChan)
-	s.wg.Wait()
-	log.Info().Msg("Todos os workers foram finalizados")
+	_ = s.Shutdown(context.Background())
 }
 
-func (s *pulseService) EnqueuePulse(pulse Pulse) {
+func (s *pulseService) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shuttingDown.Store(true)
+		s.closeMu.Lock()
+		s.closed = true
+		close(s.quit)
+		close(s.pulseChan)
+		s.closeMu.Unlock()
+
+		pending := len(s.pulseChan)
+		log.Info().Int("pending", pending).Msg("Drenando pulsos pendentes para o Redis")
+
+		done := make(chan struct{})
+		go func() {
+			s.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.cancelWork()
+			<-done
+			s.shutdownErr = fmt.Errorf("drenagem interrompida com %d pulsos pendentes: %w", len(s.pulseChan), ctx.Err())
+		}
+		s.cancelWork()
+		if s.shutdownErr == nil && len(s.pulseChan) > 0 {
+			s.shutdownErr = fmt.Errorf("%d pulsos pendentes não foram drenados: nenhum worker em execução", len(s.pulseChan))
+		}
+
+		channelBufferSize.Set(float64(len(s.pulseChan)))
+		log.Info().
+			Int64("accepted", s.accepted.Load()).
+			Int64("stored", s.stored.Load()).
+			Int64("failed", s.failed.Load()).
+			Err(s.shutdownErr).
+			Msg("Todos os workers foram finalizados")
+	})
+	return s.shutdownErr
+}
+
+func (s *pulseService) Status() Status {
+	gen, _ := s.generationAtomic.Load().(string)
+	return Status{
+		QueueLength:   len(s.pulseChan),
+		QueueCapacity: cap(s.pulseChan),
+		Generation:    gen,
+		ShuttingDown:  s.shuttingDown.Load(),
+	}
+}
+
+func (s *pulseService) EnqueuePulse(pulse Pulse) error {
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+	if s.closed {
+		return ErrServiceStopped
+	}
+
 	select {
 	case s.pulseChan <- pulse:
+		s.accepted.Add(1)
 		channelBufferSize.Set(float64(len(s.pulseChan)))
+		return nil
 	case <-s.ctx.Done():
-		return
+		return ErrServiceStopped
 	}
 }
 
@@ -122,10 +262,13 @@ func (s *pulseService) processPulses() {
 	defer s.wg.Done()
 	for pulse := range s.pulseChan {
 		start := time.Now()
-		if err := s.storePulseInRedis(s.ctx, s.redisClient, pulse); err != nil {
+		if err := s.storePulse(s.workCtx, pulse); err != nil {
+			s.failed.Add(1)
 			log.Error().Err(err).Str("tenant_id", pulse.TenantId).Msg("Erro ao armazenar pulso no Redis")
 		} else {
+			s.stored.Add(1)
 			pulsesReceived.Inc()
+			s.track(pulse)
 		}
 		duration := time.Since(start).Seconds()
 		pulseProcessingTime.Observe(duration)
@@ -134,21 +277,65 @@ func (s *pulseService) processPulses() {
 	}
 }
 
-// O método é executado em um goroutine e aguarda a finalização do worker
-// O método processa os pulsos recebidos do canal pulseChan e os armazena no Redis
-// Caso ocorra um erro ao armazenar o pulso, ele é registrado no log
-func (s *pulseService) storePulseInRedis(ctx context.Context, client clients.RedisClient, pulse Pulse) error {
-	return utils.Retry(func() error {
-		gen := s.generationAtomic.Load().(string)
-		key := fmt.Sprintf("generation:%s:tenant:%s:sku:%s:useUnit:%s", gen, pulse.TenantId, pulse.ProductSku, pulse.UseUnit)
+// track informa o pulso gravado ao usageTracker. O pulso não é repetido em caso de erro,
+// pois a gravação da agregação já foi concluída.
+func (s *pulseService) track(pulse Pulse) {
+	if s.usageTracker == nil {
+		return
+	}
+	if err := s.usageTracker.Track(s.workCtx, pulse); err != nil {
+		log.Error().Err(err).Str("tenant_id", pulse.TenantId).Str("product_sku", pulse.ProductSku).Msg("Erro ao acompanhar o consumo do pulso")
+	}
+}
 
+// storePulse grava o pulso no agregado do tenant na geração atual.
+// O método é executado pelos workers e repete a gravação em caso de erro.
+func (s *pulseService) storePulse(ctx context.Context, pulse Pulse) error {
+	if !s.keepOriginalUnit {
+		normalized, err := pulse.Normalize()
+		if err != nil {
+			return err
+		}
+		pulse = normalized
+	}
+	// storedGen é a geração em que o agregado já foi gravado; nas tentativas seguintes apenas o índice é repetido,
+	// para que o valor não seja somado duas vezes
+	var storedGen string
+	// written é o incremento gravado no agregado, registrado no ledger mesmo que o índice não seja gravado
+	var written *usagestore.Increment
+	err := utils.Retry(func() error {
 		redisAccessCount.Inc()
-
-		if err := client.IncrByFloat(ctx, key, pulse.UsedAmount).Err(); err != nil {
-			log.Error().Str("key", key).Err(err).Msg("Erro ao armazenar pulso no Redis")
+		if storedGen != "" {
+			if err := s.store.Index(ctx, storedGen, pulse.TenantId); err != nil {
+				log.Warn().Str("generation", storedGen).Str("tenant_id", pulse.TenantId).Err(err).Msg("Erro ao registrar o tenant no índice da geração")
+				return err
+			}
+			return nil
+		}
+		inc := usagestore.Increment{
+			Generation: s.generationAtomic.Load().(string),
+			TenantId:   pulse.TenantId,
+			Field:      generation.Field(pulse.ProductSku, string(pulse.UseUnit), AmountScale()),
+			Units:      pulse.UsedAmount.Units(),
+			Max:        pulse.UseUnit.Aggregation() == AggregationMax,
+		}
+		err := s.store.Increment(ctx, inc)
+		if err == nil || errors.Is(err, usagestore.ErrNotIndexed) {
+			written = &inc
+		}
+		if errors.Is(err, usagestore.ErrNotIndexed) {
+			storedGen = inc.Generation
+			log.Warn().Str("generation", inc.Generation).Str("tenant_id", pulse.TenantId).Err(err).Msg("Erro ao registrar o tenant no índice da geração")
+			return err
+		}
+		if err != nil {
+			log.Error().Str("tenant_id", pulse.TenantId).Str("field", inc.Field).Err(err).Msg("Erro ao armazenar o agregado do pulso")
 			return err
 		}
-
 		return nil
 	}, 3)
+	if written != nil && s.ledger != nil {
+		s.recordLedger(ctx, *written)
+	}
+	return err
 }
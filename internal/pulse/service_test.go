@@ -4,17 +4,32 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients/mocks"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
+// onIncrement espera a gravação do pulso no agregado, feita pelo usagestore com um script Lua
+func onIncrement(redisClient *mocks.MockRedisClient, ctx interface{}, key, field string, units int64) *mock.Call {
+	keys, args := interface{}([]string{key}), interface{}([]interface{}{field, strconv.FormatInt(units, 10)})
+	if key == mock.Anything {
+		keys, args = mock.Anything, mock.Anything
+	}
+	return redisClient.On("Eval", ctx, mock.Anything, keys, args)
+}
+
 // mocks.MockRedisClient é um mock para a interface RedisClient
 func TestMain(m *testing.M) {
 	zerolog.SetGlobalLevel(zerolog.Disabled)
@@ -25,6 +40,8 @@ func TestMain(m *testing.M) {
 		"redisAccessCount":    redisAccessCount,
 		"channelBufferSize":   channelBufferSize,
 		"pulsesProcessed":     pulsesProcessed,
+		"pulsesRejected":      pulsesRejected,
+		"pulsesQuarantined":   pulsesQuarantined,
 	}
 
 	pulsesReceived = prometheus.NewCounter(prometheus.CounterOpts{Name: "ingestor_pulses_received_total"})
@@ -33,6 +50,8 @@ func TestMain(m *testing.M) {
 
 	channelBufferSize = prometheus.NewGauge(prometheus.GaugeOpts{Name: "ingestor_channel_buffer_size"})
 	pulsesProcessed = prometheus.NewCounter(prometheus.CounterOpts{Name: "ingestor_pulses_processed_total"})
+	pulsesRejected = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "ingestor_pulses_rejected_total"}, []string{"code"})
+	pulsesQuarantined = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "ingestor_pulses_quarantined_total"}, []string{"code"})
 
 	exitCode := m.Run()
 
@@ -41,6 +60,8 @@ func TestMain(m *testing.M) {
 	redisAccessCount = originalMetrics["redisAccessCount"].(prometheus.Counter)
 	channelBufferSize = originalMetrics["channelBufferSize"].(prometheus.Gauge)
 	pulsesProcessed = originalMetrics["pulsesProcessed"].(prometheus.Counter)
+	pulsesRejected = originalMetrics["pulsesRejected"].(*prometheus.CounterVec)
+	pulsesQuarantined = originalMetrics["pulsesQuarantined"].(*prometheus.CounterVec)
 
 	os.Exit(exitCode)
 }
@@ -74,7 +95,9 @@ func TestNewPulseService(t *testing.T) {
 		initialRedisClient.On("Set", ctx, "current_generation", "A", time.Duration(0)).Return(nil)
 		initialRedisClient.On("Close").Return(nil)
 
+		// as opções são aplicadas antes da leitura da geração, que utiliza o cliente definido por elas
 		anotherRedisClient := new(mocks.MockRedisClient)
+		anotherRedisClient.On("Get", ctx, "current_generation").Return("B", nil)
 		var addressRedisClientSettled *clients.RedisClient
 
 		svc := NewPulseService(ctx, initialRedisClient, func(ps *pulseService) {
@@ -86,6 +109,17 @@ func TestNewPulseService(t *testing.T) {
 		assert.NotEqual(t, initialRedisClient, *addressRedisClientSettled)
 	})
 
+	t.Run("UsingUsageStore", func(t *testing.T) {
+		ctx := context.Background()
+		store := usagestore.NewMemoryStore()
+		_, err := store.ToggleGeneration()
+		require.NoError(t, err)
+
+		svc := NewPulseService(ctx, nil, WithUsageStore(store))
+		require.NotNil(t, svc)
+		assert.Equal(t, "B", svc.Status().Generation)
+	})
+
 }
 
 func TestStartAndStop(t *testing.T) {
@@ -97,17 +131,18 @@ func TestStartAndStop(t *testing.T) {
 		testPulse := &Pulse{
 			TenantId:   "tenant1",
 			ProductSku: "sku1",
-			UsedAmount: 100,
+			UsedAmount: MustParseAmount("100"),
 			UseUnit:    "KB",
 		}
-		redisClient.On("IncrByFloat", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB", testPulse.UsedAmount).Return(nil)
+		redisClient.On("SAdd", mock.Anything, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil)
+		onIncrement(redisClient, mock.Anything, "generation:A:{tenant1}", "sku1:B:6", int64(100*1024e6)).Return(nil, nil)
 
 		svc := NewPulseService(ctx, redisClient)
-		svc.EnqueuePulse(*testPulse)
+		assert.NoError(t, svc.EnqueuePulse(*testPulse))
 		svc.Start(2, 100*time.Millisecond)
 		time.Sleep(500 * time.Millisecond)
-		redisClient.AssertExpectations(t)
 		svc.Stop()
+		redisClient.AssertExpectations(t)
 		assert.NotNil(t, svc)
 	})
 
@@ -118,17 +153,17 @@ func TestStartAndStop(t *testing.T) {
 		testPulse := &Pulse{
 			TenantId:   "tenant1",
 			ProductSku: "sku1",
-			UsedAmount: 100,
+			UsedAmount: MustParseAmount("100"),
 			UseUnit:    "KB",
 		}
-		redisClient.On("IncrByFloat", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB", testPulse.UsedAmount).Return(fmt.Errorf("redis error"))
+		redisClient.On("SAdd", mock.Anything, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil)
+		onIncrement(redisClient, mock.Anything, "generation:A:{tenant1}", "sku1:B:6", int64(100*1024e6)).Return(nil, fmt.Errorf("redis error"))
 
 		svc := NewPulseService(ctx, redisClient)
-		svc.EnqueuePulse(*testPulse)
+		assert.NoError(t, svc.EnqueuePulse(*testPulse))
 		svc.Start(2, 1*time.Minute)
-		time.Sleep(time.Millisecond)
-		redisClient.AssertExpectations(t)
 		svc.Stop()
+		redisClient.AssertExpectations(t)
 		assert.NotNil(t, svc)
 	})
 }
@@ -144,12 +179,11 @@ func TestEnqueuePulse(t *testing.T) {
 		pulse := Pulse{
 			TenantId:   "tenant1",
 			ProductSku: "sku1",
-			UsedAmount: 100,
+			UsedAmount: MustParseAmount("100"),
 			UseUnit:    "KB",
 		}
 
-		svc.EnqueuePulse(pulse)
-		assert.True(t, true)
+		assert.NoError(t, svc.EnqueuePulse(pulse))
 	})
 	t.Run("EnqueueWithCancelledCtx", func(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.Background())
@@ -163,11 +197,11 @@ func TestEnqueuePulse(t *testing.T) {
 		pulse := Pulse{
 			TenantId:   "tenant1",
 			ProductSku: "sku1",
-			UsedAmount: 100.0,
+			UsedAmount: MustParseAmount("100.0"),
 			UseUnit:    KB,
 		}
 
-		svc.EnqueuePulse(pulse)
+		assert.ErrorIs(t, svc.EnqueuePulse(pulse), ErrServiceStopped)
 
 		select {
 		case got := <-svc.pulseChan:
@@ -178,47 +212,323 @@ func TestEnqueuePulse(t *testing.T) {
 
 }
 
-func TestStorePulseInRedis(t *testing.T) {
+func TestShutdown(t *testing.T) {
+	t.Run("RejectsPulsesAfterShutdown", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		redisClient.On("Get", ctx, "current_generation").Return("A", nil)
+
+		svc := NewPulseService(ctx, redisClient)
+		svc.Start(1, time.Minute)
+		assert.NoError(t, svc.Shutdown(ctx))
+		assert.ErrorIs(t, svc.EnqueuePulse(Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB}), ErrServiceStopped)
+
+		// Chamadas repetidas não devem fechar o canal novamente
+		assert.NoError(t, svc.Shutdown(ctx))
+		svc.Stop()
+	})
+
+	t.Run("DrainsAfterContextCancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		redisClient := new(mocks.MockRedisClient)
+		redisClient.On("Get", mock.Anything, "current_generation").Return("A", nil)
+		redisClient.On("SAdd", mock.Anything, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil)
+		onIncrement(redisClient, mock.Anything, "generation:A:{tenant1}", "sku1:B:6", int64(1024e6)).Return(nil, nil).Times(3)
+
+		svc := NewPulseService(ctx, redisClient)
+		for range 3 {
+			assert.NoError(t, svc.EnqueuePulse(Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB}))
+		}
+		cancel()
+		svc.Start(1, time.Minute)
+
+		assert.NoError(t, svc.Shutdown(context.Background()))
+		redisClient.AssertExpectations(t)
+	})
+
+	t.Run("DeadlineExceeded", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		redisClient.On("Get", ctx, "current_generation").Return("A", nil)
+		redisClient.On("SAdd", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		onIncrement(redisClient, mock.Anything, mock.Anything, mock.Anything, int64(1024e6)).Return(nil, nil).After(50 * time.Millisecond)
+
+		svc := NewPulseService(ctx, redisClient)
+		for range 2 {
+			assert.NoError(t, svc.EnqueuePulse(Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB}))
+		}
+		svc.Start(1, time.Minute)
+
+		deadline, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		err := svc.Shutdown(deadline)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "pulsos pendentes")
+	})
+
+	t.Run("NoWorkersRunning", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		redisClient.On("Get", ctx, "current_generation").Return("A", nil)
+
+		svc := NewPulseService(ctx, redisClient)
+		assert.NoError(t, svc.EnqueuePulse(Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB}))
+
+		err := svc.Shutdown(ctx)
+		assert.ErrorContains(t, err, "1 pulsos pendentes não foram drenados")
+	})
+}
+
+type usageTrackerFunc func(ctx context.Context, p Pulse) error
+
+func (f usageTrackerFunc) Track(ctx context.Context, p Pulse) error {
+	return f(ctx, p)
+}
+
+func TestUsageTracker(t *testing.T) {
 	ctx := context.Background()
 	redisClient := new(mocks.MockRedisClient)
-	svc := &pulseService{
-		redisClient: redisClient,
-		ctx:         ctx,
+	redisClient.On("Get", ctx, "current_generation").Return("A", nil)
+	redisClient.On("SAdd", mock.Anything, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil)
+	onIncrement(redisClient, mock.Anything, "generation:A:{tenant1}", "sku1:B:6", int64(1024e6)).Return(nil, nil)
+	redisClient.On("SAdd", mock.Anything, "generation:A:tenants", []interface{}{"tenant2"}).Return(nil)
+	onIncrement(redisClient, mock.Anything, "generation:A:{tenant2}", "sku1:B:6", int64(1024e6)).Return(nil, fmt.Errorf("redis error"))
+
+	var tracked []Pulse
+	svc := NewPulseService(ctx, redisClient, WithUsageTracker(usageTrackerFunc(func(ctx context.Context, p Pulse) error {
+		tracked = append(tracked, p)
+		return fmt.Errorf("falha no tracker")
+	})))
+	for _, tenant := range []string{"tenant1", "tenant2", "tenant1"} {
+		assert.NoError(t, svc.EnqueuePulse(Pulse{TenantId: tenant, ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB}))
 	}
-	svc.generationAtomic.Store("A")
+	svc.Start(1, time.Minute)
+	assert.NoError(t, svc.Shutdown(ctx))
+
+	// somente os pulsos gravados são acompanhados, na unidade recebida, e a falha do tracker não afeta a gravação
+	assert.Equal(t, []Pulse{
+		{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB},
+		{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB},
+	}, tracked)
+	assert.Equal(t, int64(2), svc.(*pulseService).stored.Load())
+}
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	redisClient := new(mocks.MockRedisClient)
+	redisClient.On("Get", ctx, "current_generation").Return("B", nil)
+
+	svc := NewPulseService(ctx, redisClient, WithChannelSize(10))
+	assert.NoError(t, svc.EnqueuePulse(Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB}))
+	assert.Equal(t, Status{QueueLength: 1, QueueCapacity: 10, Generation: "B"}, svc.Status())
+
+	redisClient.On("SAdd", mock.Anything, "generation:B:tenants", []interface{}{"tenant1"}).Return(nil)
+	onIncrement(redisClient, mock.Anything, "generation:B:{tenant1}", "sku1:B:6", int64(1024e6)).Return(nil, nil).Once()
+	svc.Start(1, time.Minute)
+	assert.NoError(t, svc.Shutdown(ctx))
+	assert.Equal(t, Status{QueueLength: 0, QueueCapacity: 10, Generation: "B", ShuttingDown: true}, svc.Status())
+}
+
+func TestStorePulse(t *testing.T) {
 	pulse := Pulse{
 		TenantId:   "tenant1",
 		ProductSku: "sku1",
-		UsedAmount: 100,
+		UsedAmount: MustParseAmount("100"),
 		UseUnit:    "KB",
 	}
-	key := fmt.Sprintf("generation:A:tenant:%s:sku:%s:useUnit:%s", pulse.TenantId, pulse.ProductSku, pulse.UseUnit)
-	redisClient.On("IncrByFloat", ctx, key, pulse.UsedAmount).Return(nil)
 
-	err := svc.storePulseInRedis(ctx, redisClient, pulse)
-	assert.NoError(t, err)
-	redisClient.AssertExpectations(t)
+	t.Run("NormalizesToBaseUnit", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		svc := &pulseService{
+			store: usagestore.NewRedisStore(ctx, redisClient),
+			ctx:   ctx,
+		}
+		svc.generationAtomic.Store("A")
+		redisClient.On("SAdd", ctx, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil)
+		onIncrement(redisClient, ctx, "generation:A:{tenant1}", "sku1:B:6", int64(102400e6)).Return(nil, nil)
+
+		err := svc.storePulse(ctx, pulse)
+		assert.NoError(t, err)
+		redisClient.AssertExpectations(t)
+	})
+
+	t.Run("KeepOriginalUnit", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		svc := &pulseService{
+			store: usagestore.NewRedisStore(ctx, redisClient),
+			ctx:   ctx,
+		}
+		WithKeepOriginalUnit()(svc)
+		svc.generationAtomic.Store("A")
+		redisClient.On("SAdd", ctx, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil)
+		onIncrement(redisClient, ctx, "generation:A:{tenant1}", "sku1:KB:6", pulse.UsedAmount.Units()).Return(nil, nil)
+
+		err := svc.storePulse(ctx, pulse)
+		assert.NoError(t, err)
+		redisClient.AssertExpectations(t)
+	})
+
+	t.Run("MaxAggregationKeepsHighestValue", func(t *testing.T) {
+		registry, err := NewUnitRegistry([]UnitDefinition{
+			{Name: "conn", Dimension: "connections", Factor: 1, Aggregation: AggregationMax},
+			{Name: "kconn", Dimension: "connections", Factor: 1000, Aggregation: AggregationMax},
+		})
+		assert.NoError(t, err)
+		original := Units()
+		SetUnitRegistry(registry)
+		defer SetUnitRegistry(original)
+
+		ctx := context.Background()
+		mr := miniredis.RunT(t)
+		redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer redisClient.Close()
+		svc := &pulseService{store: usagestore.NewRedisStore(ctx, redisClient), ctx: ctx}
+		svc.generationAtomic.Store("A")
+
+		for _, p := range []Pulse{
+			{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("500"), UseUnit: "conn"},
+			{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1.5"), UseUnit: "kconn"},
+			{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("900"), UseUnit: "conn"},
+		} {
+			assert.NoError(t, svc.storePulse(ctx, p))
+		}
+		assert.Equal(t, "1500000000", mr.HGet("generation:A:{tenant1}", "sku1:conn:6"))
+	})
+
+	t.Run("HashPerTenant", func(t *testing.T) {
+		registry, err := NewUnitRegistry(append(DefaultUnits(), UnitDefinition{Name: "conn", Dimension: "connections", Factor: 1, Aggregation: AggregationMax}))
+		assert.NoError(t, err)
+		original := Units()
+		SetUnitRegistry(registry)
+		defer SetUnitRegistry(original)
+
+		ctx := context.Background()
+		mr := miniredis.RunT(t)
+		redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		defer redisClient.Close()
+		svc := &pulseService{store: usagestore.NewRedisStore(ctx, redisClient), ctx: ctx}
+		svc.generationAtomic.Store("B")
+
+		for _, p := range []Pulse{
+			{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB},
+			{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("512"), UseUnit: B},
+			{TenantId: "tenant1", ProductSku: "sku2", UsedAmount: MustParseAmount("30"), UseUnit: "conn"},
+			{TenantId: "tenant1", ProductSku: "sku2", UsedAmount: MustParseAmount("10"), UseUnit: "conn"},
+			{TenantId: "tenant2", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KBxSec},
+		} {
+			assert.NoError(t, svc.storePulse(ctx, p))
+		}
+		assert.ElementsMatch(t, []string{"generation:B:{tenant1}", "generation:B:{tenant2}", "generation:B:tenants"}, mr.Keys())
+		tenants, err := mr.Members("generation:B:tenants")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"tenant1", "tenant2"}, tenants)
+		assert.Equal(t, "1536000000", mr.HGet("generation:B:{tenant1}", "sku1:B:6"))
+		assert.Equal(t, "30000000", mr.HGet("generation:B:{tenant1}", "sku2:conn:6"))
+		assert.Equal(t, "1024000000", mr.HGet("generation:B:{tenant2}", "sku1:B/sec:6"))
+	})
+
+	t.Run("InvalidUnit", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		svc := &pulseService{
+			store: usagestore.NewRedisStore(ctx, redisClient),
+			ctx:   ctx,
+		}
+		svc.generationAtomic.Store("A")
+
+		err := svc.storePulse(ctx, Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: "TB"})
+		assert.ErrorContains(t, err, "unrecognized pulse unit: TB")
+		redisClient.AssertNotCalled(t, "Eval", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
 }
 
-func TestStorePulseInRedis_RetryOnError(t *testing.T) {
+func TestStorePulse_RetryOnError(t *testing.T) {
 	ctx := context.Background()
 	redisClient := new(mocks.MockRedisClient)
 	svc := &pulseService{
-		redisClient: redisClient,
-		ctx:         ctx,
+		store: usagestore.NewRedisStore(ctx, redisClient),
+		ctx:   ctx,
 	}
 	svc.generationAtomic.Store("A")
 	pulse := Pulse{
 		TenantId:   "tenant1",
 		ProductSku: "sku1",
-		UsedAmount: 100,
+		UsedAmount: MustParseAmount("100"),
 		UseUnit:    "KB",
 	}
-	key := fmt.Sprintf("generation:A:tenant:%s:sku:%s:useUnit:%s", pulse.TenantId, pulse.ProductSku, pulse.UseUnit)
-	redisClient.On("IncrByFloat", ctx, key, pulse.UsedAmount).Return(fmt.Errorf("redis error")).Once()
-	redisClient.On("IncrByFloat", ctx, key, pulse.UsedAmount).Return(nil).Once()
+	redisClient.On("SAdd", ctx, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil)
+	onIncrement(redisClient, ctx, "generation:A:{tenant1}", "sku1:B:6", int64(100*1024e6)).Return(nil, fmt.Errorf("redis error")).Once()
+	onIncrement(redisClient, ctx, "generation:A:{tenant1}", "sku1:B:6", int64(100*1024e6)).Return(nil, nil).Once()
 
-	err := svc.storePulseInRedis(ctx, redisClient, pulse)
+	err := svc.storePulse(ctx, pulse)
 	assert.NoError(t, err)
 	redisClient.AssertExpectations(t)
 }
+
+func TestStorePulse_RetryIndexOnly(t *testing.T) {
+	ctx := context.Background()
+	redisClient := new(mocks.MockRedisClient)
+	svc := &pulseService{
+		store: usagestore.NewRedisStore(ctx, redisClient),
+		ctx:   ctx,
+	}
+	svc.generationAtomic.Store("A")
+	pulse := Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: B}
+	redisClient.On("SAdd", ctx, "generation:A:tenants", []interface{}{"tenant1"}).Return(fmt.Errorf("redis error")).Once()
+	redisClient.On("SAdd", ctx, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil).Once()
+	// o agregado já gravado não é somado novamente, mesmo que a geração mude entre as tentativas
+	onIncrement(redisClient, ctx, "generation:A:{tenant1}", "sku1:B:6", int64(1e6)).Run(func(mock.Arguments) {
+		svc.generationAtomic.Store("B")
+	}).Return(nil, nil).Once()
+
+	assert.NoError(t, svc.storePulse(ctx, pulse))
+	redisClient.AssertExpectations(t)
+}
+
+type failingLedger struct {
+	usagestore.Ledger
+}
+
+func (failingLedger) Record(ctx context.Context, inc usagestore.Increment) error {
+	return fmt.Errorf("ledger indisponível")
+}
+
+func TestStorePulse_Ledger(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("RecordsStoredIncrements", func(t *testing.T) {
+		redisClient := new(mocks.MockRedisClient)
+		ledger := usagestore.NewMemoryLedger()
+		svc := &pulseService{
+			store:  usagestore.NewRedisStore(ctx, redisClient),
+			ctx:    ctx,
+			ledger: ledger,
+		}
+		svc.generationAtomic.Store("A")
+		redisClient.On("SAdd", ctx, "generation:A:tenants", []interface{}{"tenant1"}).Return(fmt.Errorf("redis error")).Once()
+		redisClient.On("SAdd", ctx, "generation:A:tenants", []interface{}{"tenant1"}).Return(nil)
+		onIncrement(redisClient, ctx, "generation:A:{tenant1}", "sku1:B:6", int64(1e6)).Return(nil, nil).Once()
+		onIncrement(redisClient, ctx, "generation:A:{tenant1}", "sku2:B:6", int64(1e6)).Return(nil, fmt.Errorf("redis error"))
+
+		// o incremento repetido apenas no índice é registrado uma vez; o que não foi gravado não é registrado
+		assert.NoError(t, svc.storePulse(ctx, Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: B}))
+		assert.Error(t, svc.storePulse(ctx, Pulse{TenantId: "tenant1", ProductSku: "sku2", UsedAmount: MustParseAmount("1"), UseUnit: B}))
+		entries, err := ledger.Close(ctx, "A")
+		require.NoError(t, err)
+		assert.Equal(t, []usagestore.LedgerEntry{{TenantId: "tenant1", Field: "sku1:B:6", Pulses: 1, Units: 1e6}}, entries)
+	})
+
+	t.Run("FailureDoesNotAffectStore", func(t *testing.T) {
+		store := usagestore.NewMemoryStore()
+		svc := NewPulseService(ctx, nil, WithUsageStore(store), WithLedger(failingLedger{})).(*pulseService)
+		failures := testutil.ToFloat64(ledgerFailures)
+
+		assert.NoError(t, svc.storePulse(ctx, Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB}))
+		assert.Equal(t, failures+1, testutil.ToFloat64(ledgerFailures))
+		fields, err := store.Read(ctx, "A", "tenant1", false)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"sku1:B:6": "1024000000"}, fields)
+	})
+}
@@ -0,0 +1,85 @@
+package pulse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGracefulShutdownLosesNoAcknowledgedPulse sobe o handler real atrás de um http.Server,
+// envia pulsos concorrentes enquanto executa a mesma sequência de parada do cmd/ingestor
+// e verifica que todo pulso respondido com 204 foi agregado no Redis.
+func TestGracefulShutdownLosesNoAcknowledgedPulse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisClient.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc := NewPulseService(ctx, redisClient, WithChannelSize(64))
+	require.NotNil(t, svc)
+	svc.Start(4, time.Minute)
+
+	r := gin.New()
+	r.POST("/ingest", NewPulseHandler(svc).Ingestor())
+	server := &http.Server{Handler: r}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+
+	url := "http://" + listener.Addr().String() + "/ingest"
+	body, _ := json.Marshal(Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: MustParseAmount("1"), UseUnit: KB})
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	var acknowledged atomic.Int64
+	var stopClients atomic.Bool
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stopClients.Load() {
+				resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+				if err != nil {
+					continue
+				}
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusNoContent {
+					acknowledged.Add(1)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	// Mesma ordem do cmd/ingestor: para de aceitar conexões, aguarda os handlers e drena o canal
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	require.NoError(t, server.Shutdown(shutdownCtx))
+	cancel()
+	require.NoError(t, svc.Shutdown(shutdownCtx))
+	stopClients.Store(true)
+	wg.Wait()
+
+	require.Positive(t, acknowledged.Load())
+	// Os pulsos em KB são gravados na unidade canônica (B)
+	total, err := ParseScaledAmount(mr.HGet("generation:A:{tenant1}", "sku1:B:6"), 6)
+	require.NoError(t, err)
+	assert.Equal(t, acknowledged.Load()*1024, total.Units()/1e6)
+	assert.True(t, errors.Is(svc.EnqueuePulse(Pulse{}), ErrServiceStopped))
+}
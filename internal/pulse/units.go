@@ -0,0 +1,292 @@
+package pulse
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Dimension é a grandeza medida por uma unidade. Só é possível converter entre unidades da mesma dimensão.
+type Dimension string
+
+const (
+	// Volume é medido em bytes
+	Volume Dimension = "volume"
+	// Rate é medido em bytes por segundo
+	Rate Dimension = "rate"
+)
+
+// AggregationKind define como os pulsos de uma dimensão são combinados em um ciclo
+type AggregationKind string
+
+const (
+	// AggregationSum soma os valores recebidos (ex.: bytes transferidos, requisições)
+	AggregationSum AggregationKind = "sum"
+	// AggregationMax mantém o maior valor recebido (ex.: pico de conexões simultâneas)
+	AggregationMax AggregationKind = "max"
+)
+
+// UnitDefinition descreve uma unidade aceita nos pulsos
+type UnitDefinition struct {
+	// Name é o valor informado em use_unit. Não pode conter ":", "*" nem espaços, pois compõe a chave no Redis.
+	Name PulseUnit `yaml:"name" toml:"name" json:"name" swaggertype:"string" example:"KB"`
+	// Dimension agrupa as unidades conversíveis entre si
+	Dimension Dimension `yaml:"dimension" toml:"dimension" json:"dimension" swaggertype:"string" example:"volume"`
+	// Factor é a quantidade de unidades base em uma unidade. A unidade base da dimensão tem fator 1.
+	Factor float64 `yaml:"factor" toml:"factor" json:"factor" example:"1024"`
+	// Aggregation é a forma de agregação da dimensão; quando vazio, utiliza sum
+	Aggregation AggregationKind `yaml:"aggregation" toml:"aggregation" json:"aggregation" example:"sum"`
+}
+
+// UnitRegistry é o conjunto de unidades aceitas, consultado na validação, na conversão e na agregação dos pulsos
+type UnitRegistry struct {
+	definitions []UnitDefinition
+	byName      map[PulseUnit]UnitDefinition
+	bases       map[Dimension]PulseUnit
+	// display são as unidades de cada dimensão em ordem crescente de fator
+	display map[Dimension][]PulseUnit
+}
+
+// DefaultUnits retorna as unidades de volume e taxa em bytes, com fator 1024 entre unidades consecutivas
+func DefaultUnits() []UnitDefinition {
+	return []UnitDefinition{
+		{Name: B, Dimension: Volume, Factor: 1, Aggregation: AggregationSum},
+		{Name: KB, Dimension: Volume, Factor: 1 << 10, Aggregation: AggregationSum},
+		{Name: MB, Dimension: Volume, Factor: 1 << 20, Aggregation: AggregationSum},
+		{Name: GB, Dimension: Volume, Factor: 1 << 30, Aggregation: AggregationSum},
+		{Name: BxSec, Dimension: Rate, Factor: 1, Aggregation: AggregationSum},
+		{Name: KBxSec, Dimension: Rate, Factor: 1 << 10, Aggregation: AggregationSum},
+		{Name: MBxSec, Dimension: Rate, Factor: 1 << 20, Aggregation: AggregationSum},
+		{Name: GBxSec, Dimension: Rate, Factor: 1 << 30, Aggregation: AggregationSum},
+	}
+}
+
+// NewUnitRegistry valida as definições e cria o registro.
+// Cada dimensão deve ter exatamente uma unidade com fator 1 e uma única forma de agregação.
+// Todos os problemas encontrados são retornados de uma vez.
+func NewUnitRegistry(definitions []UnitDefinition) (*UnitRegistry, error) {
+	if len(definitions) == 0 {
+		return nil, errors.New("nenhuma unidade definida")
+	}
+
+	r := &UnitRegistry{
+		byName:  make(map[PulseUnit]UnitDefinition, len(definitions)),
+		bases:   make(map[Dimension]PulseUnit),
+		display: make(map[Dimension][]PulseUnit),
+	}
+	aggregations := make(map[Dimension]AggregationKind)
+	var errs []error
+	for i, def := range definitions {
+		if def.Aggregation == "" {
+			def.Aggregation = AggregationSum
+		}
+		switch {
+		case def.Name == "":
+			errs = append(errs, fmt.Errorf("unidade %d: nome não informado", i))
+			continue
+		case strings.ContainsAny(string(def.Name), ":* \t\n"):
+			errs = append(errs, fmt.Errorf("unidade %q: o nome não pode conter ':', '*' nem espaços", def.Name))
+			continue
+		}
+		if _, exists := r.byName[def.Name]; exists {
+			errs = append(errs, fmt.Errorf("unidade %q: definida mais de uma vez", def.Name))
+			continue
+		}
+		if def.Dimension == "" {
+			errs = append(errs, fmt.Errorf("unidade %q: dimensão não informada", def.Name))
+			continue
+		}
+		if def.Factor <= 0 || math.IsInf(def.Factor, 0) || math.IsNaN(def.Factor) {
+			errs = append(errs, fmt.Errorf("unidade %q: fator deve ser maior que 0, recebido: %g", def.Name, def.Factor))
+			continue
+		}
+		if def.Aggregation != AggregationSum && def.Aggregation != AggregationMax {
+			errs = append(errs, fmt.Errorf("unidade %q: agregação inválida %q (use sum ou max)", def.Name, def.Aggregation))
+			continue
+		}
+		if agg, ok := aggregations[def.Dimension]; ok && agg != def.Aggregation {
+			errs = append(errs, fmt.Errorf("unidade %q: a dimensão %q já utiliza a agregação %s", def.Name, def.Dimension, agg))
+			continue
+		}
+		aggregations[def.Dimension] = def.Aggregation
+		if def.Factor == 1 {
+			if base, ok := r.bases[def.Dimension]; ok {
+				errs = append(errs, fmt.Errorf("unidade %q: a dimensão %q já tem a unidade base %s", def.Name, def.Dimension, base))
+				continue
+			}
+			r.bases[def.Dimension] = def.Name
+		}
+
+		r.byName[def.Name] = def
+		r.definitions = append(r.definitions, def)
+		r.display[def.Dimension] = append(r.display[def.Dimension], def.Name)
+	}
+	for dim := range r.display {
+		if _, ok := r.bases[dim]; !ok {
+			errs = append(errs, fmt.Errorf("dimensão %q: nenhuma unidade com fator 1", dim))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	for dim, names := range r.display {
+		sort.SliceStable(names, func(i, j int) bool { return r.byName[names[i]].Factor < r.byName[names[j]].Factor })
+		r.display[dim] = names
+	}
+	return r, nil
+}
+
+// Definitions retorna as unidades na ordem em que foram definidas
+func (r *UnitRegistry) Definitions() []UnitDefinition {
+	return append([]UnitDefinition(nil), r.definitions...)
+}
+
+// Names retorna os nomes das unidades na ordem em que foram definidas
+func (r *UnitRegistry) Names() []PulseUnit {
+	names := make([]PulseUnit, len(r.definitions))
+	for i, def := range r.definitions {
+		names[i] = def.Name
+	}
+	return names
+}
+
+// Lookup retorna a definição da unidade
+func (r *UnitRegistry) Lookup(unit PulseUnit) (UnitDefinition, bool) {
+	def, ok := r.byName[unit]
+	return def, ok
+}
+
+// Base retorna a unidade base da dimensão da unidade, ou vazio se a unidade não estiver registrada
+func (r *UnitRegistry) Base(unit PulseUnit) PulseUnit {
+	return r.bases[r.byName[unit].Dimension]
+}
+
+// Convert converte amount da unidade from para a unidade to.
+// Retorna erro se alguma das unidades não estiver registrada ou se forem de dimensões diferentes.
+func (r *UnitRegistry) Convert(amount float64, from, to PulseUnit) (float64, error) {
+	factor, err := r.factor(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return amount * factor, nil
+}
+
+// ConvertAmount converte amount da unidade from para a unidade to, arredondando o resultado para a escala.
+// Além dos erros de Convert, retorna ErrAmountOverflow se o valor convertido não couber na escala.
+func (r *UnitRegistry) ConvertAmount(amount Amount, from, to PulseUnit) (Amount, error) {
+	factor, err := r.factor(from, to)
+	if err != nil {
+		return Amount{}, err
+	}
+	return amount.Mul(factor)
+}
+
+// factor retorna o fator que converte um valor da unidade from para a unidade to
+func (r *UnitRegistry) factor(from, to PulseUnit) (float64, error) {
+	source, ok := r.byName[from]
+	if !ok {
+		return 0, fmt.Errorf("unrecognized pulse unit: %s", from)
+	}
+	target, ok := r.byName[to]
+	if !ok {
+		return 0, fmt.Errorf("unrecognized pulse unit: %s", to)
+	}
+	if source.Dimension != target.Dimension {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, source.Dimension, to, target.Dimension)
+	}
+	return source.Factor / target.Factor, nil
+}
+
+// Humanize converte amount, expresso na unidade informada, para a maior unidade da mesma dimensão
+// em que o valor seja ao menos 1. Valores menores que 1 unidade base permanecem na unidade base.
+// Unidades não registradas são retornadas sem conversão.
+func (r *UnitRegistry) Humanize(amount float64, unit PulseUnit) (float64, PulseUnit) {
+	base, err := r.Convert(amount, unit, r.Base(unit))
+	if err != nil {
+		return amount, unit
+	}
+	candidates := r.display[r.byName[unit].Dimension]
+	chosen := r.Base(unit)
+	for _, candidate := range candidates {
+		factor := r.byName[candidate].Factor
+		if factor < 1 {
+			continue
+		}
+		if math.Abs(base) < factor {
+			break
+		}
+		chosen = candidate
+	}
+	return base / r.byName[chosen].Factor, chosen
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = mustDefaultRegistry()
+)
+
+func mustDefaultRegistry() *UnitRegistry {
+	r, err := NewUnitRegistry(DefaultUnits())
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Units retorna o registro de unidades em uso
+func Units() *UnitRegistry {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry
+}
+
+// SetUnitRegistry substitui o registro de unidades em uso.
+// Deve ser chamado na inicialização, antes de os pulsos começarem a ser recebidos.
+func SetUnitRegistry(r *UnitRegistry) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = r
+}
+
+// Valida se a unidade está registrada
+func (p PulseUnit) IsValid() bool {
+	_, ok := Units().Lookup(p)
+	return ok
+}
+
+// Dimension retorna a dimensão da unidade, ou vazio se a unidade não estiver registrada
+func (p PulseUnit) Dimension() Dimension {
+	def, _ := Units().Lookup(p)
+	return def.Dimension
+}
+
+// Aggregation retorna a forma de agregação da unidade, ou vazio se a unidade não estiver registrada
+func (p PulseUnit) Aggregation() AggregationKind {
+	def, _ := Units().Lookup(p)
+	return def.Aggregation
+}
+
+// Base retorna a unidade base da dimensão da unidade (B para volume, B/sec para taxa no registro padrão)
+func (p PulseUnit) Base() PulseUnit {
+	return Units().Base(p)
+}
+
+// Convert converte amount da unidade p para a unidade to
+func (p PulseUnit) Convert(amount float64, to PulseUnit) (float64, error) {
+	return Units().Convert(amount, p, to)
+}
+
+// ConvertAmount converte amount da unidade p para a unidade to, arredondando o resultado para a escala
+func (p PulseUnit) ConvertAmount(amount Amount, to PulseUnit) (Amount, error) {
+	return Units().ConvertAmount(amount, p, to)
+}
+
+// Humanize converte amount, expresso na unidade p, para a maior unidade da mesma dimensão
+// em que o valor seja ao menos 1
+func (p PulseUnit) Humanize(amount float64) (float64, PulseUnit) {
+	return Units().Humanize(amount, p)
+}
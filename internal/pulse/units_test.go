@@ -0,0 +1,85 @@
+package pulse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUnitRegistry(t *testing.T) {
+	t.Run("DefaultUnits", func(t *testing.T) {
+		registry, err := NewUnitRegistry(DefaultUnits())
+		require.NoError(t, err)
+		assert.Equal(t, []PulseUnit{B, KB, MB, GB, BxSec, KBxSec, MBxSec, GBxSec}, registry.Names())
+		assert.Equal(t, B, registry.Base(GB))
+		assert.Equal(t, BxSec, registry.Base(KBxSec))
+	})
+
+	t.Run("CustomUnits", func(t *testing.T) {
+		registry, err := NewUnitRegistry([]UnitDefinition{
+			{Name: "cpu-h", Dimension: "cpu", Factor: 3600},
+			{Name: "cpu-s", Dimension: "cpu", Factor: 1},
+			{Name: "conn", Dimension: "connections", Factor: 1, Aggregation: AggregationMax},
+		})
+		require.NoError(t, err)
+
+		def, ok := registry.Lookup("cpu-h")
+		require.True(t, ok)
+		assert.Equal(t, AggregationSum, def.Aggregation, "agregação vazia deve utilizar sum")
+		assert.Equal(t, PulseUnit("cpu-s"), registry.Base("cpu-h"))
+
+		amount, err := registry.Convert(2, "cpu-h", "cpu-s")
+		require.NoError(t, err)
+		assert.Equal(t, 7200.0, amount)
+
+		amount, unit := registry.Humanize(5400, "cpu-s")
+		assert.Equal(t, 1.5, amount)
+		assert.Equal(t, PulseUnit("cpu-h"), unit)
+	})
+
+	tests := []struct {
+		name    string
+		defs    []UnitDefinition
+		wantErr string
+	}{
+		{name: "Empty", defs: nil, wantErr: "nenhuma unidade definida"},
+		{name: "MissingName", defs: []UnitDefinition{{Dimension: "d", Factor: 1}}, wantErr: "unidade 0: nome não informado"},
+		{name: "NameWithColon", defs: []UnitDefinition{{Name: "a:b", Dimension: "d", Factor: 1}}, wantErr: "não pode conter"},
+		{name: "Duplicated", defs: []UnitDefinition{{Name: "a", Dimension: "d", Factor: 1}, {Name: "a", Dimension: "d", Factor: 2}}, wantErr: "definida mais de uma vez"},
+		{name: "MissingDimension", defs: []UnitDefinition{{Name: "a", Factor: 1}}, wantErr: "dimensão não informada"},
+		{name: "InvalidFactor", defs: []UnitDefinition{{Name: "a", Dimension: "d", Factor: 0}}, wantErr: "fator deve ser maior que 0"},
+		{name: "InvalidAggregation", defs: []UnitDefinition{{Name: "a", Dimension: "d", Factor: 1, Aggregation: "avg"}}, wantErr: "agregação inválida"},
+		{name: "MixedAggregation", defs: []UnitDefinition{{Name: "a", Dimension: "d", Factor: 1}, {Name: "b", Dimension: "d", Factor: 2, Aggregation: AggregationMax}}, wantErr: "já utiliza a agregação sum"},
+		{name: "TwoBaseUnits", defs: []UnitDefinition{{Name: "a", Dimension: "d", Factor: 1}, {Name: "b", Dimension: "d", Factor: 1}}, wantErr: "já tem a unidade base a"},
+		{name: "NoBaseUnit", defs: []UnitDefinition{{Name: "a", Dimension: "d", Factor: 2}}, wantErr: "dimensão \"d\": nenhuma unidade com fator 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := NewUnitRegistry(tt.defs)
+			assert.Nil(t, registry)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("ReportsAllErrors", func(t *testing.T) {
+		_, err := NewUnitRegistry([]UnitDefinition{{Name: "a", Factor: 1}, {Name: "b", Dimension: "d", Factor: -1}})
+		assert.ErrorContains(t, err, "dimensão não informada")
+		assert.ErrorContains(t, err, "fator deve ser maior que 0")
+	})
+}
+
+func TestSetUnitRegistry(t *testing.T) {
+	registry, err := NewUnitRegistry([]UnitDefinition{{Name: "req", Dimension: "requests", Factor: 1}})
+	require.NoError(t, err)
+	original := Units()
+	SetUnitRegistry(registry)
+	defer SetUnitRegistry(original)
+
+	assert.True(t, PulseUnit("req").IsValid())
+	assert.False(t, KB.IsValid())
+	_, err = NewPulse("tenant1", "sku1", MustParseAmount("1"), KB)
+	assert.Error(t, err)
+	_, err = NewPulse("tenant1", "sku1", MustParseAmount("1"), "req")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,165 @@
+package pulse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Validator valida um pulso antes de ele ser enfileirado (ex.: regras do catálogo de produtos).
+// Violações devem ser retornadas como *ValidationError para que o código seja informado ao cliente e às métricas.
+type Validator interface {
+	Validate(p Pulse) error
+}
+
+// ValidationError descreve a violação de uma regra de validação do pulso
+type ValidationError struct {
+	// Code identifica a regra violada (ex.: SKU_UNKNOWN) e é utilizado como label nas métricas
+	Code string
+	// Message descreve a violação para o cliente
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Códigos utilizados nas métricas de pulsos rejeitados fora do catálogo
+const (
+	// CodeInvalidPulse é utilizado quando o Validator retorna um erro que não é *ValidationError
+	CodeInvalidPulse = "INVALID_PULSE"
+	// CodeMalformedRequest indica um corpo que não é um objeto JSON válido
+	CodeMalformedRequest = "MALFORMED_REQUEST"
+	// CodeInvalidFields indica um pulso com campos inválidos (veja Pulse.ValidateFields)
+	CodeInvalidFields = "INVALID_FIELDS"
+	// CodeTenantForbidden indica um tenant_id não permitido para a credencial da requisição
+	CodeTenantForbidden = "TENANT_FORBIDDEN"
+	// CodeRateLimited indica um tenant acima do seu limite de pulsos por segundo
+	CodeRateLimited = "RATE_LIMITED"
+	// CodeQuotaExceeded indica um tenant que excedeu o limite rígido da cota do SKU no período
+	CodeQuotaExceeded = "QUOTA_EXCEEDED"
+)
+
+// Quarantine guarda os pulsos que violaram a validação para análise posterior, sem agregá-los
+type Quarantine interface {
+	Quarantine(ctx context.Context, p Pulse, reason *ValidationError) error
+}
+
+// Limites dos campos do pulso
+const (
+	MaxTenantIdLength   = 128
+	MaxProductSkuLength = 64
+	// MaxUsedAmount é o maior used_amount aceito, na unidade informada no pulso
+	MaxUsedAmount = 1e15
+)
+
+// identifierPattern é o formato de tenant_id e product_sku. Os valores compõem as chaves no Redis
+// codificados por keycodec, então ":" é aceito; o formato admite apenas identificadores que o codec
+// representa (veja keycodec.Validate) e mantém "*" e espaços fora dos ids.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]*$`)
+
+// Códigos dos erros de campo
+const (
+	FieldRequired    = "required"
+	FieldTooLong     = "too_long"
+	FieldPattern     = "pattern"
+	FieldTooPrecise  = "too_precise"
+	FieldNegative    = "negative"
+	FieldTooLarge    = "too_large"
+	FieldInvalidType = "invalid_type"
+	FieldUnknownUnit = "unknown_unit"
+)
+
+// FieldError descreve um campo inválido do pulso
+type FieldError struct {
+	// Field é o nome do campo no JSON
+	Field string `json:"field" example:"used_amount"`
+	// Code identifica a regra violada
+	Code string `json:"code" example:"negative"`
+	// Message descreve o problema
+	Message string `json:"message" example:"used_amount não pode ser negativo"`
+}
+
+// ValidateFields verifica o formato dos campos do pulso e retorna todos os campos inválidos
+func (p Pulse) ValidateFields() []FieldError {
+	var errs []FieldError
+	errs = append(errs, validateIdentifier("tenant_id", p.TenantId, MaxTenantIdLength)...)
+	errs = append(errs, validateIdentifier("product_sku", p.ProductSku, MaxProductSkuLength)...)
+	switch {
+	case p.UsedAmount.Sign() < 0:
+		errs = append(errs, FieldError{Field: "used_amount", Code: FieldNegative, Message: "used_amount não pode ser negativo"})
+	case p.UsedAmount.Float64() > MaxUsedAmount:
+		errs = append(errs, usedAmountTooLarge())
+	}
+	switch {
+	case p.UseUnit == "":
+		errs = append(errs, FieldError{Field: "use_unit", Code: FieldRequired, Message: "use_unit é obrigatório"})
+	case !p.UseUnit.IsValid():
+		errs = append(errs, FieldError{Field: "use_unit", Code: FieldUnknownUnit, Message: fmt.Sprintf("unidade %q não registrada; consulte GET /units", p.UseUnit)})
+	case p.UsedAmount.Sign() >= 0 && p.UsedAmount.Float64() <= MaxUsedAmount:
+		// o valor é convertido para a unidade canônica pelos workers, depois que o pulso já foi aceito
+		if _, err := p.Normalize(); errors.Is(err, ErrAmountOverflow) {
+			errs = append(errs, usedAmountTooLargeInBase(p.UseUnit.Base()))
+		}
+	}
+	return errs
+}
+
+// validateUsedAmount converte o used_amount recebido no JSON sem perda de precisão
+func validateUsedAmount(raw string) (Amount, *FieldError) {
+	amount, err := ParseAmount(raw)
+	switch {
+	case errors.Is(err, ErrAmountPrecision):
+		return Amount{}, &FieldError{Field: "used_amount", Code: FieldTooPrecise, Message: fmt.Sprintf("used_amount deve ter no máximo %d casas decimais", AmountScale())}
+	case errors.Is(err, ErrAmountOverflow):
+		if strings.HasPrefix(raw, "-") {
+			return Amount{}, &FieldError{Field: "used_amount", Code: FieldNegative, Message: "used_amount não pode ser negativo"}
+		}
+		fe := usedAmountTooLarge()
+		return Amount{}, &fe
+	case err != nil:
+		return Amount{}, &FieldError{Field: "used_amount", Code: FieldInvalidType, Message: "used_amount deve ser do tipo number, recebido: number " + raw}
+	}
+	return amount, nil
+}
+
+// usedAmountTooLarge informa o maior used_amount aceito, limitado também pelo maior valor representável na escala
+func usedAmountTooLarge() FieldError {
+	limit := fmt.Sprintf("%g", float64(MaxUsedAmount))
+	if largest := AmountFromUnits(math.MaxInt64); largest.Float64() < MaxUsedAmount {
+		limit = largest.String()
+	}
+	return FieldError{Field: "used_amount", Code: FieldTooLarge, Message: "used_amount deve ser no máximo " + limit}
+}
+
+// usedAmountTooLargeInBase informa que o used_amount excede o maior valor representável na escala
+// depois de convertido para a unidade canônica base
+func usedAmountTooLargeInBase(base PulseUnit) FieldError {
+	largest := AmountFromUnits(math.MaxInt64)
+	return FieldError{Field: "used_amount", Code: FieldTooLarge, Message: fmt.Sprintf("used_amount convertido para %s deve ser no máximo %s", base, largest)}
+}
+
+// ValidTenantId indica se o valor pode ser utilizado como tenant_id
+func ValidTenantId(tenantId string) bool {
+	return validateIdentifier("tenant_id", tenantId, MaxTenantIdLength) == nil
+}
+
+// ValidProductSku indica se o valor pode ser utilizado como product_sku
+func ValidProductSku(productSku string) bool {
+	return validateIdentifier("product_sku", productSku, MaxProductSkuLength) == nil
+}
+
+func validateIdentifier(field, value string, maxLength int) []FieldError {
+	switch {
+	case value == "":
+		return []FieldError{{Field: field, Code: FieldRequired, Message: field + " é obrigatório"}}
+	case len(value) > maxLength:
+		return []FieldError{{Field: field, Code: FieldTooLong, Message: fmt.Sprintf("%s deve ter no máximo %d caracteres", field, maxLength)}}
+	case !identifierPattern.MatchString(value):
+		return []FieldError{{Field: field, Code: FieldPattern, Message: field + " deve começar com letra ou número e conter apenas letras, números, '_', '.', ':' ou '-'"}}
+	}
+	return nil
+}
@@ -18,7 +18,10 @@ func (pss *pulseProducerService) randomPulse(tenantId string) (*pulse.Pulse, err
 	skuSelector := rand.Intn(len(*pss.skuMap))
 	productSku := fmt.Sprintf("SKU-%d", skuSelector)
 	useUnit := (*pss.skuMap)[productSku]
-	usedAmount := float64(rand.Intn(1000)) + rand.Float64()
+	usedAmount, err := pulse.AmountFromFloat(float64(rand.Intn(1000)) + rand.Float64())
+	if err != nil {
+		return nil, err
+	}
 	pulse, err := pulse.NewPulse(tenantId, productSku, usedAmount, useUnit)
 	if err != nil {
 		log.Error().Msgf("Erro ao gerar pulso: %v", err)
@@ -28,8 +31,8 @@ func (pss *pulseProducerService) randomPulse(tenantId string) (*pulse.Pulse, err
 	return pulse, nil
 }
 
-// randomPulseUnit retorna uma unidade de pulso aleatória
+// randomPulseUnit retorna uma unidade aleatória do registro de unidades em uso
 func (pss *pulseProducerService) randomPulseUnit() pulse.PulseUnit {
-	units := []pulse.PulseUnit{pulse.KB, pulse.MB, pulse.GB, pulse.KBxSec, pulse.MBxSec, pulse.GBxSec}
+	units := pulse.Units().Names()
 	return units[rand.Intn(len(units))]
 }
@@ -25,7 +25,8 @@ func TestRandomPulse(t *testing.T) {
 		assert.NotNil(t, pulseGenerated)
 		assert.Equal(t, "tenant-123", pulseGenerated.TenantId)
 		assert.Equal(t, "SKU-0", pulseGenerated.ProductSku)
-		assert.GreaterOrEqual(t, pulseGenerated.UsedAmount, 0.0)
+		assert.GreaterOrEqual(t, pulseGenerated.UsedAmount.Sign(), 0)
+		assert.Less(t, pulseGenerated.UsedAmount.Float64(), 1000.0)
 		assert.Equal(t, pulse.KB, pulseGenerated.UseUnit)
 	})
 
@@ -62,6 +63,17 @@ func TestRandomPulseUnit(t *testing.T) {
 		pulseProducerService := &pulseProducerService{}
 
 		pulseUnitGenerated := pulseProducerService.randomPulseUnit()
-		assert.Contains(t, []pulse.PulseUnit{pulse.KB, pulse.MB, pulse.GB, pulse.KBxSec, pulse.MBxSec, pulse.GBxSec}, pulseUnitGenerated)
+		assert.Contains(t, pulse.Units().Names(), pulseUnitGenerated)
+	})
+
+	t.Run("UsesConfiguredRegistry", func(t *testing.T) {
+		registry, err := pulse.NewUnitRegistry([]pulse.UnitDefinition{{Name: "req", Dimension: "requests", Factor: 1}})
+		assert.NoError(t, err)
+		original := pulse.Units()
+		pulse.SetUnitRegistry(registry)
+		defer pulse.SetUnitRegistry(original)
+
+		pulseProducerService := &pulseProducerService{}
+		assert.Equal(t, pulse.PulseUnit("req"), pulseProducerService.randomPulseUnit())
 	})
 }
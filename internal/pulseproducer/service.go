@@ -26,6 +26,7 @@ type pulseProducerService struct {
 	skuMap      *map[string]pulse.PulseUnit
 	qtySKUs     int
 	httpClient  clients.HTTPClient
+	apiKey      string
 }
 type PulseProducerService interface {
 	// Inicia o serviço de produção de pulsos
@@ -36,6 +37,16 @@ type PulseProducerService interface {
 	Stop()
 }
 
+type ProducerOptions func(*pulseProducerService)
+
+// WithAPIKey envia a chave de API no cabeçalho X-API-Key de cada pulso.
+// Como os tenants são gerados aleatoriamente, a chave deve estar vinculada a todos os tenants (*).
+func WithAPIKey(apiKey string) ProducerOptions {
+	return func(s *pulseProducerService) {
+		s.apiKey = apiKey
+	}
+}
+
 var qtyPulsesSent int64
 var qtyPulsesFailed int64
 var qtyPulsesSuccess int64
@@ -47,9 +58,9 @@ var qtyPulsesSuccess int64
 // e retorna um ponteiro para o serviço de produção de pulsos.
 // O cliente HTTP é configurado com um tempo limite de 5 segundos,
 // 100 conexões simultâneas e um tempo limite de conexão ociosa de 30 segundos.
-// É possível personalizar o cliente HTTP, se necessário.
+// É possível personalizar o cliente HTTP, se necessário, e enviar uma chave de API com WithAPIKey.
 // O serviço de produção de pulsos é iniciado com o método Start() e parado com o método Stop().
-func NewPulseProducerService(ingestorURL string, minDelay, maxDelay, qtyTenants, qtySKUs int) PulseProducerService {
+func NewPulseProducerService(ingestorURL string, minDelay, maxDelay, qtyTenants, qtySKUs int, opts ...ProducerOptions) PulseProducerService {
 	httpClient := &http.Client{
 		Timeout: 5 * time.Second,
 		Transport: &http.Transport{
@@ -68,6 +79,12 @@ func NewPulseProducerService(ingestorURL string, minDelay, maxDelay, qtyTenants,
 		qtySKUs:     qtySKUs,
 		httpClient:  httpClient,
 	}
+	for _, opt := range opts {
+		opt(&psv)
+	}
+	if psv.apiKey != "" {
+		psv.httpClient = clients.NewHeaderHTTPClient(httpClient, http.Header{"X-Api-Key": []string{psv.apiKey}})
+	}
 
 	psv.skuMap = psv.generateSkuMap()
 	return &psv
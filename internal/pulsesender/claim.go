@@ -0,0 +1,18 @@
+package pulsesender
+
+import (
+	"github.com/ThalysSilva/ingestor-consumo/internal/keycodec"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// maxAggregationUnits retorna as unidades registradas com agregação max, codificadas como nos campos
+// do hash (veja generation.Field), para a reserva dos agregados (veja usagestore.UsageStore.Claim)
+func maxAggregationUnits() []string {
+	var units []string
+	for _, unit := range pulse.Units().Names() {
+		if unit.Aggregation() == pulse.AggregationMax {
+			units = append(units, keycodec.Escape(string(unit)))
+		}
+	}
+	return units
+}
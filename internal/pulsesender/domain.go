@@ -0,0 +1,40 @@
+package pulsesender
+
+import "github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+
+// AggregatedPulse é o total de um tenant e SKU enviado para a API.
+// UsedAmount e UseUnit estão na unidade base da dimensão (B ou B/sec no registro padrão), com UsedAmount
+// exato na escala em uso (veja pulse.Amount);
+// DisplayAmount e DisplayUnit trazem o mesmo total na maior unidade em que o valor é ao menos 1.
+type AggregatedPulse struct {
+	pulse.Pulse
+	DisplayAmount float64         `json:"display_amount"`
+	DisplayUnit   pulse.PulseUnit `json:"display_unit"`
+
+	// fields são os campos reservados do tenant somados neste total, apagados após o envio
+	fields []string
+}
+
+// newAggregatedPulse cria o agregado a partir do pulso lido do campo informado do hash do tenant
+func newAggregatedPulse(p pulse.Pulse, field string) *AggregatedPulse {
+	ap := &AggregatedPulse{Pulse: p, fields: []string{field}}
+	ap.DisplayAmount, ap.DisplayUnit = p.UseUnit.Humanize(p.UsedAmount.Float64())
+	return ap
+}
+
+// add combina amount, na unidade do agregado, conforme a agregação da unidade (soma ou máximo)
+// e registra o campo de origem. Se a soma transbordar, o agregado não é alterado e o erro é retornado.
+func (a *AggregatedPulse) add(amount pulse.Amount, field string) error {
+	if a.UseUnit.Aggregation() == pulse.AggregationMax {
+		a.UsedAmount = a.UsedAmount.Max(amount)
+	} else {
+		sum, err := a.UsedAmount.Add(amount)
+		if err != nil {
+			return err
+		}
+		a.UsedAmount = sum
+	}
+	a.fields = append(a.fields, field)
+	a.DisplayAmount, a.DisplayUnit = a.UseUnit.Humanize(a.UsedAmount.Float64())
+	return nil
+}
@@ -0,0 +1,39 @@
+package pulsesender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/health"
+)
+
+// CycleCheck verifica o loop de envio: o loop deve estar em execução, o último ciclo deve ter sido
+// concluído sem erro e nenhum ciclo pode ficar mais de maxAge sem ser concluído.
+// Antes do primeiro ciclo, maxAge é contado a partir do início do loop.
+func CycleCheck(svc PulseSenderService, maxAge time.Duration) health.CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		status := svc.Status()
+		if status.Stopping {
+			return "", errors.New("loop de envio finalizando")
+		}
+		if !status.Running {
+			return "", errors.New("loop de envio não iniciado")
+		}
+
+		last := status.LastCycleAt
+		detail := fmt.Sprintf("%d ciclos; último concluído em %s (%s)", status.Cycles, last.Format(time.RFC3339), status.LastCycleDuration.Round(time.Millisecond))
+		if status.Cycles == 0 {
+			last = status.LoopStartedAt
+			detail = "nenhum ciclo concluído desde " + last.Format(time.RFC3339)
+		}
+		if status.LastCycleErr != nil {
+			return detail, fmt.Errorf("último ciclo falhou: %w", status.LastCycleErr)
+		}
+		if age := time.Since(last); age > maxAge {
+			return detail, fmt.Errorf("nenhum ciclo concluído há %s (limite %s)", age.Round(time.Second), maxAge)
+		}
+		return detail, nil
+	}
+}
@@ -0,0 +1,45 @@
+package pulsesender
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// statusStub implementa PulseSenderService retornando um Status fixo
+type statusStub struct {
+	PulseSenderService
+	status Status
+}
+
+func (s statusStub) Status() Status { return s.status }
+
+func TestCycleCheck(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		status  Status
+		wantErr string
+	}{
+		{name: "NotStarted", status: Status{}, wantErr: "não iniciado"},
+		{name: "Stopping", status: Status{Running: true, Stopping: true}, wantErr: "finalizando"},
+		{name: "WaitingFirstCycle", status: Status{Running: true, LoopStartedAt: now}},
+		{name: "FirstCycleOverdue", status: Status{Running: true, LoopStartedAt: now.Add(-time.Hour)}, wantErr: "nenhum ciclo concluído há"},
+		{name: "LastCycleOK", status: Status{Running: true, LoopStartedAt: now.Add(-time.Hour), Cycles: 3, LastCycleAt: now}},
+		{name: "LastCycleFailed", status: Status{Running: true, Cycles: 1, LastCycleAt: now, LastCycleErr: errors.New("boom")}, wantErr: "último ciclo falhou: boom"},
+		{name: "LastCycleStale", status: Status{Running: true, Cycles: 1, LastCycleAt: now.Add(-time.Hour)}, wantErr: "nenhum ciclo concluído há"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CycleCheck(statusStub{status: tt.status}, time.Minute)(context.Background())
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
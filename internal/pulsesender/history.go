@@ -0,0 +1,34 @@
+package pulsesender
+
+import (
+	"context"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/rs/zerolog/log"
+)
+
+// DeliveryRecorder guarda os agregados entregues à API (ex.: history.Store)
+type DeliveryRecorder interface {
+	Record(ctx context.Context, at time.Time, pulses []pulse.Pulse) error
+}
+
+// WithDeliveryRecorder grava cada lote entregue, após apagar as suas chaves do Redis.
+// Lotes cujas chaves não puderam ser apagadas são gravados quando forem reenviados.
+func WithDeliveryRecorder(recorder DeliveryRecorder) ServiceOptions {
+	return func(ps *pulseSenderService) {
+		ps.recorder = recorder
+	}
+}
+
+// record grava o lote entregue no horário da entrega.
+// Falhas não desfazem a entrega, então são apenas registradas no log.
+func (s *pulseSenderService) record(batchIndex int, aggregated []*AggregatedPulse) {
+	pulses := make([]pulse.Pulse, 0, len(aggregated))
+	for _, ap := range aggregated {
+		pulses = append(pulses, ap.Pulse)
+	}
+	if err := s.recorder.Record(s.ctx, time.Now(), pulses); err != nil {
+		log.Warn().Err(err).Int("batch", batchIndex).Msg("Erro ao gravar o lote entregue no histórico")
+	}
+}
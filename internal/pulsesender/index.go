@@ -0,0 +1,14 @@
+package pulsesender
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// clearIndex apaga o índice reservado após um ciclo concluído sem falhas, quando todos os hashes
+// reservados foram enviados. Após falhas ele é mantido, e os tenants já enviados são apenas ignorados
+// no próximo ciclo da geração.
+func (s *pulseSenderService) clearIndex(gen string) {
+	if err := s.store.ClearIndex(s.ctx, gen); err != nil {
+		log.Warn().Err(err).Str("generation", gen).Msg("Erro ao apagar o índice da geração")
+	}
+}
@@ -0,0 +1,258 @@
+package pulsesender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/rs/zerolog/log"
+)
+
+// JanitorAction é o tratamento dado aos agregados reservados há mais tempo que o limite do janitor
+type JanitorAction string
+
+const (
+	// JanitorReport apenas registra os agregados nas métricas e no log; eles continuam sendo reenviados
+	// nos ciclos da geração
+	JanitorReport JanitorAction = "report"
+	// JanitorRequeue move os agregados para a geração atual, para que sejam enviados no próximo ciclo
+	JanitorRequeue JanitorAction = "requeue"
+	// JanitorArchive grava os agregados no Archiver e os apaga do store, encerrando as tentativas de envio
+	JanitorArchive JanitorAction = "archive"
+)
+
+// Janitor verifica os agregados reservados que ficaram de ciclos com falhas
+type Janitor interface {
+	// Sweep verifica os agregados reservados das duas gerações e trata os reservados há mais tempo que o limite
+	Sweep(ctx context.Context) error
+}
+
+// ArchivedAggregate é um campo reservado arquivado pelo janitor
+type ArchivedAggregate struct {
+	ArchivedAt   time.Time `json:"archived_at"`
+	PendingSince time.Time `json:"pending_since"`
+	Generation   string    `json:"generation"`
+	TenantId     string    `json:"tenant_id"`
+	// Field e Value são o campo e o valor como estavam no store (veja generation.Field)
+	Field      string          `json:"field"`
+	Value      string          `json:"value"`
+	ProductSku string          `json:"product_sku,omitempty"`
+	UseUnit    pulse.PulseUnit `json:"use_unit,omitempty"`
+	// UsedAmount é o valor decodificado na unidade do campo; ausente se o campo ou o valor forem inválidos
+	UsedAmount *pulse.Amount `json:"used_amount,omitempty"`
+}
+
+// Archiver guarda os agregados arquivados pelo janitor (ex.: NewFileArchiver)
+type Archiver interface {
+	Archive(ctx context.Context, records []ArchivedAggregate) error
+	Close() error
+}
+
+type janitor struct {
+	store     usagestore.UsageStore
+	threshold time.Duration
+	action    JanitorAction
+	archiver  Archiver
+	now       func() time.Time
+}
+
+type JanitorOptions func(*janitor)
+
+// WithJanitorAction define o tratamento dos agregados reservados há mais tempo que o limite (padrão JanitorReport)
+func WithJanitorAction(action JanitorAction) JanitorOptions {
+	return func(j *janitor) {
+		j.action = action
+	}
+}
+
+// WithArchiver define onde os agregados são gravados com JanitorArchive
+func WithArchiver(archiver Archiver) JanitorOptions {
+	return func(j *janitor) {
+		j.archiver = archiver
+	}
+}
+
+// WithJanitorClock define o relógio utilizado para calcular há quanto tempo os agregados estão reservados
+func WithJanitorClock(now func() time.Time) JanitorOptions {
+	return func(j *janitor) {
+		j.now = now
+	}
+}
+
+// NewJanitor cria o janitor dos agregados reservados no store. O tempo em que um tenant está reservado
+// é contado a partir da primeira verificação em que ele aparece (veja usagestore.UsageStore.Leftovers).
+func NewJanitor(store usagestore.UsageStore, threshold time.Duration, opts ...JanitorOptions) Janitor {
+	registerMetrics()
+	j := &janitor{
+		store:     store,
+		threshold: threshold,
+		action:    JanitorReport,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	if threshold <= 0 {
+		log.Error().Dur("threshold", threshold).Msg("threshold deve ser maior que 0")
+		panic(fmt.Sprintf("threshold deve ser maior que 0, recebido: %s", threshold))
+	}
+	switch j.action {
+	case JanitorReport, JanitorRequeue:
+	case JanitorArchive:
+		if j.archiver == nil {
+			panic("a ação archive do janitor exige um Archiver (WithArchiver)")
+		}
+	default:
+		panic(fmt.Sprintf("ação do janitor inválida: %q", j.action))
+	}
+	return j
+}
+
+// WithJanitor executa o janitor ao final de cada ciclo de envio, quando os agregados que falharam
+// já estão reservados e nenhum ciclo os altera
+func WithJanitor(janitor Janitor) ServiceOptions {
+	return func(ps *pulseSenderService) {
+		ps.janitor = janitor
+	}
+}
+
+// sweep executa o janitor após o ciclo. Falhas não afetam o resultado do ciclo, então são apenas registradas no log.
+func (s *pulseSenderService) sweep() {
+	if err := s.janitor.Sweep(s.ctx); err != nil {
+		log.Warn().Err(err).Msg("Erro ao verificar os agregados reservados")
+	}
+}
+
+func (j *janitor) Sweep(ctx context.Context) error {
+	current, err := j.store.GetCurrentGeneration()
+	if err != nil {
+		return fmt.Errorf("erro ao obter geração atual: %v", err)
+	}
+	now := j.now()
+	maxUnits := maxAggregationUnits()
+
+	var errs []error
+	// a geração atual também pode ter agregados reservados, do ciclo anterior ao último
+	for _, gen := range []string{generation.Other(current), current} {
+		leftovers, err := j.store.Leftovers(ctx, gen, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("geração %s: %w", gen, err))
+			continue
+		}
+		var oldest time.Duration
+		for _, leftover := range leftovers {
+			age := now.Sub(leftover.Since)
+			oldest = max(oldest, age)
+			if age < j.threshold {
+				continue
+			}
+			log.Warn().
+				Str("generation", gen).
+				Str("tenant_id", leftover.TenantId).
+				Int("fields", leftover.Fields).
+				Time("since", leftover.Since).
+				Str("action", string(j.action)).
+				Msg("Agregados reservados há mais tempo que o limite")
+			if err := j.handle(ctx, gen, current, leftover, maxUnits, now); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s na geração %s: %w", leftover.TenantId, gen, err))
+				continue
+			}
+			staleTenants.WithLabelValues(string(j.action)).Inc()
+		}
+		leftoverTenants.WithLabelValues(gen).Set(float64(len(leftovers)))
+		leftoverOldestAge.WithLabelValues(gen).Set(oldest.Seconds())
+	}
+	return errors.Join(errs...)
+}
+
+// handle aplica a ação do janitor aos agregados reservados do tenant na geração gen
+func (j *janitor) handle(ctx context.Context, gen, current string, leftover usagestore.Leftover, maxUnits []string, now time.Time) error {
+	switch j.action {
+	case JanitorRequeue:
+		return j.store.Requeue(ctx, gen, current, leftover.TenantId, maxUnits)
+	case JanitorArchive:
+		return j.archive(ctx, gen, leftover, now)
+	default:
+		return nil
+	}
+}
+
+// archive grava os campos reservados no Archiver e só então os apaga do store, então uma falha na deleção
+// pode arquivar os mesmos campos novamente na próxima verificação
+func (j *janitor) archive(ctx context.Context, gen string, leftover usagestore.Leftover, now time.Time) error {
+	fields, err := j.store.Read(ctx, gen, leftover.TenantId, true)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	names := slices.Sorted(maps.Keys(fields))
+	records := make([]ArchivedAggregate, 0, len(fields))
+	for _, field := range names {
+		record := ArchivedAggregate{
+			ArchivedAt:   now,
+			PendingSince: leftover.Since,
+			Generation:   gen,
+			TenantId:     leftover.TenantId,
+			Field:        field,
+			Value:        fields[field],
+		}
+		if productSku, unit, scale, ok := generation.ParseField(field); ok {
+			record.ProductSku, record.UseUnit = productSku, pulse.PulseUnit(unit)
+			if amount, err := pulse.ParseFieldAmount(fields[field], scale); err == nil {
+				record.UsedAmount = &amount
+			}
+		}
+		records = append(records, record)
+	}
+	if err := j.archiver.Archive(ctx, records); err != nil {
+		return fmt.Errorf("erro ao arquivar os agregados: %w", err)
+	}
+	if err := j.store.Delete(ctx, gen, leftover.TenantId, names); err != nil {
+		return fmt.Errorf("agregados arquivados, mas não apagados: %w", err)
+	}
+	return nil
+}
+
+type fileArchiver struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileArchiver grava os agregados arquivados no arquivo, um JSON por linha, acrescentando ao conteúdo existente
+func NewFileArchiver(path string) (Archiver, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao abrir o arquivo dos agregados arquivados: %w", err)
+	}
+	return &fileArchiver{file: file}, nil
+}
+
+func (a *fileArchiver) Archive(ctx context.Context, records []ArchivedAggregate) error {
+	var buf []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(buf); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *fileArchiver) Close() error {
+	return a.file.Close()
+}
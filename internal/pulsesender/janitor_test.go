@@ -0,0 +1,164 @@
+package pulsesender
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLeftoverStore cria um store com agregados do tenant1 que ficaram reservados na geração A
+// após um ciclo em que a API falhou; a geração atual é a B
+func newLeftoverStore(t *testing.T) usagestore.UsageStore {
+	ctx := context.Background()
+	store := usagestore.NewMemoryStore()
+	require.NoError(t, store.Increment(ctx, usagestore.Increment{Generation: "A", TenantId: "tenant1", Field: "sku1:B:6", Units: 5000000}))
+	require.NoError(t, store.Increment(ctx, usagestore.Increment{Generation: "A", TenantId: "tenant1", Field: "sku1:conn:6", Units: 30000000, Max: true}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	svc := NewPulseSenderService(ctx, nil, server.URL, 10, WithUsageStore(store)).(*pulseSenderService)
+	require.Error(t, svc.sendPulses(0))
+	return store
+}
+
+func TestNewJanitor(t *testing.T) {
+	store := usagestore.NewMemoryStore()
+	assert.Panics(t, func() { NewJanitor(store, 0) })
+	assert.Panics(t, func() { NewJanitor(store, time.Hour, WithJanitorAction(JanitorArchive)) })
+	assert.Panics(t, func() { NewJanitor(store, time.Hour, WithJanitorAction("delete")) })
+	assert.NotPanics(t, func() { NewJanitor(store, time.Hour, WithJanitorAction(JanitorRequeue)) })
+}
+
+func TestJanitor_Sweep(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+
+	t.Run("Report", func(t *testing.T) {
+		store := newLeftoverStore(t)
+		now := start
+		janitor := NewJanitor(store, time.Hour, WithJanitorClock(func() time.Time { return now }))
+		reported := testutil.ToFloat64(staleTenants.WithLabelValues(string(JanitorReport)))
+
+		require.NoError(t, janitor.Sweep(ctx))
+		assert.Equal(t, float64(1), testutil.ToFloat64(leftoverTenants.WithLabelValues("A")))
+		assert.Equal(t, float64(0), testutil.ToFloat64(leftoverTenants.WithLabelValues("B")))
+		assert.Equal(t, reported, testutil.ToFloat64(staleTenants.WithLabelValues(string(JanitorReport))))
+
+		// a idade é contada a partir da primeira verificação, e os agregados continuam reservados
+		now = start.Add(90 * time.Minute)
+		require.NoError(t, janitor.Sweep(ctx))
+		assert.Equal(t, (90 * time.Minute).Seconds(), testutil.ToFloat64(leftoverOldestAge.WithLabelValues("A")))
+		assert.Equal(t, reported+1, testutil.ToFloat64(staleTenants.WithLabelValues(string(JanitorReport))))
+		fields, err := store.Read(ctx, "A", "tenant1", true)
+		require.NoError(t, err)
+		assert.Len(t, fields, 2)
+	})
+
+	t.Run("Requeue", func(t *testing.T) {
+		store := newLeftoverStore(t)
+		require.NoError(t, store.Increment(ctx, usagestore.Increment{Generation: "B", TenantId: "tenant1", Field: "sku1:B:6", Units: 1000000}))
+		now := start
+		janitor := NewJanitor(store, time.Hour, WithJanitorAction(JanitorRequeue), WithJanitorClock(func() time.Time { return now }))
+		require.NoError(t, janitor.Sweep(ctx))
+		now = start.Add(time.Hour)
+		require.NoError(t, janitor.Sweep(ctx))
+
+		// os agregados são combinados com os da geração atual e enviados no próximo ciclo
+		fields, err := store.Read(ctx, "A", "tenant1", true)
+		require.NoError(t, err)
+		assert.Empty(t, fields)
+		fields, err = store.Read(ctx, "B", "tenant1", false)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"sku1:B:6": "6000000", "sku1:conn:6": "30000000"}, fields)
+
+		var sent []AggregatedPulse
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var batch []AggregatedPulse
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+			sent = append(sent, batch...)
+		}))
+		defer server.Close()
+		svc := NewPulseSenderService(ctx, nil, server.URL, 10, WithUsageStore(store)).(*pulseSenderService)
+		require.NoError(t, svc.sendPulses(0))
+		require.Len(t, sent, 2)
+		amounts := map[pulse.PulseUnit]string{}
+		for _, p := range sent {
+			amounts[p.UseUnit] = p.UsedAmount.String()
+		}
+		assert.Equal(t, map[pulse.PulseUnit]string{pulse.B: "6", pulse.PulseUnit("conn"): "30"}, amounts)
+
+		require.NoError(t, janitor.Sweep(ctx))
+		assert.Equal(t, float64(0), testutil.ToFloat64(leftoverTenants.WithLabelValues("A")))
+	})
+
+	t.Run("Archive", func(t *testing.T) {
+		store := newLeftoverStore(t)
+		path := filepath.Join(t.TempDir(), "archive.jsonl")
+		archiver, err := NewFileArchiver(path)
+		require.NoError(t, err)
+		now := start
+		janitor := NewJanitor(store, time.Hour, WithJanitorAction(JanitorArchive), WithArchiver(archiver), WithJanitorClock(func() time.Time { return now }))
+		require.NoError(t, janitor.Sweep(ctx))
+		now = start.Add(2 * time.Hour)
+		require.NoError(t, janitor.Sweep(ctx))
+		require.NoError(t, archiver.Close())
+
+		fields, err := store.Read(ctx, "A", "tenant1", true)
+		require.NoError(t, err)
+		assert.Empty(t, fields)
+
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		defer file.Close()
+		var records []ArchivedAggregate
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var record ArchivedAggregate
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+			records = append(records, record)
+		}
+		require.Len(t, records, 2)
+		assert.Equal(t, "A", records[0].Generation)
+		assert.Equal(t, "tenant1", records[0].TenantId)
+		assert.Equal(t, "sku1:B:6", records[0].Field)
+		assert.Equal(t, pulse.B, records[0].UseUnit)
+		require.NotNil(t, records[0].UsedAmount)
+		assert.Equal(t, "5", records[0].UsedAmount.String())
+		assert.True(t, records[0].PendingSince.Equal(start))
+		assert.Equal(t, "30000000", records[1].Value)
+	})
+}
+
+type countingJanitor struct {
+	sweeps atomic.Int32
+}
+
+func (j *countingJanitor) Sweep(ctx context.Context) error {
+	j.sweeps.Add(1)
+	return nil
+}
+
+func TestWithJanitor(t *testing.T) {
+	ctx := context.Background()
+	janitor := &countingJanitor{}
+	svc := NewPulseSenderService(ctx, nil, "http://example.com", 10, WithUsageStore(usagestore.NewMemoryStore()), WithJanitor(janitor)).(*pulseSenderService)
+
+	svc.runCycle(0)
+	svc.runCycle(0)
+	assert.Equal(t, int32(2), janitor.sweeps.Load())
+}
@@ -38,6 +38,27 @@ var (
 			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10},
 		},
 	)
+	leftoverTenants = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ingestor_sender_leftover_tenants",
+			Help: "Tenants com agregados reservados que ficaram de ciclos com falhas, na última verificação do janitor",
+		},
+		[]string{"generation"},
+	)
+	leftoverOldestAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ingestor_sender_leftover_oldest_seconds",
+			Help: "Tempo em que o tenant mais antigo está com agregados reservados, na última verificação do janitor",
+		},
+		[]string{"generation"},
+	)
+	staleTenants = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestor_sender_stale_tenants_total",
+			Help: "Total de tenants com agregados reservados há mais tempo que o limite do janitor, por ação aplicada",
+		},
+		[]string{"action"},
+	)
 )
 
 func registerMetrics() {
@@ -51,5 +72,8 @@ func registerMetrics() {
 		pulsesSentSuccess,
 		pulsesNotDeleted,
 		aggregationCycleTime,
+		leftoverTenants,
+		leftoverOldestAge,
+		staleTenants,
 	)
 }
@@ -0,0 +1,29 @@
+package pulsesender
+
+import (
+	"context"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/rs/zerolog/log"
+)
+
+// CycleReconciler compara os totais gravados pelos ingestores com os entregues em cada ciclo (ex.: reconcile.Reconciler)
+type CycleReconciler interface {
+	Reconcile(ctx context.Context, gen string, delivered []pulse.Pulse) error
+}
+
+// WithReconciler executa a conciliação ao final de cada ciclo de envio com os agregados entregues e apagados
+// no ciclo, inclusive nos ciclos com falhas, cujos agregados não entregues ficam com saldo até serem reenviados
+func WithReconciler(reconciler CycleReconciler) ServiceOptions {
+	return func(ps *pulseSenderService) {
+		ps.reconciler = reconciler
+	}
+}
+
+// reconcile executa a conciliação do ciclo da geração gen.
+// Falhas não afetam o resultado do ciclo, então são apenas registradas no log.
+func (s *pulseSenderService) reconcile(gen string, delivered []pulse.Pulse) {
+	if err := s.reconciler.Reconcile(s.ctx, gen, delivered); err != nil {
+		log.Warn().Err(err).Str("generation", gen).Msg("Erro ao conciliar os totais do ciclo de envio")
+	}
+}
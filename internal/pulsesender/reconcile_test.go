@@ -0,0 +1,55 @@
+package pulsesender
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/reconcile"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWithReconciler verifica a conciliação dos ciclos de envio, incluindo um ciclo com falha na entrega
+func TestWithReconciler(t *testing.T) {
+	ctx := context.Background()
+	store := usagestore.NewMemoryStore()
+	ledger := usagestore.NewMemoryLedger()
+	for _, inc := range []usagestore.Increment{
+		{Generation: "A", TenantId: "tenant1", Field: "sku1:B:6", Units: 2000000},
+		{Generation: "A", TenantId: "tenant1", Field: "sku1:KB:6", Units: 1000000},
+	} {
+		require.NoError(t, store.Increment(ctx, inc))
+		require.NoError(t, ledger.Record(ctx, inc))
+	}
+
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	reconciler := reconcile.NewReconciler(ledger)
+	svc := NewPulseSenderService(ctx, nil, server.URL, 10, WithUsageStore(store), WithReconciler(reconciler)).(*pulseSenderService)
+
+	// o total não entregue fica faltante até ser reenviado no próximo ciclo da geração
+	svc.runCycle(0)
+	report := reconciler.Reports(1)[0]
+	assert.Equal(t, "A", report.Generation)
+	assert.Equal(t, 1, report.Missing)
+	assert.Equal(t, int64(2), report.Pulses)
+	require.Len(t, report.Entries, 1)
+	assert.Equal(t, "1026", report.Entries[0].Balance.String())
+
+	svc.runCycle(0)
+	assert.Equal(t, "B", reconciler.Reports(1)[0].Generation)
+	assert.Equal(t, 1, reconciler.Reports(1)[0].Missing)
+
+	status = http.StatusOK
+	svc.runCycle(0)
+	report = reconciler.Reports(1)[0]
+	assert.Equal(t, "A", report.Generation)
+	assert.Equal(t, 1, report.Matched)
+	assert.Empty(t, report.Entries)
+}
@@ -6,34 +6,91 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
 	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
 	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
 	"github.com/ThalysSilva/ingestor-consumo/pkg/utils"
 	"github.com/rs/zerolog/log"
 )
 
 type pulseSenderService struct {
-	ctx            context.Context
-	redisClient    clients.RedisClient
+	// ctx é utilizado nas operações de um ciclo e não é cancelado junto com o contexto
+	// recebido no construtor, permitindo que um ciclo em andamento seja concluído na parada
+	ctx context.Context
+	// loopCtx encerra o loop de envio quando cancelado
+	loopCtx        context.Context
 	apiURLSender   string
 	batchQtyToSend int
-	generation     generation.ManagerGeneration
-	httpClient     clients.HTTPClient
+	maxWorkers     int
+	scanCount      int64
+	// store guarda os agregados e a geração atual (veja WithUsageStore)
+	store      usagestore.UsageStore
+	httpClient clients.HTTPClient
+	// recorder grava os lotes entregues (veja WithDeliveryRecorder)
+	recorder DeliveryRecorder
+	// fullScan percorre as chaves com SCAN em vez do índice da geração (veja WithFullScan)
+	fullScan bool
+	// finalCycle executa um último ciclo de envio ao finalizar o loop (veja WithFinalCycle)
+	finalCycle bool
+	// janitor verifica os agregados reservados após cada ciclo (veja WithJanitor)
+	janitor Janitor
+	// reconciler concilia os totais gravados e entregues ao final de cada ciclo (veja WithReconciler)
+	reconciler CycleReconciler
+
+	mu       sync.Mutex
+	running  bool
+	stopChan chan struct{}
+	stopOnce sync.Once
+	loopDone chan struct{}
+
+	// estado do loop exposto por Status, protegido por mu
+	loopStartedAt     time.Time
+	cycles            int64
+	lastCycleAt       time.Time
+	lastCycleDuration time.Duration
+	lastCycleErr      error
 }
 
+const (
+	// DefaultMaxWorkers é a quantidade padrão de lotes enviados em paralelo
+	DefaultMaxWorkers = 5
+	// DefaultScanCount é o valor padrão do COUNT utilizado no SCAN do Redis
+	DefaultScanCount = usagestore.DefaultScanCount
+)
+
 type PulseSenderService interface {
 	// StartLoop inicia o loop de envio de pulsos.
 	//
 	// O interval define o intervalo entre os envios de pulsos.
 	//
 	// O stabilizationDelay define um tempo de espera após alternar a geração
+	//
+	// O loop retorna quando o contexto do serviço é cancelado ou Stop é chamado,
+	// sempre após concluir o ciclo de envio em andamento.
 	StartLoop(interval, stabilizationDelay time.Duration)
+
+	// Stop impede o início de novos ciclos e aguarda a conclusão do ciclo em andamento,
+	// incluindo o envio e a deleção das chaves já alternadas de geração.
+	Stop()
+
+	// Status retorna o estado do loop e o resultado do último ciclo de envio
+	Status() Status
+}
+
+// Status resume o estado do loop de envio para as verificações de prontidão
+type Status struct {
+	Running           bool
+	Stopping          bool
+	LoopStartedAt     time.Time
+	Cycles            int64
+	LastCycleAt       time.Time
+	LastCycleDuration time.Duration
+	LastCycleErr      error
 }
 
 type ServiceOptions func(*pulseSenderService)
@@ -45,6 +102,47 @@ func WithCustomHTTPClient(client clients.HTTPClient) ServiceOptions {
 	}
 }
 
+// WithMaxWorkers define a quantidade máxima de lotes enviados em paralelo para a API
+func WithMaxWorkers(maxWorkers int) ServiceOptions {
+	return func(ps *pulseSenderService) {
+		ps.maxWorkers = maxWorkers
+	}
+}
+
+// WithScanCount define o COUNT utilizado em cada iteração do SCAN no Redis.
+// Ignorado com WithUsageStore (veja usagestore.WithScanCount).
+func WithScanCount(scanCount int64) ServiceOptions {
+	return func(ps *pulseSenderService) {
+		ps.scanCount = scanCount
+	}
+}
+
+// WithFullScan percorre as chaves do Redis com SCAN em todos os ciclos, em vez do índice da geração.
+// Deve ser utilizado enquanto houver ingestores que não gravam o índice (veja generation.IndexKey).
+// Ignorado com WithUsageStore (veja usagestore.WithFullScan).
+func WithFullScan() ServiceOptions {
+	return func(ps *pulseSenderService) {
+		ps.fullScan = true
+	}
+}
+
+// WithUsageStore lê e apaga os agregados no store informado em vez do Redis de redisClient,
+// como o usagestore.NewMemoryStore compartilhado com o ingestor no mesmo processo
+func WithUsageStore(store usagestore.UsageStore) ServiceOptions {
+	return func(ps *pulseSenderService) {
+		ps.store = store
+	}
+}
+
+// WithFinalCycle executa um último ciclo de envio, sem a espera de estabilização, quando o loop é finalizado
+// por Stop ou pelo cancelamento do contexto. Deve ser utilizado apenas quando nenhum ingestor grava
+// depois da parada, como no all-in-one, que drena os pulsos do ingestor do mesmo processo antes de Stop.
+func WithFinalCycle() ServiceOptions {
+	return func(ps *pulseSenderService) {
+		ps.finalCycle = true
+	}
+}
+
 var marshalFunc = json.Marshal
 
 func NewPulseSenderService(ctx context.Context, redisClient clients.RedisClient, apiURLSender string, batchQtyToSend int, opts ...ServiceOptions) PulseSenderService {
@@ -54,46 +152,150 @@ func NewPulseSenderService(ctx context.Context, redisClient clients.RedisClient,
 	}
 
 	registerMetrics()
-	generation := generation.NewManagerGeneration(redisClient, ctx)
 	httpClient := &http.Client{
 		Timeout: 10 * time.Second,
 	}
 	pss := &pulseSenderService{
-		ctx:            ctx,
-		redisClient:    redisClient,
+		ctx:            context.WithoutCancel(ctx),
+		loopCtx:        ctx,
 		httpClient:     httpClient,
 		apiURLSender:   apiURLSender,
 		batchQtyToSend: batchQtyToSend,
-		generation:     generation,
+		maxWorkers:     DefaultMaxWorkers,
+		scanCount:      DefaultScanCount,
+		stopChan:       make(chan struct{}),
+		loopDone:       make(chan struct{}),
 	}
 
 	for _, opt := range opts {
 		opt(pss)
 	}
 
+	if pss.maxWorkers <= 0 {
+		log.Error().Int("max_workers", pss.maxWorkers).Msg("maxWorkers deve ser maior que 0")
+		panic(fmt.Sprintf("maxWorkers deve ser maior que 0, recebido: %d", pss.maxWorkers))
+	}
+	if pss.scanCount <= 0 {
+		log.Error().Int64("scan_count", pss.scanCount).Msg("scanCount deve ser maior que 0")
+		panic(fmt.Sprintf("scanCount deve ser maior que 0, recebido: %d", pss.scanCount))
+	}
+	if pss.store == nil {
+		storeOpts := []usagestore.RedisOptions{usagestore.WithScanCount(pss.scanCount)}
+		if pss.fullScan {
+			storeOpts = append(storeOpts, usagestore.WithFullScan())
+		}
+		pss.store = usagestore.NewRedisStore(pss.ctx, redisClient, storeOpts...)
+	}
+
 	return pss
 
 }
 
 func (s *pulseSenderService) StartLoop(interval, stabilizationDelay time.Duration) {
+	s.mu.Lock()
+	s.running = true
+	s.loopStartedAt = time.Now()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+		close(s.loopDone)
+	}()
+
 	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			log.Info().Msg("PulseSender: iniciando ciclo de envio")
-			if err := s.sendPulses(stabilizationDelay); err != nil {
-				log.Error().Err(err).Msg("Erro ao enviar pulsos")
-			} else {
-				log.Info().Msg("PulseSender: pulsos enviados com sucesso")
+			if s.stopRequested() {
+				s.finishLoop()
+				return
 			}
-		case <-s.ctx.Done():
-			log.Info().Msg("PulseSender: finalizando loop de envio")
-			ticker.Stop()
+			s.runCycle(stabilizationDelay)
+		case <-s.stopChan:
+			s.finishLoop()
+			return
+		case <-s.loopCtx.Done():
+			s.finishLoop()
 			return
 		}
 	}
 }
 
+// runCycle executa um ciclo de envio e registra o resultado
+func (s *pulseSenderService) runCycle(stabilizationDelay time.Duration) {
+	log.Info().Msg("PulseSender: iniciando ciclo de envio")
+	start := time.Now()
+	err := s.sendPulses(stabilizationDelay)
+	if err != nil {
+		log.Error().Err(err).Msg("Erro ao enviar pulsos")
+	} else {
+		log.Info().Msg("PulseSender: pulsos enviados com sucesso")
+	}
+	s.recordCycle(start, err)
+	if s.janitor != nil {
+		s.sweep()
+	}
+}
+
+// finishLoop executa o último ciclo de envio, com WithFinalCycle, antes de o loop ser finalizado
+func (s *pulseSenderService) finishLoop() {
+	if s.finalCycle {
+		log.Info().Msg("PulseSender: executando o último ciclo de envio")
+		s.runCycle(0)
+	}
+	log.Info().Msg("PulseSender: finalizando loop de envio")
+}
+
+func (s *pulseSenderService) Stop() {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+
+	s.mu.Lock()
+	started := !s.loopStartedAt.IsZero()
+	s.mu.Unlock()
+	if started {
+		<-s.loopDone
+	}
+	log.Info().Msg("PulseSender: finalizado")
+}
+
+func (s *pulseSenderService) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Status{
+		Running:           s.running,
+		Stopping:          s.stopRequested(),
+		LoopStartedAt:     s.loopStartedAt,
+		Cycles:            s.cycles,
+		LastCycleAt:       s.lastCycleAt,
+		LastCycleDuration: s.lastCycleDuration,
+		LastCycleErr:      s.lastCycleErr,
+	}
+}
+
+// recordCycle registra o resultado do ciclo iniciado em start
+func (s *pulseSenderService) recordCycle(start time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cycles++
+	s.lastCycleAt = time.Now()
+	s.lastCycleDuration = s.lastCycleAt.Sub(start)
+	s.lastCycleErr = err
+}
+
+// stopRequested indica se a parada foi solicitada por Stop ou pelo cancelamento do contexto
+func (s *pulseSenderService) stopRequested() bool {
+	select {
+	case <-s.stopChan:
+		return true
+	case <-s.loopCtx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *pulseSenderService) sendPulses(stabilizationDelay time.Duration) error {
 	start := time.Now()
 	defer func() {
@@ -101,75 +303,100 @@ func (s *pulseSenderService) sendPulses(stabilizationDelay time.Duration) error
 		aggregationCycleTime.Observe(duration)
 	}()
 
-	currentGen, err := s.generation.GetCurrentGeneration()
+	currentGen, err := s.store.GetCurrentGeneration()
 	if err != nil {
 		log.Error().Err(err).Msg("Erro ao obter geração atual")
 		return err
 	}
-	if _, err := s.generation.ToggleGeneration(); err != nil {
+	if _, err := s.store.ToggleGeneration(); err != nil {
 		return fmt.Errorf("erro ao alternar geração: %v", err)
 	}
 	time.Sleep(stabilizationDelay)
 
-	pattern := fmt.Sprintf("generation:%s:tenant:*:sku:*:useUnit:*", currentGen)
-	cursor := uint64(0)
-	aggregatedPulses := make(map[string]pulse.Pulse)
+	// cycleDelivered são os agregados entregues e apagados no ciclo, conciliados ao final dele
+	var deliveredMu sync.Mutex
+	var cycleDelivered []pulse.Pulse
+	if s.reconciler != nil {
+		defer func() { s.reconcile(currentGen, cycleDelivered) }()
+	}
 
-	for {
-		batch, nextCursor, err := s.redisClient.Scan(s.ctx, cursor, pattern, 100).Result()
+	aggregatedPulses := make(map[string]*AggregatedPulse)
+	// readFailed indica que algum hash não pôde ser reservado ou lido e deve continuar no índice reservado
+	readFailed := false
+
+	tenants, err := s.store.ListGeneration(s.ctx, currentGen)
+	if err != nil {
+		return err
+	}
+	maxUnits := maxAggregationUnits()
+	for _, tenantId := range tenants {
+		// os agregados são enviados a partir dos campos reservados, então um incremento atrasado
+		// grava um novo agregado do tenant em vez de ser apagado junto com os campos enviados
+		fields, err := s.store.Claim(s.ctx, currentGen, tenantId, maxUnits)
 		if err != nil {
-			return fmt.Errorf("erro ao escanear chaves no Redis: %v", err)
+			log.Error().Str("tenant_id", tenantId).Err(err).Msg("Erro ao reservar hash do tenant")
+			readFailed = true
+			continue
 		}
-		cursor = nextCursor
+		key := generation.ClaimKey(currentGen, tenantId)
 
-		for _, key := range batch {
-			usedAmountStr, err := s.redisClient.Get(s.ctx, key).Result()
-			if err != nil {
-				log.Error().Str("key", key).Err(err).Msg("Erro ao obter chave")
+		for field, usedAmountStr := range fields {
+			productSku, unit, scale, ok := generation.ParseField(field)
+			if !ok {
+				log.Warn().Str("key", key).Str("field", field).Msg("Campo inválido")
 				continue
 			}
-
-			usedAmount, err := strconv.ParseFloat(usedAmountStr, 64)
+			usedAmount, err := pulse.ParseFieldAmount(usedAmountStr, scale)
 			if err != nil {
-				log.Error().Str("key", key).Err(err).Msg("Erro ao converter valor")
-				continue
-			}
-
-			parts := strings.Split(key, ":")
-			if len(parts) != 8 {
-				log.Warn().Str("key", key).Msg("Chave inválida")
+				log.Error().Str("key", key).Str("field", field).Err(err).Msg("Erro ao converter valor")
 				continue
 			}
 
-			pulse := pulse.Pulse{
-				TenantId:   parts[3],
-				ProductSku: parts[5],
+			p := pulse.Pulse{
+				TenantId:   tenantId,
+				ProductSku: productSku,
 				UsedAmount: usedAmount,
-				UseUnit:    pulse.PulseUnit(parts[7]),
+				UseUnit:    pulse.PulseUnit(unit),
+			}
+			// Campos gravados em outras unidades (ingestores com WithKeepOriginalUnit ou anteriores à conversão)
+			// são somados ao total canônico; unidades desconhecidas são enviadas como estão
+			if normalized, err := p.Normalize(); err == nil {
+				p = normalized
+			} else {
+				log.Warn().Str("key", key).Str("field", field).Err(err).Msg("Unidade não convertida para a unidade canônica")
 			}
-			aggregatedPulses[key] = pulse
-		}
 
-		if cursor == 0 {
-			break
+			aggKey := p.TenantId + "\x00" + p.ProductSku + "\x00" + string(p.UseUnit)
+			if agg, ok := aggregatedPulses[aggKey]; ok {
+				// o campo que transborda o total permanece no hash reservado, que é mantido no índice reservado
+				// para que o campo seja enviado em um próximo ciclo
+				if err := agg.add(p.UsedAmount, field); err != nil {
+					log.Error().Str("key", key).Str("field", field).Err(err).Msg("Erro ao somar valor ao agregado")
+					readFailed = true
+				}
+				continue
+			}
+			aggregatedPulses[aggKey] = newAggregatedPulse(p, field)
 		}
 	}
 
 	if len(aggregatedPulses) == 0 {
 		log.Info().Str("generation", currentGen).Msg("Nenhum pulso para enviar")
+		if !readFailed {
+			s.clearIndex(currentGen)
+		}
 		return nil
 	}
 
 	pulsesBatch := utils.ChunkMapValues(aggregatedPulses, s.batchQtyToSend)
-	const maxWorkers = 5
-	semaphore := make(chan struct{}, maxWorkers)
+	semaphore := make(chan struct{}, s.maxWorkers)
 	errChan := make(chan error, len(pulsesBatch))
 	var wg sync.WaitGroup
 
 	for batchIndex, pulses := range pulsesBatch {
 		wg.Add(1)
 		semaphore <- struct{}{}
-		go func(batchIndex int, pulses []pulse.Pulse) {
+		go func(batchIndex int, pulses []*AggregatedPulse) {
 			defer wg.Done()
 			defer func() { <-semaphore }()
 
@@ -180,25 +407,56 @@ func (s *pulseSenderService) sendPulses(stabilizationDelay time.Duration) error
 				return
 			}
 			resp, err := s.httpClient.Post(s.apiURLSender, "application/json", bytes.NewBuffer(pulsesData))
-			if err != nil || resp.StatusCode != http.StatusOK {
+			if err != nil {
 				pulsesSentFailed.Add(float64(len(pulses)))
 				errChan <- fmt.Errorf("falha envio lote %d: %v", batchIndex, err)
 				return
 			}
 			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				pulsesSentFailed.Add(float64(len(pulses)))
+				errChan <- fmt.Errorf("falha envio lote %d: status %d", batchIndex, resp.StatusCode)
+				return
+			}
 
-			var keysToDelete []string
+			// os agregados de um tenant estão no mesmo hash reservado, então os campos são apagados com um HDEL por tenant
+			fieldsByTenant := make(map[string][]string)
 			for _, pulse := range pulses {
-				key := fmt.Sprintf("generation:%s:tenant:%s:sku:%s:useUnit:%s",
-					currentGen, pulse.TenantId, pulse.ProductSku, pulse.UseUnit)
-				keysToDelete = append(keysToDelete, key)
+				fieldsByTenant[pulse.TenantId] = append(fieldsByTenant[pulse.TenantId], pulse.fields...)
+			}
+			var failedTenants []string
+			var deleteErr error
+			for tenantId, fields := range fieldsByTenant {
+				if err := s.store.Delete(s.ctx, currentGen, tenantId, fields); err != nil {
+					failedTenants = append(failedTenants, tenantId)
+					deleteErr = err
+				}
 			}
 
-			if err := s.redisClient.Del(s.ctx, keysToDelete...).Err(); err != nil {
-				for range pulses {
-					pulsesNotDeleted.Inc()
+			delivered := pulses
+			if deleteErr != nil {
+				delivered = nil
+				for _, pulse := range pulses {
+					if slices.Contains(failedTenants, pulse.TenantId) {
+						pulsesNotDeleted.Inc()
+						continue
+					}
+					delivered = append(delivered, pulse)
 				}
-				errChan <- fmt.Errorf("erro ao apagar chaves do lote %d: %v", batchIndex, err)
+			}
+			if s.recorder != nil && len(delivered) > 0 {
+				s.record(batchIndex, delivered)
+			}
+			if s.reconciler != nil {
+				deliveredMu.Lock()
+				for _, ap := range delivered {
+					cycleDelivered = append(cycleDelivered, ap.Pulse)
+				}
+				deliveredMu.Unlock()
+			}
+			if deleteErr != nil {
+				pulsesSentSuccess.Add(float64(len(delivered)))
+				errChan <- fmt.Errorf("erro ao apagar chaves do lote %d: %v", batchIndex, deleteErr)
 				return
 			}
 
@@ -219,5 +477,8 @@ func (s *pulseSenderService) sendPulses(stabilizationDelay time.Duration) error
 	if len(errors) > 0 {
 		return fmt.Errorf("falhas no envio: %v", errors)
 	}
+	if !readFailed {
+		s.clearIndex(currentGen)
+	}
 	return nil
 }
@@ -3,22 +3,30 @@ package pulsesender
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
 	"github.com/ThalysSilva/ingestor-consumo/internal/clients/mocks"
-	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
 	"github.com/ThalysSilva/ingestor-consumo/pkg/utils"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMain(m *testing.M) {
@@ -111,6 +119,48 @@ func TestNewPulseSenderService(t *testing.T) {
 		assert.Equal(t, httpClient, *addressHttpClientSettled)
 
 	})
+
+	t.Run("UsingOptionsWithWorkersAndScanCount", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+
+		var settled *pulseSenderService
+		svc := NewPulseSenderService(ctx, redisClient, "http://example.com", 10, WithMaxWorkers(2), WithScanCount(1000),
+			func(ps *pulseSenderService) {
+				settled = ps
+			})
+		assert.NotNil(t, svc)
+		assert.Equal(t, 2, settled.maxWorkers)
+		assert.Equal(t, int64(1000), settled.scanCount)
+	})
+
+	t.Run("DefaultWorkersAndScanCount", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+
+		svc := NewPulseSenderService(ctx, redisClient, "http://example.com", 10)
+		settled := svc.(*pulseSenderService)
+		assert.Equal(t, DefaultMaxWorkers, settled.maxWorkers)
+		assert.Equal(t, DefaultScanCount, settled.scanCount)
+	})
+
+	t.Run("PanicOnInvalidMaxWorkers", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+
+		assert.PanicsWithValue(t, "maxWorkers deve ser maior que 0, recebido: 0", func() {
+			NewPulseSenderService(ctx, redisClient, "http://example.com", 10, WithMaxWorkers(0))
+		})
+	})
+
+	t.Run("PanicOnInvalidScanCount", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+
+		assert.PanicsWithValue(t, "scanCount deve ser maior que 0, recebido: -1", func() {
+			NewPulseSenderService(ctx, redisClient, "http://example.com", 10, WithScanCount(-1))
+		})
+	})
 }
 
 func TestStartLoopAndStop(t *testing.T) {
@@ -119,19 +169,23 @@ func TestStartLoopAndStop(t *testing.T) {
 		defer cancel()
 		redisClient := new(mocks.MockRedisClient)
 		clientHttp := new(mocks.MockHTTPClient)
-		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
-		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
-		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil).Once()
+		redisClient.On("Get", mock.Anything, "current_generation").Return("A", nil).Once()
+		redisClient.On("Get", mock.Anything, "current_generation").Return("A", nil).Once()
+		redisClient.On("Set", mock.Anything, "current_generation", "B", time.Duration(0)).Return(nil).Once()
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
-			"generation:A:tenant:tenant2:sku:sku2:useUnit:MB",
+			"generation:A:{tenant1}",
+			"generation:A:{tenant2}",
 		}
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", mock.Anything, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Scan", mock.Anything, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").Return("100.000", nil).Once()
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant2:sku:sku2:useUnit:MB").Return("200.000", nil).Once()
-		clientHttp.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).Return(&http.Response{}, nil)
+		redisClient.On("Scan", mock.Anything, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", mock.Anything, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", mock.Anything, "generation:A:{tenant1}:sending").Return(map[string]string{"sku1:KB": "100.000"}, nil).Once()
+		redisClient.On("Eval", mock.Anything, mock.Anything, []string{"generation:A:{tenant2}", "generation:A:{tenant2}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", mock.Anything, "generation:A:{tenant2}:sending").Return(map[string]string{"sku2:MB": "200.000"}, nil).Once()
+		clientHttp.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).Return(&http.Response{Body: io.NopCloser(bytes.NewReader(nil))}, nil)
 
 		svc := NewPulseSenderService(ctx, redisClient, "http://example.com", 10, WithCustomHTTPClient(clientHttp))
 		go svc.StartLoop(300*time.Millisecond, 1*time.Millisecond)
@@ -141,6 +195,143 @@ func TestStartLoopAndStop(t *testing.T) {
 		redisClient.AssertExpectations(t)
 		assert.NotNil(t, svc)
 	})
+
+	// mockSlowCycle prepara um ciclo com um hash cujo envio demora o suficiente para a parada ocorrer no meio.
+	// posting é fechado ao ler o hash, antes do envio
+	mockSlowCycle := func(redisClient *mocks.MockRedisClient, httpClient *mocks.MockHTTPClient, posting chan struct{}) {
+		key := "generation:A:{tenant1}"
+		redisClient.On("Get", mock.Anything, "current_generation").Return("A", nil).Twice()
+		redisClient.On("Set", mock.Anything, "current_generation", "B", time.Duration(0)).Return(nil).Once()
+		redisClient.On("Eval", mock.Anything, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Del", mock.Anything, []string{"{generation:A:tenants}:sending"}).Return(nil).Once()
+		redisClient.On("Scan", mock.Anything, uint64(0), "generation:A:{*}", int64(100)).
+			Return([]string{key}, uint64(0), nil).Once()
+		redisClient.On("Scan", mock.Anything, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", mock.Anything, mock.Anything, []string{key, key + ":sending"}, []interface{}(nil)).Return(int64(1), nil).Once()
+		redisClient.On("HGetAll", mock.Anything, key+":sending").Run(func(mock.Arguments) { close(posting) }).Return(map[string]string{"sku1:KB": "100"}, nil).Once()
+		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
+			After(200*time.Millisecond).
+			Return(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(nil))}, nil).Once()
+		redisClient.On("HDel", mock.Anything, key+":sending", []string{"sku1:KB"}).Return(nil).Once()
+	}
+
+	t.Run("StopWaitsForCycleInProgress", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		httpClient := new(mocks.MockHTTPClient)
+		posting := make(chan struct{})
+		mockSlowCycle(redisClient, httpClient, posting)
+
+		svc := NewPulseSenderService(ctx, redisClient, "http://example.com", 10, WithCustomHTTPClient(httpClient))
+		loopReturned := make(chan struct{})
+		go func() {
+			svc.StartLoop(20*time.Millisecond, time.Millisecond)
+			close(loopReturned)
+		}()
+
+		<-posting
+		svc.Stop()
+
+		// Ao retornar, o ciclo deve ter apagado as chaves enviadas e nenhum novo ciclo deve ter iniciado
+		redisClient.AssertExpectations(t)
+		httpClient.AssertExpectations(t)
+		select {
+		case <-loopReturned:
+		case <-time.After(time.Second):
+			t.Fatal("StartLoop não retornou após Stop")
+		}
+
+		status := svc.Status()
+		assert.False(t, status.Running)
+		assert.True(t, status.Stopping)
+		assert.Equal(t, int64(1), status.Cycles)
+		assert.NoError(t, status.LastCycleErr)
+		assert.GreaterOrEqual(t, status.LastCycleDuration, 200*time.Millisecond)
+	})
+
+	t.Run("ContextCancelledCompletesCycle", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		redisClient := new(mocks.MockRedisClient)
+		httpClient := new(mocks.MockHTTPClient)
+		posting := make(chan struct{})
+		mockSlowCycle(redisClient, httpClient, posting)
+
+		svc := NewPulseSenderService(ctx, redisClient, "http://example.com", 10, WithCustomHTTPClient(httpClient))
+		loopReturned := make(chan struct{})
+		go func() {
+			svc.StartLoop(20*time.Millisecond, time.Millisecond)
+			close(loopReturned)
+		}()
+
+		<-posting
+		cancel()
+		select {
+		case <-loopReturned:
+		case <-time.After(time.Second):
+			t.Fatal("StartLoop não retornou após o cancelamento do contexto")
+		}
+		redisClient.AssertExpectations(t)
+		httpClient.AssertExpectations(t)
+	})
+
+	t.Run("FinalCycleOnStop", func(t *testing.T) {
+		ctx := context.Background()
+		store := usagestore.NewMemoryStore()
+		require.NoError(t, store.Increment(ctx, usagestore.Increment{Generation: "A", TenantId: "tenant1", Field: "sku1:B:6", Units: 5000000}))
+
+		var posts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			posts.Add(1)
+		}))
+		defer server.Close()
+
+		svc := NewPulseSenderService(ctx, nil, server.URL, 10, WithUsageStore(store), WithFinalCycle())
+		loopReturned := make(chan struct{})
+		go func() {
+			svc.StartLoop(time.Hour, time.Hour)
+			close(loopReturned)
+		}()
+		require.Eventually(t, func() bool { return svc.Status().Running }, time.Second, time.Millisecond)
+
+		// o último ciclo envia a geração atual sem aguardar o intervalo nem a espera de estabilização
+		svc.Stop()
+		<-loopReturned
+		assert.Equal(t, int32(1), posts.Load())
+		assert.Equal(t, int64(1), svc.Status().Cycles)
+		fields, err := store.Read(ctx, "A", "tenant1", true)
+		require.NoError(t, err)
+		assert.Empty(t, fields)
+	})
+
+	t.Run("StopWithoutStart", func(t *testing.T) {
+		redisClient := new(mocks.MockRedisClient)
+		svc := NewPulseSenderService(context.Background(), redisClient, "http://example.com", 10)
+
+		svc.Stop()
+		// Um StartLoop posterior deve retornar imediatamente
+		done := make(chan struct{})
+		go func() {
+			svc.StartLoop(time.Millisecond, time.Millisecond)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("StartLoop não respeitou o Stop anterior")
+		}
+		svc.Stop()
+	})
+}
+
+// closeTrackingBody registra se o corpo da resposta foi fechado
+type closeTrackingBody struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed.Store(true)
+	return nil
 }
 
 func TestSendPulses(t *testing.T) {
@@ -148,29 +339,34 @@ func TestSendPulses(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
-			"generation:A:tenant:tenant2:sku:sku2:useUnit:MB",
+			"generation:A:{tenant1}",
+			"generation:A:{tenant2}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil).Once()
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Del", ctx, []string{"{generation:A:tenants}:sending"}).Return(nil).Once()
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("100.00", nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant2:sku:sku2:useUnit:MB").
-			Return("200.00", nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(map[string]string{"sku1:KB": "100.00"}, nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant2}", "generation:A:{tenant2}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant2}:sending").
+			Return(map[string]string{"sku2:MB": "200.00"}, nil)
 
 		resp := &http.Response{
 			StatusCode: http.StatusOK,
@@ -179,7 +375,8 @@ func TestSendPulses(t *testing.T) {
 		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
 			Return(resp, nil)
 
-		redisClient.On("Del", ctx, mock.MatchedBy(utils.MatchKeysIgnoreOrder(keys))).Return(nil).Once()
+		redisClient.On("HDel", ctx, "generation:A:{tenant1}:sending", []string{"sku1:KB"}).Return(nil).Once()
+		redisClient.On("HDel", ctx, "generation:A:{tenant2}:sending", []string{"sku2:MB"}).Return(nil).Once()
 
 		err := svc.sendPulses(1 * time.Millisecond)
 		assert.NoError(t, err)
@@ -187,18 +384,174 @@ func TestSendPulses(t *testing.T) {
 		httpClient.AssertExpectations(t)
 		ctx.Done()
 	})
+	t.Run("AggregatesUnitsIntoCanonicalTotal", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		httpClient := new(mocks.MockHTTPClient)
+		svc := &pulseSenderService{
+			httpClient:     httpClient,
+			ctx:            ctx,
+			apiURLSender:   "http://example.com",
+			batchQtyToSend: 10,
+			maxWorkers:     1,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
+		}
+
+		// Mesmo tenant e SKU em unidades diferentes de volume, uma taxa e uma unidade desconhecida
+		values := map[string]string{
+			"sku1:B":      "512",
+			"sku1:KB":     "1.5",
+			"sku1:MB":     "2",
+			"sku1:KB/sec": "4",
+			"sku1:TB":     "1",
+		}
+		fields := make([]string, 0, len(values))
+		for field := range values {
+			fields = append(fields, field)
+		}
+		key := "generation:A:{tenant1}"
+		redisClient.On("Eval", ctx, mock.Anything, []string{key, key + ":sending"}, []interface{}(nil)).Return(int64(1), nil).Once()
+		redisClient.On("HGetAll", ctx, key+":sending").Return(values, nil).Once()
+		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Twice()
+		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil).Once()
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Del", ctx, []string{"{generation:A:tenants}:sending"}).Return(nil).Once()
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
+			Return([]string{key}, uint64(0), nil).Once()
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+
+		var body []byte
+		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
+			Run(func(args mock.Arguments) { body = args.Get(2).(*bytes.Buffer).Bytes() }).
+			Return(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(nil))}, nil).Once()
+		redisClient.On("HDel", ctx, key+":sending", mock.MatchedBy(utils.MatchKeysIgnoreOrder(fields))).Return(nil).Once()
+
+		assert.NoError(t, svc.sendPulses(time.Millisecond))
+		redisClient.AssertExpectations(t)
+		httpClient.AssertExpectations(t)
+
+		var sent []map[string]any
+		assert.NoError(t, json.Unmarshal(body, &sent))
+		byUnit := make(map[string]map[string]any)
+		for _, item := range sent {
+			byUnit[item["use_unit"].(string)] = item
+		}
+		assert.Len(t, byUnit, 3)
+		assert.Equal(t, map[string]any{
+			"tenant_id": "tenant1", "product_sku": "sku1",
+			"used_amount": float64(512 + 1536 + 2<<20), "use_unit": "B",
+			"display_amount": float64(512+1536+2<<20) / (1 << 20), "display_unit": "MB",
+		}, byUnit["B"])
+		assert.Equal(t, float64(4096), byUnit["B/sec"]["used_amount"])
+		assert.Equal(t, "KB/sec", byUnit["B/sec"]["display_unit"])
+		assert.Equal(t, float64(4), byUnit["B/sec"]["display_amount"])
+		assert.Equal(t, float64(1), byUnit["TB"]["used_amount"])
+		assert.Equal(t, "TB", byUnit["TB"]["display_unit"])
+	})
+
+	t.Run("MaxAggregationAcrossUnits", func(t *testing.T) {
+		registry, err := pulse.NewUnitRegistry([]pulse.UnitDefinition{
+			{Name: "conn", Dimension: "connections", Factor: 1, Aggregation: pulse.AggregationMax},
+			{Name: "kconn", Dimension: "connections", Factor: 1000, Aggregation: pulse.AggregationMax},
+		})
+		assert.NoError(t, err)
+		original := pulse.Units()
+		pulse.SetUnitRegistry(registry)
+		defer pulse.SetUnitRegistry(original)
+
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		httpClient := new(mocks.MockHTTPClient)
+		svc := &pulseSenderService{
+			httpClient:     httpClient,
+			ctx:            ctx,
+			apiURLSender:   "http://example.com",
+			batchQtyToSend: 10,
+			maxWorkers:     1,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
+		}
+		key := "generation:A:{tenant1}"
+		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Twice()
+		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil).Once()
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Del", ctx, []string{"{generation:A:tenants}:sending"}).Return(nil).Once()
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
+			Return([]string{key}, uint64(0), nil).Once()
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{key, key + ":sending"}, []interface{}{"conn", "kconn"}).Return(int64(1), nil).Once()
+		redisClient.On("HGetAll", ctx, key+":sending").Return(map[string]string{"sku1:conn": "800", "sku1:kconn": "1.2"}, nil).Once()
+
+		var body []byte
+		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
+			Run(func(args mock.Arguments) { body = args.Get(2).(*bytes.Buffer).Bytes() }).
+			Return(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(nil))}, nil).Once()
+		redisClient.On("HDel", ctx, key+":sending", mock.MatchedBy(utils.MatchKeysIgnoreOrder([]string{"sku1:conn", "sku1:kconn"}))).Return(nil).Once()
+
+		assert.NoError(t, svc.sendPulses(time.Millisecond))
+
+		var sent []AggregatedPulse
+		assert.NoError(t, json.Unmarshal(body, &sent))
+		assert.Len(t, sent, 1)
+		assert.Equal(t, pulse.MustParseAmount("1200"), sent[0].UsedAmount)
+		assert.Equal(t, pulse.PulseUnit("conn"), sent[0].UseUnit)
+		assert.Equal(t, 1.2, sent[0].DisplayAmount)
+		assert.Equal(t, pulse.PulseUnit("kconn"), sent[0].DisplayUnit)
+	})
+
+	t.Run("UsesConfiguredScanCount", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		httpClient := new(mocks.MockHTTPClient)
+		svc := &pulseSenderService{
+			httpClient:     httpClient,
+			ctx:            ctx,
+			apiURLSender:   "http://example.com",
+			batchQtyToSend: 1,
+			maxWorkers:     1,
+			scanCount:      500,
+			store:          usagestore.NewRedisStore(ctx, redisClient, usagestore.WithScanCount(500)),
+		}
+
+		keys := []string{
+			"generation:A:{tenant1}",
+			"generation:A:{tenant2}",
+		}
+		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Twice()
+		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil).Once()
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Del", ctx, []string{"{generation:A:tenants}:sending"}).Return(nil).Once()
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(500)).
+			Return(keys, uint64(0), nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(500)).Return(nil, uint64(0), nil)
+		for _, key := range keys {
+			redisClient.On("Eval", ctx, mock.Anything, []string{key, key + ":sending"}, []interface{}(nil)).Return(int64(1), nil).Once()
+		}
+		redisClient.On("HGetAll", ctx, keys[0]+":sending").Return(map[string]string{"sku1:KB": "1"}, nil)
+		redisClient.On("HGetAll", ctx, keys[1]+":sending").Return(map[string]string{"sku2:MB": "2"}, nil)
+		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
+			Return(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(nil))}, nil).Twice()
+		redisClient.On("HDel", ctx, mock.Anything, mock.Anything).Return(nil).Twice()
+
+		err := svc.sendPulses(1 * time.Millisecond)
+		assert.NoError(t, err)
+		redisClient.AssertExpectations(t)
+		httpClient.AssertExpectations(t)
+	})
+
 	t.Run("ErrorInGenerationToggle", func(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
@@ -214,30 +567,34 @@ func TestSendPulses(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
+			"generation:A:{tenant1}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("100", nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(map[string]string{"sku1:KB": "100"}, nil)
 
+		body := &closeTrackingBody{Reader: bytes.NewReader([]byte{})}
 		resp := &http.Response{
 			StatusCode: http.StatusInternalServerError,
-			Body:       io.NopCloser(bytes.NewReader([]byte{})),
+			Body:       body,
 		}
 		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
 			Return(resp, nil)
@@ -245,6 +602,9 @@ func TestSendPulses(t *testing.T) {
 		err := svc.sendPulses(1 * time.Millisecond)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "falha envio lote")
+		assert.Contains(t, err.Error(), "status 500")
+		// o corpo de uma resposta recusada também é fechado, para que a conexão seja reutilizada
+		assert.True(t, body.closed.Load())
 		redisClient.AssertExpectations(t)
 		httpClient.AssertExpectations(t)
 	})
@@ -253,19 +613,20 @@ func TestSendPulses(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(nil, uint64(0), fmt.Errorf("scan error"))
 
 		err := svc.sendPulses(1 * time.Millisecond)
@@ -273,30 +634,58 @@ func TestSendPulses(t *testing.T) {
 		assert.Contains(t, err.Error(), "scan error")
 		redisClient.AssertExpectations(t)
 	})
+	t.Run("ErrorOnIndexScan", func(t *testing.T) {
+		ctx := context.Background()
+		redisClient := new(mocks.MockRedisClient)
+		httpClient := new(mocks.MockHTTPClient)
+		svc := &pulseSenderService{
+			httpClient:     httpClient,
+			ctx:            ctx,
+			apiURLSender:   "http://example.com",
+			batchQtyToSend: 2,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
+		}
+		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Twice()
+		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("SScan", ctx, "{generation:A:tenants}:sending", uint64(0), "", int64(100)).
+			Return(nil, uint64(0), fmt.Errorf("sscan error"))
+
+		err := svc.sendPulses(1 * time.Millisecond)
+		assert.ErrorContains(t, err, "sscan error")
+		redisClient.AssertNotCalled(t, "Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		redisClient.AssertExpectations(t)
+	})
+
 	t.Run("ErrorOnGetRedis", func(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
+			"generation:A:{tenant1}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("", fmt.Errorf("get error"))
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(nil, fmt.Errorf("get error"))
 		httpClient.AssertNotCalled(t, "Post", mock.Anything, mock.Anything, mock.Anything)
 		_ = svc.sendPulses(1 * time.Millisecond)
 		redisClient.AssertExpectations(t)
@@ -306,55 +695,64 @@ func TestSendPulses(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
+			"generation:A:{tenant1}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Del", ctx, []string{"{generation:A:tenants}:sending"}).Return(nil).Once()
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("invalid", nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(map[string]string{"sku1:KB": "invalid"}, nil)
 
 		_ = svc.sendPulses(1 * time.Millisecond)
 		httpClient.AssertNotCalled(t, "Post", mock.Anything, mock.Anything, mock.Anything)
 		redisClient.AssertExpectations(t)
 	})
-	t.Run("ErrorOnSplitKey", func(t *testing.T) {
+	t.Run("ErrorOnParseKeyOrField", func(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"tenant:tenant1:sku:sku1:useUnit:KB",
+			"generation:A:tenant1",
+			"generation:A:{tenant1}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Del", ctx, []string{"{generation:A:tenants}:sending"}).Return(nil).Once()
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("100", nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(map[string]string{"sku1": "100"}, nil)
 
 		_ = svc.sendPulses(1 * time.Millisecond)
 		httpClient.AssertNotCalled(t, "Post", mock.Anything, mock.Anything, mock.Anything)
@@ -371,26 +769,29 @@ func TestSendPulses(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
+			"generation:A:{tenant1}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("100", nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(map[string]string{"sku1:KB": "100"}, nil)
 
 		err := svc.sendPulses(1 * time.Millisecond)
 		assert.Error(t, err)
@@ -403,26 +804,29 @@ func TestSendPulses(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
+			"generation:A:{tenant1}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("100", nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(map[string]string{"sku1:KB": "100"}, nil)
 
 		resp := &http.Response{
 			StatusCode: http.StatusInternalServerError,
@@ -441,26 +845,29 @@ func TestSendPulses(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
+			"generation:A:{tenant1}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("100", nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(map[string]string{"sku1:KB": "100"}, nil)
 
 		resp := &http.Response{
 			StatusCode: http.StatusInternalServerError,
@@ -480,26 +887,29 @@ func TestSendPulses(t *testing.T) {
 		ctx := context.Background()
 		redisClient := new(mocks.MockRedisClient)
 		httpClient := new(mocks.MockHTTPClient)
-		generation := generation.NewManagerGeneration(redisClient, ctx)
 		svc := &pulseSenderService{
-			redisClient:    redisClient,
 			httpClient:     httpClient,
 			ctx:            ctx,
 			apiURLSender:   "http://example.com",
 			batchQtyToSend: 2,
-			generation:     generation,
+			maxWorkers:     DefaultMaxWorkers,
+			scanCount:      DefaultScanCount,
+			store:          usagestore.NewRedisStore(ctx, redisClient),
 		}
 
 		keys := []string{
-			"generation:A:tenant:tenant1:sku:sku1:useUnit:KB",
+			"generation:A:{tenant1}",
 		}
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Get", ctx, "current_generation").Return("A", nil).Once()
 		redisClient.On("Set", ctx, "current_generation", "B", time.Duration(0)).Return(nil)
-		redisClient.On("Scan", ctx, uint64(0), "generation:A:tenant:*:sku:*:useUnit:*", int64(100)).
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:tenants", "{generation:A:tenants}:sending"}, []interface{}(nil)).Return(int64(0), nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}", int64(100)).
 			Return(keys, uint64(0), nil)
-		redisClient.On("Get", ctx, "generation:A:tenant:tenant1:sku:sku1:useUnit:KB").
-			Return("100", nil)
+		redisClient.On("Scan", ctx, uint64(0), "generation:A:{*}:sending", int64(100)).Return(nil, uint64(0), nil)
+		redisClient.On("Eval", ctx, mock.Anything, []string{"generation:A:{tenant1}", "generation:A:{tenant1}:sending"}, []interface{}(nil)).Return(int64(1), nil)
+		redisClient.On("HGetAll", ctx, "generation:A:{tenant1}:sending").
+			Return(map[string]string{"sku1:KB": "100"}, nil)
 
 		resp := &http.Response{
 			StatusCode: http.StatusOK,
@@ -508,7 +918,7 @@ func TestSendPulses(t *testing.T) {
 		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
 			Return(resp, nil)
 
-		redisClient.On("Del", ctx, []string{"generation:A:tenant:tenant1:sku:sku1:useUnit:KB"}).Return(fmt.Errorf("falha ao excluir chaves no Redis"))
+		redisClient.On("HDel", ctx, "generation:A:{tenant1}:sending", []string{"sku1:KB"}).Return(fmt.Errorf("falha ao excluir chaves no Redis"))
 		err := svc.sendPulses(1 * time.Millisecond)
 		httpClient.AssertExpectations(t)
 		assert.Error(t, err)
@@ -516,3 +926,340 @@ func TestSendPulses(t *testing.T) {
 	})
 
 }
+
+func TestSendPulses_TenantHashes(t *testing.T) {
+	newClients := map[string]func(addr string) redis.UniversalClient{
+		"Single": func(addr string) redis.UniversalClient { return redis.NewClient(&redis.Options{Addr: addr}) },
+		"Cluster": func(addr string) redis.UniversalClient {
+			return redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{addr}})
+		},
+	}
+	for name, newClient := range newClients {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mr := miniredis.RunT(t)
+			redisClient := newClient(mr.Addr())
+			defer redisClient.Close()
+			httpClient := new(mocks.MockHTTPClient)
+			svc := &pulseSenderService{
+				httpClient:     httpClient,
+				ctx:            ctx,
+				apiURLSender:   "http://example.com",
+				batchQtyToSend: 1,
+				maxWorkers:     DefaultMaxWorkers,
+				scanCount:      1,
+				store:          usagestore.NewRedisStore(ctx, redisClient, usagestore.WithScanCount(1)),
+			}
+
+			mr.Set("current_generation", "A")
+			mr.HSet("generation:A:{tenant1}", "sku1:B", "100", "sku2:B/sec", "5")
+			mr.HSet("generation:A:{tenant2}", "sku1:KB", "1")
+			// o hash da geração que passa a receber os pulsos não é alterado
+			mr.HSet("generation:B:{tenant1}", "sku1:B", "7")
+
+			var sent []AggregatedPulse
+			var mu sync.Mutex
+			resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte{}))}
+			httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
+				Run(func(args mock.Arguments) {
+					var batch []AggregatedPulse
+					assert.NoError(t, json.Unmarshal(args.Get(2).(*bytes.Buffer).Bytes(), &batch))
+					mu.Lock()
+					sent = append(sent, batch...)
+					mu.Unlock()
+				}).
+				Return(resp, nil).Times(3)
+
+			require.NoError(t, svc.sendPulses(time.Millisecond))
+			httpClient.AssertExpectations(t)
+			assert.Len(t, sent, 3)
+			assert.False(t, mr.Exists("generation:A:{tenant1}"))
+			assert.False(t, mr.Exists("generation:A:{tenant2}"))
+			assert.Equal(t, "7", mr.HGet("generation:B:{tenant1}", "sku1:B"))
+		})
+	}
+}
+
+func TestSendPulses_GenerationIndex(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisClient.Close()
+	httpClient := new(mocks.MockHTTPClient)
+	svc := &pulseSenderService{
+		httpClient:     httpClient,
+		ctx:            ctx,
+		apiURLSender:   "http://example.com",
+		batchQtyToSend: 10,
+		maxWorkers:     DefaultMaxWorkers,
+		scanCount:      1,
+		store:          usagestore.NewRedisStore(ctx, redisClient, usagestore.WithScanCount(1)),
+	}
+
+	var sent []string
+	var amounts map[string]float64
+	var mu sync.Mutex
+	// post registra o envio de um lote; during é executado durante o envio, depois da reserva dos hashes
+	post := func(status int, during func()) {
+		amounts = make(map[string]float64)
+		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
+			Run(func(args mock.Arguments) {
+				var batch []AggregatedPulse
+				assert.NoError(t, json.Unmarshal(args.Get(2).(*bytes.Buffer).Bytes(), &batch))
+				mu.Lock()
+				defer mu.Unlock()
+				for _, p := range batch {
+					sent = append(sent, p.TenantId)
+					amounts[p.TenantId] += p.UsedAmount.Float64()
+				}
+				if during != nil {
+					during()
+				}
+			}).
+			Return(&http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewReader([]byte{}))}, nil).Once()
+	}
+
+	mr.Set("current_generation", "A")
+	mr.HSet("generation:A:{tenant1}", "sku1:B", "1")
+	mr.HSet("generation:A:{tenant2}", "sku1:B", "2")
+	// tenant3 já foi enviado em um ciclo com falhas e tenant9 foi gravado sem o índice
+	mr.SAdd("generation:A:tenants", "tenant1", "tenant2", "tenant3")
+	mr.HSet("generation:A:{tenant9}", "sku1:B", "9")
+
+	t.Run("ReadsIndexedTenants", func(t *testing.T) {
+		post(http.StatusOK, nil)
+		require.NoError(t, svc.sendPulses(time.Millisecond))
+		assert.ElementsMatch(t, []string{"tenant1", "tenant2"}, sent)
+		assert.False(t, mr.Exists("generation:A:tenants"))
+		assert.True(t, mr.Exists("generation:A:{tenant9}"))
+	})
+
+	t.Run("KeepsIndexOnFailure", func(t *testing.T) {
+		sent = nil
+		mr.Set("current_generation", "A")
+		mr.HSet("generation:A:{tenant1}", "sku1:B", "1")
+		mr.SAdd("generation:A:tenants", "tenant1")
+		post(http.StatusBadGateway, nil)
+		assert.Error(t, svc.sendPulses(time.Millisecond))
+		assert.Equal(t, []string{"tenant1"}, sent)
+		// os agregados continuam reservados para o próximo ciclo da geração
+		assert.True(t, mr.Exists("{generation:A:tenants}:sending"))
+		assert.Equal(t, "1", mr.HGet("generation:A:{tenant1}:sending", "sku1:B"))
+		assert.False(t, mr.Exists("generation:A:tenants"))
+		assert.False(t, mr.Exists("generation:A:{tenant1}"))
+	})
+
+	t.Run("MergesClaimedAfterFailure", func(t *testing.T) {
+		sent = nil
+		mr.Set("current_generation", "A")
+		mr.HSet("generation:A:{tenant1}", "sku1:B", "2")
+		mr.SAdd("generation:A:tenants", "tenant1")
+		post(http.StatusOK, nil)
+		require.NoError(t, svc.sendPulses(time.Millisecond))
+		assert.Equal(t, map[string]float64{"tenant1": 3}, amounts)
+		assert.Equal(t, []string{"current_generation", "generation:A:{tenant9}"}, mr.Keys())
+	})
+
+	t.Run("LateWriteSurvives", func(t *testing.T) {
+		sent = nil
+		mr.Set("current_generation", "A")
+		mr.HSet("generation:A:{tenant1}", "sku1:B", "4")
+		mr.SAdd("generation:A:tenants", "tenant1")
+		// um ingestor atrasado grava na geração enviada depois da reserva, durante o envio
+		post(http.StatusOK, func() {
+			_, err := mr.HIncrByFloat("generation:A:{tenant1}", "sku1:B", 5)
+			assert.NoError(t, err)
+			_, err = mr.SAdd("generation:A:tenants", "tenant1")
+			assert.NoError(t, err)
+		})
+		require.NoError(t, svc.sendPulses(time.Millisecond))
+		assert.Equal(t, map[string]float64{"tenant1": 4}, amounts)
+		assert.Equal(t, "5", mr.HGet("generation:A:{tenant1}", "sku1:B"))
+		members, err := mr.Members("generation:A:tenants")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tenant1"}, members)
+		assert.False(t, mr.Exists("generation:A:{tenant1}:sending"))
+	})
+
+	t.Run("FullScan", func(t *testing.T) {
+		sent = nil
+		mr.Set("current_generation", "A")
+		svc.store = usagestore.NewRedisStore(ctx, redisClient, usagestore.WithScanCount(1), usagestore.WithFullScan())
+		post(http.StatusOK, nil)
+		require.NoError(t, svc.sendPulses(time.Millisecond))
+		assert.ElementsMatch(t, []string{"tenant1", "tenant9"}, sent)
+		assert.Equal(t, []string{"current_generation"}, mr.Keys())
+	})
+	httpClient.AssertExpectations(t)
+}
+
+func TestSendPulses_ExactAmounts(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisClient.Close()
+	httpClient := new(mocks.MockHTTPClient)
+	svc := &pulseSenderService{
+		httpClient:     httpClient,
+		ctx:            ctx,
+		apiURLSender:   "http://example.com",
+		batchQtyToSend: 10,
+		maxWorkers:     DefaultMaxWorkers,
+		scanCount:      DefaultScanCount,
+		store:          usagestore.NewRedisStore(ctx, redisClient),
+	}
+
+	var payloads []string
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte{}))}
+	httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).
+		Run(func(args mock.Arguments) { payloads = append(payloads, args.Get(2).(*bytes.Buffer).String()) }).
+		Return(resp, nil)
+
+	t.Run("SumsScaledAndFloatFields", func(t *testing.T) {
+		mr.Set("current_generation", "A")
+		// 100 bilhões de B e um milionésimo, 0.000001 KB e um campo sem escala de um ingestor anterior
+		mr.HSet("generation:A:{tenant1}", "sku1:B:6", "100000000000000001", "sku1:KB:6", "1", "sku1:B", "0.5")
+		require.NoError(t, svc.sendPulses(time.Millisecond))
+		require.Len(t, payloads, 1)
+		assert.Contains(t, payloads[0], `"used_amount":100000000000.501025`)
+		assert.Equal(t, []string{"current_generation"}, mr.Keys())
+	})
+
+	t.Run("KeepsFieldThatOverflows", func(t *testing.T) {
+		payloads = nil
+		mr.Set("current_generation", "A")
+		mr.HSet("generation:A:{tenant2}", "sku1:B:6", "9223372036854775807", "sku1:KB:6", "1000000")
+		mr.SAdd("generation:A:tenants", "tenant2")
+		require.NoError(t, svc.sendPulses(time.Millisecond))
+		require.Len(t, payloads, 1)
+		// um dos campos é enviado e o outro continua reservado, com o índice reservado, para o próximo ciclo
+		fields, err := mr.HKeys("generation:A:{tenant2}:sending")
+		require.NoError(t, err)
+		assert.Len(t, fields, 1)
+		assert.True(t, mr.Exists("{generation:A:tenants}:sending"))
+
+		payloads = nil
+		mr.Set("current_generation", "A")
+		require.NoError(t, svc.sendPulses(time.Millisecond))
+		require.Len(t, payloads, 1)
+		assert.Equal(t, []string{"current_generation"}, mr.Keys())
+	})
+
+	t.Run("SendsOverflowParts", func(t *testing.T) {
+		payloads = nil
+		mr.Set("current_generation", "A")
+		// as partes gravadas quando o campo transbordaria são somadas ao mesmo agregado e apagadas com ele
+		mr.HSet("generation:A:{tenant3}", "sku1:B:6", "9223372036854775000", "sku1:B:6:1", "807")
+		mr.SAdd("generation:A:tenants", "tenant3")
+		require.NoError(t, svc.sendPulses(time.Millisecond))
+		require.Len(t, payloads, 1)
+		assert.Contains(t, payloads[0], `"used_amount":9223372036854.775807`)
+		assert.Equal(t, []string{"current_generation"}, mr.Keys())
+	})
+}
+
+type recordedBatch struct {
+	at     time.Time
+	pulses []pulse.Pulse
+}
+
+type fakeRecorder struct {
+	mu      sync.Mutex
+	batches []recordedBatch
+	err     error
+}
+
+func (f *fakeRecorder) Record(_ context.Context, at time.Time, pulses []pulse.Pulse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, recordedBatch{at: at, pulses: pulses})
+	return f.err
+}
+
+func TestSendPulses_DeliveryRecorder(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisClient.Close()
+	httpClient := new(mocks.MockHTTPClient)
+	recorder := &fakeRecorder{}
+	svc := &pulseSenderService{
+		httpClient:     httpClient,
+		ctx:            ctx,
+		apiURLSender:   "http://example.com",
+		batchQtyToSend: 10,
+		maxWorkers:     DefaultMaxWorkers,
+		scanCount:      DefaultScanCount,
+		store:          usagestore.NewRedisStore(ctx, redisClient),
+	}
+	WithDeliveryRecorder(recorder)(svc)
+
+	mr.Set("current_generation", "A")
+	mr.HSet("generation:A:{tenant1}", "sku1:KB", "1", "sku1:B", "24")
+
+	t.Run("NotRecordedWhenDeliveryFails", func(t *testing.T) {
+		failed := &http.Response{StatusCode: http.StatusBadGateway, Body: io.NopCloser(bytes.NewReader([]byte{}))}
+		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).Return(failed, nil).Once()
+		assert.Error(t, svc.sendPulses(time.Millisecond))
+		assert.Empty(t, recorder.batches)
+		mr.Set("current_generation", "A")
+	})
+
+	t.Run("RecordsDeliveredBatch", func(t *testing.T) {
+		resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader([]byte{}))}
+		httpClient.On("Post", "http://example.com", "application/json", mock.AnythingOfType("*bytes.Buffer")).Return(resp, nil).Once()
+		recorder.err = errors.New("disco cheio")
+
+		before := time.Now()
+		// falhas no histórico não desfazem a entrega
+		assert.NoError(t, svc.sendPulses(time.Millisecond))
+		require.Len(t, recorder.batches, 1)
+		assert.False(t, recorder.batches[0].at.Before(before))
+		assert.Equal(t, []pulse.Pulse{{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1048"), UseUnit: pulse.B}}, recorder.batches[0].pulses)
+		assert.False(t, mr.Exists("generation:A:{tenant1}"))
+	})
+}
+
+// TestSendPulses_MemoryStore envia os agregados gravados pelo serviço de pulsos no mesmo processo, sem Redis
+func TestSendPulses_MemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := usagestore.NewMemoryStore()
+
+	ingestor := pulse.NewPulseService(ctx, nil, pulse.WithUsageStore(store))
+	require.NotNil(t, ingestor)
+	ingestor.Start(4, time.Hour)
+	for range 1000 {
+		require.NoError(t, ingestor.EnqueuePulse(pulse.Pulse{TenantId: "tenant1", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("0.1"), UseUnit: pulse.KB}))
+	}
+	require.NoError(t, ingestor.EnqueuePulse(pulse.Pulse{TenantId: "tenant2", ProductSku: "sku1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.MB}))
+	require.NoError(t, ingestor.Shutdown(ctx))
+
+	var mu sync.Mutex
+	sent := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []AggregatedPulse
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		mu.Lock()
+		defer mu.Unlock()
+		for _, p := range batch {
+			sent[p.TenantId] = p.UsedAmount.String() + " " + string(p.UseUnit)
+		}
+	}))
+	defer server.Close()
+
+	svc := NewPulseSenderService(ctx, nil, server.URL, 10, WithUsageStore(store)).(*pulseSenderService)
+	require.NoError(t, svc.sendPulses(0))
+	assert.Equal(t, map[string]string{"tenant1": "102400 B", "tenant2": "1048576 B"}, sent)
+
+	gen, err := store.GetCurrentGeneration()
+	require.NoError(t, err)
+	assert.Equal(t, "B", gen)
+	for _, tenantId := range []string{"tenant1", "tenant2"} {
+		fields, err := store.Read(ctx, "A", tenantId, true)
+		require.NoError(t, err)
+		assert.Empty(t, fields)
+	}
+	tenants, err := store.ListGeneration(ctx, "A")
+	require.NoError(t, err)
+	assert.Empty(t, tenants)
+}
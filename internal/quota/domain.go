@@ -0,0 +1,151 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// Period é a janela de faturamento em que o consumo de uma cota é acumulado, sempre em UTC
+type Period string
+
+const (
+	Daily   Period = "day"
+	Monthly Period = "month"
+)
+
+// Start retorna o início do período que contém t
+func (p Period) Start(t time.Time) time.Time {
+	t = t.UTC()
+	if p == Daily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// End retorna o início do período seguinte ao que contém t
+func (p Period) End(t time.Time) time.Time {
+	start := p.Start(t)
+	if p == Daily {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// ID identifica o período que contém t nas chaves do Redis (ex.: 2025-01 ou 2025-01-31)
+func (p Period) ID(t time.Time) string {
+	if p == Daily {
+		return p.Start(t).Format("2006-01-02")
+	}
+	return p.Start(t).Format("2006-01")
+}
+
+// Quota é o limite contratual de consumo de um tenant em um SKU, por período
+type Quota struct {
+	TenantId   string `yaml:"tenant_id" toml:"tenant_id" json:"tenant_id"`
+	ProductSku string `yaml:"product_sku" toml:"product_sku" json:"product_sku"`
+	// Unit é a unidade em que os limites estão expressos. Os pulsos de qualquer unidade da mesma dimensão
+	// são convertidos para a unidade base antes de serem somados.
+	Unit   pulse.PulseUnit `yaml:"unit" toml:"unit" json:"unit"`
+	Period Period          `yaml:"period" toml:"period" json:"period"`
+	// SoftLimit emite um alerta quando ultrapassado; 0 não alerta
+	SoftLimit float64 `yaml:"soft_limit" toml:"soft_limit" json:"soft_limit,omitempty"`
+	// HardLimit emite um alerta e, se a aplicação estiver ativa, recusa os pulsos até o fim do período; 0 não limita
+	HardLimit float64 `yaml:"hard_limit" toml:"hard_limit" json:"hard_limit,omitempty"`
+}
+
+// document é o formato do arquivo de cotas
+type document struct {
+	Quotas []Quota `yaml:"quotas" toml:"quotas" json:"quotas"`
+}
+
+// Level identifica o limite ultrapassado
+type Level string
+
+const (
+	Soft Level = "soft"
+	Hard Level = "hard"
+)
+
+// validate verifica a cota contra o registro de unidades em uso
+func (q Quota) validate() error {
+	if !pulse.ValidTenantId(q.TenantId) {
+		return fmt.Errorf("tenant_id inválido %q", q.TenantId)
+	}
+	if q.ProductSku == "" {
+		return fmt.Errorf("cota do tenant %s: product_sku não informado", q.TenantId)
+	}
+	if !q.Unit.IsValid() {
+		return fmt.Errorf("%s: unidade não registrada %q", q, q.Unit)
+	}
+	if q.Unit.Aggregation() != pulse.AggregationSum {
+		return fmt.Errorf("%s: a unidade %s não é somada (agregação %s) e não pode ter cota", q, q.Unit, q.Unit.Aggregation())
+	}
+	if q.Period != Daily && q.Period != Monthly {
+		return fmt.Errorf("%s: período inválido %q (use day ou month)", q, q.Period)
+	}
+	for _, limit := range []float64{q.SoftLimit, q.HardLimit} {
+		if limit < 0 || math.IsNaN(limit) || math.IsInf(limit, 0) {
+			return fmt.Errorf("%s: limite inválido: %g", q, limit)
+		}
+	}
+	if q.SoftLimit == 0 && q.HardLimit == 0 {
+		return fmt.Errorf("%s: informe soft_limit e/ou hard_limit", q)
+	}
+	if q.SoftLimit > 0 && q.HardLimit > 0 && q.SoftLimit >= q.HardLimit {
+		return fmt.Errorf("%s: soft_limit (%g) deve ser menor que hard_limit (%g)", q, q.SoftLimit, q.HardLimit)
+	}
+	for _, level := range []Level{Soft, Hard} {
+		if _, err := q.limitAmount(level); err != nil {
+			return fmt.Errorf("%s: limite %s: %w", q, level, err)
+		}
+	}
+	return nil
+}
+
+func (q Quota) String() string {
+	return fmt.Sprintf("cota %s/%s/%s", q.TenantId, q.ProductSku, q.Period)
+}
+
+// limit retorna o limite do nível convertido para a unidade base, na escala dos totais.
+// As cotas validadas sempre têm limites representáveis.
+func (q Quota) limit(level Level) pulse.Amount {
+	limit, _ := q.limitAmount(level)
+	return limit
+}
+
+// limitAmount converte o limite do nível para a unidade base, arredondado para a escala
+func (q Quota) limitAmount(level Level) (pulse.Amount, error) {
+	limit := q.SoftLimit
+	if level == Hard {
+		limit = q.HardLimit
+	}
+	amount, err := pulse.AmountFromFloat(limit)
+	if err != nil {
+		return pulse.Amount{}, err
+	}
+	return q.Unit.ConvertAmount(amount, q.Unit.Base())
+}
+
+// validateAll verifica as cotas e a unicidade de cada tenant, SKU, dimensão e período.
+// Todos os problemas encontrados são retornados de uma vez.
+func validateAll(quotas []Quota) error {
+	var errs []error
+	seen := make(map[string]bool, len(quotas))
+	for _, q := range quotas {
+		if err := q.validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		id := fmt.Sprintf("%s|%s|%s|%s", q.TenantId, q.ProductSku, q.Unit.Dimension(), q.Period)
+		if seen[id] {
+			errs = append(errs, fmt.Errorf("%s: cota duplicada para a dimensão %s", q, q.Unit.Dimension()))
+			continue
+		}
+		seen[id] = true
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,47 @@
+package quota
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	metricsRegistered  = false
+	thresholdCrossings = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quota_threshold_crossings_total",
+			Help: "Total de limites de cota ultrapassados, por tenant, SKU e nível (soft ou hard)",
+		},
+		[]string{"tenant_id", "product_sku", "level"},
+	)
+	usageRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "quota_usage_ratio",
+			Help: "Fração consumida da cota no período atual, em relação ao hard_limit (ou ao soft_limit, se não houver hard_limit)",
+		},
+		[]string{"tenant_id", "product_sku", "unit", "period"},
+	)
+	trackingErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "quota_tracking_errors_total",
+			Help: "Total de falhas ao acumular o consumo das cotas no Redis",
+		},
+	)
+	eventsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "quota_events_dropped_total",
+			Help: "Total de eventos de cota descartados por falha ou fila cheia do webhook",
+		},
+	)
+)
+
+func registerMetrics() {
+	if metricsRegistered {
+		return
+	}
+	metricsRegistered = true
+
+	prometheus.MustRegister(
+		thresholdCrossings,
+		usageRatio,
+		trackingErrors,
+		eventsDropped,
+	)
+}
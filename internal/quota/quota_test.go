@@ -0,0 +1,379 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// recordingSink guarda os eventos recebidos
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recordingSink) Notify(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recordingSink) Close() {}
+
+func (r *recordingSink) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+func TestPeriod(t *testing.T) {
+	now := time.Date(2025, 1, 31, 23, 30, 0, 0, time.FixedZone("BRT", -3*3600))
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), Daily.Start(now))
+	assert.Equal(t, time.Date(2025, 2, 2, 0, 0, 0, 0, time.UTC), Daily.End(now))
+	assert.Equal(t, "2025-02-01", Daily.ID(now))
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), Monthly.Start(now))
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), Monthly.End(now))
+	assert.Equal(t, "2025-02", Monthly.ID(now))
+}
+
+func TestLoadFile(t *testing.T) {
+	quotas, err := LoadFile(writeFile(t, "quotas.yaml", `
+quotas:
+  - tenant_id: tenant1
+    product_sku: SKU-1
+    unit: GB
+    period: month
+    soft_limit: 80
+    hard_limit: 100
+  - tenant_id: tenant1
+    product_sku: SKU-1
+    unit: MB/sec
+    period: day
+    soft_limit: 10
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []Quota{
+		{TenantId: "tenant1", ProductSku: "SKU-1", Unit: pulse.GB, Period: Monthly, SoftLimit: 80, HardLimit: 100},
+		{TenantId: "tenant1", ProductSku: "SKU-1", Unit: pulse.MBxSec, Period: Daily, SoftLimit: 10},
+	}, quotas)
+
+	quotas, err = LoadFile(writeFile(t, "quotas.toml", `
+[[quotas]]
+tenant_id = "tenant1"
+product_sku = "SKU-1"
+unit = "KB"
+period = "day"
+hard_limit = 1
+`))
+	require.NoError(t, err)
+	assert.Len(t, quotas, 1)
+
+	quotas, err = LoadFile(writeFile(t, "quotas.json", `{"quotas": [{"tenant_id": "tenant1", "product_sku": "SKU-1", "unit": "B", "period": "month", "soft_limit": 1}]}`))
+	require.NoError(t, err)
+	assert.Len(t, quotas, 1)
+
+	_, err = LoadFile(writeFile(t, "quotas.ini", ""))
+	assert.ErrorContains(t, err, "formato de cotas não suportado")
+
+	_, err = LoadFile(filepath.Join(t.TempDir(), "ausente.yaml"))
+	assert.ErrorContains(t, err, "erro ao ler as cotas")
+
+	_, err = LoadFile(writeFile(t, "invalid.yaml", `
+quotas:
+  - {tenant_id: "", product_sku: SKU-1, unit: GB, period: month, soft_limit: 1}
+  - {tenant_id: tenant1, product_sku: "", unit: GB, period: month, soft_limit: 1}
+  - {tenant_id: tenant1, product_sku: SKU-1, unit: TB, period: month, soft_limit: 1}
+  - {tenant_id: tenant1, product_sku: SKU-1, unit: GB, period: week, soft_limit: 1}
+  - {tenant_id: tenant1, product_sku: SKU-1, unit: GB, period: month}
+  - {tenant_id: tenant1, product_sku: SKU-1, unit: GB, period: month, soft_limit: -1}
+  - {tenant_id: tenant1, product_sku: SKU-2, unit: GB, period: month, soft_limit: 10, hard_limit: 10}
+  - {tenant_id: tenant1, product_sku: SKU-3, unit: GB, period: month, soft_limit: 1}
+  - {tenant_id: tenant1, product_sku: SKU-3, unit: MB, period: month, hard_limit: 1}
+`))
+	require.Error(t, err)
+	for _, msg := range []string{
+		`tenant_id inválido ""`,
+		"product_sku não informado",
+		`unidade não registrada "TB"`,
+		`período inválido "week"`,
+		"informe soft_limit e/ou hard_limit",
+		"limite inválido: -1",
+		"soft_limit (10) deve ser menor que hard_limit (10)",
+		"cota tenant1/SKU-3/month: cota duplicada para a dimensão volume",
+	} {
+		assert.ErrorContains(t, err, msg)
+	}
+}
+
+func TestLoadFileMaxAggregation(t *testing.T) {
+	registry, err := pulse.NewUnitRegistry([]pulse.UnitDefinition{
+		{Name: "B", Dimension: pulse.Volume, Factor: 1, Aggregation: pulse.AggregationSum},
+		{Name: "conn", Dimension: "connections", Factor: 1, Aggregation: pulse.AggregationMax},
+	})
+	require.NoError(t, err)
+	original := pulse.Units()
+	pulse.SetUnitRegistry(registry)
+	defer pulse.SetUnitRegistry(original)
+
+	_, err = LoadFile(writeFile(t, "quotas.yaml", `
+quotas:
+  - {tenant_id: tenant1, product_sku: SKU-1, unit: conn, period: day, hard_limit: 10}
+`))
+	assert.ErrorContains(t, err, "a unidade conn não é somada")
+}
+
+func newTracker(t *testing.T, mr *miniredis.Miniredis, quotas []Quota, now *time.Time, opts ...TrackerOptions) *tracker {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	tr := NewTracker(client, quotas, opts...).(*tracker)
+	tr.now = func() time.Time { return *now }
+	return tr
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+	sink := &recordingSink{}
+	quotas := []Quota{
+		{TenantId: "tenant1", ProductSku: "SKU-1", Unit: pulse.KB, Period: Monthly, SoftLimit: 8, HardLimit: 10},
+		{TenantId: "tenant1", ProductSku: "SKU-1", Unit: pulse.KB, Period: Daily, SoftLimit: 6},
+	}
+	// duas réplicas compartilham os totais
+	a := newTracker(t, mr, quotas, &now, WithSink(sink))
+	b := newTracker(t, mr, quotas, &now, WithSink(sink))
+	assert.Equal(t, 2, a.Len())
+
+	monthKey := "quota:2025-01:tenant:tenant1:sku:SKU-1:useUnit:B:6"
+	dayKey := "quota:2025-01-31:tenant:tenant1:sku:SKU-1:useUnit:B:6"
+
+	// pulsos de outros tenants, SKUs ou dimensões não são acumulados
+	require.NoError(t, a.Track(ctx, pulse.Pulse{TenantId: "tenant2", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.KB}))
+	require.NoError(t, a.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.KBxSec}))
+	assert.Empty(t, mr.Keys())
+
+	// o valor é somado na unidade base, em 10^-6 B
+	require.NoError(t, a.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("5"), UseUnit: pulse.KB}))
+	total, err := mr.Get(monthKey)
+	require.NoError(t, err)
+	assert.Equal(t, "5120000000", total)
+	assert.Equal(t, 30*24*time.Hour+2*time.Hour, mr.TTL(monthKey))
+	assert.Equal(t, 30*24*time.Hour+2*time.Hour, mr.TTL(dayKey))
+	assert.Empty(t, sink.Events())
+	assert.Equal(t, 0.5, testutil.ToFloat64(usageRatio.WithLabelValues("tenant1", "SKU-1", "B", "month")))
+
+	// o limite soft diário é ultrapassado uma única vez, mesmo por outra réplica
+	softBefore := testutil.ToFloat64(thresholdCrossings.WithLabelValues("tenant1", "SKU-1", "soft"))
+	require.NoError(t, b.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1024"), UseUnit: pulse.B}))
+	require.NoError(t, a.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.B}))
+	events := sink.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, Event{
+		Type:        EventSoftLimit,
+		TenantId:    "tenant1",
+		ProductSku:  "SKU-1",
+		Unit:        "B",
+		Period:      Daily,
+		PeriodStart: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		Limit:       pulse.MustParseAmount("6144"),
+		Total:       pulse.MustParseAmount("6144"),
+		OccurredAt:  now,
+	}, events[0])
+	assert.Equal(t, softBefore+1, testutil.ToFloat64(thresholdCrossings.WithLabelValues("tenant1", "SKU-1", "soft")))
+
+	// um único pulso pode ultrapassar os dois limites mensais
+	_, blocked := a.Blocked("tenant1", "SKU-1")
+	assert.False(t, blocked)
+	require.NoError(t, a.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.MB}))
+	events = sink.Events()
+	require.Len(t, events, 3)
+	assert.Equal(t, EventSoftLimit, events[1].Type)
+	assert.Equal(t, Monthly, events[1].Period)
+	assert.Equal(t, pulse.MustParseAmount("8192"), events[1].Limit)
+	assert.Equal(t, EventHardLimit, events[2].Type)
+	assert.Equal(t, pulse.MustParseAmount("10240"), events[2].Limit)
+	assert.Equal(t, pulse.MustParseAmount("1054721"), events[2].Total)
+
+	until, blocked := a.Blocked("tenant1", "SKU-1")
+	assert.True(t, blocked)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), until)
+	_, blocked = a.Blocked("tenant1", "SKU-2")
+	assert.False(t, blocked)
+
+	// a outra réplica bloqueia ao acumular o próximo pulso, sem emitir outro evento
+	_, blocked = b.Blocked("tenant1", "SKU-1")
+	assert.False(t, blocked)
+	require.NoError(t, b.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.B}))
+	_, blocked = b.Blocked("tenant1", "SKU-1")
+	assert.True(t, blocked)
+	assert.Len(t, sink.Events(), 3)
+
+	// uma réplica nova aplica o bloqueio ao sincronizar
+	c := newTracker(t, mr, quotas, &now, WithSink(sink))
+	require.NoError(t, c.Sync(ctx))
+	_, blocked = c.Blocked("tenant1", "SKU-1")
+	assert.True(t, blocked)
+
+	// o bloqueio termina com o período, e o novo período começa do zero
+	now = time.Date(2025, 2, 1, 0, 0, 1, 0, time.UTC)
+	mr.SetTime(now)
+	_, blocked = a.Blocked("tenant1", "SKU-1")
+	assert.False(t, blocked)
+	require.NoError(t, a.Sync(ctx))
+	assert.Empty(t, a.blocked)
+	require.NoError(t, a.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.KB}))
+	total, err = mr.Get("quota:2025-02:tenant:tenant1:sku:SKU-1:useUnit:B:6")
+	require.NoError(t, err)
+	assert.Equal(t, "1024000000", total)
+}
+
+func TestTrackerExactTotals(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+	sink := &recordingSink{}
+	tr := newTracker(t, mr, []Quota{{TenantId: "tenant1", ProductSku: "SKU-1", Unit: pulse.B, Period: Daily, HardLimit: 1}}, &now, WithSink(sink))
+
+	// em ponto flutuante, dez pulsos de 0.1 somam 0.9999999999999999 e não atingiriam o limite
+	for i := 0; i < 9; i++ {
+		require.NoError(t, tr.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("0.1"), UseUnit: pulse.B}))
+	}
+	_, blocked := tr.Blocked("tenant1", "SKU-1")
+	assert.False(t, blocked)
+	require.NoError(t, tr.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("0.1"), UseUnit: pulse.B}))
+	_, blocked = tr.Blocked("tenant1", "SKU-1")
+	assert.True(t, blocked)
+	require.Len(t, sink.Events(), 1)
+	assert.Equal(t, "1", sink.Events()[0].Total.String())
+}
+
+func TestTrackerSyncLegacyTotal(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+	quotas := []Quota{{TenantId: "tenant1", ProductSku: "SKU-1", Unit: pulse.KB, Period: Monthly, HardLimit: 10}}
+
+	// o total gravado em ponto flutuante por versões anteriores inicia o total do período
+	require.NoError(t, mr.Set("quota:2025-01:tenant:tenant1:sku:SKU-1:useUnit:B", "10240.5"))
+	tr := newTracker(t, mr, quotas, &now)
+	require.NoError(t, tr.Sync(ctx))
+	total, err := mr.Get("quota:2025-01:tenant:tenant1:sku:SKU-1:useUnit:B:6")
+	require.NoError(t, err)
+	assert.Equal(t, "10240500000", total)
+	assert.Equal(t, 30*24*time.Hour+2*time.Hour, mr.TTL("quota:2025-01:tenant:tenant1:sku:SKU-1:useUnit:B:6"))
+	_, blocked := tr.Blocked("tenant1", "SKU-1")
+	assert.True(t, blocked)
+
+	// o total já iniciado não é sobrescrito por outra réplica
+	require.NoError(t, tr.Track(ctx, pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.B}))
+	require.NoError(t, newTracker(t, mr, quotas, &now).Sync(ctx))
+	total, err = mr.Get("quota:2025-01:tenant:tenant1:sku:SKU-1:useUnit:B:6")
+	require.NoError(t, err)
+	assert.Equal(t, "10241500000", total)
+}
+
+func TestTrackerRedisError(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.Now()
+	tr := newTracker(t, mr, []Quota{{TenantId: "tenant1", ProductSku: "SKU-1", Unit: pulse.B, Period: Daily, HardLimit: 1}}, &now)
+	mr.Close()
+
+	before := testutil.ToFloat64(trackingErrors)
+	err := tr.Track(context.Background(), pulse.Pulse{TenantId: "tenant1", ProductSku: "SKU-1", UsedAmount: pulse.MustParseAmount("1"), UseUnit: pulse.B})
+	assert.ErrorContains(t, err, "cota tenant1/SKU-1/day")
+	assert.Equal(t, before+1, testutil.ToFloat64(trackingErrors))
+	assert.Error(t, tr.Sync(context.Background()))
+}
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		// a primeira tentativa falha e é repetida
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var e Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		received = append(received, e)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, time.Second)
+	sink.Notify(Event{Type: EventSoftLimit, TenantId: "tenant1"})
+	sink.Notify(Event{Type: EventHardLimit, TenantId: "tenant1"})
+	sink.Close()
+	sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, calls)
+	require.Len(t, received, 2)
+	assert.Equal(t, EventSoftLimit, received[0].Type)
+	assert.Equal(t, EventHardLimit, received[1].Type)
+}
+
+func TestWebhookSinkDrops(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	before := testutil.ToFloat64(eventsDropped)
+	sink := NewWebhookSink(server.URL, time.Second)
+	sink.Notify(Event{Type: EventHardLimit, TenantId: "tenant1"})
+	sink.Close()
+	assert.Equal(t, before+1, testutil.ToFloat64(eventsDropped))
+
+	// com a fila cheia, o evento é descartado sem bloquear
+	full := &webhookSink{events: make(chan Event)}
+	before = testutil.ToFloat64(eventsDropped)
+	full.Notify(Event{Type: EventSoftLimit})
+	assert.Equal(t, before+1, testutil.ToFloat64(eventsDropped))
+}
+
+func TestMultiSink(t *testing.T) {
+	a, b := &recordingSink{}, &recordingSink{}
+	sink := NewMultiSink(a, b, NewLogSink())
+	sink.Notify(Event{Type: EventSoftLimit})
+	sink.Close()
+	assert.Len(t, a.Events(), 1)
+	assert.Len(t, b.Events(), 1)
+}
@@ -0,0 +1,159 @@
+package quota
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// Tipos dos eventos de cota
+const (
+	EventSoftLimit = "quota.soft_limit"
+	EventHardLimit = "quota.hard_limit"
+)
+
+// Event é emitido uma única vez por período quando o consumo acumulado ultrapassa um limite da cota.
+// Os valores estão na unidade base da dimensão (Unit).
+type Event struct {
+	Type        string       `json:"type"`
+	TenantId    string       `json:"tenant_id"`
+	ProductSku  string       `json:"product_sku"`
+	Unit        string       `json:"unit"`
+	Period      Period       `json:"period"`
+	PeriodStart time.Time    `json:"period_start"`
+	PeriodEnd   time.Time    `json:"period_end"`
+	Limit       pulse.Amount `json:"limit"`
+	Total       pulse.Amount `json:"total"`
+	OccurredAt  time.Time    `json:"occurred_at"`
+}
+
+// Sink recebe os eventos de cota. Notify não deve bloquear o processamento dos pulsos.
+type Sink interface {
+	Notify(e Event)
+	// Close entrega os eventos pendentes, se houver, e libera os recursos do sink
+	Close()
+}
+
+type logSink struct{}
+
+// NewLogSink registra os eventos de cota no log
+func NewLogSink() Sink {
+	return logSink{}
+}
+
+func (logSink) Notify(e Event) {
+	log.Warn().
+		Str("type", e.Type).
+		Str("tenant_id", e.TenantId).
+		Str("product_sku", e.ProductSku).
+		Str("unit", e.Unit).
+		Str("period", string(e.Period)).
+		Time("period_start", e.PeriodStart).
+		Str("limit", e.Limit.String()).
+		Str("total", e.Total.String()).
+		Msg("Limite de cota ultrapassado")
+}
+
+func (logSink) Close() {}
+
+// DefaultWebhookQueueSize é a quantidade de eventos aguardando envio ao webhook
+const DefaultWebhookQueueSize = 1000
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewWebhookSink envia cada evento em um POST JSON para url, em segundo plano.
+// Eventos que não couberem na fila ou falharem após 3 tentativas são descartados e contados em quota_events_dropped_total.
+func NewWebhookSink(url string, timeout time.Duration) Sink {
+	registerMetrics()
+	w := &webhookSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		events: make(chan Event, DefaultWebhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *webhookSink) Notify(e Event) {
+	select {
+	case w.events <- e:
+	default:
+		eventsDropped.Inc()
+		log.Error().Str("type", e.Type).Str("tenant_id", e.TenantId).Msg("Fila do webhook de cotas cheia, evento descartado")
+	}
+}
+
+// Close aguarda o envio dos eventos já enfileirados
+func (w *webhookSink) Close() {
+	w.once.Do(func() {
+		close(w.events)
+		<-w.done
+	})
+}
+
+func (w *webhookSink) run() {
+	defer close(w.done)
+	for e := range w.events {
+		if err := utils.Retry(func() error { return w.post(e) }, 3); err != nil {
+			eventsDropped.Inc()
+			log.Error().Err(err).Str("type", e.Type).Str("tenant_id", e.TenantId).Msg("Erro ao enviar evento de cota ao webhook")
+		}
+	}
+}
+
+func (w *webhookSink) post(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Str("url", w.url).Msg("Falha ao enviar evento de cota")
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Warn().Int("status", resp.StatusCode).Str("url", w.url).Msg("Webhook de cotas respondeu com erro")
+		return fmt.Errorf("webhook respondeu %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type multiSink []Sink
+
+// NewMultiSink repassa cada evento a todos os sinks
+func NewMultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Notify(e Event) {
+	for _, s := range m {
+		s.Notify(e)
+	}
+}
+
+func (m multiSink) Close() {
+	for _, s := range m {
+		s.Close()
+	}
+}
@@ -0,0 +1,39 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFile lê as cotas de um arquivo YAML, TOML ou JSON com a lista quotas e as valida
+// contra o registro de unidades em uso
+func LoadFile(path string) ([]Quota, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler as cotas: %w", err)
+	}
+	var doc document
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("formato de cotas não suportado: %s (use .yaml, .yml, .toml ou .json)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao interpretar as cotas %s: %w", path, err)
+	}
+	if err := validateAll(doc.Quotas); err != nil {
+		return nil, fmt.Errorf("cotas inválidas em %s: %w", path, err)
+	}
+	return doc.Quotas, nil
+}
@@ -0,0 +1,316 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/keycodec"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultRedisPrefix é o prefixo padrão dos totais das cotas no Redis
+const DefaultRedisPrefix = "quota:"
+
+// DefaultRetention é o tempo em que o total de um período é mantido no Redis após o fim do período
+const DefaultRetention = 30 * 24 * time.Hour
+
+// trackScript soma ARGV[1] (em 10^-escala da unidade base) ao total KEYS[1] e o faz expirar no instante ARGV[2] (em segundos).
+// Retorna {total anterior, total atual}, para que cada limite seja ultrapassado uma única vez entre as réplicas.
+// Os totais são lidos com GET, pois os números do Lua não representam todos os inteiros de 64 bits.
+const trackScript = `
+local previous = redis.call('GET', KEYS[1]) or '0'
+redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('EXPIREAT', KEYS[1], ARGV[2])
+return {previous, redis.call('GET', KEYS[1])}
+`
+
+// seedScript grava ARGV[1] em KEYS[1], se o total ainda não existir, com expiração no instante ARGV[2] (em segundos).
+// Retorna o total da chave.
+const seedScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  redis.call('SET', KEYS[1], ARGV[1])
+  redis.call('EXPIREAT', KEYS[1], ARGV[2])
+end
+return redis.call('GET', KEYS[1])
+`
+
+type Tracker interface {
+	// Track soma o pulso ao total do período de cada cota do tenant e SKU na dimensão do pulso.
+	// Ao ultrapassar um limite, emite o evento ao sink; ao ultrapassar o hard_limit, bloqueia o tenant e SKU
+	// até o fim do período.
+	pulse.UsageTracker
+
+	// Blocked indica se o tenant e SKU ultrapassaram o hard_limit de alguma cota no período atual
+	pulse.QuotaGuard
+
+	// Sync lê os totais do período atual no Redis e bloqueia os tenants e SKUs acima do hard_limit,
+	// para que uma réplica recém-iniciada aplique os bloqueios antes de receber novos pulsos
+	Sync(ctx context.Context) error
+
+	// Len retorna a quantidade de cotas em uso
+	Len() int
+}
+
+type tracker struct {
+	client    clients.RedisClient
+	prefix    string
+	retention time.Duration
+	sink      Sink
+	now       func() time.Time
+	// quotas agrupa as cotas por tenant, SKU e unidade base
+	quotas map[string][]Quota
+	count  int
+
+	mu sync.RWMutex
+	// blocked guarda, por tenant e SKU, até quando os pulsos devem ser recusados
+	blocked map[string]time.Time
+}
+
+type TrackerOptions func(*tracker)
+
+// WithRedisPrefix define o prefixo dos totais no Redis
+func WithRedisPrefix(prefix string) TrackerOptions {
+	return func(t *tracker) {
+		t.prefix = prefix
+	}
+}
+
+// WithRetention define por quanto tempo o total de um período é mantido no Redis após o seu fim
+func WithRetention(retention time.Duration) TrackerOptions {
+	return func(t *tracker) {
+		t.retention = retention
+	}
+}
+
+// WithSink define o destino dos eventos de cota; o padrão é o log
+func WithSink(sink Sink) TrackerOptions {
+	return func(t *tracker) {
+		t.sink = sink
+	}
+}
+
+// NewTracker cria o acompanhamento das cotas, que devem ter sido validadas (veja LoadFile).
+// Os totais ficam em <prefix><período>:tenant:<tenant>:sku:<sku>:useUnit:<unidade base>:<escala>,
+// ao lado das chaves das gerações, e não são afetados pela troca de geração do sender.
+// Cada total é um inteiro em 10^-escala da unidade base (veja pulse.Amount), somado sem perda de precisão.
+// Os identificadores são codificados com keycodec.Escape.
+func NewTracker(client clients.RedisClient, quotas []Quota, opts ...TrackerOptions) Tracker {
+	registerMetrics()
+	t := &tracker{
+		client:    client,
+		prefix:    DefaultRedisPrefix,
+		retention: DefaultRetention,
+		sink:      NewLogSink(),
+		now:       time.Now,
+		quotas:    make(map[string][]Quota),
+		count:     len(quotas),
+		blocked:   make(map[string]time.Time),
+	}
+	for _, q := range quotas {
+		id := quotaId(q.TenantId, q.ProductSku, q.Unit.Base())
+		t.quotas[id] = append(t.quotas[id], q)
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func quotaId(tenantId, productSku string, unit pulse.PulseUnit) string {
+	return tenantId + "|" + productSku + "|" + string(unit)
+}
+
+func blockId(tenantId, productSku string) string {
+	return tenantId + "|" + productSku
+}
+
+func (t *tracker) key(q Quota, now time.Time) string {
+	return fmt.Sprintf("%s:%d", t.legacyKey(q, now), pulse.AmountScale())
+}
+
+// legacyKey é a chave dos totais gravados por versões anteriores, em ponto flutuante e sem a escala
+func (t *tracker) legacyKey(q Quota, now time.Time) string {
+	return fmt.Sprintf("%s%s:tenant:%s:sku:%s:useUnit:%s", t.prefix, q.Period.ID(now), keycodec.Escape(q.TenantId), keycodec.Escape(q.ProductSku), keycodec.Escape(string(q.Unit.Base())))
+}
+
+func (t *tracker) expireAt(q Quota, now time.Time) int64 {
+	return q.Period.End(now).Add(t.retention).Unix()
+}
+
+func (t *tracker) Track(ctx context.Context, p pulse.Pulse) error {
+	normalized, err := p.Normalize()
+	if err != nil {
+		return err
+	}
+	quotas := t.quotas[quotaId(normalized.TenantId, normalized.ProductSku, normalized.UseUnit)]
+	if len(quotas) == 0 {
+		return nil
+	}
+	now := t.now()
+	var errs []error
+	for _, q := range quotas {
+		previous, total, err := t.add(ctx, q, now, normalized.UsedAmount)
+		if err != nil {
+			trackingErrors.Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", q, err))
+			continue
+		}
+		t.observe(q, now, previous, total)
+	}
+	return errors.Join(errs...)
+}
+
+func (t *tracker) add(ctx context.Context, q Quota, now time.Time, amount pulse.Amount) (pulse.Amount, pulse.Amount, error) {
+	res, err := t.client.Eval(ctx, trackScript, []string{t.key(q, now)}, strconv.FormatInt(amount.Units(), 10), t.expireAt(q, now)).Slice()
+	if err != nil {
+		return pulse.Amount{}, pulse.Amount{}, err
+	}
+	if len(res) != 2 {
+		return pulse.Amount{}, pulse.Amount{}, fmt.Errorf("resposta inesperada do script de cota: %v", res)
+	}
+	var values [2]pulse.Amount
+	for i, v := range res {
+		raw, ok := v.(string)
+		if !ok {
+			return pulse.Amount{}, pulse.Amount{}, fmt.Errorf("resposta inesperada do script de cota: %v", res)
+		}
+		values[i], err = parseTotal(raw)
+		if err != nil {
+			return pulse.Amount{}, pulse.Amount{}, err
+		}
+	}
+	return values[0], values[1], nil
+}
+
+// parseTotal interpreta o total de uma cota, gravado na escala em uso
+func parseTotal(raw string) (pulse.Amount, error) {
+	total, err := pulse.ParseScaledAmount(raw, pulse.AmountScale())
+	if err != nil {
+		return pulse.Amount{}, fmt.Errorf("total inválido da cota: %w", err)
+	}
+	return total, nil
+}
+
+// observe emite os eventos dos limites ultrapassados pela soma e atualiza o bloqueio e a métrica de uso
+func (t *tracker) observe(q Quota, now time.Time, previous, total pulse.Amount) {
+	for _, level := range []Level{Soft, Hard} {
+		limit := q.limit(level)
+		if limit.Sign() <= 0 || previous.Units() >= limit.Units() || total.Units() < limit.Units() {
+			continue
+		}
+		thresholdCrossings.WithLabelValues(q.TenantId, q.ProductSku, string(level)).Inc()
+		eventType := EventSoftLimit
+		if level == Hard {
+			eventType = EventHardLimit
+		}
+		t.sink.Notify(Event{
+			Type:        eventType,
+			TenantId:    q.TenantId,
+			ProductSku:  q.ProductSku,
+			Unit:        string(q.Unit.Base()),
+			Period:      q.Period,
+			PeriodStart: q.Period.Start(now),
+			PeriodEnd:   q.Period.End(now),
+			Limit:       limit,
+			Total:       total,
+			OccurredAt:  now.UTC(),
+		})
+	}
+	t.update(q, now, total)
+}
+
+// update bloqueia o tenant e SKU se o total atingiu o hard_limit e atualiza a métrica de uso
+func (t *tracker) update(q Quota, now time.Time, total pulse.Amount) {
+	reference := q.limit(Hard)
+	if reference.Sign() > 0 && total.Units() >= reference.Units() {
+		t.block(q.TenantId, q.ProductSku, q.Period.End(now))
+	}
+	if reference.Sign() <= 0 {
+		reference = q.limit(Soft)
+	}
+	usageRatio.WithLabelValues(q.TenantId, q.ProductSku, string(q.Unit.Base()), string(q.Period)).Set(total.Float64() / reference.Float64())
+}
+
+func (t *tracker) block(tenantId, productSku string, until time.Time) {
+	id := blockId(tenantId, productSku)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until.After(t.blocked[id]) {
+		t.blocked[id] = until
+	}
+}
+
+func (t *tracker) Blocked(tenantId, productSku string) (time.Time, bool) {
+	t.mu.RLock()
+	until, ok := t.blocked[blockId(tenantId, productSku)]
+	t.mu.RUnlock()
+	if !ok || !t.now().Before(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+func (t *tracker) Sync(ctx context.Context) error {
+	now := t.now()
+	t.mu.Lock()
+	for id, until := range t.blocked {
+		if !now.Before(until) {
+			delete(t.blocked, id)
+		}
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, quotas := range t.quotas {
+		for _, q := range quotas {
+			raw, err := t.client.Get(ctx, t.key(q, now)).Result()
+			if err == redis.Nil {
+				raw, err = t.seed(ctx, q, now)
+				if raw == "" && err == nil {
+					continue
+				}
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", q, err))
+				continue
+			}
+			total, err := parseTotal(raw)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", q, err))
+				continue
+			}
+			t.update(q, now, total)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// seed inicia o total do período com o total gravado em ponto flutuante por versões anteriores, se houver,
+// para que a atualização não zere o consumo do período. Retorna o total da chave, ou "" se não houver total.
+func (t *tracker) seed(ctx context.Context, q Quota, now time.Time) (string, error) {
+	raw, err := t.client.Get(ctx, t.legacyKey(q, now)).Result()
+	if err == redis.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return "", fmt.Errorf("total anterior inválido %q", raw)
+	}
+	legacy, err := pulse.AmountFromFloat(f)
+	if err != nil {
+		return "", fmt.Errorf("total anterior inválido %q: %w", raw, err)
+	}
+	return t.client.Eval(ctx, seedScript, []string{t.key(q, now)}, strconv.FormatInt(legacy.Units(), 10), t.expireAt(q, now)).Text()
+}
+
+func (t *tracker) Len() int {
+	return t.count
+}
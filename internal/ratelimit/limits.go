@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// Limit é a configuração do balde de um tenant: Rate pulsos por segundo, com rajadas de até Burst pulsos.
+// Rate 0 indica um tenant sem limite.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited indica se o limite não restringe o tenant
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// NewLimit cria um limite de rate pulsos por segundo. Com burst 0, a rajada é de um segundo de pulsos.
+func NewLimit(rate float64, burst int) Limit {
+	if burst <= 0 && rate > 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return Limit{Rate: rate, Burst: burst}
+}
+
+// Limits reúne o limite padrão e os limites específicos de alguns tenants
+type Limits struct {
+	Default   Limit
+	Overrides map[string]Limit
+}
+
+// For retorna o limite aplicado ao tenant
+func (l Limits) For(tenantId string) Limit {
+	if limit, ok := l.Overrides[tenantId]; ok {
+		return limit
+	}
+	return l.Default
+}
+
+// OtherTenants é o label das métricas que agrupa os tenants sem limite específico e não autenticados
+const OtherTenants = "other"
+
+// metricLabel retorna o label do tenant nas métricas. O tenant_id é informado pelo cliente, então apenas
+// os tenants com limite específico ou autenticados (veja pulse.AuthenticatedTenant) são identificados,
+// para que a quantidade de séries seja limitada.
+func (l Limits) metricLabel(ctx context.Context, tenantId string) string {
+	if _, ok := l.Overrides[tenantId]; ok || pulse.AuthenticatedTenant(ctx, tenantId) {
+		return tenantId
+	}
+	return OtherTenants
+}
+
+// ParseOverrides interpreta os limites por tenant no formato tenant=taxa[:rajada] (ex.: tenant1=100:500).
+// A taxa 0 remove o limite do tenant.
+func ParseOverrides(items []string) (map[string]Limit, error) {
+	overrides := make(map[string]Limit, len(items))
+	var errs []error
+	for _, item := range items {
+		tenant, value, ok := strings.Cut(item, "=")
+		if !ok || !pulse.ValidTenantId(tenant) {
+			errs = append(errs, fmt.Errorf("limite inválido %q (use tenant=taxa[:rajada])", item))
+			continue
+		}
+		rawRate, rawBurst, hasBurst := strings.Cut(value, ":")
+		rate, err := strconv.ParseFloat(rawRate, 64)
+		if err != nil || rate < 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+			errs = append(errs, fmt.Errorf("taxa inválida para o tenant %s: %q", tenant, rawRate))
+			continue
+		}
+		burst := 0
+		if hasBurst {
+			burst, err = strconv.Atoi(rawBurst)
+			if err != nil || burst < 1 {
+				errs = append(errs, fmt.Errorf("rajada inválida para o tenant %s: %q", tenant, rawBurst))
+				continue
+			}
+		}
+		if _, ok := overrides[tenant]; ok {
+			errs = append(errs, fmt.Errorf("tenant %s informado mais de uma vez", tenant))
+			continue
+		}
+		overrides[tenant] = NewLimit(rate, burst)
+	}
+	return overrides, errors.Join(errs...)
+}
+
+// bucket é o estado de um balde de fichas
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// take repõe as fichas acumuladas desde a última atualização e consome uma, se houver.
+// Relógios que voltam no tempo não repõem fichas.
+func (b *bucket) take(limit Limit, now time.Time) pulse.RateLimit {
+	if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed.Seconds()*limit.Rate)
+		b.updatedAt = now
+	}
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return decision(limit, allowed, b.tokens)
+}
+
+// decision calcula os campos informados ao cliente a partir das fichas restantes no balde
+func decision(limit Limit, allowed bool, tokens float64) pulse.RateLimit {
+	d := pulse.RateLimit{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		d.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return d
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
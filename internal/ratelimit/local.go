@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// sweepInterval é o intervalo entre as remoções dos baldes cheios, que equivalem a baldes novos
+const sweepInterval = time.Minute
+
+type localLimiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweptAt time.Time
+}
+
+// NewLocalLimiter limita cada tenant com um balde de fichas em memória.
+// Cada réplica do ingestor aplica o limite de forma independente.
+func NewLocalLimiter(limits Limits) pulse.RateLimiter {
+	registerMetrics()
+	return newLocalLimiter(limits)
+}
+
+func newLocalLimiter(limits Limits) *localLimiter {
+	return &localLimiter{limits: limits, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+func (l *localLimiter) Allow(ctx context.Context, tenantId string) (pulse.RateLimit, error) {
+	limit := l.limits.For(tenantId)
+	if limit.Unlimited() {
+		return pulse.RateLimit{Allowed: true}, nil
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[tenantId]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		l.buckets[tenantId] = b
+	}
+	d := b.take(limit, now)
+	if !d.Allowed {
+		throttled.WithLabelValues(l.limits.metricLabel(ctx, tenantId)).Inc()
+	}
+	return d, nil
+}
+
+// sweep remove os baldes que já estariam cheios, para que tenants inativos não ocupem memória.
+// Deve ser chamado com mu travado.
+func (l *localLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < sweepInterval {
+		return
+	}
+	l.sweptAt = now
+	for tenantId, b := range l.buckets {
+		limit := l.limits.For(tenantId)
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(l.buckets, tenantId)
+		}
+	}
+}
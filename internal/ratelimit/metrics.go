@@ -0,0 +1,32 @@
+package ratelimit
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	metricsRegistered = false
+	throttled         = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestor_rate_limited_total",
+			Help: "Total de pulsos recusados por exceder o limite de taxa, por tenant; os tenants sem limite específico e não autenticados são agrupados em other",
+		},
+		[]string{"tenant_id"},
+	)
+	rateLimitErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestor_rate_limit_errors_total",
+			Help: "Total de falhas ao consultar o limite de taxa no Redis, em que o limite local foi aplicado",
+		},
+	)
+)
+
+func registerMetrics() {
+	if metricsRegistered {
+		return
+	}
+	metricsRegistered = true
+
+	prometheus.MustRegister(
+		throttled,
+		rateLimitErrors,
+	)
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+func TestParseOverrides(t *testing.T) {
+	overrides, err := ParseOverrides([]string{"tenant1=100:500", "tenant2=2.5", "interno=0"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Limit{
+		"tenant1": {Rate: 100, Burst: 500},
+		"tenant2": {Rate: 2.5, Burst: 3},
+		"interno": {Rate: 0, Burst: 0},
+	}, overrides)
+	assert.True(t, overrides["interno"].Unlimited())
+
+	_, err = ParseOverrides([]string{"tenant1", "tenant 2=1", "tenant3=-1", "tenant4=1:0", "tenant5=x", "tenant6=1", "tenant6=2"})
+	require.Error(t, err)
+	for _, msg := range []string{`"tenant1"`, `"tenant 2=1"`, "taxa inválida para o tenant tenant3", "rajada inválida para o tenant tenant4", "taxa inválida para o tenant tenant5", "tenant6 informado mais de uma vez"} {
+		assert.ErrorContains(t, err, msg)
+	}
+}
+
+func TestLimitsFor(t *testing.T) {
+	limits := Limits{Default: NewLimit(10, 0), Overrides: map[string]Limit{"tenant1": NewLimit(1, 5)}}
+	assert.Equal(t, Limit{Rate: 10, Burst: 10}, limits.For("tenant2"))
+	assert.Equal(t, Limit{Rate: 1, Burst: 5}, limits.For("tenant1"))
+}
+
+func TestLimitsMetricLabel(t *testing.T) {
+	ctx := context.Background()
+	limits := Limits{Default: NewLimit(10, 0), Overrides: map[string]Limit{"tenant1": NewLimit(1, 5)}}
+	assert.Equal(t, "tenant1", limits.metricLabel(ctx, "tenant1"))
+	assert.Equal(t, OtherTenants, limits.metricLabel(ctx, "tenant2"))
+	authenticated := pulse.ContextWithAuthenticatedTenant(ctx, "tenant2")
+	assert.Equal(t, "tenant2", limits.metricLabel(authenticated, "tenant2"))
+	assert.Equal(t, OtherTenants, limits.metricLabel(authenticated, "tenant3"))
+}
+
+func TestLocalLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newLocalLimiter(Limits{
+		Default:   NewLimit(2, 3),
+		Overrides: map[string]Limit{"interno": NewLimit(0, 0)},
+	})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	// a rajada inicial consome o balde cheio
+	for remaining := 2; remaining >= 0; remaining-- {
+		d, err := l.Allow(ctx, "tenant1")
+		require.NoError(t, err)
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 3, d.Limit)
+		assert.Equal(t, remaining, d.Remaining)
+	}
+	// tenant1 não tem limite específico nem foi autenticado, então é contado em other
+	before := testutil.ToFloat64(throttled.WithLabelValues(OtherTenants))
+	d, err := l.Allow(ctx, "tenant1")
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, d.Reset)
+	assert.Equal(t, before+1, testutil.ToFloat64(throttled.WithLabelValues(OtherTenants)))
+
+	// os tenants têm baldes independentes
+	d, _ = l.Allow(ctx, "tenant2")
+	assert.True(t, d.Allowed)
+
+	// a taxa repõe uma ficha a cada 500ms
+	now = now.Add(500 * time.Millisecond)
+	d, _ = l.Allow(ctx, "tenant1")
+	assert.True(t, d.Allowed)
+	d, _ = l.Allow(ctx, "tenant1")
+	assert.False(t, d.Allowed)
+
+	// relógio voltando no tempo não repõe fichas
+	now = now.Add(-time.Second)
+	d, _ = l.Allow(ctx, "tenant1")
+	assert.False(t, d.Allowed)
+	now = now.Add(time.Second)
+
+	// tenants sem limite não recebem cabeçalhos
+	for i := 0; i < 10; i++ {
+		d, _ = l.Allow(ctx, "interno")
+		assert.Equal(t, pulse.RateLimit{Allowed: true}, d)
+	}
+
+	// baldes que estariam cheios são removidos
+	now = now.Add(sweepInterval)
+	l.Allow(ctx, "tenant3")
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, "tenant3")
+}
+
+func newRedisLimiter(t *testing.T, mr *miniredis.Miniredis, limits Limits, now *time.Time) *redisLimiter {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	r := NewRedisLimiter(client, DefaultRedisPrefix, limits).(*redisLimiter)
+	r.now = func() time.Time { return *now }
+	r.fallback.now = r.now
+	return r
+}
+
+func TestRedisLimiter(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	limits := Limits{Default: NewLimit(1, 2)}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// duas réplicas compartilham o mesmo balde
+	a := newRedisLimiter(t, mr, limits, &now)
+	b := newRedisLimiter(t, mr, limits, &now)
+
+	d, err := a.Allow(ctx, "tenant1")
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining)
+	d, _ = b.Allow(ctx, "tenant1")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	d, _ = a.Allow(ctx, "tenant1")
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.True(t, mr.Exists("ratelimit:tenant1"))
+	assert.Greater(t, mr.TTL("ratelimit:tenant1"), time.Duration(0))
+
+	now = now.Add(1500 * time.Millisecond)
+	d, _ = b.Allow(ctx, "tenant1")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	// com o Redis indisponível, o limite é aplicado localmente
+	mr.Close()
+	before := testutil.ToFloat64(rateLimitErrors)
+	d, err = a.Allow(ctx, "tenant1")
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining)
+	assert.Equal(t, before+1, testutil.ToFloat64(rateLimitErrors))
+}
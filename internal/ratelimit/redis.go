@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultRedisPrefix é o prefixo padrão dos baldes no Redis
+const DefaultRedisPrefix = "ratelimit:"
+
+// takeScript aplica o balde de fichas guardado no hash KEYS[1] (campos tokens e ts, em ms).
+// ARGV: taxa por segundo, rajada e instante atual em ms. Retorna {permitido (0 ou 1), fichas restantes}.
+// O hash expira quando o balde estaria cheio, pois um balde ausente equivale a um balde cheio.
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	ts = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+type redisLimiter struct {
+	client   clients.RedisClient
+	prefix   string
+	limits   Limits
+	fallback *localLimiter
+	now      func() time.Time
+}
+
+// NewRedisLimiter limita cada tenant com um balde de fichas compartilhado entre as réplicas do ingestor,
+// guardado em <prefix><tenant_id>. O instante utilizado é o relógio de cada réplica.
+// Se o Redis falhar, o limite é aplicado localmente até a próxima consulta bem-sucedida.
+func NewRedisLimiter(client clients.RedisClient, prefix string, limits Limits) pulse.RateLimiter {
+	registerMetrics()
+	return &redisLimiter{
+		client:   client,
+		prefix:   prefix,
+		limits:   limits,
+		fallback: newLocalLimiter(limits),
+		now:      time.Now,
+	}
+}
+
+func (r *redisLimiter) Allow(ctx context.Context, tenantId string) (pulse.RateLimit, error) {
+	limit := r.limits.For(tenantId)
+	if limit.Unlimited() {
+		return pulse.RateLimit{Allowed: true}, nil
+	}
+	nowMs := r.now().UnixMilli()
+	allowed, tokens, err := r.take(ctx, tenantId, limit, nowMs)
+	if err != nil {
+		rateLimitErrors.Inc()
+		log.Warn().Err(err).Str("tenant_id", tenantId).Msg("Erro ao consultar o limite de taxa no Redis, aplicando o limite local")
+		return r.fallback.Allow(ctx, tenantId)
+	}
+	if !allowed {
+		throttled.WithLabelValues(r.limits.metricLabel(ctx, tenantId)).Inc()
+	}
+	return decision(limit, allowed, tokens), nil
+}
+
+func (r *redisLimiter) take(ctx context.Context, tenantId string, limit Limit, nowMs int64) (bool, float64, error) {
+	res, err := r.client.Eval(ctx, takeScript, []string{r.prefix + tenantId},
+		strconv.FormatFloat(limit.Rate, 'f', -1, 64), limit.Burst, nowMs).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("resposta inesperada do script de limite: %v", res)
+	}
+	allowed, ok := res[0].(int64)
+	if !ok {
+		return false, 0, fmt.Errorf("resposta inesperada do script de limite: %v", res)
+	}
+	raw, ok := res[1].(string)
+	if !ok {
+		return false, 0, fmt.Errorf("resposta inesperada do script de limite: %v", res)
+	}
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(tokens) {
+		return false, 0, fmt.Errorf("fichas inválidas no script de limite: %q", raw)
+	}
+	return allowed == 1, tokens, nil
+}
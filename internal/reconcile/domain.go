@@ -0,0 +1,59 @@
+// Package reconcile compara, a cada ciclo do sender, os totais gravados pelos ingestores (veja usagestore.Ledger)
+// com os totais entregues e apagados pelo sender, por tenant, SKU e unidade canônica.
+package reconcile
+
+import (
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+)
+
+// Status é o resultado da conciliação de um tenant, SKU e unidade
+type Status string
+
+const (
+	// Matched indica que o total entregue é igual ao gravado, somado ao saldo dos ciclos anteriores
+	Matched Status = "matched"
+	// Missing indica que foi entregue menos do que o gravado; o saldo é carregado para os próximos ciclos
+	Missing Status = "missing"
+	// Extra indica que foi entregue mais do que o gravado; o saldo é carregado para os próximos ciclos
+	Extra Status = "extra"
+)
+
+// Entry é a conciliação de um tenant, SKU e unidade canônica em um ciclo.
+// Os valores estão na unidade canônica (veja pulse.Pulse.Normalize).
+type Entry struct {
+	TenantId   string          `json:"tenant_id"`
+	ProductSku string          `json:"product_sku"`
+	UseUnit    pulse.PulseUnit `json:"use_unit"`
+	// Pulses é a quantidade de pulsos gravados no ciclo
+	Pulses int64 `json:"pulses"`
+	// Written é o total gravado no ciclo (o maior valor, nas unidades com agregação max)
+	Written pulse.Amount `json:"written"`
+	// Delivered é o total entregue no ciclo
+	Delivered pulse.Amount `json:"delivered"`
+	// Carried é o saldo dos ciclos anteriores
+	Carried pulse.Amount `json:"carried"`
+	// Balance é o esperado menos o entregue: positivo quando falta entregar, negativo quando foi entregue a mais
+	Balance pulse.Amount `json:"balance"`
+	Status  Status       `json:"status"`
+}
+
+// Report é o resultado da conciliação de um ciclo do sender
+type Report struct {
+	Generation string    `json:"generation"`
+	At         time.Time `json:"at"`
+	// Matched, Missing e Extra são as quantidades de tenants, SKUs e unidades em cada Status
+	Matched int `json:"matched"`
+	Missing int `json:"missing"`
+	Extra   int `json:"extra"`
+	// Pulses é a quantidade de pulsos gravados no ciclo
+	Pulses int64 `json:"pulses"`
+	// Entries são as conciliações com saldo, ordenadas por tenant, SKU e unidade
+	Entries []Entry `json:"entries"`
+}
+
+// ReportList é a resposta de GET /reconciliation
+type ReportList struct {
+	Reports []Report `json:"reports"`
+}
@@ -0,0 +1,46 @@
+package reconcile
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultReportsLimit é a quantidade de relatórios retornada quando limit não é informado
+const DefaultReportsLimit = 10
+
+type ReconcileHandler interface {
+	Reports() gin.HandlerFunc
+}
+
+type reconcileHandler struct {
+	reconciler Reconciler
+}
+
+func NewReconcileHandler(reconciler Reconciler) ReconcileHandler {
+	return &reconcileHandler{reconciler: reconciler}
+}
+
+// Reports retorna os relatórios das últimas conciliações, do mais recente para o mais antigo.
+// Parâmetro de consulta: limit, a quantidade de relatórios (padrão DefaultReportsLimit).
+func (h *reconcileHandler) Reports() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := DefaultReportsLimit
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				pulse.WriteProblem(c, http.StatusBadRequest, pulse.Problem{
+					Type:   pulse.ProblemTypeInvalidQuery,
+					Title:  "Consulta inválida",
+					Detail: fmt.Sprintf("limit deve ser um inteiro maior que 0, recebido: %q", value),
+				})
+				return
+			}
+			limit = parsed
+		}
+		c.JSON(http.StatusOK, ReportList{Reports: h.reconciler.Reports(limit)})
+	}
+}
@@ -0,0 +1,47 @@
+package reconcile
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	metricsRegistered = false
+	reconciledEntries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingestor_reconcile_entries_total",
+			Help: "Total de tenants, SKUs e unidades conciliados nos ciclos de envio, por resultado",
+		},
+		[]string{"status"},
+	)
+	outstandingEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ingestor_reconcile_outstanding",
+			Help: "Tenants, SKUs e unidades com saldo na última conciliação, por resultado (missing ou extra)",
+		},
+		[]string{"status"},
+	)
+	writtenPulses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestor_reconcile_written_pulses_total",
+			Help: "Total de pulsos gravados pelos ingestores fechados pela conciliação",
+		},
+	)
+	reconcileErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestor_reconcile_errors_total",
+			Help: "Total de conciliações concluídas com erros ou não executadas",
+		},
+	)
+)
+
+func registerMetrics() {
+	if metricsRegistered {
+		return
+	}
+	metricsRegistered = true
+
+	prometheus.MustRegister(
+		reconciledEntries,
+		outstandingEntries,
+		writtenPulses,
+		reconcileErrors,
+	)
+}
@@ -0,0 +1,193 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withMaxUnits registra, durante o teste, as unidades padrão e a unidade conn com agregação max
+func withMaxUnits(t *testing.T) {
+	registry, err := pulse.NewUnitRegistry(append(pulse.DefaultUnits(),
+		pulse.UnitDefinition{Name: "conn", Dimension: "connections", Factor: 1, Aggregation: pulse.AggregationMax}))
+	require.NoError(t, err)
+	original := pulse.Units()
+	pulse.SetUnitRegistry(registry)
+	t.Cleanup(func() { pulse.SetUnitRegistry(original) })
+}
+
+func record(t *testing.T, ledger usagestore.Ledger, incs ...usagestore.Increment) {
+	for _, inc := range incs {
+		require.NoError(t, ledger.Record(context.Background(), inc))
+	}
+}
+
+func delivered(tenantId, productSku, amount string, unit pulse.PulseUnit) pulse.Pulse {
+	return pulse.Pulse{TenantId: tenantId, ProductSku: productSku, UsedAmount: pulse.MustParseAmount(amount), UseUnit: unit}
+}
+
+func TestNewReconciler(t *testing.T) {
+	assert.Panics(t, func() { NewReconciler(usagestore.NewMemoryLedger(), WithHistorySize(0)) })
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	withMaxUnits(t)
+	ctx := context.Background()
+	ledger := usagestore.NewMemoryLedger()
+	at := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	r := NewReconciler(ledger, WithClock(func() time.Time { return at }))
+	missing := testutil.ToFloat64(reconciledEntries.WithLabelValues(string(Missing)))
+
+	record(t, ledger,
+		usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku1:B:6", Units: 2e6},
+		usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku1:B:6", Units: 3e6},
+		usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku1:KB:6", Units: 1e6},
+		usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku2:conn:6", Units: 30e6, Max: true},
+		usagestore.Increment{Generation: "A", TenantId: "t2", Field: "sku1:B:6", Units: 1e6},
+	)
+	// os campos em KB são conciliados na unidade canônica, como o sender os entrega
+	require.NoError(t, r.Reconcile(ctx, "A", []pulse.Pulse{
+		delivered("t1", "sku1", "1029", pulse.B),
+		delivered("t1", "sku2", "30", "conn"),
+		delivered("t3", "sku1", "1", pulse.B),
+	}))
+
+	reports := r.Reports(10)
+	require.Len(t, reports, 1)
+	report := reports[0]
+	assert.Equal(t, "A", report.Generation)
+	assert.Equal(t, at, report.At)
+	assert.Equal(t, 2, report.Matched)
+	assert.Equal(t, 1, report.Missing)
+	assert.Equal(t, 1, report.Extra)
+	assert.Equal(t, int64(5), report.Pulses)
+	assert.Equal(t, []Entry{
+		{TenantId: "t2", ProductSku: "sku1", UseUnit: pulse.B, Pulses: 1, Written: pulse.MustParseAmount("1"), Balance: pulse.MustParseAmount("1"), Status: Missing},
+		{TenantId: "t3", ProductSku: "sku1", UseUnit: pulse.B, Delivered: pulse.MustParseAmount("1"), Balance: pulse.MustParseAmount("-1"), Status: Extra},
+	}, report.Entries)
+	assert.Equal(t, missing+1, testutil.ToFloat64(reconciledEntries.WithLabelValues(string(Missing))))
+	assert.Equal(t, float64(1), testutil.ToFloat64(outstandingEntries.WithLabelValues(string(Extra))))
+
+	// os saldos são carregados para os próximos ciclos, inclusive por outra instância com o mesmo ledger
+	r = NewReconciler(ledger)
+	require.NoError(t, r.Reconcile(ctx, "B", []pulse.Pulse{delivered("t2", "sku1", "1", pulse.B)}))
+	report = r.Reports(1)[0]
+	assert.Equal(t, 1, report.Matched)
+	assert.Equal(t, 0, report.Missing)
+	assert.Equal(t, 1, report.Extra)
+	require.Len(t, report.Entries, 1)
+	assert.Equal(t, "t3", report.Entries[0].TenantId)
+	assert.Equal(t, "-1", report.Entries[0].Carried.String())
+}
+
+func TestReconciler_MaxUnits(t *testing.T) {
+	withMaxUnits(t)
+	ctx := context.Background()
+	ledger := usagestore.NewMemoryLedger()
+	r := NewReconciler(ledger)
+
+	// o maior valor gravado é esperado enquanto nada for entregue
+	record(t, ledger,
+		usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku1:conn:6", Units: 50e6, Max: true},
+		usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku1:conn:6", Units: 20e6, Max: true},
+	)
+	require.NoError(t, r.Reconcile(ctx, "A", nil))
+	report := r.Reports(1)[0]
+	require.Len(t, report.Entries, 1)
+	assert.Equal(t, Missing, report.Entries[0].Status)
+	assert.Equal(t, "50", report.Entries[0].Balance.String())
+
+	// a entrega do maior valor compensa o saldo, que não é somado ao valor gravado no ciclo
+	record(t, ledger, usagestore.Increment{Generation: "B", TenantId: "t1", Field: "sku1:conn:6", Units: 10e6, Max: true})
+	require.NoError(t, r.Reconcile(ctx, "B", []pulse.Pulse{delivered("t1", "sku1", "50", "conn")}))
+	report = r.Reports(1)[0]
+	assert.Equal(t, 1, report.Matched)
+	assert.Empty(t, report.Entries)
+
+	// sem saldo, um valor entregue menor que o gravado fica faltante apenas no ciclo
+	record(t, ledger, usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku1:conn:6", Units: 40e6, Max: true})
+	require.NoError(t, r.Reconcile(ctx, "A", []pulse.Pulse{delivered("t1", "sku1", "30", "conn")}))
+	assert.Equal(t, 1, r.Reports(1)[0].Missing)
+	require.NoError(t, r.Reconcile(ctx, "B", nil))
+	assert.Equal(t, 0, r.Reports(1)[0].Missing)
+}
+
+func TestReconciler_Reports(t *testing.T) {
+	ctx := context.Background()
+	r := NewReconciler(usagestore.NewMemoryLedger(), WithHistorySize(2))
+	for _, gen := range []string{"A", "B", "A"} {
+		require.NoError(t, r.Reconcile(ctx, gen, nil))
+	}
+	reports := r.Reports(10)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "A", reports[0].Generation)
+	assert.Equal(t, "B", reports[1].Generation)
+	assert.Len(t, r.Reports(1), 1)
+}
+
+type failingStateLedger struct {
+	usagestore.Ledger
+}
+
+func (failingStateLedger) State(ctx context.Context) ([]byte, error) {
+	return nil, fmt.Errorf("ledger indisponível")
+}
+
+func TestReconciler_StateError(t *testing.T) {
+	ctx := context.Background()
+	ledger := usagestore.NewMemoryLedger()
+	record(t, ledger, usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku1:B:6", Units: 1})
+	r := NewReconciler(failingStateLedger{ledger})
+	errors := testutil.ToFloat64(reconcileErrors)
+
+	// sem os saldos, os totais não são fechados e continuam para a próxima conciliação
+	assert.Error(t, r.Reconcile(ctx, "A", nil))
+	assert.Equal(t, errors+1, testutil.ToFloat64(reconcileErrors))
+	assert.Empty(t, r.Reports(10))
+	entries, err := ledger.Close(ctx, "A")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestReconcileHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	ledger := usagestore.NewMemoryLedger()
+	r := NewReconciler(ledger)
+	record(t, ledger, usagestore.Increment{Generation: "A", TenantId: "t1", Field: "sku1:B:6", Units: 1500000})
+	require.NoError(t, r.Reconcile(ctx, "A", nil))
+	require.NoError(t, r.Reconcile(ctx, "B", nil))
+
+	router := gin.New()
+	router.GET("/reconciliation", NewReconcileHandler(r).Reports())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reconciliation?limit=1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var body map[string][]map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body["reports"], 1)
+	report := body["reports"][0]
+	assert.Equal(t, "B", report["generation"])
+	assert.Equal(t, float64(1), report["missing"])
+	entries := report["entries"].([]any)
+	require.Len(t, entries, 1)
+	assert.Equal(t, float64(1.5), entries[0].(map[string]any)["carried"])
+	assert.Equal(t, "missing", entries[0].(map[string]any)["status"])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reconciliation?limit=0", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "/problems/invalid-query")
+}
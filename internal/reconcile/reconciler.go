@@ -0,0 +1,334 @@
+package reconcile
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultHistorySize é a quantidade padrão de relatórios mantidos em memória para Reports
+const DefaultHistorySize = 100
+
+// Reconciler concilia os totais gravados e entregues a cada ciclo do sender (veja pulsesender.WithReconciler)
+type Reconciler interface {
+	// Reconcile fecha os totais gravados na geração enviada pelo ciclo e os compara com os agregados
+	// entregues e apagados no ciclo, somados aos saldos dos ciclos anteriores
+	Reconcile(ctx context.Context, gen string, delivered []pulse.Pulse) error
+
+	// Reports retorna até limit relatórios, do mais recente para o mais antigo
+	Reports(limit int) []Report
+}
+
+type reconciler struct {
+	ledger      usagestore.Ledger
+	historySize int
+	now         func() time.Time
+
+	mu      sync.Mutex
+	reports []Report
+}
+
+type ReconcilerOptions func(*reconciler)
+
+// WithHistorySize define a quantidade de relatórios mantidos em memória (padrão DefaultHistorySize)
+func WithHistorySize(size int) ReconcilerOptions {
+	return func(r *reconciler) {
+		r.historySize = size
+	}
+}
+
+// WithClock define o relógio utilizado no horário dos relatórios
+func WithClock(now func() time.Time) ReconcilerOptions {
+	return func(r *reconciler) {
+		r.now = now
+	}
+}
+
+// NewReconciler cria a conciliação dos totais registrados no ledger pelos ingestores (veja pulse.WithLedger).
+// Os saldos são guardados no próprio ledger (veja usagestore.Ledger.SaveState), então sobrevivem ao reinício do sender.
+func NewReconciler(ledger usagestore.Ledger, opts ...ReconcilerOptions) Reconciler {
+	registerMetrics()
+	r := &reconciler{
+		ledger:      ledger,
+		historySize: DefaultHistorySize,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.historySize <= 0 {
+		log.Error().Int("history_size", r.historySize).Msg("historySize deve ser maior que 0")
+		panic(fmt.Sprintf("historySize deve ser maior que 0, recebido: %d", r.historySize))
+	}
+	return r
+}
+
+// key identifica os totais de um tenant e SKU na unidade canônica
+type key struct {
+	TenantId   string          `json:"tenant_id"`
+	ProductSku string          `json:"product_sku"`
+	UseUnit    pulse.PulseUnit `json:"use_unit"`
+}
+
+// balance é o saldo de um tenant, SKU e unidade carregado entre os ciclos
+type balance struct {
+	key
+	Amount pulse.Amount `json:"amount"`
+}
+
+// state é o estado guardado no ledger
+type state struct {
+	Balances []balance `json:"balances"`
+}
+
+// totals são os totais de um tenant, SKU e unidade no ciclo
+type totals struct {
+	pulses       int64
+	written      pulse.Amount
+	delivered    pulse.Amount
+	hasDelivered bool
+}
+
+func (r *reconciler) Reconcile(ctx context.Context, gen string, delivered []pulse.Pulse) error {
+	// os saldos são lidos antes do fechamento, para que os totais não sejam apagados sem conciliação
+	carried, err := r.loadState(ctx)
+	if err != nil {
+		reconcileErrors.Inc()
+		return err
+	}
+	entries, closeErr := r.ledger.Close(ctx, gen)
+
+	var errs []error
+	if closeErr != nil {
+		errs = append(errs, fmt.Errorf("erro ao fechar os totais da geração %s: %w", gen, closeErr))
+	}
+	cycle := make(map[key]*totals)
+	get := func(k key) *totals {
+		t, ok := cycle[k]
+		if !ok {
+			t = &totals{}
+			cycle[k] = t
+		}
+		return t
+	}
+	for _, entry := range entries {
+		p, err := writtenPulse(entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t := get(key{p.TenantId, p.ProductSku, p.UseUnit})
+		t.pulses += entry.Pulses
+		if t.written, err = combine(p.UseUnit, t.written, p.UsedAmount); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, p := range delivered {
+		t := get(key{p.TenantId, p.ProductSku, p.UseUnit})
+		t.hasDelivered = true
+		if t.delivered, err = combine(p.UseUnit, t.delivered, p.UsedAmount); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for k := range carried {
+		get(k)
+	}
+
+	report := Report{Generation: gen, At: r.now(), Entries: []Entry{}}
+	next := state{Balances: []balance{}}
+	for k, t := range cycle {
+		entry, carry, err := settle(k, t, carried[k])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		report.Pulses += t.pulses
+		switch entry.Status {
+		case Matched:
+			report.Matched++
+		case Missing:
+			report.Missing++
+		case Extra:
+			report.Extra++
+		}
+		if entry.Status != Matched {
+			report.Entries = append(report.Entries, entry)
+		}
+		if carry.Sign() != 0 {
+			next.Balances = append(next.Balances, balance{key: k, Amount: carry})
+		}
+	}
+	slices.SortFunc(report.Entries, func(a, b Entry) int {
+		return cmp.Or(cmp.Compare(a.TenantId, b.TenantId), cmp.Compare(a.ProductSku, b.ProductSku), cmp.Compare(a.UseUnit, b.UseUnit))
+	})
+	slices.SortFunc(next.Balances, func(a, b balance) int {
+		return cmp.Or(cmp.Compare(a.TenantId, b.TenantId), cmp.Compare(a.ProductSku, b.ProductSku), cmp.Compare(a.UseUnit, b.UseUnit))
+	})
+
+	if err := r.saveState(ctx, next); err != nil {
+		errs = append(errs, err)
+	}
+	r.publish(report)
+	if err := errors.Join(errs...); err != nil {
+		reconcileErrors.Inc()
+		return err
+	}
+	return nil
+}
+
+// settle concilia os totais do ciclo com o saldo carregado e retorna o saldo para o próximo ciclo.
+// Nas unidades somadas o saldo é o esperado menos o entregue, carregado até ser compensado.
+// Nas unidades com agregação max o esperado é o maior valor gravado, carregado apenas enquanto nada for entregue.
+func settle(k key, t *totals, carried pulse.Amount) (Entry, pulse.Amount, error) {
+	entry := Entry{
+		TenantId:   k.TenantId,
+		ProductSku: k.ProductSku,
+		UseUnit:    k.UseUnit,
+		Pulses:     t.pulses,
+		Written:    t.written,
+		Delivered:  t.delivered,
+		Carried:    carried,
+	}
+	var expected pulse.Amount
+	if k.UseUnit.Aggregation() == pulse.AggregationMax {
+		expected = carried.Max(t.written)
+	} else {
+		var err error
+		if expected, err = carried.Add(t.written); err != nil {
+			return Entry{}, pulse.Amount{}, fmt.Errorf("tenant %s, SKU %s: %w", k.TenantId, k.ProductSku, err)
+		}
+	}
+	balance, err := expected.Add(pulse.AmountFromUnits(-t.delivered.Units()))
+	if err != nil {
+		return Entry{}, pulse.Amount{}, fmt.Errorf("tenant %s, SKU %s: %w", k.TenantId, k.ProductSku, err)
+	}
+	entry.Balance = balance
+	switch balance.Sign() {
+	case 0:
+		entry.Status = Matched
+	case 1:
+		entry.Status = Missing
+	default:
+		entry.Status = Extra
+	}
+
+	carry := balance
+	if k.UseUnit.Aggregation() == pulse.AggregationMax && t.hasDelivered {
+		carry = pulse.Amount{}
+	}
+	return entry, carry, nil
+}
+
+// writtenPulse converte os totais do campo gravado para a unidade canônica, como o sender faz com os campos reservados
+func writtenPulse(entry usagestore.LedgerEntry) (pulse.Pulse, error) {
+	productSku, unit, scale, ok := generation.ParseField(entry.Field)
+	if !ok || scale == generation.FloatScale {
+		return pulse.Pulse{}, fmt.Errorf("campo inválido nos totais do tenant %s: %q", entry.TenantId, entry.Field)
+	}
+	amount, err := pulse.AmountFromUnits(entry.Units).Rescale(scale, pulse.AmountScale())
+	if err != nil {
+		return pulse.Pulse{}, fmt.Errorf("campo %s do tenant %s: %w", entry.Field, entry.TenantId, err)
+	}
+	p := pulse.Pulse{TenantId: entry.TenantId, ProductSku: productSku, UsedAmount: amount, UseUnit: pulse.PulseUnit(unit)}
+	if normalized, err := p.Normalize(); err == nil {
+		p = normalized
+	}
+	return p, nil
+}
+
+// combine soma os valores, ou retorna o maior nas unidades com agregação max
+func combine(unit pulse.PulseUnit, total, amount pulse.Amount) (pulse.Amount, error) {
+	if unit.Aggregation() == pulse.AggregationMax {
+		return total.Max(amount), nil
+	}
+	return total.Add(amount)
+}
+
+func (r *reconciler) loadState(ctx context.Context) (map[key]pulse.Amount, error) {
+	raw, err := r.ledger.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+	carried := make(map[key]pulse.Amount)
+	if len(raw) == 0 {
+		return carried, nil
+	}
+	var s state
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("estado da conciliação inválido: %w", err)
+	}
+	for _, b := range s.Balances {
+		carried[b.key] = b.Amount
+	}
+	return carried, nil
+}
+
+func (r *reconciler) saveState(ctx context.Context, s state) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.ledger.SaveState(ctx, raw)
+}
+
+// publish registra o relatório nas métricas e no log e o guarda para Reports
+func (r *reconciler) publish(report Report) {
+	reconciledEntries.WithLabelValues(string(Matched)).Add(float64(report.Matched))
+	reconciledEntries.WithLabelValues(string(Missing)).Add(float64(report.Missing))
+	reconciledEntries.WithLabelValues(string(Extra)).Add(float64(report.Extra))
+	outstandingEntries.WithLabelValues(string(Missing)).Set(float64(report.Missing))
+	outstandingEntries.WithLabelValues(string(Extra)).Set(float64(report.Extra))
+	writtenPulses.Add(float64(report.Pulses))
+
+	event := log.Info()
+	if report.Missing > 0 || report.Extra > 0 {
+		event = log.Warn()
+	}
+	event.Str("generation", report.Generation).
+		Int("matched", report.Matched).
+		Int("missing", report.Missing).
+		Int("extra", report.Extra).
+		Int64("pulses", report.Pulses).
+		Msg("Conciliação do ciclo de envio")
+	for _, entry := range report.Entries {
+		log.Debug().
+			Str("generation", report.Generation).
+			Str("tenant_id", entry.TenantId).
+			Str("product_sku", entry.ProductSku).
+			Str("use_unit", string(entry.UseUnit)).
+			Str("written", entry.Written.String()).
+			Str("delivered", entry.Delivered.String()).
+			Str("carried", entry.Carried.String()).
+			Str("balance", entry.Balance.String()).
+			Str("status", string(entry.Status)).
+			Msg("Saldo na conciliação")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, report)
+	if len(r.reports) > r.historySize {
+		r.reports = slices.Delete(r.reports, 0, len(r.reports)-r.historySize)
+	}
+}
+
+func (r *reconciler) Reports(limit int) []Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limit = min(limit, len(r.reports))
+	reports := make([]Report, 0, limit)
+	for i := len(r.reports) - 1; i >= len(r.reports)-limit; i-- {
+		reports = append(reports, r.reports[i])
+	}
+	return reports
+}
@@ -0,0 +1,133 @@
+package usage
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+type UsageHandler interface {
+	Tenant() gin.HandlerFunc
+	Sku() gin.HandlerFunc
+}
+
+type usageHandler struct {
+	reader      Reader
+	tenantCheck pulse.TenantCheck
+}
+
+type HandlerOptions func(*usageHandler)
+
+// WithTenantCheck responde 403 às consultas de tenants não permitidos para a requisição
+// (ex.: tenants vinculados à chave de API utilizada)
+func WithTenantCheck(check pulse.TenantCheck) HandlerOptions {
+	return func(h *usageHandler) {
+		h.tenantCheck = check
+	}
+}
+
+func NewUsageHandler(reader Reader, opts ...HandlerOptions) UsageHandler {
+	h := &usageHandler{reader: reader}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Tenant retorna o consumo do tenant que ainda não foi entregue pelo sender
+// @OperationId UsageTenant
+// @Summary Consumo do tenant
+// @Description Consumo agregado nas gerações atual e pendente, ainda não entregue pelo sender. Os valores enviados e apagados pelo sender não aparecem.
+// @Tags Consumo
+// @Produce json
+// @Param tenant path string true "tenant_id"
+// @Param normalize query bool false "Converte e soma os valores na unidade base de cada dimensão" default(true)
+// @Success 200 {object} Report
+// @Failure 400 {object} pulse.Problem "tenant_id ou normalize inválido"
+// @Failure 401 {object} pulse.Problem "Credencial ausente, inválida ou expirada"
+// @Failure 403 {object} pulse.Problem "A credencial não permite consultar o tenant"
+// @Failure 503 {object} pulse.Problem "Redis indisponível"
+// @Security ApiKeyAuth
+// @Router /usage/{tenant} [get]
+func (h *usageHandler) Tenant() gin.HandlerFunc {
+	return h.serve
+}
+
+// Sku retorna o consumo do tenant em um SKU que ainda não foi entregue pelo sender
+// @OperationId UsageSku
+// @Summary Consumo do tenant em um SKU
+// @Description Consumo agregado do SKU nas gerações atual e pendente, ainda não entregue pelo sender.
+// @Tags Consumo
+// @Produce json
+// @Param tenant path string true "tenant_id"
+// @Param sku path string true "product_sku"
+// @Param normalize query bool false "Converte e soma os valores na unidade base de cada dimensão" default(true)
+// @Success 200 {object} Report
+// @Failure 400 {object} pulse.Problem "tenant_id, product_sku ou normalize inválido"
+// @Failure 401 {object} pulse.Problem "Credencial ausente, inválida ou expirada"
+// @Failure 403 {object} pulse.Problem "A credencial não permite consultar o tenant"
+// @Failure 503 {object} pulse.Problem "Redis indisponível"
+// @Security ApiKeyAuth
+// @Router /usage/{tenant}/{sku} [get]
+func (h *usageHandler) Sku() gin.HandlerFunc {
+	return h.serve
+}
+
+func (h *usageHandler) serve(c *gin.Context) {
+	tenantId, productSku := c.Param("tenant"), c.Param("sku")
+	if !pulse.ValidTenantId(tenantId) {
+		invalidQuery(c, fmt.Sprintf("tenant_id inválido: %q", tenantId))
+		return
+	}
+	if productSku != "" && !pulse.ValidProductSku(productSku) {
+		invalidQuery(c, fmt.Sprintf("product_sku inválido: %q", productSku))
+		return
+	}
+	normalize := true
+	if raw := c.Query("normalize"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			invalidQuery(c, fmt.Sprintf("normalize deve ser true ou false, recebido: %q", raw))
+			return
+		}
+		normalize = value
+	}
+	if h.tenantCheck != nil && !h.tenantCheck(c, tenantId) {
+		pulse.WriteProblem(c, http.StatusForbidden, pulse.Problem{
+			Type:   pulse.ProblemTypeTenantForbidden,
+			Title:  "Tenant não permitido",
+			Detail: fmt.Sprintf("a credencial utilizada não permite consultar o consumo do tenant %s", tenantId),
+			Code:   pulse.CodeTenantForbidden,
+		})
+		return
+	}
+
+	start := time.Now()
+	report, err := h.reader.Tenant(c.Request.Context(), tenantId, productSku, normalize)
+	queryDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		queryErrors.Inc()
+		log.Error().Err(err).Str("tenant_id", tenantId).Msg("Erro ao consultar o consumo do tenant")
+		c.Header("Retry-After", "1")
+		pulse.WriteProblem(c, http.StatusServiceUnavailable, pulse.Problem{
+			Type:   pulse.ProblemTypeUnavailable,
+			Title:  http.StatusText(http.StatusServiceUnavailable),
+			Detail: "não foi possível consultar o consumo; tente novamente",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func invalidQuery(c *gin.Context, detail string) {
+	pulse.WriteProblem(c, http.StatusBadRequest, pulse.Problem{
+		Type:   pulse.ProblemTypeInvalidQuery,
+		Title:  "Consulta inválida",
+		Detail: detail,
+	})
+}
@@ -0,0 +1,32 @@
+package usage
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	metricsRegistered = false
+	queryDuration     = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "usage_query_duration_seconds",
+			Help:    "Duração das consultas de consumo em /usage",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+	)
+	queryErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "usage_query_errors_total",
+			Help: "Total de consultas de consumo que falharam ao ler o Redis",
+		},
+	)
+)
+
+func registerMetrics() {
+	if metricsRegistered {
+		return
+	}
+	metricsRegistered = true
+
+	prometheus.MustRegister(
+		queryDuration,
+		queryErrors,
+	)
+}
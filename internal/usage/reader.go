@@ -0,0 +1,155 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/ThalysSilva/ingestor-consumo/internal/usagestore"
+	"github.com/rs/zerolog/log"
+)
+
+// Item é o consumo de um SKU em uma unidade que ainda não foi entregue pelo sender
+type Item struct {
+	ProductSku string          `json:"product_sku" example:"SKU-77"`
+	UseUnit    pulse.PulseUnit `json:"use_unit" swaggertype:"string" example:"B"`
+	// Current é o valor agregado na geração que está recebendo os pulsos
+	Current float64 `json:"current" example:"1024"`
+	// Pending é o valor agregado na geração que o sender está enviando ou enviará no próximo ciclo
+	Pending float64 `json:"pending" example:"512"`
+	// Total é Current mais Pending, ou o maior dos dois nas unidades com agregação max
+	Total float64 `json:"total" example:"1536"`
+}
+
+// Report é o consumo de um tenant ainda não entregue pelo sender
+type Report struct {
+	TenantId          string `json:"tenant_id" example:"tenant_xpto"`
+	CurrentGeneration string `json:"current_generation" example:"A"`
+	PendingGeneration string `json:"pending_generation" example:"B"`
+	// Normalized indica que os valores foram convertidos e somados na unidade base de cada dimensão
+	Normalized bool   `json:"normalized"`
+	Items      []Item `json:"items"`
+}
+
+// Reader consulta o consumo dos tenants nas gerações do Redis
+type Reader interface {
+	// Tenant retorna o consumo do tenant nas duas gerações, ordenado por SKU e unidade.
+	// Com productSku informado, retorna apenas os itens do SKU.
+	// Com normalize, converte os valores para a unidade base da dimensão e soma os itens do mesmo SKU e dimensão.
+	Tenant(ctx context.Context, tenantId, productSku string, normalize bool) (Report, error)
+}
+
+type storeReader struct {
+	store usagestore.UsageStore
+}
+
+// NewReader consulta o consumo lendo os agregados do tenant em cada geração e os agregados reservados pelo sender,
+// sem percorrer os agregados dos demais tenants
+func NewReader(store usagestore.UsageStore) Reader {
+	registerMetrics()
+	return &storeReader{store: store}
+}
+
+// NewRedisReader consulta o consumo lendo o hash do tenant em cada geração (veja generation.Key)
+// e os hashes reservados pelo sender (veja generation.ClaimKey),
+// sem percorrer as chaves do Redis.
+func NewRedisReader(ctx context.Context, client clients.RedisClient) Reader {
+	return NewReader(usagestore.NewRedisStore(ctx, client))
+}
+
+func (r *storeReader) Tenant(ctx context.Context, tenantId, productSku string, normalize bool) (Report, error) {
+	current, err := r.store.GetCurrentGeneration()
+	if err != nil {
+		return Report{}, fmt.Errorf("erro ao obter a geração atual: %w", err)
+	}
+	report := Report{
+		TenantId:          tenantId,
+		CurrentGeneration: current,
+		PendingGeneration: generation.Other(current),
+		Normalized:        normalize,
+		Items:             []Item{},
+	}
+
+	items := make(map[string]*Item)
+	var order []string
+	// os hashes reservados pelo sender estão sendo enviados (ou aguardam um novo envio após falhas),
+	// então são somados ao pendente nas duas gerações
+	sources := []struct {
+		gen     string
+		claimed bool
+		pending bool
+	}{
+		{report.CurrentGeneration, false, false},
+		{report.PendingGeneration, false, true},
+		{report.PendingGeneration, true, true},
+		{report.CurrentGeneration, true, true},
+	}
+	for _, source := range sources {
+		values, err := r.read(ctx, source.gen, tenantId, productSku, source.claimed)
+		if err != nil {
+			return Report{}, err
+		}
+		for _, v := range values {
+			if normalize {
+				if normalized, err := v.Normalize(); err == nil {
+					v = normalized
+				} else {
+					log.Warn().Err(err).Str("tenant_id", tenantId).Str("product_sku", v.ProductSku).Msg("Unidade não convertida para a unidade canônica")
+				}
+			}
+			id := v.ProductSku + "\x00" + string(v.UseUnit)
+			item, ok := items[id]
+			if !ok {
+				item = &Item{ProductSku: v.ProductSku, UseUnit: v.UseUnit}
+				items[id] = item
+				order = append(order, id)
+			}
+			if !source.pending {
+				item.Current = combine(v.UseUnit, item.Current, v.UsedAmount.Float64())
+			} else {
+				item.Pending = combine(v.UseUnit, item.Pending, v.UsedAmount.Float64())
+			}
+		}
+	}
+
+	slices.Sort(order)
+	for _, id := range order {
+		item := items[id]
+		item.Total = combine(item.UseUnit, item.Current, item.Pending)
+		report.Items = append(report.Items, *item)
+	}
+	return report, nil
+}
+
+// combine soma os valores, ou mantém o maior nas unidades com agregação max
+func combine(unit pulse.PulseUnit, a, b float64) float64 {
+	if unit.Aggregation() == pulse.AggregationMax {
+		return max(a, b)
+	}
+	return a + b
+}
+
+// read retorna os agregados do tenant na geração (ou os reservados, com claimed), na unidade em que foram gravados
+func (r *storeReader) read(ctx context.Context, gen, tenantId, productSku string, claimed bool) ([]pulse.Pulse, error) {
+	fields, err := r.store.Read(ctx, gen, tenantId, claimed)
+	if err != nil {
+		return nil, err
+	}
+	var found []pulse.Pulse
+	for field, raw := range fields {
+		sku, unit, scale, ok := generation.ParseField(field)
+		if !ok || (productSku != "" && sku != productSku) {
+			continue
+		}
+		amount, err := pulse.ParseFieldAmount(raw, scale)
+		if err != nil {
+			log.Warn().Str("generation", gen).Str("tenant_id", tenantId).Str("field", field).Err(err).Msg("Erro ao converter valor")
+			continue
+		}
+		found = append(found, pulse.Pulse{TenantId: tenantId, ProductSku: sku, UsedAmount: amount, UseUnit: pulse.PulseUnit(unit)})
+	}
+	return found, nil
+}
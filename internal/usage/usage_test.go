@@ -0,0 +1,199 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/pulse"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReader(t *testing.T) (*miniredis.Miniredis, Reader) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, NewRedisReader(context.Background(), client)
+}
+
+func seed(mr *miniredis.Miniredis) {
+	mr.Set("current_generation", "B")
+	mr.HSet("generation:B:{t1}", "sku1:KB:6", "2000000", "sku1:B:6", "48000000", "sku2:GB/sec:6", "1000000")
+	// campo sem escala, gravado antes dos valores em ponto fixo
+	mr.HSet("generation:A:{t1}", "sku1:B", "1000")
+	// agregado de outro tenant não deve aparecer
+	mr.HSet("generation:B:{t2}", "sku1:B", "7")
+}
+
+func TestRedisReader(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("RawUnits", func(t *testing.T) {
+		mr, reader := newTestReader(t)
+		seed(mr)
+
+		report, err := reader.Tenant(ctx, "t1", "", false)
+		require.NoError(t, err)
+		assert.Equal(t, "t1", report.TenantId)
+		assert.Equal(t, "B", report.CurrentGeneration)
+		assert.Equal(t, "A", report.PendingGeneration)
+		assert.False(t, report.Normalized)
+		assert.Equal(t, []Item{
+			{ProductSku: "sku1", UseUnit: pulse.B, Current: 48, Pending: 1000, Total: 1048},
+			{ProductSku: "sku1", UseUnit: pulse.KB, Current: 2, Total: 2},
+			{ProductSku: "sku2", UseUnit: pulse.GBxSec, Current: 1, Total: 1},
+		}, report.Items)
+	})
+
+	t.Run("Normalized", func(t *testing.T) {
+		mr, reader := newTestReader(t)
+		seed(mr)
+
+		report, err := reader.Tenant(ctx, "t1", "", true)
+		require.NoError(t, err)
+		assert.True(t, report.Normalized)
+		assert.Equal(t, []Item{
+			{ProductSku: "sku1", UseUnit: pulse.B, Current: 2*1024 + 48, Pending: 1000, Total: 2*1024 + 48 + 1000},
+			{ProductSku: "sku2", UseUnit: pulse.BxSec, Current: 1 << 30, Total: 1 << 30},
+		}, report.Items)
+	})
+
+	t.Run("ClaimedHashesArePending", func(t *testing.T) {
+		mr, reader := newTestReader(t)
+		seed(mr)
+		// hash reservado pelo sender durante o envio da geração A
+		mr.HSet("generation:A:{t1}:sending", "sku1:B:6", "24000000")
+
+		report, err := reader.Tenant(ctx, "t1", "sku1", false)
+		require.NoError(t, err)
+		assert.Equal(t, Item{ProductSku: "sku1", UseUnit: pulse.B, Current: 48, Pending: 1024, Total: 1072}, report.Items[0])
+	})
+
+	t.Run("FilterBySku", func(t *testing.T) {
+		mr, reader := newTestReader(t)
+		seed(mr)
+
+		report, err := reader.Tenant(ctx, "t1", "sku2", true)
+		require.NoError(t, err)
+		require.Len(t, report.Items, 1)
+		assert.Equal(t, "sku2", report.Items[0].ProductSku)
+	})
+
+	t.Run("UnknownTenant", func(t *testing.T) {
+		mr, reader := newTestReader(t)
+		seed(mr)
+
+		report, err := reader.Tenant(ctx, "t9", "", true)
+		require.NoError(t, err)
+		assert.NotNil(t, report.Items)
+		assert.Empty(t, report.Items)
+	})
+
+	t.Run("MaxAggregation", func(t *testing.T) {
+		registry, err := pulse.NewUnitRegistry(append(pulse.DefaultUnits(), pulse.UnitDefinition{Name: "conn", Dimension: "connections", Factor: 1, Aggregation: pulse.AggregationMax}))
+		require.NoError(t, err)
+		original := pulse.Units()
+		pulse.SetUnitRegistry(registry)
+		defer pulse.SetUnitRegistry(original)
+
+		mr, reader := newTestReader(t)
+		mr.Set("current_generation", "A")
+		mr.HSet("generation:A:{t1}", "sku1:conn", "30")
+		mr.HSet("generation:B:{t1}", "sku1:conn", "50")
+
+		report, err := reader.Tenant(ctx, "t1", "", true)
+		require.NoError(t, err)
+		assert.Equal(t, []Item{{ProductSku: "sku1", UseUnit: "conn", Current: 30, Pending: 50, Total: 50}}, report.Items)
+	})
+
+	t.Run("RedisUnavailable", func(t *testing.T) {
+		mr, reader := newTestReader(t)
+		mr.Close()
+
+		_, err := reader.Tenant(ctx, "t1", "", true)
+		assert.Error(t, err)
+	})
+}
+
+type stubReader struct {
+	report Report
+	err    error
+	calls  []string
+}
+
+func (s *stubReader) Tenant(_ context.Context, tenantId, productSku string, normalize bool) (Report, error) {
+	s.calls = append(s.calls, tenantId+"|"+productSku+"|"+strconv.FormatBool(normalize))
+	return s.report, s.err
+}
+
+func newTestRouter(reader Reader, opts ...HandlerOptions) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewUsageHandler(reader, opts...)
+	r.GET("/usage/:tenant", h.Tenant())
+	r.GET("/usage/:tenant/:sku", h.Sku())
+	return r
+}
+
+func TestUsageHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		readerErr   error
+		opts        []HandlerOptions
+		wantStatus  int
+		wantType    string
+		wantCall    string
+		wantNoCalls bool
+	}{
+		{name: "Tenant", path: "/usage/t1", wantStatus: http.StatusOK, wantCall: "t1||true"},
+		{name: "Sku", path: "/usage/t1/sku1", wantStatus: http.StatusOK, wantCall: "t1|sku1|true"},
+		{name: "RawUnits", path: "/usage/t1?normalize=false", wantStatus: http.StatusOK, wantCall: "t1||false"},
+		{name: "InvalidNormalize", path: "/usage/t1?normalize=talvez", wantStatus: http.StatusBadRequest, wantType: pulse.ProblemTypeInvalidQuery, wantNoCalls: true},
+		{name: "InvalidTenant", path: "/usage/%24t1", wantStatus: http.StatusBadRequest, wantType: pulse.ProblemTypeInvalidQuery, wantNoCalls: true},
+		{name: "InvalidSku", path: "/usage/t1/%24sku", wantStatus: http.StatusBadRequest, wantType: pulse.ProblemTypeInvalidQuery, wantNoCalls: true},
+		{
+			name:        "TenantForbidden",
+			path:        "/usage/t1",
+			opts:        []HandlerOptions{WithTenantCheck(func(c *gin.Context, tenantId string) bool { return tenantId == "t2" })},
+			wantStatus:  http.StatusForbidden,
+			wantType:    pulse.ProblemTypeTenantForbidden,
+			wantNoCalls: true,
+		},
+		{name: "ReaderError", path: "/usage/t1", readerErr: errors.New("redis fora"), wantStatus: http.StatusServiceUnavailable, wantType: pulse.ProblemTypeUnavailable, wantCall: "t1||true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &stubReader{report: Report{TenantId: "t1", Items: []Item{}}, err: tt.readerErr}
+			w := httptest.NewRecorder()
+			newTestRouter(reader, tt.opts...).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantNoCalls {
+				assert.Empty(t, reader.calls)
+			} else {
+				assert.Equal(t, []string{tt.wantCall}, reader.calls)
+			}
+			if tt.wantType == "" {
+				var report Report
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+				assert.Equal(t, "t1", report.TenantId)
+				return
+			}
+			assert.Equal(t, pulse.ProblemContentType, w.Header().Get("Content-Type"))
+			var problem pulse.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, tt.wantType, problem.Type)
+			assert.Equal(t, tt.wantStatus, problem.Status)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package usagestore
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+)
+
+// LedgerEntry são os totais gravados pelos ingestores para um campo do agregado de um tenant
+type LedgerEntry struct {
+	TenantId string
+	// Field é o campo do agregado (veja generation.Field)
+	Field string
+	// Pulses é a quantidade de pulsos gravados no campo
+	Pulses int64
+	// Units é a soma dos valores dos pulsos (ou o maior, nas unidades com agregação max) em 10^-escala da unidade
+	Units int64
+}
+
+// Ledger guarda, independentemente dos agregados, os totais gravados pelos ingestores em cada geração,
+// para que a conciliação os compare com os totais entregues pelo sender (veja o pacote reconcile).
+// Os totais não são reservados nem apagados pelo envio, apenas por Close.
+type Ledger interface {
+	// Record soma o incremento gravado no agregado aos totais da geração: um pulso e o valor (ou o maior, com Max)
+	Record(ctx context.Context, inc Increment) error
+
+	// Close retorna e apaga os totais gravados na geração. As gravações posteriores formam novos totais,
+	// retornados no próximo Close. Em caso de erro, os totais retornados já foram apagados e os demais
+	// permanecem para o próximo Close.
+	Close(ctx context.Context, gen string) ([]LedgerEntry, error)
+
+	// State retorna o estado salvo pela conciliação com SaveState (nil se não houver)
+	State(ctx context.Context) ([]byte, error)
+
+	// SaveState substitui o estado da conciliação
+	SaveState(ctx context.Context, state []byte) error
+}
+
+type memoryLedger struct {
+	mu sync.Mutex
+	// entries guarda os totais por geração e por tenant e campo
+	entries map[string]map[string]*LedgerEntry
+	state   []byte
+}
+
+// NewMemoryLedger guarda os totais em memória, para o all-in-one com o store em memória e para testes
+func NewMemoryLedger() Ledger {
+	return &memoryLedger{entries: make(map[string]map[string]*LedgerEntry)}
+}
+
+func (l *memoryLedger) Record(ctx context.Context, inc Increment) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries, ok := l.entries[inc.Generation]
+	if !ok {
+		entries = make(map[string]*LedgerEntry)
+		l.entries[inc.Generation] = entries
+	}
+	key := inc.TenantId + "\x00" + inc.Field
+	entry, ok := entries[key]
+	if !ok {
+		entries[key] = &LedgerEntry{TenantId: inc.TenantId, Field: inc.Field, Pulses: 1, Units: inc.Units}
+		return nil
+	}
+	if inc.Max {
+		entry.Units = max(entry.Units, inc.Units)
+	} else {
+		sum, err := addInt(entry.Units, inc.Units)
+		if err != nil {
+			return fmt.Errorf("campo %s do tenant %s: %w", inc.Field, inc.TenantId, err)
+		}
+		entry.Units = sum
+	}
+	entry.Pulses++
+	return nil
+}
+
+func (l *memoryLedger) Close(ctx context.Context, gen string) ([]LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := l.entries[gen]
+	delete(l.entries, gen)
+	closed := make([]LedgerEntry, 0, len(entries))
+	for _, key := range slices.Sorted(maps.Keys(entries)) {
+		closed = append(closed, *entries[key])
+	}
+	return closed, nil
+}
+
+func (l *memoryLedger) State(ctx context.Context) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.state), nil
+}
+
+func (l *memoryLedger) SaveState(ctx context.Context, state []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state = slices.Clone(state)
+	return nil
+}
+
+// ledgerPulsesSuffix é o sufixo do campo com a quantidade de pulsos no hash dos totais do Redis (veja generation.LedgerKey).
+// O SKU e a unidade do campo são codificados por keycodec, então não contêm ":".
+const ledgerPulsesSuffix = ":pulses"
+
+// parseLedgerFields converte os campos do hash dos totais em LedgerEntry, ordenados pelo campo
+func parseLedgerFields(tenantId string, values map[string]string) ([]LedgerEntry, error) {
+	entries := make(map[string]*LedgerEntry)
+	entry := func(field string) *LedgerEntry {
+		e, ok := entries[field]
+		if !ok {
+			e = &LedgerEntry{TenantId: tenantId, Field: field}
+			entries[field] = e
+		}
+		return e
+	}
+	for field, value := range values {
+		var n int64
+		if _, err := fmt.Sscan(value, &n); err != nil {
+			return nil, fmt.Errorf("valor inválido no campo %s dos totais do tenant %s: %q", field, tenantId, value)
+		}
+		if name, ok := strings.CutSuffix(field, ledgerPulsesSuffix); ok {
+			entry(name).Pulses = n
+			continue
+		}
+		if _, _, _, ok := generation.ParseField(field); !ok {
+			return nil, fmt.Errorf("campo inválido nos totais do tenant %s: %q", tenantId, field)
+		}
+		entry(field).Units = n
+	}
+	closed := make([]LedgerEntry, 0, len(entries))
+	for _, field := range slices.Sorted(maps.Keys(entries)) {
+		closed = append(closed, *entries[field])
+	}
+	return closed, nil
+}
@@ -0,0 +1,82 @@
+package usagestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/jackc/pgx/v5"
+)
+
+type postgresLedger struct {
+	client clients.PostgresClient
+}
+
+// NewPostgresLedger guarda os totais em uma linha por geração, tenant, SKU, unidade e escala
+// (veja migrations/0003_reconcile_ledger.sql). O esquema deve ser criado antes com MigratePostgres.
+func NewPostgresLedger(client clients.PostgresClient) Ledger {
+	return &postgresLedger{client: client}
+}
+
+// recordSQL soma um pulso e o valor aos totais (ou grava o maior valor, com $7)
+const recordSQL = `
+INSERT INTO reconcile_ledger AS l (generation, tenant_id, product_sku, use_unit, scale, pulses, units)
+VALUES ($1, $2, $3, $4, $5, 1, $6)
+ON CONFLICT (generation, tenant_id, product_sku, use_unit, scale) DO UPDATE
+SET pulses = l.pulses + 1,
+	units = CASE WHEN $7 THEN GREATEST(l.units, EXCLUDED.units) ELSE l.units + EXCLUDED.units END`
+
+func (l *postgresLedger) Record(ctx context.Context, inc Increment) error {
+	productSku, unit, scale, err := parseScaledField(inc.Field)
+	if err != nil {
+		return err
+	}
+	_, err = l.client.Exec(ctx, recordSQL, inc.Generation, inc.TenantId, productSku, unit, scale, inc.Units, inc.Max)
+	if err != nil {
+		return fmt.Errorf("erro ao registrar o campo %s do tenant %s nos totais: %w", inc.Field, inc.TenantId, err)
+	}
+	return nil
+}
+
+// Close apaga as linhas da geração com DELETE ... RETURNING, então uma gravação concorrente aguarda
+// a deleção e cria uma nova linha, retornada no próximo Close
+func (l *postgresLedger) Close(ctx context.Context, gen string) ([]LedgerEntry, error) {
+	rows, err := l.client.Query(ctx, `
+DELETE FROM reconcile_ledger WHERE generation = $1
+RETURNING tenant_id, product_sku, use_unit, scale, pulses, units`, gen)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao fechar os totais da geração: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (LedgerEntry, error) {
+		var entry LedgerEntry
+		var productSku, unit string
+		var scale int
+		err := row.Scan(&entry.TenantId, &productSku, &unit, &scale, &entry.Pulses, &entry.Units)
+		entry.Field = generation.Field(productSku, unit, scale)
+		return entry, err
+	})
+}
+
+func (l *postgresLedger) State(ctx context.Context) ([]byte, error) {
+	var state []byte
+	err := l.client.QueryRow(ctx, "SELECT state FROM reconcile_state").Scan(&state)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o estado da conciliação: %w", err)
+	}
+	return state, nil
+}
+
+func (l *postgresLedger) SaveState(ctx context.Context, state []byte) error {
+	_, err := l.client.Exec(ctx, `
+INSERT INTO reconcile_state (id, state) VALUES (true, $1)
+ON CONFLICT (id) DO UPDATE SET state = EXCLUDED.state`, string(state))
+	if err != nil {
+		return fmt.Errorf("erro ao gravar o estado da conciliação: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package usagestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/go-redis/redis/v8"
+)
+
+type redisLedger struct {
+	client    clients.RedisClient
+	scanCount int64
+}
+
+// NewRedisLedger guarda os totais em um hash por tenant e geração (veja generation.LedgerKey), com um campo
+// para a quantidade de pulsos e outro para o valor de cada campo do agregado, e o índice dos tenants
+// de cada geração (veja generation.LedgerIndexKey)
+func NewRedisLedger(client clients.RedisClient, scanCount int64) Ledger {
+	return &redisLedger{client: client, scanCount: scanCount}
+}
+
+func (l *redisLedger) Record(ctx context.Context, inc Increment) error {
+	key := generation.LedgerKey(inc.Generation, inc.TenantId)
+
+	var index, pulses *redis.IntCmd
+	var write redis.Cmder
+	_, _ = l.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		index = pipe.SAdd(ctx, generation.LedgerIndexKey(inc.Generation), inc.TenantId)
+		pulses = pipe.HIncrBy(ctx, key, inc.Field+ledgerPulsesSuffix, 1)
+		if inc.Max {
+			write = pipe.Eval(ctx, maxScript, []string{key}, inc.Field, strconv.FormatInt(inc.Units, 10))
+		} else {
+			write = pipe.HIncrBy(ctx, key, inc.Field, inc.Units)
+		}
+		return nil
+	})
+	return errors.Join(index.Err(), pulses.Err(), write.Err())
+}
+
+// closeTenantScript retorna e apaga o hash dos totais do tenant
+const closeTenantScript = `
+local values = redis.call('HGETALL', KEYS[1])
+redis.call('DEL', KEYS[1])
+return values
+`
+
+// Close move o índice da geração para generation.LedgerClosingKey com o claimIndexScript e fecha os totais
+// de cada tenant com o closeTenantScript. O índice em fechamento só é apagado quando todos os tenants
+// foram fechados, para que os demais sejam fechados no próximo Close.
+func (l *redisLedger) Close(ctx context.Context, gen string) ([]LedgerEntry, error) {
+	closingKey := generation.LedgerClosingKey(gen)
+	indexed, err := l.client.Eval(ctx, claimIndexScript, []string{generation.LedgerIndexKey(gen), closingKey}).Int()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao reservar o índice dos totais da geração: %v", err)
+	}
+	if indexed == 0 {
+		return nil, nil
+	}
+
+	var tenants []string
+	cursor := uint64(0)
+	for {
+		page, next, err := l.client.SScan(ctx, closingKey, cursor, "", l.scanCount).Result()
+		if err != nil {
+			return nil, fmt.Errorf("erro ao percorrer o índice dos totais da geração no Redis: %v", err)
+		}
+		tenants = append(tenants, page...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	var entries []LedgerEntry
+	var errs []error
+	seen := make(map[string]struct{})
+	for _, tenantId := range tenants {
+		// o SSCAN pode retornar o mesmo membro mais de uma vez
+		if _, ok := seen[tenantId]; ok {
+			continue
+		}
+		seen[tenantId] = struct{}{}
+		values, err := l.client.Eval(ctx, closeTenantScript, []string{generation.LedgerKey(gen, tenantId)}).StringSlice()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("erro ao fechar os totais do tenant %s: %v", tenantId, err))
+			continue
+		}
+		fields := make(map[string]string, len(values)/2)
+		for i := 0; i+1 < len(values); i += 2 {
+			fields[values[i]] = values[i+1]
+		}
+		closed, err := parseLedgerFields(tenantId, fields)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		entries = append(entries, closed...)
+	}
+	if len(errs) == 0 {
+		if err := l.client.Del(ctx, closingKey).Err(); err != nil {
+			errs = append(errs, fmt.Errorf("erro ao apagar %s: %w", closingKey, err))
+		}
+	}
+	return entries, errors.Join(errs...)
+}
+
+func (l *redisLedger) State(ctx context.Context) ([]byte, error) {
+	state, err := l.client.Get(ctx, generation.LedgerStateKey()).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler o estado da conciliação: %w", err)
+	}
+	return state, nil
+}
+
+func (l *redisLedger) SaveState(ctx context.Context, state []byte) error {
+	if err := l.client.Set(ctx, generation.LedgerStateKey(), state, 0).Err(); err != nil {
+		return fmt.Errorf("erro ao gravar o estado da conciliação: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package usagestore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisTestLedger(t *testing.T) (*miniredis.Miniredis, Ledger) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, NewRedisLedger(client, DefaultScanCount)
+}
+
+// ledgers são as implementações verificadas por TestLedger
+var ledgers = map[string]func(t *testing.T) Ledger{
+	"Redis": func(t *testing.T) Ledger {
+		_, ledger := newRedisTestLedger(t)
+		return ledger
+	},
+	"Memory": func(*testing.T) Ledger { return NewMemoryLedger() },
+	"Postgres": func(t *testing.T) Ledger {
+		pool, _ := newPostgresTestStore(t)
+		return NewPostgresLedger(pool)
+	},
+}
+
+// TestLedger verifica que as implementações têm a mesma semântica de gravação e fechamento dos totais
+func TestLedger(t *testing.T) {
+	for name, newLedger := range ledgers {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ledger := newLedger(t)
+
+			for _, inc := range []Increment{
+				{Generation: "A", TenantId: "t1", Field: "sku1:B:6", Units: 1500000},
+				{Generation: "A", TenantId: "t1", Field: "sku1:B:6", Units: 2500000},
+				{Generation: "A", TenantId: "t1", Field: "sku1:conn:6", Units: 30, Max: true},
+				{Generation: "A", TenantId: "t1", Field: "sku1:conn:6", Units: 50, Max: true},
+				{Generation: "A", TenantId: "t1", Field: "sku1:conn:6", Units: 20, Max: true},
+				{Generation: "A", TenantId: "t:2", Field: "sku%3A1:B:6", Units: 7},
+				{Generation: "B", TenantId: "t3", Field: "sku1:B:6", Units: 9},
+			} {
+				require.NoError(t, ledger.Record(ctx, inc))
+			}
+
+			entries, err := ledger.Close(ctx, "A")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []LedgerEntry{
+				{TenantId: "t1", Field: "sku1:B:6", Pulses: 2, Units: 4000000},
+				{TenantId: "t1", Field: "sku1:conn:6", Pulses: 3, Units: 50},
+				{TenantId: "t:2", Field: "sku%3A1:B:6", Pulses: 1, Units: 7},
+			}, entries)
+
+			// as gravações posteriores ao fechamento formam novos totais
+			entries, err = ledger.Close(ctx, "A")
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+			require.NoError(t, ledger.Record(ctx, Increment{Generation: "A", TenantId: "t1", Field: "sku1:B:6", Units: 3}))
+			entries, err = ledger.Close(ctx, "A")
+			require.NoError(t, err)
+			assert.Equal(t, []LedgerEntry{{TenantId: "t1", Field: "sku1:B:6", Pulses: 1, Units: 3}}, entries)
+
+			entries, err = ledger.Close(ctx, "B")
+			require.NoError(t, err)
+			assert.Equal(t, []LedgerEntry{{TenantId: "t3", Field: "sku1:B:6", Pulses: 1, Units: 9}}, entries)
+
+			state, err := ledger.State(ctx)
+			require.NoError(t, err)
+			assert.Nil(t, state)
+			require.NoError(t, ledger.SaveState(ctx, []byte(`{"balances":[]}`)))
+			require.NoError(t, ledger.SaveState(ctx, []byte(`{"balances":[1]}`)))
+			state, err = ledger.State(ctx)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"balances":[1]}`, string(state))
+		})
+	}
+}
+
+func TestRedisLedger_Close(t *testing.T) {
+	ctx := context.Background()
+	mr, ledger := newRedisTestLedger(t)
+	require.NoError(t, ledger.Record(ctx, Increment{Generation: "A", TenantId: "t1", Field: "sku1:B:6", Units: 5}))
+	require.NoError(t, ledger.Record(ctx, Increment{Generation: "A", TenantId: "t2", Field: "sku1:B:6", Units: 5}))
+
+	// um tenant com totais inválidos não impede o fechamento dos demais e continua no índice em fechamento
+	mr.HSet(generation.LedgerKey("A", "t2"), "invalid", "x")
+	entries, err := ledger.Close(ctx, "A")
+	assert.Error(t, err)
+	assert.Equal(t, []LedgerEntry{{TenantId: "t1", Field: "sku1:B:6", Pulses: 1, Units: 5}}, entries)
+	assert.False(t, mr.Exists(generation.LedgerKey("A", "t1")))
+	assert.True(t, mr.Exists(generation.LedgerClosingKey("A")))
+	assert.False(t, mr.Exists(generation.LedgerIndexKey("A")))
+
+	mr.Del(generation.LedgerKey("A", "t2"))
+	require.NoError(t, ledger.Record(ctx, Increment{Generation: "A", TenantId: "t2", Field: "sku1:B:6", Units: 1}))
+	entries, err = ledger.Close(ctx, "A")
+	require.NoError(t, err)
+	assert.Equal(t, []LedgerEntry{{TenantId: "t2", Field: "sku1:B:6", Pulses: 1, Units: 1}}, entries)
+	assert.False(t, mr.Exists(generation.LedgerClosingKey("A")))
+}
@@ -0,0 +1,289 @@
+package usagestore
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	current string
+	// hashes e indexes utilizam os nomes das chaves do Redis (veja generation.Key e generation.IndexKey),
+	// então os agregados reservados ficam em generation.ClaimKey e os tenants reservados em generation.ClaimIndexKey
+	hashes  map[string]map[string]string
+	indexes map[string]map[string]struct{}
+	// leftovers guarda, por geração, desde quando cada tenant está com agregados reservados (veja Leftovers)
+	leftovers map[string]map[string]time.Time
+}
+
+// NewMemoryStore guarda os agregados em memória, com a mesma semântica de reserva do Redis.
+// Os agregados são perdidos ao finalizar o processo e não são compartilhados entre processos, então
+// o store é indicado para desenvolvimento local, testes e execuções com o ingestor e o sender no mesmo processo.
+func NewMemoryStore() UsageStore {
+	return &memoryStore{
+		current:   "A",
+		hashes:    make(map[string]map[string]string),
+		indexes:   make(map[string]map[string]struct{}),
+		leftovers: make(map[string]map[string]time.Time),
+	}
+}
+
+func (s *memoryStore) GetCurrentGeneration() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current, nil
+}
+
+func (s *memoryStore) ToggleGeneration() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = generation.Other(s.current)
+	return s.current, nil
+}
+
+func (s *memoryStore) Increment(ctx context.Context, inc Increment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := generation.Key(inc.Generation, inc.TenantId)
+	hash := s.hash(key)
+	raw, exists := hash[inc.Field]
+	switch {
+	case !exists:
+		hash[inc.Field] = strconv.FormatInt(inc.Units, 10)
+	case inc.Max:
+		current, err := strconv.ParseFloat(raw, 64)
+		if err != nil || float64(inc.Units) > current {
+			hash[inc.Field] = strconv.FormatInt(inc.Units, 10)
+		}
+	default:
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return fmt.Errorf("valor do campo %s em %s não é um inteiro: %q", inc.Field, key, raw)
+		}
+		addUnits(hash, inc.Field, inc.Units)
+	}
+	s.index(generation.IndexKey(inc.Generation), inc.TenantId)
+	return nil
+}
+
+func (s *memoryStore) Index(ctx context.Context, gen, tenantId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index(generation.IndexKey(gen), tenantId)
+	return nil
+}
+
+func (s *memoryStore) ListGeneration(ctx context.Context, gen string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	indexKey, claimIndexKey := generation.IndexKey(gen), generation.ClaimIndexKey(gen)
+	for tenantId := range s.indexes[indexKey] {
+		s.index(claimIndexKey, tenantId)
+	}
+	delete(s.indexes, indexKey)
+
+	tenants := make([]string, 0, len(s.indexes[claimIndexKey]))
+	for tenantId := range s.indexes[claimIndexKey] {
+		tenants = append(tenants, tenantId)
+	}
+	slices.Sort(tenants)
+	return tenants, nil
+}
+
+// Claim combina os campos como o claimScript do Redis (veja mergeField)
+func (s *memoryStore) Claim(ctx context.Context, gen, tenantId string, maxUnits []string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, claimKey := generation.Key(gen, tenantId), generation.ClaimKey(gen, tenantId)
+	hash, claimed := s.hashes[key], s.hashes[claimKey]
+	switch {
+	case hash == nil && claimed == nil:
+		return nil, nil
+	case claimed == nil:
+		s.hashes[claimKey] = hash
+	case hash != nil:
+		merged := maps.Clone(claimed)
+		for field, value := range hash {
+			if err := mergeField(merged, field, value, maxUnits); err != nil {
+				return nil, fmt.Errorf("erro ao reservar o campo %s de %s: %w", field, key, err)
+			}
+		}
+		s.hashes[claimKey] = merged
+	}
+	delete(s.hashes, key)
+	return maps.Clone(s.hashes[claimKey]), nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, gen, tenantId string, fields []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claimKey := generation.ClaimKey(gen, tenantId)
+	hash := s.hashes[claimKey]
+	for _, field := range fields {
+		delete(hash, field)
+	}
+	if len(hash) == 0 {
+		delete(s.hashes, claimKey)
+	}
+	return nil
+}
+
+func (s *memoryStore) ClearIndex(ctx context.Context, gen string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.indexes, generation.ClaimIndexKey(gen))
+	return nil
+}
+
+func (s *memoryStore) Read(ctx context.Context, gen, tenantId string, claimed bool) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := generation.Key(gen, tenantId)
+	if claimed {
+		key = generation.ClaimKey(gen, tenantId)
+	}
+	// os campos são copiados para que não sejam alterados pelas gravações seguintes
+	return maps.Clone(s.hashes[key]), nil
+}
+
+// Leftovers considera os hashes reservados da geração, mesmo os de tenants fora do índice reservado
+func (s *memoryStore) Leftovers(ctx context.Context, gen string, now time.Time) ([]Leftover, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.leftovers[gen]
+	current := make(map[string]time.Time)
+	var leftovers []Leftover
+	for key, hash := range s.hashes {
+		keyGen, tenantId, ok := generation.ParseClaimKey(key)
+		if !ok || keyGen != gen || len(hash) == 0 {
+			continue
+		}
+		since, ok := previous[tenantId]
+		if !ok {
+			since = now
+		}
+		current[tenantId] = since
+		leftovers = append(leftovers, Leftover{TenantId: tenantId, Since: since, Fields: len(hash)})
+	}
+	s.leftovers[gen] = current
+	slices.SortFunc(leftovers, func(a, b Leftover) int { return strings.Compare(a.TenantId, b.TenantId) })
+	return leftovers, nil
+}
+
+func (s *memoryStore) Requeue(ctx context.Context, from, to, tenantId string, maxUnits []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claimKey, key := generation.ClaimKey(from, tenantId), generation.Key(to, tenantId)
+	claimed := s.hashes[claimKey]
+	if claimed == nil {
+		return nil
+	}
+	merged := maps.Clone(s.hashes[key])
+	if merged == nil {
+		merged = make(map[string]string)
+	}
+	for field, value := range claimed {
+		if err := mergeField(merged, field, value, maxUnits); err != nil {
+			return fmt.Errorf("erro ao mover o campo %s de %s: %w", field, claimKey, err)
+		}
+	}
+	s.hashes[key] = merged
+	delete(s.hashes, claimKey)
+	s.index(generation.IndexKey(to), tenantId)
+	return nil
+}
+
+func (s *memoryStore) hash(key string) map[string]string {
+	hash, ok := s.hashes[key]
+	if !ok {
+		hash = make(map[string]string)
+		s.hashes[key] = hash
+	}
+	return hash
+}
+
+func (s *memoryStore) index(key, tenantId string) {
+	index, ok := s.indexes[key]
+	if !ok {
+		index = make(map[string]struct{})
+		s.indexes[key] = index
+	}
+	index[tenantId] = struct{}{}
+}
+
+// mergeField combina o valor de um campo de outro agregado no hash, como o claimScript do Redis: máximo nas unidades
+// com agregação max, soma inteira nos campos com escala (veja addUnits) e soma em ponto flutuante nos demais.
+// Os valores que não são números substituem o valor do hash.
+func mergeField(hash map[string]string, field, value string, maxUnits []string) error {
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		hash[field] = value
+		return nil
+	}
+	claimed, exists := hash[field]
+	parts := strings.Split(field, ":")
+	switch {
+	case len(parts) > 1 && slices.Contains(maxUnits, parts[1]):
+		current, err := strconv.ParseFloat(claimed, 64)
+		if !exists || err != nil || amount > current {
+			hash[field] = value
+		}
+	case len(parts) > 2:
+		units, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("valor não é um inteiro: %q", value)
+		}
+		addUnits(hash, field, units)
+	case !exists:
+		hash[field] = value
+	default:
+		current, err := strconv.ParseFloat(claimed, 64)
+		if err != nil {
+			return fmt.Errorf("valor não é um número: %q", claimed)
+		}
+		hash[field] = strconv.FormatFloat(current+amount, 'f', -1, 64)
+	}
+	return nil
+}
+
+// addUnits soma units ao campo com escala do hash. Se a soma transbordar o campo, units é somado na primeira parte
+// do campo em que couber (veja generation.OverflowField), como no incrScript e no claimScript do Redis;
+// as partes com valores que não são inteiros também são ignoradas.
+func addUnits(hash map[string]string, field string, units int64) {
+	base, _ := generation.SplitOverflowField(field)
+	for n := 0; ; n++ {
+		target := field
+		if n > 0 {
+			target = generation.OverflowField(base, n)
+		}
+		raw, exists := hash[target]
+		if !exists {
+			hash[target] = strconv.FormatInt(units, 10)
+			return
+		}
+		current, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			continue
+		}
+		if sum, err := addInt(current, units); err == nil {
+			hash[target] = strconv.FormatInt(sum, 10)
+			return
+		}
+	}
+}
+
+// addInt soma os inteiros ou retorna erro se a soma transbordar
+func addInt(a, b int64) (int64, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, fmt.Errorf("incremento transborda o valor: %d + %d", a, b)
+	}
+	return a + b, nil
+}
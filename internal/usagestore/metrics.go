@@ -0,0 +1,24 @@
+package usagestore
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	metricsRegistered = false
+	fullScans         = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ingestor_sender_full_scans_total",
+			Help: "Total de ciclos que percorreram as chaves do Redis com SCAN em vez do índice da geração",
+		},
+	)
+)
+
+func registerMetrics() {
+	if metricsRegistered {
+		return
+	}
+	metricsRegistered = true
+
+	prometheus.MustRegister(
+		fullScans,
+	)
+}
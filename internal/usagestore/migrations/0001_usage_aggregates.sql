@@ -0,0 +1,27 @@
+-- Geração que recebe os pulsos; a outra é a enviada pelo sender
+CREATE TABLE usage_generation (
+	id      boolean PRIMARY KEY DEFAULT true CHECK (id),
+	current text    NOT NULL CHECK (current IN ('A', 'B'))
+);
+INSERT INTO usage_generation (id, current) VALUES (true, 'A');
+
+-- Agregados por geração, tenant, SKU e unidade, em 10^-scale da unidade.
+-- claimed separa os agregados reservados pelo sender dos que continuam recebendo incrementos.
+CREATE TABLE usage_aggregates (
+	generation  text    NOT NULL,
+	tenant_id   text    NOT NULL,
+	claimed     boolean NOT NULL,
+	product_sku text    NOT NULL,
+	use_unit    text    NOT NULL,
+	scale       integer NOT NULL,
+	units       bigint  NOT NULL,
+	PRIMARY KEY (generation, tenant_id, claimed, product_sku, use_unit, scale)
+);
+
+-- Tenants com agregados em cada geração; claimed marca os reservados para o ciclo de envio
+CREATE TABLE usage_tenants (
+	generation text    NOT NULL,
+	tenant_id  text    NOT NULL,
+	claimed    boolean NOT NULL,
+	PRIMARY KEY (generation, claimed, tenant_id)
+);
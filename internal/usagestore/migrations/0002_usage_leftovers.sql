@@ -0,0 +1,7 @@
+-- Tenants com agregados reservados que ficaram de ciclos com falhas, desde a primeira vez em que foram encontrados
+CREATE TABLE usage_leftovers (
+	generation text        NOT NULL,
+	tenant_id  text        NOT NULL,
+	since      timestamptz NOT NULL,
+	PRIMARY KEY (generation, tenant_id)
+);
@@ -0,0 +1,18 @@
+-- Totais gravados pelos ingestores por geração, tenant, SKU e unidade, comparados pela conciliação com os
+-- totais entregues pelo sender. units está em 10^-scale da unidade.
+CREATE TABLE reconcile_ledger (
+	generation  text    NOT NULL,
+	tenant_id   text    NOT NULL,
+	product_sku text    NOT NULL,
+	use_unit    text    NOT NULL,
+	scale       integer NOT NULL,
+	pulses      bigint  NOT NULL,
+	units       bigint  NOT NULL,
+	PRIMARY KEY (generation, tenant_id, product_sku, use_unit, scale)
+);
+
+-- Saldos carregados pela conciliação entre os ciclos
+CREATE TABLE reconcile_state (
+	id    boolean PRIMARY KEY DEFAULT true CHECK (id),
+	state jsonb   NOT NULL
+);
@@ -0,0 +1,5 @@
+-- Partes de um agregado: um incremento que transbordaria units é somado na primeira parte em que couber
+-- (veja generation.OverflowField). A parte 0 é o próprio campo.
+ALTER TABLE usage_aggregates ADD COLUMN part integer NOT NULL DEFAULT 0;
+ALTER TABLE usage_aggregates DROP CONSTRAINT usage_aggregates_pkey;
+ALTER TABLE usage_aggregates ADD PRIMARY KEY (generation, tenant_id, claimed, product_sku, use_unit, scale, part);
@@ -0,0 +1,413 @@
+package usagestore
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/ThalysSilva/ingestor-consumo/internal/keycodec"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLock é a chave do pg_advisory_xact_lock que impede que duas réplicas apliquem as migrações ao mesmo tempo
+const migrationLock int64 = 0x696e67657374
+
+type postgresStore struct {
+	client clients.PostgresClient
+	// ctx é utilizado na leitura e na alternância da geração, cujos métodos não recebem contexto
+	ctx context.Context
+}
+
+// NewPostgresStore guarda os agregados em uma linha por geração, tenant, SKU, unidade e escala
+// (veja migrations/0001_usage_aggregates.sql), incrementada com INSERT ... ON CONFLICT DO UPDATE.
+// A reserva move as linhas para claimed com SELECT ... FOR UPDATE SKIP LOCKED, então um incremento em andamento
+// não bloqueia o sender: a linha continua pendente, o tenant volta ao índice da geração e a linha é enviada
+// no próximo ciclo dela.
+// O esquema deve ser criado antes com MigratePostgres.
+func NewPostgresStore(ctx context.Context, client clients.PostgresClient) UsageStore {
+	return &postgresStore{client: client, ctx: ctx}
+}
+
+// MigratePostgres aplica as migrações de migrations/ ainda não registradas em usage_schema_migrations,
+// em ordem e em uma única transação, e retorna a quantidade aplicada
+func MigratePostgres(ctx context.Context, client clients.PostgresClient) (int, error) {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return 0, err
+	}
+	slices.Sort(names)
+
+	tx, err := client.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("erro ao iniciar a transação das migrações: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return 0, fmt.Errorf("erro ao obter o lock das migrações: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS usage_schema_migrations (
+	version    integer     PRIMARY KEY,
+	name       text        NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`); err != nil {
+		return 0, fmt.Errorf("erro ao criar a tabela das migrações: %w", err)
+	}
+
+	applied := 0
+	for _, name := range names {
+		base := strings.TrimPrefix(name, "migrations/")
+		version, err := strconv.Atoi(strings.SplitN(base, "_", 2)[0])
+		if err != nil {
+			return 0, fmt.Errorf("migração sem versão: %s", base)
+		}
+		var exists bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM usage_schema_migrations WHERE version = $1)", version).Scan(&exists); err != nil {
+			return 0, fmt.Errorf("erro ao consultar a migração %s: %w", base, err)
+		}
+		if exists {
+			continue
+		}
+		sql, err := migrations.ReadFile(name)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(ctx, string(sql)); err != nil {
+			return 0, fmt.Errorf("erro ao aplicar a migração %s: %w", base, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO usage_schema_migrations (version, name) VALUES ($1, $2)", version, base); err != nil {
+			return 0, fmt.Errorf("erro ao registrar a migração %s: %w", base, err)
+		}
+		log.Info().Str("migration", base).Msg("Migração do PostgreSQL aplicada")
+		applied++
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("erro ao concluir as migrações: %w", err)
+	}
+	return applied, nil
+}
+
+func (s *postgresStore) GetCurrentGeneration() (string, error) {
+	var gen string
+	if err := s.client.QueryRow(s.ctx, "SELECT current FROM usage_generation").Scan(&gen); err != nil {
+		return "", fmt.Errorf("erro ao obter a geração atual: %w", err)
+	}
+	return gen, nil
+}
+
+func (s *postgresStore) ToggleGeneration() (string, error) {
+	var gen string
+	err := s.client.QueryRow(s.ctx, "UPDATE usage_generation SET current = CASE current WHEN 'A' THEN 'B' ELSE 'A' END RETURNING current").Scan(&gen)
+	if err != nil {
+		return "", fmt.Errorf("erro ao alternar a geração: %w", err)
+	}
+	return gen, nil
+}
+
+// incrementSQL registra o tenant no índice da geração e soma o valor à parte $8 do agregado (ou grava o maior,
+// com $7) no mesmo comando, então ErrNotIndexed não ocorre
+const incrementSQL = `
+WITH indexed AS (
+	INSERT INTO usage_tenants (generation, tenant_id, claimed) VALUES ($1, $2, false)
+	ON CONFLICT DO NOTHING
+)
+INSERT INTO usage_aggregates AS a (generation, tenant_id, claimed, product_sku, use_unit, scale, part, units)
+VALUES ($1, $2, false, $3, $4, $5, $8, $6)
+ON CONFLICT (generation, tenant_id, claimed, product_sku, use_unit, scale, part) DO UPDATE
+SET units = CASE WHEN $7 THEN GREATEST(a.units, EXCLUDED.units) ELSE a.units + EXCLUDED.units END`
+
+// numericValueOutOfRange é o código do erro retornado quando a soma transborda a coluna units
+const numericValueOutOfRange = "22003"
+
+// Increment soma o valor na primeira parte do agregado em que couber (veja generation.OverflowField),
+// repetindo o comando na parte seguinte quando a soma transborda a coluna units
+func (s *postgresStore) Increment(ctx context.Context, inc Increment) error {
+	productSku, unit, scale, part, err := parseAggregateField(inc.Field)
+	if err != nil {
+		return err
+	}
+	for {
+		_, err = s.client.Exec(ctx, incrementSQL, inc.Generation, inc.TenantId, productSku, unit, scale, inc.Units, inc.Max, part)
+		var pgErr *pgconn.PgError
+		if inc.Max || !errors.As(err, &pgErr) || pgErr.Code != numericValueOutOfRange {
+			break
+		}
+		part++
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao incrementar o campo %s do tenant %s: %w", inc.Field, inc.TenantId, err)
+	}
+	return nil
+}
+
+func (s *postgresStore) Index(ctx context.Context, gen, tenantId string) error {
+	_, err := s.client.Exec(ctx, "INSERT INTO usage_tenants (generation, tenant_id, claimed) VALUES ($1, $2, false) ON CONFLICT DO NOTHING", gen, tenantId)
+	return err
+}
+
+// claimTenantsSQL move os tenants do índice da geração para o índice reservado,
+// somando-os aos que ficaram de um ciclo com falhas
+const claimTenantsSQL = `
+WITH moved AS (
+	DELETE FROM usage_tenants WHERE generation = $1 AND NOT claimed
+	RETURNING tenant_id
+)
+INSERT INTO usage_tenants (generation, tenant_id, claimed)
+SELECT $1, tenant_id, true FROM moved
+ON CONFLICT DO NOTHING`
+
+func (s *postgresStore) ListGeneration(ctx context.Context, gen string) ([]string, error) {
+	if _, err := s.client.Exec(ctx, claimTenantsSQL, gen); err != nil {
+		return nil, fmt.Errorf("erro ao reservar o índice da geração: %w", err)
+	}
+	rows, err := s.client.Query(ctx, "SELECT tenant_id FROM usage_tenants WHERE generation = $1 AND claimed ORDER BY tenant_id", gen)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar os tenants da geração: %w", err)
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// mergeSQL retorna o fim do comando que insere as linhas da CTE moved (product_sku, use_unit, scale, part, units)
+// no agregado do tenant na geração, com claimed, combinando-as com as linhas existentes: máximo nas unidades
+// de maxUnits, soma nas demais. A linha cuja soma transbordaria a coluna units é inserida em uma nova parte,
+// depois das partes existentes, como no claimScript do Redis. Os argumentos são os parâmetros do comando.
+func mergeSQL(gen, tenantId, claimed, maxUnits string) string {
+	return fmt.Sprintf(`, checked AS (
+	SELECT m.product_sku, m.use_unit, m.scale, m.part, m.units,
+		t.units IS NOT NULL AND m.use_unit <> ALL(%[4]s::text[])
+		AND t.units::numeric + m.units NOT BETWEEN -9223372036854775808 AND 9223372036854775807 AS overflows
+	FROM moved m
+	LEFT JOIN usage_aggregates t ON t.generation = %[1]s::text AND t.tenant_id = %[2]s::text AND t.claimed = %[3]s
+	AND (t.product_sku, t.use_unit, t.scale, t.part) = (m.product_sku, m.use_unit, m.scale, m.part)
+), placed AS (
+	SELECT c.product_sku, c.use_unit, c.scale, c.units, CASE WHEN NOT c.overflows THEN c.part ELSE (
+		SELECT max(p.part) FROM (
+			SELECT a.part FROM usage_aggregates a
+			WHERE a.generation = %[1]s::text AND a.tenant_id = %[2]s::text AND a.claimed = %[3]s
+			AND (a.product_sku, a.use_unit, a.scale) = (c.product_sku, c.use_unit, c.scale)
+			UNION ALL
+			SELECT m.part FROM moved m WHERE (m.product_sku, m.use_unit, m.scale) = (c.product_sku, c.use_unit, c.scale)
+		) p
+	) + row_number() OVER (PARTITION BY c.product_sku, c.use_unit, c.scale, c.overflows ORDER BY c.part) END AS part
+	FROM checked c
+)
+INSERT INTO usage_aggregates AS a (generation, tenant_id, claimed, product_sku, use_unit, scale, part, units)
+SELECT %[1]s::text, %[2]s::text, %[3]s, product_sku, use_unit, scale, part, units FROM placed
+ON CONFLICT (generation, tenant_id, claimed, product_sku, use_unit, scale, part) DO UPDATE
+SET units = CASE WHEN a.use_unit = ANY(%[4]s::text[]) THEN GREATEST(a.units, EXCLUDED.units) ELSE a.units + EXCLUDED.units END`,
+		gen, tenantId, claimed, maxUnits)
+}
+
+// claimSQL move as linhas pendentes do tenant para claimed, combinando-as com as que ficaram reservadas
+// de um ciclo com falhas (veja mergeSQL), com as unidades com agregação max em $3. As linhas bloqueadas
+// por um incremento em andamento são ignoradas (SKIP LOCKED) e continuam pendentes (veja reindexSQL).
+var claimSQL = `
+WITH moved AS (
+	DELETE FROM usage_aggregates
+	WHERE generation = $1 AND tenant_id = $2 AND NOT claimed
+	AND (product_sku, use_unit, scale, part) IN (
+		SELECT product_sku, use_unit, scale, part FROM usage_aggregates
+		WHERE generation = $1 AND tenant_id = $2 AND NOT claimed
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING product_sku, use_unit, scale, part, units
+)` + mergeSQL("$1", "$2", "true", "$3")
+
+// reindexSQL registra de novo no índice da geração o tenant que ainda tem linhas pendentes depois do claimSQL,
+// como as ignoradas por estarem bloqueadas. ListGeneration moveu o tenant para o índice reservado, apagado
+// por ClearIndex ao fim do ciclo, então sem o registro as linhas não seriam listadas no próximo ciclo da geração.
+const reindexSQL = `
+INSERT INTO usage_tenants (generation, tenant_id, claimed)
+SELECT $1::text, $2::text, false
+WHERE EXISTS (SELECT 1 FROM usage_aggregates WHERE generation = $1 AND tenant_id = $2 AND NOT claimed)
+ON CONFLICT DO NOTHING`
+
+func (s *postgresStore) Claim(ctx context.Context, gen, tenantId string, maxUnits []string) (map[string]string, error) {
+	units := unescapeUnits(maxUnits)
+
+	tx, err := s.client.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao iniciar a reserva do tenant %s: %w", tenantId, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if _, err := tx.Exec(ctx, claimSQL, gen, tenantId, units); err != nil {
+		return nil, fmt.Errorf("erro ao reservar os agregados do tenant %s: %w", tenantId, err)
+	}
+	if _, err := tx.Exec(ctx, reindexSQL, gen, tenantId); err != nil {
+		return nil, fmt.Errorf("erro ao registrar no índice os agregados pendentes do tenant %s: %w", tenantId, err)
+	}
+	fields, err := readFields(ctx, tx, gen, tenantId, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("erro ao concluir a reserva do tenant %s: %w", tenantId, err)
+	}
+	return fields, nil
+}
+
+func (s *postgresStore) Delete(ctx context.Context, gen, tenantId string, fields []string) error {
+	var skus, units []string
+	var scales, parts []int32
+	for _, field := range fields {
+		productSku, unit, scale, part, err := parseAggregateField(field)
+		if err != nil {
+			// um campo inválido não pode ter sido gravado na tabela
+			continue
+		}
+		skus = append(skus, productSku)
+		units = append(units, unit)
+		scales = append(scales, int32(scale))
+		parts = append(parts, int32(part))
+	}
+	_, err := s.client.Exec(ctx, `
+DELETE FROM usage_aggregates
+WHERE generation = $1 AND tenant_id = $2 AND claimed
+AND (product_sku, use_unit, scale, part) IN (SELECT * FROM unnest($3::text[], $4::text[], $5::integer[], $6::integer[]))`,
+		gen, tenantId, skus, units, scales, parts)
+	return err
+}
+
+func (s *postgresStore) ClearIndex(ctx context.Context, gen string) error {
+	_, err := s.client.Exec(ctx, "DELETE FROM usage_tenants WHERE generation = $1 AND claimed", gen)
+	return err
+}
+
+func (s *postgresStore) Read(ctx context.Context, gen, tenantId string, claimed bool) (map[string]string, error) {
+	return readFields(ctx, s.client, gen, tenantId, claimed)
+}
+
+// leftoversSQL registra em usage_leftovers os tenants com linhas reservadas na geração, mantendo o horário
+// dos já registrados, e remove os que não têm mais linhas reservadas. O SELECT final não enxerga as linhas
+// inseridas no mesmo comando, que são obtidas do RETURNING.
+const leftoversSQL = `
+WITH reserved AS (
+	SELECT tenant_id, count(*) AS fields FROM usage_aggregates
+	WHERE generation = $1 AND claimed
+	GROUP BY tenant_id
+), removed AS (
+	DELETE FROM usage_leftovers
+	WHERE generation = $1 AND tenant_id NOT IN (SELECT tenant_id FROM reserved)
+), inserted AS (
+	INSERT INTO usage_leftovers (generation, tenant_id, since)
+	SELECT $1, tenant_id, $2::timestamptz FROM reserved
+	ON CONFLICT DO NOTHING
+	RETURNING tenant_id, since
+)
+SELECT c.tenant_id, COALESCE(i.since, l.since), c.fields
+FROM reserved c
+LEFT JOIN inserted i ON i.tenant_id = c.tenant_id
+LEFT JOIN usage_leftovers l ON l.generation = $1 AND l.tenant_id = c.tenant_id
+ORDER BY c.tenant_id`
+
+func (s *postgresStore) Leftovers(ctx context.Context, gen string, now time.Time) ([]Leftover, error) {
+	rows, err := s.client.Query(ctx, leftoversSQL, gen, now)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao registrar os agregados reservados da geração: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Leftover, error) {
+		var leftover Leftover
+		err := row.Scan(&leftover.TenantId, &leftover.Since, &leftover.Fields)
+		return leftover, err
+	})
+}
+
+// requeueSQL move as linhas reservadas do tenant em $1 para as linhas pendentes em $2, combinando-as como claimSQL,
+// e registra o tenant no índice de $2
+var requeueSQL = `
+WITH moved AS (
+	DELETE FROM usage_aggregates
+	WHERE generation = $1 AND tenant_id = $3 AND claimed
+	RETURNING product_sku, use_unit, scale, part, units
+), indexed AS (
+	INSERT INTO usage_tenants (generation, tenant_id, claimed)
+	SELECT $2::text, $3, false WHERE EXISTS (SELECT 1 FROM moved)
+	ON CONFLICT DO NOTHING
+)` + mergeSQL("$2", "$3", "false", "$4")
+
+func (s *postgresStore) Requeue(ctx context.Context, from, to, tenantId string, maxUnits []string) error {
+	if _, err := s.client.Exec(ctx, requeueSQL, from, to, tenantId, unescapeUnits(maxUnits)); err != nil {
+		return fmt.Errorf("erro ao mover os agregados reservados do tenant %s: %w", tenantId, err)
+	}
+	return nil
+}
+
+// unescapeUnits decodifica as unidades recebidas como nos campos, pois a coluna use_unit guarda a unidade decodificada
+func unescapeUnits(maxUnits []string) []string {
+	units := make([]string, 0, len(maxUnits))
+	for _, unit := range maxUnits {
+		if decoded, err := keycodec.Unescape(unit); err == nil {
+			unit = decoded
+		}
+		units = append(units, unit)
+	}
+	return units
+}
+
+// querier é implementado pelo pool e pelas transações
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// readFields retorna os agregados do tenant no formato dos campos do hash do Redis
+// (veja generation.Field e generation.OverflowField)
+func readFields(ctx context.Context, q querier, gen, tenantId string, claimed bool) (map[string]string, error) {
+	rows, err := q.Query(ctx, `
+SELECT product_sku, use_unit, scale, part, units FROM usage_aggregates
+WHERE generation = $1 AND tenant_id = $2 AND claimed = $3`, gen, tenantId, claimed)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler os agregados do tenant %s: %w", tenantId, err)
+	}
+	defer rows.Close()
+
+	var fields map[string]string
+	for rows.Next() {
+		var productSku, unit string
+		var scale, part int
+		var units int64
+		if err := rows.Scan(&productSku, &unit, &scale, &part, &units); err != nil {
+			return nil, fmt.Errorf("erro ao ler os agregados do tenant %s: %w", tenantId, err)
+		}
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		field := generation.Field(productSku, unit, scale)
+		if part > 0 {
+			field = generation.OverflowField(field, part)
+		}
+		fields[field] = strconv.FormatInt(units, 10)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao ler os agregados do tenant %s: %w", tenantId, err)
+	}
+	return fields, nil
+}
+
+// parseScaledField separa o SKU, a unidade e a escala do campo. Os campos sem escala (veja generation.FloatField)
+// não são aceitos, pois os valores são guardados como inteiros.
+func parseScaledField(field string) (productSku, unit string, scale int, err error) {
+	productSku, unit, scale, ok := generation.ParseField(field)
+	if !ok || scale == generation.FloatScale {
+		return "", "", 0, errors.New("campo sem escala ou inválido: " + field)
+	}
+	return productSku, unit, scale, nil
+}
+
+// parseAggregateField separa do campo a parte do agregado (veja generation.OverflowField), guardada na coluna part
+func parseAggregateField(field string) (productSku, unit string, scale, part int, err error) {
+	base, part := generation.SplitOverflowField(field)
+	productSku, unit, scale, err = parseScaledField(base)
+	return productSku, unit, scale, part, err
+}
@@ -0,0 +1,470 @@
+package usagestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/clients"
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultScanCount é o valor padrão do COUNT utilizado no SCAN e no SSCAN do Redis
+const DefaultScanCount int64 = 100
+
+type redisStore struct {
+	generation.ManagerGeneration
+	client    clients.RedisClient
+	scanCount int64
+	// fullScan percorre as chaves com SCAN em vez do índice da geração (veja WithFullScan)
+	fullScan bool
+	// keyTTL é a expiração renovada a cada gravação (veja WithKeyTTL)
+	keyTTL time.Duration
+}
+
+type RedisOptions func(*redisStore)
+
+// WithScanCount define o COUNT utilizado em cada iteração do SCAN e do SSCAN no Redis
+func WithScanCount(scanCount int64) RedisOptions {
+	return func(s *redisStore) {
+		s.scanCount = scanCount
+	}
+}
+
+// WithFullScan faz ListGeneration percorrer as chaves do Redis com SCAN em vez do índice da geração.
+// Deve ser utilizado enquanto houver ingestores que não gravam o índice (veja generation.IndexKey).
+func WithFullScan() RedisOptions {
+	return func(s *redisStore) {
+		s.fullScan = true
+	}
+}
+
+// WithKeyTTL renova a expiração do hash do tenant e do índice da geração a cada Increment e Index, para que
+// os agregados que não são enviados, como os de um sender parado, não fiquem no Redis indefinidamente.
+// A reserva renomeia o hash e mantém a expiração, então os agregados reservados que não forem entregues
+// também expiram. Deve ser bem maior que o intervalo do sender, pois os agregados expirados não são enviados.
+func WithKeyTTL(ttl time.Duration) RedisOptions {
+	return func(s *redisStore) {
+		s.keyTTL = ttl
+	}
+}
+
+// NewRedisStore guarda os agregados em um hash por tenant e geração (veja generation.Key), com o índice
+// dos tenants de cada geração (veja generation.IndexKey). A reserva do sender renomeia os hashes e o índice
+// (veja generation.ClaimKey e generation.ClaimIndexKey) com scripts Lua, de forma atômica.
+func NewRedisStore(ctx context.Context, client clients.RedisClient, opts ...RedisOptions) UsageStore {
+	registerMetrics()
+	s := &redisStore{
+		ManagerGeneration: generation.NewManagerGeneration(client, ctx),
+		client:            client,
+		scanCount:         DefaultScanCount,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// maxScript grava ARGV[2] no campo ARGV[1] do hash KEYS[1] somente se for maior que o valor atual,
+// utilizado nas unidades com agregação max
+const maxScript = `
+local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]))
+if current == nil or tonumber(ARGV[2]) > current then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+return redis.call('HGET', KEYS[1], ARGV[1])
+`
+
+// fitsScript define a função fits, que indica se a soma dos inteiros a e b, em texto, cabe em 64 bits com sinal.
+// Os números do Lua são doubles, então os valores são separados em dígitos altos e nos 9 dígitos baixos,
+// que são somados sem perda de precisão. O HINCRBY do Redis também rejeita a soma que transborda, mas o erro
+// não deixaria o script escolher outro campo.
+const fitsScript = `
+local function split(value)
+	local negative = string.sub(value, 1, 1) == '-'
+	if negative then
+		value = string.sub(value, 2)
+	end
+	return negative, tonumber(string.sub(value, 1, -10)) or 0, tonumber(string.sub(value, -9))
+end
+local function fits(a, b)
+	local negativeA, highA, lowA = split(a)
+	local negativeB, highB, lowB = split(b)
+	if negativeA ~= negativeB then
+		return true
+	end
+	local high, low = highA + highB, lowA + lowB
+	if low >= 1e9 then
+		high, low = high + 1, low - 1e9
+	end
+	local limit = 854775807
+	if negativeA then
+		limit = 854775808
+	end
+	return high < 9223372036 or (high == 9223372036 and low <= limit)
+end
+`
+
+// incrScript soma ARGV[2] ao campo ARGV[1] do hash KEYS[1] com HINCRBY. Se a soma transbordar o campo, o valor
+// é somado na primeira parte do campo em que couber (veja generation.OverflowField), em vez de ser rejeitado,
+// pois o pulso já foi aceito pelo ingestor. Retorna o campo gravado.
+const incrScript = fitsScript + `
+local field, n = ARGV[1], 0
+while true do
+	local current = redis.call('HGET', KEYS[1], field)
+	if not current or not string.match(current, '^%-?%d+$') or fits(current, ARGV[2]) then
+		redis.call('HINCRBY', KEYS[1], field, ARGV[2])
+		return field
+	end
+	n = n + 1
+	field = ARGV[1] .. ':' .. n
+end
+`
+
+func (s *redisStore) Increment(ctx context.Context, inc Increment) error {
+	key := generation.Key(inc.Generation, inc.TenantId)
+
+	var index *redis.IntCmd
+	var write redis.Cmder
+	_, _ = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		index = pipe.SAdd(ctx, generation.IndexKey(inc.Generation), inc.TenantId)
+		if inc.Max {
+			write = pipe.Eval(ctx, maxScript, []string{key}, inc.Field, strconv.FormatInt(inc.Units, 10))
+		} else {
+			write = pipe.Eval(ctx, incrScript, []string{key}, inc.Field, strconv.FormatInt(inc.Units, 10))
+		}
+		if s.keyTTL > 0 {
+			pipe.Expire(ctx, key, s.keyTTL)
+			pipe.Expire(ctx, generation.IndexKey(inc.Generation), s.keyTTL)
+		}
+		return nil
+	})
+	if err := write.Err(); err != nil {
+		return err
+	}
+	if err := index.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotIndexed, err)
+	}
+	return nil
+}
+
+func (s *redisStore) Index(ctx context.Context, gen, tenantId string) error {
+	if s.keyTTL <= 0 {
+		return s.client.SAdd(ctx, generation.IndexKey(gen), tenantId).Err()
+	}
+	var index *redis.IntCmd
+	_, _ = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		index = pipe.SAdd(ctx, generation.IndexKey(gen), tenantId)
+		pipe.Expire(ctx, generation.IndexKey(gen), s.keyTTL)
+		return nil
+	})
+	return index.Err()
+}
+
+// claimIndexScript move os tenants do índice da geração (KEYS[1]) para o índice reservado (KEYS[2]),
+// somando-os aos que ficaram de um ciclo com falhas. Retorna 1 se o índice reservado existir.
+const claimIndexScript = `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('SUNIONSTORE', KEYS[2], KEYS[2], KEYS[1])
+	redis.call('DEL', KEYS[1])
+end
+return redis.call('EXISTS', KEYS[2])
+`
+
+// claimIndex reserva o índice da geração para o ciclo (veja generation.ClaimIndexKey).
+// Os tenants gravados por ingestores atrasados depois da reserva voltam a formar o índice da geração
+// e são enviados no próximo ciclo dela.
+func (s *redisStore) claimIndex(ctx context.Context, gen string) (bool, error) {
+	indexed, err := s.client.Eval(ctx, claimIndexScript, []string{generation.IndexKey(gen), generation.ClaimIndexKey(gen)}).Int()
+	if err != nil {
+		return false, fmt.Errorf("erro ao reservar o índice da geração: %v", err)
+	}
+	return indexed == 1, nil
+}
+
+// ListGeneration percorre o índice reservado com SSCAN; quando ele não existe, como nos dados gravados
+// antes do índice, ou com WithFullScan, percorre os hashes e os hashes reservados com SCAN.
+// Os tenants são reservados depois de listados, para que a reserva não altere as chaves percorridas pelo SCAN.
+func (s *redisStore) ListGeneration(ctx context.Context, gen string) ([]string, error) {
+	// no Redis Cluster o SCAN percorre cada master, e uma chave pode ser retornada mais de uma vez;
+	// o mesmo tenant também pode ter o hash e o hash reservado
+	seen := make(map[string]struct{})
+	var tenants []string
+	visit := func(tenantId string) {
+		if _, ok := seen[tenantId]; ok {
+			return
+		}
+		seen[tenantId] = struct{}{}
+		tenants = append(tenants, tenantId)
+	}
+
+	if !s.fullScan {
+		indexed, err := s.claimIndex(ctx, gen)
+		if err != nil {
+			return nil, err
+		}
+		if indexed {
+			err := s.scanIndex(ctx, gen, visit)
+			return tenants, err
+		}
+		log.Info().Str("generation", gen).Msg("Índice da geração não encontrado, percorrendo as chaves com SCAN")
+	}
+
+	fullScans.Inc()
+	for _, pattern := range []struct {
+		match string
+		parse func(key string) (string, string, bool)
+	}{
+		{generation.Pattern(gen), generation.ParseKey},
+		{generation.ClaimPattern(gen), generation.ParseClaimKey},
+	} {
+		err := clients.ScanKeys(ctx, s.client, pattern.match, s.scanCount, func(keys []string) error {
+			for _, key := range keys {
+				_, tenantId, ok := pattern.parse(key)
+				if !ok {
+					log.Warn().Str("key", key).Msg("Chave inválida")
+					continue
+				}
+				visit(tenantId)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("erro ao escanear chaves no Redis: %v", err)
+		}
+	}
+	return tenants, nil
+}
+
+// scanIndex percorre com SSCAN os tenants do índice reservado da geração
+func (s *redisStore) scanIndex(ctx context.Context, gen string, visit func(tenantId string)) error {
+	cursor := uint64(0)
+	for {
+		tenants, next, err := s.client.SScan(ctx, generation.ClaimIndexKey(gen), cursor, "", s.scanCount).Result()
+		if err != nil {
+			return fmt.Errorf("erro ao percorrer o índice da geração no Redis: %v", err)
+		}
+		for _, tenantId := range tenants {
+			visit(tenantId)
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// claimScript reserva o hash do tenant (KEYS[1]) no hash reservado (KEYS[2]) de forma atômica.
+// Sem hash reservado, o hash é renomeado; com um hash reservado de um ciclo com falhas, os campos são
+// combinados nele (máximo para as unidades em ARGV, soma para as demais) e o hash é apagado. Os campos com escala
+// (veja generation.Field) são somados com HINCRBY, sem perda de precisão, e a soma que transbordaria o campo
+// é gravada na primeira parte do campo em que couber (veja generation.OverflowField), como no incrScript;
+// os campos sem escala são somados com HINCRBYFLOAT. Os valores do hash são verificados antes da primeira
+// gravação, então um erro não altera nenhum dos hashes.
+// Retorna 1 se houver agregados reservados para o envio.
+const claimScript = fitsScript + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return redis.call('EXISTS', KEYS[2])
+end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	redis.call('RENAME', KEYS[1], KEYS[2])
+	return 1
+end
+local maxUnits = {}
+for _, unit in ipairs(ARGV) do
+	maxUnits[unit] = true
+end
+local function kind(field)
+	local unit = string.match(field, '^[^:]*:([^:]*)')
+	if unit and maxUnits[unit] then
+		return 'max'
+	elseif string.match(field, '^[^:]*:[^:]*:') then
+		return 'int'
+	end
+	return 'float'
+end
+local values = redis.call('HGETALL', KEYS[1])
+for i = 1, #values, 2 do
+	local field, value = values[i], values[i + 1]
+	if tonumber(value) and kind(field) == 'int' and not string.match(value, '^%-?%d+$') then
+		return redis.error_reply('valor do campo ' .. field .. ' em ' .. KEYS[1] .. ' não é um inteiro: ' .. value)
+	end
+end
+for i = 1, #values, 2 do
+	local field, value = values[i], values[i + 1]
+	local amount = tonumber(value)
+	local fieldKind = kind(field)
+	if not amount then
+		redis.call('HSET', KEYS[2], field, value)
+	elseif fieldKind == 'max' then
+		local current = tonumber(redis.call('HGET', KEYS[2], field))
+		if not current or amount > current then
+			redis.call('HSET', KEYS[2], field, value)
+		end
+	elseif fieldKind == 'int' then
+		-- as partes com valores que não são inteiros também são ignoradas, para que o HINCRBY não falhe
+		local base = string.match(field, '^[^:]*:[^:]*:[^:]*')
+		local target, n = field, 0
+		while true do
+			local current = redis.call('HGET', KEYS[2], target)
+			if not current or (string.match(current, '^%-?%d+$') and fits(current, value)) then
+				break
+			end
+			n = n + 1
+			target = base .. ':' .. n
+		end
+		redis.call('HINCRBY', KEYS[2], target, value)
+	else
+		redis.call('HINCRBYFLOAT', KEYS[2], field, value)
+	end
+end
+redis.call('DEL', KEYS[1])
+return 1
+`
+
+// Claim move o hash do tenant para o hash reservado (veja generation.ClaimKey) e retorna os campos reservados.
+// Os pulsos gravados depois da reserva criam um novo hash e são enviados no próximo ciclo da geração,
+// em vez de serem apagados sem envio.
+func (s *redisStore) Claim(ctx context.Context, gen, tenantId string, maxUnits []string) (map[string]string, error) {
+	claimKey := generation.ClaimKey(gen, tenantId)
+	var args []interface{}
+	for _, unit := range maxUnits {
+		args = append(args, unit)
+	}
+	claimed, err := s.client.Eval(ctx, claimScript, []string{generation.Key(gen, tenantId), claimKey}, args...).Int()
+	if err != nil || claimed == 0 {
+		return nil, err
+	}
+	fields, err := s.client.HGetAll(ctx, claimKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao obter o hash reservado %s: %w", claimKey, err)
+	}
+	return fields, nil
+}
+
+func (s *redisStore) Delete(ctx context.Context, gen, tenantId string, fields []string) error {
+	return s.client.HDel(ctx, generation.ClaimKey(gen, tenantId), fields...).Err()
+}
+
+// ClearIndex apaga o índice reservado. Com WithFullScan o índice da geração também é apagado, pois não é reservado.
+func (s *redisStore) ClearIndex(ctx context.Context, gen string) error {
+	keys := []string{generation.ClaimIndexKey(gen)}
+	if s.fullScan {
+		keys = append(keys, generation.IndexKey(gen))
+	}
+	var errs []error
+	for _, key := range keys {
+		if err := s.client.Del(ctx, key).Err(); err != nil {
+			errs = append(errs, fmt.Errorf("erro ao apagar %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *redisStore) Read(ctx context.Context, gen, tenantId string, claimed bool) (map[string]string, error) {
+	key := generation.Key(gen, tenantId)
+	if claimed {
+		key = generation.ClaimKey(gen, tenantId)
+	}
+	fields, err := s.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler os agregados do tenant em %s: %w", key, err)
+	}
+	return fields, nil
+}
+
+// leftoversScript registra no ZSET KEYS[1] os tenants em ARGV[2..] com o horário ARGV[1], mantendo o horário
+// dos já registrados, e remove os que não estão mais em ARGV. Retorna os tenants com os horários.
+const leftoversScript = `
+local keep = {}
+for i = 2, #ARGV do
+	keep[ARGV[i]] = true
+	redis.call('ZADD', KEYS[1], 'NX', ARGV[1], ARGV[i])
+end
+for _, tenant in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+	if not keep[tenant] then
+		redis.call('ZREM', KEYS[1], tenant)
+	end
+end
+return redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+`
+
+// Leftovers percorre o índice reservado (e, com WithFullScan, os hashes reservados com SCAN) e registra os tenants
+// com hash reservado em generation.LeftoversKey
+func (s *redisStore) Leftovers(ctx context.Context, gen string, now time.Time) ([]Leftover, error) {
+	seen := make(map[string]struct{})
+	var candidates []string
+	visit := func(tenantId string) {
+		if _, ok := seen[tenantId]; ok {
+			return
+		}
+		seen[tenantId] = struct{}{}
+		candidates = append(candidates, tenantId)
+	}
+	if err := s.scanIndex(ctx, gen, visit); err != nil {
+		return nil, err
+	}
+	if s.fullScan {
+		err := clients.ScanKeys(ctx, s.client, generation.ClaimPattern(gen), s.scanCount, func(keys []string) error {
+			for _, key := range keys {
+				if _, tenantId, ok := generation.ParseClaimKey(key); ok {
+					visit(tenantId)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("erro ao escanear chaves no Redis: %v", err)
+		}
+	}
+
+	fields := make(map[string]int)
+	args := []interface{}{now.Unix()}
+	for _, tenantId := range candidates {
+		claimed, err := s.Read(ctx, gen, tenantId, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(claimed) == 0 {
+			continue
+		}
+		fields[tenantId] = len(claimed)
+		args = append(args, tenantId)
+	}
+
+	values, err := s.client.Eval(ctx, leftoversScript, []string{generation.LeftoversKey(gen)}, args...).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("erro ao registrar os agregados reservados da geração: %v", err)
+	}
+	var leftovers []Leftover
+	for i := 0; i+1 < len(values); i += 2 {
+		// o score é um double no Redis e pode ser retornado em notação científica
+		since, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("horário inválido do tenant %s em %s: %q", values[i], generation.LeftoversKey(gen), values[i+1])
+		}
+		leftovers = append(leftovers, Leftover{TenantId: values[i], Since: time.Unix(int64(since), 0), Fields: fields[values[i]]})
+	}
+	return leftovers, nil
+}
+
+// Requeue move o hash reservado para o hash do tenant em to com o claimScript, que combina os campos
+// no hash de destino quando ele já existe
+func (s *redisStore) Requeue(ctx context.Context, from, to, tenantId string, maxUnits []string) error {
+	var args []interface{}
+	for _, unit := range maxUnits {
+		args = append(args, unit)
+	}
+	keys := []string{generation.ClaimKey(from, tenantId), generation.Key(to, tenantId)}
+	if err := s.client.Eval(ctx, claimScript, keys, args...).Err(); err != nil {
+		return fmt.Errorf("erro ao mover os agregados reservados do tenant %s: %v", tenantId, err)
+	}
+	if err := s.Index(ctx, to, tenantId); err != nil {
+		return fmt.Errorf("%w: %v", ErrNotIndexed, err)
+	}
+	return nil
+}
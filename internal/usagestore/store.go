@@ -0,0 +1,76 @@
+package usagestore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ThalysSilva/ingestor-consumo/internal/generation"
+)
+
+// ErrNotIndexed indica que o valor foi gravado, mas o tenant não foi registrado no índice da geração.
+// A gravação não deve ser repetida, para que o valor não seja somado duas vezes; apenas Index.
+var ErrNotIndexed = errors.New("tenant não registrado no índice da geração")
+
+// Increment é a gravação de um pulso no agregado de um tenant
+type Increment struct {
+	Generation string
+	TenantId   string
+	// Field é o campo do agregado, com SKU, unidade e escala (veja generation.Field)
+	Field string
+	// Units é o valor do pulso em 10^-escala da unidade
+	Units int64
+	// Max grava o valor somente se for maior que o atual, nas unidades com agregação max
+	Max bool
+}
+
+// Leftover é um tenant com agregados reservados que ficaram de ciclos de envio com falhas
+type Leftover struct {
+	TenantId string
+	// Since é quando o tenant foi encontrado com agregados reservados pela primeira vez por Leftovers
+	Since time.Time
+	// Fields é a quantidade de campos reservados
+	Fields int
+}
+
+// UsageStore guarda os agregados de consumo dos tenants em duas gerações: o ingestor incrementa a geração atual
+// enquanto o sender reserva, envia e apaga os agregados da outra.
+// Os campos e valores seguem o formato dos hashes no Redis (veja generation.Field e generation.ParseField).
+type UsageStore interface {
+	generation.ManagerGeneration
+
+	// Increment soma o valor ao campo do agregado do tenant (ou grava o maior, com Max) e registra o tenant
+	// no índice da geração. A soma que transbordaria o campo é gravada em uma parte dele (veja generation.OverflowField).
+	// Retorna um erro com ErrNotIndexed se apenas o registro no índice falhar.
+	Increment(ctx context.Context, inc Increment) error
+
+	// Index registra o tenant no índice da geração
+	Index(ctx context.Context, gen, tenantId string) error
+
+	// ListGeneration reserva o índice da geração para o ciclo de envio e retorna os tenants com agregados nela,
+	// incluindo os que ficaram reservados de um ciclo com falhas
+	ListGeneration(ctx context.Context, gen string) ([]string, error)
+
+	// Claim reserva os agregados do tenant na geração, combinando-os com os que ficaram reservados
+	// de um ciclo com falhas, e retorna os campos reservados. maxUnits são as unidades com agregação max,
+	// codificadas como nos campos. Os incrementos posteriores à reserva formam um novo agregado do tenant.
+	Claim(ctx context.Context, gen, tenantId string, maxUnits []string) (map[string]string, error)
+
+	// Delete apaga os campos enviados dos agregados reservados do tenant
+	Delete(ctx context.Context, gen, tenantId string, fields []string) error
+
+	// ClearIndex apaga o índice reservado após um ciclo concluído sem falhas
+	ClearIndex(ctx context.Context, gen string) error
+
+	// Read retorna os campos do agregado do tenant na geração sem alterá-lo; com claimed, os campos reservados
+	Read(ctx context.Context, gen, tenantId string, claimed bool) (map[string]string, error)
+
+	// Leftovers retorna os tenants com agregados reservados na geração fora de um ciclo de envio, ou seja,
+	// os que ficaram de ciclos com falhas, e desde quando cada um está reservado. O horário (now) é registrado
+	// na primeira chamada em que o tenant aparece e descartado quando ele deixa de ter agregados reservados.
+	Leftovers(ctx context.Context, gen string, now time.Time) ([]Leftover, error)
+
+	// Requeue move os agregados reservados do tenant em from para o agregado do tenant em to, combinando-os
+	// como em Claim, e registra o tenant no índice de to, para que sejam enviados no próximo ciclo dela
+	Requeue(ctx context.Context, from, to, tenantId string, maxUnits []string) error
+}